@@ -0,0 +1,166 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// AccessCheck is the result of a check of CheckAccess
+type AccessCheck struct {
+	Name string
+	// Detail is the information of the check, e.g. the caller identity or the default encryption
+	Detail string
+	// Err is why the check fails, it's nil if it passes
+	Err error
+	// Optional is true if the failure doesn't fail the archives, e.g. the caller identity of the s3 compatible services
+	Optional bool
+}
+
+// CheckAccess checks the credentials, the bucket and the permissions which the archives need under the prefix,
+// i.e. list, put, get, the multipart upload and its abort, so the missing ones are found before a long backup
+// fails at the upload, a small probe object is written under the prefix and removed
+func (s S3) CheckAccess(ctx context.Context, prefix string) []AccessCheck {
+	var checks []AccessCheck
+	check := func(name string, optional bool, fn func() (string, error)) bool {
+		detail, err := fn()
+		checks = append(checks, AccessCheck{Name: name, Detail: detail, Err: err, Optional: optional})
+		return err == nil
+	}
+
+	options := s.s3Client.Options()
+	ok := check("credentials", false, func() (string, error) {
+		if options.Credentials == nil {
+			return "", fmt.Errorf("no credentials are configured")
+		}
+		creds, err := options.Credentials.Retrieve(ctx)
+		if err != nil {
+			if IsSSOSessionError(err) {
+				err = &SSOSessionError{Profile: ssoProfile(), Err: err}
+			}
+			return "", err
+		}
+		detail := "source " + creds.Source
+		if creds.CanExpire {
+			detail += ", expires in " + time.Until(creds.Expires).Round(time.Second).String()
+		}
+		return detail, nil
+	})
+	if !ok {
+		return checks
+	}
+
+	// the assumed roles, e.g. the chained roles and the web identity of IRSA, are in the arn,
+	// the s3 compatible services may serve sts at the same endpoint
+	check("identity", true, func() (string, error) {
+		client := sts.New(sts.Options{Region: options.Region, Credentials: options.Credentials, HTTPClient: options.HTTPClient, BaseEndpoint: options.BaseEndpoint})
+		identity, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("account %s, arn %s", aws.ToString(identity.Account), aws.ToString(identity.Arn)), nil
+	})
+
+	ok = check("bucket", false, func() (string, error) {
+		head, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+		if err != nil {
+			return "", s.wrapError("", err)
+		}
+		region := aws.ToString(head.BucketRegion)
+		if region != "" && options.Region != "" && region != options.Region {
+			return "", fmt.Errorf("the bucket is in %s, but the client is in %s", region, options.Region)
+		}
+		return "region " + region, nil
+	})
+	if !ok {
+		return checks
+	}
+
+	check("encryption", true, func() (string, error) {
+		output, err := s.s3Client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(s.bucket)})
+		if err != nil {
+			return "", s.wrapError("", err)
+		}
+		var rules []string
+		if config := output.ServerSideEncryptionConfiguration; config != nil {
+			for _, rule := range config.Rules {
+				if rule.ApplyServerSideEncryptionByDefault == nil {
+					continue
+				}
+				rule := rule.ApplyServerSideEncryptionByDefault
+				desc := string(rule.SSEAlgorithm)
+				if rule.KMSMasterKeyID != nil {
+					desc += " with the key " + aws.ToString(rule.KMSMasterKeyID)
+				}
+				rules = append(rules, desc)
+			}
+		}
+		if len(rules) == 0 {
+			return "no default encryption", nil
+		}
+		return "default " + strings.Join(rules, ", "), nil
+	})
+
+	check("list", false, func() (string, error) {
+		_, err := s.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Prefix: aws.String(prefix), MaxKeys: aws.Int32(1)})
+		return "", s.wrapError(prefix, err)
+	})
+
+	probe := path.Join(prefix, ".gotgz-auth-check-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	input := s.putObjectInput(probe, "application/octet-stream", nil, bytes.NewReader(nil))
+	put := check("put", false, func() (string, error) {
+		_, err := s.s3Client.PutObject(ctx, input)
+		return probe, s.wrapError(probe, err)
+	})
+	if put {
+		check("get", false, func() (string, error) {
+			data, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(probe)})
+			if err != nil {
+				return "", s.wrapError(probe, err)
+			}
+			return "", data.Body.Close()
+		})
+		check("delete", true, func() (string, error) {
+			_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(probe)})
+			if err != nil {
+				return "the probe object is left", s.wrapError(probe, err)
+			}
+			return "", nil
+		})
+	}
+
+	// the multipart upload has the same encryption as the upload of the archives, e.g. kms:GenerateDataKey
+	var uploadID *string
+	multipart := check("multipart", false, func() (string, error) {
+		output, err := s.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               aws.String(s.bucket),
+			Key:                  aws.String(probe),
+			ServerSideEncryption: input.ServerSideEncryption,
+			SSEKMSKeyId:          input.SSEKMSKeyId,
+			StorageClass:         input.StorageClass,
+		})
+		if err != nil {
+			return "", s.wrapError(probe, err)
+		}
+		uploadID = output.UploadId
+		return "", nil
+	})
+	if multipart {
+		check("abort-multipart", false, func() (string, error) {
+			_, err := s.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String(s.bucket), Key: aws.String(probe), UploadId: uploadID})
+			if err != nil {
+				return "the incomplete upload is left until the lifecycle rule removes it", s.wrapError(probe, err)
+			}
+			return "", nil
+		})
+	}
+	return checks
+}
@@ -0,0 +1,141 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// OpenAppend decompresses the archive to append to, it's CompressFlags.Existing, the returned archiver is
+// the one of the archive if it's different from the given archiver, so the appended archive keeps its compression
+func OpenAppend(src io.ReadCloser, archiver Archiver) (io.Reader, Archiver, error) {
+	br := bufferedReadCloser{Reader: bufio.NewReaderSize(src, readBufferSize), Closer: src}
+	detected, err := DetectArchiver(br.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if detected == nil {
+		return nil, nil, errors.New("the archive to append to isn't compressed with gzip, lz4 or zstd")
+	}
+	if detected.Name() != archiver.Name() {
+		archiver = detected
+	}
+	existing, err := archiver.Reader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	return existing, archiver, nil
+}
+
+// switchWriter writes to the current writer, it's switched between the archive and the pending buffer
+type switchWriter struct {
+	w io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// copyMembers copies the members of the tar stream to w byte for byte without the end of archive,
+// so the members are appended after them, keep is called with the header of every member if it's not nil,
+// and the member is dropped with its content if it returns false, it returns the count of the copied members
+func copyMembers(ctx context.Context, w io.Writer, r io.Reader, keep func(header *tar.Header) bool) (int, error) {
+	sw := &switchWriter{}
+	counter := &offsetReader{Reader: contextReader{ctx: ctx, Reader: r}}
+	tr := tar.NewReader(io.TeeReader(counter, sw))
+
+	var count int
+	var pending bytes.Buffer
+	// kept is whether the last member is copied, the pending starts with its padding
+	kept := true
+	for {
+		// the header is pending until it's complete, so the end of archive is never written
+		pending.Reset()
+		sw.w = &pending
+		header, err := tr.Next()
+		padding := (blockSize - (counter.n-int64(pending.Len()))%blockSize) % blockSize
+		if err == io.EOF {
+			// the pending is the padding of the last member followed by the end of archive
+			if int64(pending.Len()) < padding {
+				return count, fmt.Errorf("the archive is truncated")
+			}
+			if !kept {
+				return count, nil
+			}
+			_, err := w.Write(pending.Bytes()[:padding])
+			return count, err
+		}
+		if err != nil {
+			return count, fmt.Errorf("read the archive: %w", err)
+		}
+
+		// the pending is the padding of the last member followed by the header of this one
+		if padded := pending.Next(int(padding)); kept {
+			if _, err := w.Write(padded); err != nil {
+				return count, err
+			}
+		}
+		sw.w = io.Discard
+		if kept = keep == nil || keep(header); kept {
+			if _, err := pending.WriteTo(w); err != nil {
+				return count, err
+			}
+			sw.w = w
+			count++
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return count, fmt.Errorf("read the archive: %w", err)
+		}
+	}
+}
+
+// offsetReader counts the bytes read from the tar stream
+type offsetReader struct {
+	io.Reader
+	n int64
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	n, err := o.Reader.Read(p)
+	o.n += int64(n)
+	return n, err
+}
+
+// AppendSources appends the sources to the archive of the s3Key like `tar -r`, the archive is created
+// if it doesn't exist, the object can't be changed in place, so the existing members are downloaded
+// and uploaded again with the sources, the metadata of the object is kept if flags.Metadata is nil
+func (s S3) AppendSources(ctx context.Context, flags CompressFlags, s3Key string, sources ...Source) error {
+	exist, err := s.IsExist(ctx, s3Key)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return s.UploadSources(ctx, flags, s3Key, sources...)
+	}
+
+	src, metadata, err := s.Reader(ctx, s3Key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	existing, archiver, err := OpenAppend(src, flags.Archiver)
+	if err != nil {
+		return err
+	}
+	defer closeReader(existing)
+
+	flags.Existing, flags.Archiver = existing, archiver
+	if flags.DryRun {
+		// the object isn't uploaded again for nothing
+		return CompressSources(ctx, nopCloser{io.Discard}, flags, sources...)
+	}
+	if flags.Metadata == nil {
+		flags.Metadata = metadata
+	}
+	return s.UploadSources(ctx, flags, s3Key, sources...)
+}
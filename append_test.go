@@ -0,0 +1,140 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCopyMembers(t *testing.T) {
+	for _, content := range []string{"", "1", string(bytes.Repeat([]byte("x"), blockSize))} {
+		data := newTestTar(t, tarFile{"a", "hello"}, tarFile{"b", content})
+
+		var buf bytes.Buffer
+		count, err := copyMembers(context.Background(), &buf, bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 {
+			t.Errorf("count = %d, want 2", count)
+		}
+		// the members are kept byte for byte without the two zero blocks of the end of archive
+		if want := data[:len(data)-2*blockSize]; !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("copied %d bytes, want %d", buf.Len(), len(want))
+		}
+	}
+
+	if _, err := copyMembers(context.Background(), io.Discard, bytes.NewReader(newTestTar(t, tarFile{"a", "hello"})[:blockSize+3]), nil); err == nil {
+		t.Error("the truncated archive is copied")
+	}
+}
+
+func TestCompress_Existing(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "b.txt": "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flags := CompressFlags{Archiver: GZipArchiver{}, Logger: discardLogger, Label: "backup", GlobalHeader: map[string]string{"comment": "test"}}
+	var archive bytes.Buffer
+	if err := CompressSources(context.Background(), nopWriteCloser{&archive}, flags, Source{Dir: dir, Path: "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive is detected as zstd, but it's gzip
+	existing, archiver, err := OpenAppend(io.NopCloser(&archive), ZstdArchiver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archiver.Name() != "gzip" {
+		t.Fatalf("archiver = %s, want gzip", archiver.Name())
+	}
+
+	flags.Archiver, flags.Existing = archiver, existing
+	var appended bytes.Buffer
+	if err := CompressSources(context.Background(), nopWriteCloser{&appended}, flags, Source{Dir: dir, Path: "b.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var labels, globals int
+	names, err := listNames(appended.Bytes(), ListFlags{
+		Label:        "backup",
+		VolumeLabel:  func(string) error { labels++; return nil },
+		GlobalHeader: func(map[string]string) error { globals++; return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt=a", "b.txt=b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+	if labels != 1 || globals != 1 {
+		t.Errorf("labels = %d, global headers = %d, want 1 of each", labels, globals)
+	}
+
+	flags.Existing, flags.Manifest = bytes.NewReader(nil), true
+	if err := CompressSources(context.Background(), nopWriteCloser{io.Discard}, flags); err == nil {
+		t.Error("the manifest is appended")
+	}
+
+	if _, _, err := OpenAppend(io.NopCloser(bytes.NewReader(newTestTar(t, tarFile{"a", "1"}))), GZipArchiver{}); err == nil {
+		t.Error("the uncompressed archive is opened")
+	}
+}
+
+func TestCompress_Update(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	for name, content := range map[string]string{"same.txt": "same", "changed.txt": "v1"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flags := CompressFlags{Archiver: GZipArchiver{}, Logger: discardLogger, Relative: true}
+	var archive bytes.Buffer
+	if err := CompressSources(context.Background(), nopWriteCloser{&archive}, flags, Source{Path: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "changed.txt"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the directory isn't newer than its copy, so it's not appended again
+	if err := os.Chtimes(dir, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	existing, archiver, err := OpenAppend(io.NopCloser(&archive), GZipArchiver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags.Archiver, flags.Existing, flags.Update = archiver, existing, true
+	var updated bytes.Buffer
+	if err := CompressSources(context.Background(), nopWriteCloser{&updated}, flags, Source{Path: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := listNames(updated.Bytes(), ListFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"./=", "changed.txt=v1", "same.txt=same", "changed.txt=v2", "new.txt=new"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
@@ -1,11 +1,14 @@
 package gotgz
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/pierrec/lz4/v4"
@@ -42,12 +45,32 @@ func GetCompressionHandlers(alg string) (Archiver, error) {
 	}
 }
 
+// GetArchiverByName returns the archiver with the default options by the extension of the file name
+func GetArchiverByName(fileName string) (Archiver, bool) {
+	var alg string
+	switch {
+	case strings.HasSuffix(fileName, ".gz"), strings.HasSuffix(fileName, ".tgz"):
+		alg = "gzip"
+	case strings.HasSuffix(fileName, ".lz4"):
+		alg = "lz4"
+	case strings.HasSuffix(fileName, ".zst"), strings.HasSuffix(fileName, ".tzst"):
+		alg = "zstd"
+	default:
+		return nil, false
+	}
+	archiver, err := GetCompressionHandlers(alg)
+	return archiver, err == nil
+}
+
 type Optioner interface {
 	Get(string) string
 }
 
 type GZipArchiver struct {
 	Level int
+	// Concurrency is the count of the decompressed blocks which are read ahead in the background like pgzip,
+	// so the decompression overlaps the extraction, it's read in the foreground if it's less than 2
+	Concurrency int
 }
 
 func NewGZip(query Optioner) (GZipArchiver, error) {
@@ -70,8 +93,12 @@ func (g GZipArchiver) Writer(w io.WriteCloser) (io.WriteCloser, error) {
 	return gzip.NewWriterLevel(w, g.Level)
 }
 
-func (GZipArchiver) Reader(r io.ReadCloser) (io.Reader, error) {
-	return gzip.NewReader(r)
+func (g GZipArchiver) Reader(r io.ReadCloser) (io.Reader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil || g.Concurrency < 2 {
+		return zr, err
+	}
+	return newReadAhead(zr, g.Concurrency), nil
 }
 
 func (GZipArchiver) Extension() string {
@@ -131,7 +158,29 @@ func (l Lz4Archiver) Writer(w io.WriteCloser) (io.WriteCloser, error) {
 }
 
 func (l Lz4Archiver) Reader(r io.ReadCloser) (io.Reader, error) {
-	return lz4.NewReader(r), nil
+	src := bufio.NewReader(r)
+	return &lz4Streams{Reader: lz4.NewReader(src), src: src}, nil
+}
+
+// lz4Streams reads the concatenated lz4 frames like the multistream gzip reader,
+// the lz4 reader stops at the end of the first frame
+type lz4Streams struct {
+	*lz4.Reader
+	src *bufio.Reader
+}
+
+func (l *lz4Streams) Read(p []byte) (int, error) {
+	n, err := l.Reader.Read(p)
+	if err == io.EOF {
+		if _, peekErr := l.src.Peek(1); peekErr == nil {
+			l.Reader.Reset(l.src)
+			if n == 0 {
+				return l.Read(p)
+			}
+			return n, nil
+		}
+	}
+	return n, err
 }
 
 func (Lz4Archiver) Extension() string {
@@ -144,6 +193,8 @@ func (Lz4Archiver) Name() string {
 
 type ZstdArchiver struct {
 	Level int
+	// Concurrency is the count of the goroutines to decompress the blocks, the default of zstd is used if it's 0
+	Concurrency int
 }
 
 func NewZstd(query Optioner) (ZstdArchiver, error) {
@@ -169,11 +220,25 @@ func (z ZstdArchiver) Writer(w io.WriteCloser) (io.WriteCloser, error) {
 }
 
 func (z ZstdArchiver) Reader(r io.ReadCloser) (io.Reader, error) {
-	zr, err := zstd.NewReader(r)
+	var opts []zstd.DOption
+	if z.Concurrency > 0 {
+		opts = append(opts, zstd.WithDecoderConcurrency(z.Concurrency))
+	}
+	zr, err := zstd.NewReader(r, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return zr, nil
+	return zstdReader{zr}, nil
+}
+
+// zstdReader releases the goroutines of the decoder on Close
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (z zstdReader) Close() error {
+	z.Decoder.Close()
+	return nil
 }
 
 func (ZstdArchiver) Extension() string {
@@ -183,3 +248,88 @@ func (ZstdArchiver) Extension() string {
 func (ZstdArchiver) Name() string {
 	return "zstd"
 }
+
+// AutoArchiver detects the compression algorithm by the magic bytes on read, the bytes are peeked
+// without seeking, so it works for the pipes like stdin, the uncompressed tar is read as is, the Archiver writes
+// the archive and reads the archive without the known magic bytes
+type AutoArchiver struct {
+	Archiver
+	// Concurrency is the decompression concurrency of the detected archiver, see WithConcurrency
+	Concurrency int
+}
+
+// readBufferSize is the buffer size of the detected archive, the large reads are fewer syscalls for the pipes
+const readBufferSize = 1 << 20
+
+func (a AutoArchiver) Reader(r io.ReadCloser) (io.Reader, error) {
+	src := bufferedReadCloser{Reader: bufio.NewReaderSize(r, readBufferSize), Closer: r}
+	archiver, err := DetectArchiver(src.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if archiver == nil {
+		// the uncompressed tar is read as is, e.g. the archive which is read from the resume offset
+		if block, _ := src.Peek(blockSize); len(block) == blockSize && isHeaderBlock(block) {
+			return src.Reader, nil
+		}
+		archiver = a.Archiver
+	}
+	return WithConcurrency(archiver, a.Concurrency).Reader(src)
+}
+
+// WithConcurrency returns the archiver with the decompression concurrency, the archiver is returned as is
+// if it's not parallel, e.g. lz4, or the concurrency is 0
+func WithConcurrency(archiver Archiver, concurrency int) Archiver {
+	if concurrency <= 0 {
+		return archiver
+	}
+	switch a := archiver.(type) {
+	case GZipArchiver:
+		a.Concurrency = concurrency
+		return a
+	case ZstdArchiver:
+		a.Concurrency = concurrency
+		return a
+	}
+	return archiver
+}
+
+// closeReader releases the resources of the decompressing reader, e.g. the goroutines of the parallel decompression
+func closeReader(r io.Reader) {
+	if c, ok := r.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// bufferedReadCloser keeps the ReadByte of the bufio.Reader, so gzip doesn't buffer it again
+type bufferedReadCloser struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// DetectArchiver returns the archiver with the default options by the magic bytes of the stream,
+// it returns nil if they are unknown, e.g. the uncompressed tar
+func DetectArchiver(r *bufio.Reader) (Archiver, error) {
+	magic, err := r.Peek(6)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var alg string
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		alg = "gzip"
+	case bytes.HasPrefix(magic, []byte{0x04, 0x22, 0x4d, 0x18}):
+		alg = "lz4"
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		alg = "zstd"
+	// xz and bzip2 are detected to fail with the hint instead of reading them as the corrupted tar,
+	// there are no decoders for them in gotgz
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return nil, fmt.Errorf("unsupported compression algorithm: xz, decompress it with `xz -dc` and pipe it to gotgz")
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return nil, fmt.Errorf("unsupported compression algorithm: bzip2, decompress it with `bzip2 -dc` and pipe it to gotgz")
+	default:
+		return nil, nil
+	}
+	return GetCompressionHandlers(alg)
+}
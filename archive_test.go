@@ -1,8 +1,12 @@
 package gotgz
 
 import (
+	"bufio"
+	"bytes"
+	"io"
 	"reflect"
 	"testing"
+	"testing/iotest"
 )
 
 func TestGetCompressionHandlers(t *testing.T) {
@@ -65,3 +69,160 @@ func TestGetCompressionHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestArchiver_Multistream(t *testing.T) {
+	for _, archiver := range []Archiver{GZipArchiver{}, Lz4Archiver{}, ZstdArchiver{}} {
+		t.Run(archiver.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			for _, content := range []string{"first", "second"} {
+				zw, err := archiver.Writer(nopWriteCloser{&buf})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := io.WriteString(zw, content); err != nil {
+					t.Fatal(err)
+				}
+				if err := zw.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			zr, err := archiver.Reader(io.NopCloser(&buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "firstsecond" {
+				t.Errorf("got %q, want %q", got, "firstsecond")
+			}
+		})
+	}
+}
+
+// closeCounter records the closes, the stdin must not be closed by the archivers
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestAutoArchiver(t *testing.T) {
+	for _, archiver := range []Archiver{GZipArchiver{Level: 1}, Lz4Archiver{}, ZstdArchiver{}} {
+		t.Run(archiver.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, err := archiver.Writer(nopWriteCloser{&buf})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(zw, "content"); err != nil {
+				t.Fatal(err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the pipe returns the short reads and can't seek
+			src := &closeCounter{Reader: iotest.OneByteReader(&buf)}
+			zr, err := AutoArchiver{Archiver: GZipArchiver{}}.Reader(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "content" {
+				t.Errorf("got %q, want %q", got, "content")
+			}
+			if src.closed != 0 {
+				t.Errorf("the source is closed %d times by the reader", src.closed)
+			}
+		})
+	}
+}
+
+func TestDetectArchiver(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Archiver
+		wantErr bool
+	}{
+		{name: "gzip", data: []byte{0x1f, 0x8b, 0x08, 0x00}, want: GZipArchiver{Level: -1}},
+		{name: "lz4", data: []byte{0x04, 0x22, 0x4d, 0x18, 0x64, 0x40}, want: Lz4Archiver{}},
+		{name: "zstd", data: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x04, 0x00}, want: ZstdArchiver{}},
+		{name: "bzip2", data: []byte("BZh91AY"), wantErr: true},
+		{name: "xz", data: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, wantErr: true},
+		{name: "tar", data: make([]byte, blockSize)},
+		{name: "short", data: []byte{0x1f}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectArchiver(bufio.NewReader(bytes.NewReader(tt.data)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectArchiver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectArchiver() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiver_Concurrency(t *testing.T) {
+	// the content is larger than the read ahead blocks
+	content := make([]byte, 3*readAheadBlockSize+100)
+	for i := range content {
+		content[i] = byte(i * i >> 10)
+	}
+	for _, archiver := range []Archiver{GZipArchiver{Level: 1}, ZstdArchiver{}} {
+		t.Run(archiver.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, err := archiver.Writer(nopWriteCloser{&buf})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := zw.Write(content); err != nil {
+				t.Fatal(err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			zr, err := WithConcurrency(archiver, 4).Reader(io.NopCloser(bytes.NewReader(buf.Bytes())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeReader(zr)
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Error("the decompressed content doesn't match")
+			}
+
+			// the errors of the truncated archive are returned after the decompressed blocks
+			zr, err = WithConcurrency(archiver, 4).Reader(io.NopCloser(bytes.NewReader(buf.Bytes()[:buf.Len()/2])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeReader(zr)
+			if _, err := io.ReadAll(zr); err == nil {
+				t.Error("read the truncated archive without error")
+			}
+		})
+	}
+
+	if got := WithConcurrency(Lz4Archiver{}, 4); got != (Lz4Archiver{}) {
+		t.Errorf("WithConcurrency(lz4) = %#v, want it unchanged", got)
+	}
+}
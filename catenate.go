@@ -0,0 +1,135 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+type CatenateFlags struct {
+	// Archiver compresses the catenated archive, it's uncompressed if it's nil
+	Archiver Archiver
+	// DryRun reads the archives without writing the s3 object
+	DryRun bool
+	Logger Logger
+
+	S3PartSize int64
+	S3Thread   int
+	// Metadata is the metadata of the s3 object, the metadata of the existing object is kept if it's nil
+	Metadata map[string]string
+}
+
+// CatenateSource is an archive to catenate, it's opened once the previous archives are copied,
+// so the s3 objects aren't idle until they are read
+type CatenateSource struct {
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+// Catenate writes the members of the archives to dest one after another like `tar -A`, every archive is
+// decompressed by its magic bytes, so the compressions can be mixed, and its end of archive blocks are stripped,
+// the members are copied byte for byte and the output is compressed with flags.Archiver
+func Catenate(ctx context.Context, dest io.WriteCloser, flags CatenateFlags, archives ...CatenateSource) (err error) {
+	var logger = flags.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	defer func() {
+		if err != nil {
+			closeWithError(dest, err)
+		}
+	}()
+
+	var w io.WriteCloser = nopCloser{dest}
+	if flags.Archiver != nil {
+		if w, err = flags.Archiver.Writer(dest); err != nil {
+			return err
+		}
+	}
+	for _, archive := range archives {
+		count, err := catenateArchive(ctx, w, archive)
+		if err != nil {
+			w.Close()
+			return fmt.Errorf("%s: %w", archive.Name, err)
+		}
+		logger.Info("catenate", "archive", archive.Name, "members", count)
+	}
+	// the end of archive
+	if err := tar.NewWriter(w).Close(); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return dest.Close()
+}
+
+func catenateArchive(ctx context.Context, w io.Writer, archive CatenateSource) (int, error) {
+	src, err := archive.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	r, err := readDetected(src)
+	if err != nil {
+		return 0, err
+	}
+	defer closeReader(r)
+	return copyMembers(ctx, w, r, nil)
+}
+
+// DetectCompression returns the archiver of the archive by its magic bytes, it's nil if it's uncompressed
+func DetectCompression(r io.Reader) (Archiver, error) {
+	return DetectArchiver(bufio.NewReaderSize(r, 6))
+}
+
+// Catenate appends the archives to the archive of the s3Key like `tar -A`, it's created with flags.Archiver
+// if it doesn't exist, the object can't be changed in place, so the existing members are downloaded and uploaded
+// again with the archives, it keeps its compression and its metadata if flags.Metadata is nil
+func (s S3) Catenate(ctx context.Context, flags CatenateFlags, s3Key string, archives ...CatenateSource) error {
+	exist, err := s.IsExist(ctx, s3Key)
+	if err != nil {
+		return err
+	}
+	if exist {
+		info, err := s.Stat(ctx, s3Key)
+		if err != nil {
+			return err
+		}
+		if flags.Metadata == nil {
+			flags.Metadata = info.Metadata
+		}
+		if info.Size > 0 {
+			head, err := s.RangeReader(ctx, s3Key, min(info.Size, 6))
+			if err != nil {
+				return err
+			}
+			flags.Archiver, err = DetectCompression(head)
+			head.Close()
+			if err != nil {
+				return err
+			}
+		}
+		existing := CatenateSource{Name: fmt.Sprintf("s3://%s/%s", s.bucket, s3Key), Open: func() (io.ReadCloser, error) {
+			src, _, err := s.Reader(ctx, s3Key)
+			return src, err
+		}}
+		archives = append([]CatenateSource{existing}, archives...)
+	}
+	if flags.DryRun {
+		return Catenate(ctx, nopCloser{io.Discard}, flags, archives...)
+	}
+
+	contentType := "application/x-tar"
+	if flags.Archiver != nil {
+		contentType = flags.Archiver.MediaType()
+	}
+	dest := s.writer(ctx, s3Key, contentType, flags.Metadata, flags.S3PartSize, flags.S3Thread)
+	return Catenate(ctx, dest, flags, archives...)
+}
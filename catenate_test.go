@@ -0,0 +1,70 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestCatenate(t *testing.T) {
+	plain := newTestTar(t, tarFile{"a", "1"})
+	compressed := gzipBytes(t, newTestTar(t, tarFile{"b", "22"}, tarFile{"c", ""}))
+	source := func(name string, data []byte) CatenateSource {
+		return CatenateSource{Name: name, Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }}
+	}
+
+	tests := []struct {
+		name     string
+		archiver Archiver
+		archives []CatenateSource
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "Uncompressed",
+			archives: []CatenateSource{source("plain", plain), source("compressed", compressed)},
+			want:     []string{"a=1", "b=22", "c="},
+		},
+		{
+			name:     "Compressed",
+			archiver: GZipArchiver{},
+			archives: []CatenateSource{source("compressed", compressed), source("plain", plain), source("empty", nil)},
+			want:     []string{"b=22", "c=", "a=1"},
+		},
+		{
+			name:     "Truncated",
+			archives: []CatenateSource{source("plain", plain), source("truncated", plain[:blockSize+3])},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dest bytes.Buffer
+			flags := CatenateFlags{Archiver: tt.archiver, Logger: discardLogger}
+			err := Catenate(context.Background(), nopWriteCloser{&dest}, flags, tt.archives...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Catenate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			archive := dest.Bytes()
+			if tt.archiver == nil {
+				if len(archive)%blockSize != 0 {
+					t.Errorf("the archive size %d isn't aligned", len(archive))
+				}
+				archive = gzipBytes(t, archive)
+			}
+			names, err := listNames(archive, ListFlags{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// DiffError is the error of the members which differ from the filesystem
+type DiffError struct {
+	Differences []Difference
+}
+
+func (e *DiffError) Error() string {
+	return fmt.Sprintf("%d members differ from the filesystem", len(e.Differences))
+}
+
+// FilesystemDiff compares the archive members with the files under Dir like `tar -d`,
+// e.g. verify the restore, the type, the size, the mode, the modification time in seconds,
+// the content hash and the target of the link are compared
+type FilesystemDiff struct {
+	Dir string
+	// Paths maps the member names to their files instead of Dir if it's not nil, the members which aren't in it
+	// are skipped, e.g. verify the created archive with CompressFlags.Paths
+	Paths map[string]string
+	// Members is the count of the compared members
+	Members int
+	// Differences are the members which are missing or differ, Only is "archive" if the file doesn't exist
+	Differences []Difference
+}
+
+// Compare is a ListFunc which compares the member with its file
+func (d *FilesystemDiff) Compare(header *tar.Header, content io.Reader) error {
+	path := filepath.Join(d.Dir, filepath.FromSlash(header.Name))
+	if d.Paths != nil {
+		var ok bool
+		if path, ok = d.Paths[header.Name]; !ok {
+			return nil
+		}
+		// the hardlinks of the dedup aren't the same files, only their targets are compared
+		if header.Typeflag == tar.TypeLink {
+			d.Members++
+			if _, ok := d.Paths[header.Linkname]; !ok {
+				d.Differences = append(d.Differences, Difference{Name: header.Name, Fields: []string{"link"}})
+			}
+			return nil
+		}
+	}
+	d.Members++
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		d.Differences = append(d.Differences, Difference{Name: header.Name, Only: "archive"})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fields, err := compareFile(d.Dir, path, fi, header, content)
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		d.Differences = append(d.Differences, Difference{Name: header.Name, Fields: fields})
+	}
+	return nil
+}
+
+// Err returns DiffError if there is any difference
+func (d *FilesystemDiff) Err() error {
+	if len(d.Differences) == 0 {
+		return nil
+	}
+	return &DiffError{Differences: d.Differences}
+}
+
+func compareFile(dir, path string, fi fs.FileInfo, header *tar.Header, content io.Reader) ([]string, error) {
+	var fields []string
+	if fileTypeflag(fi.Mode()) != headerTypeflag(header) {
+		return append(fields, "type"), nil
+	}
+
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		if target != header.Linkname {
+			fields = append(fields, "link")
+		}
+		// the times and the modes of the links are rarely restored
+		return fields, nil
+	case tar.TypeLink:
+		target, err := os.Stat(filepath.Join(dir, filepath.FromSlash(header.Linkname)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if target == nil || !os.SameFile(fi, target) {
+			fields = append(fields, "link")
+		}
+		return fields, nil
+	}
+
+	// the permissions aren't kept on windows
+	if runtime.GOOS != "windows" && int64(fi.Mode().Perm()) != header.Mode&0777 {
+		fields = append(fields, "mode")
+	}
+	// the time is truncated to the seconds by tar and rounded by the writer of go
+	if mtime := fi.ModTime(); mtime.Unix() != header.ModTime.Unix() && mtime.Round(time.Second).Unix() != header.ModTime.Unix() {
+		fields = append(fields, "mtime")
+	}
+	if header.Typeflag != tar.TypeReg {
+		return fields, nil
+	}
+	if fi.Size() != header.Size {
+		return append(fields, "size"), nil
+	}
+	same, err := sameContent(path, header, content)
+	if err != nil {
+		return nil, err
+	}
+	if !same {
+		fields = append(fields, "hash")
+	}
+	return fields, nil
+}
+
+// sameContent compares the checksums of the file and the member, the stored checksum of the member is used if it's present
+func sameContent(path string, header *tar.Header, content io.Reader) (bool, error) {
+	sum, err := EntryChecksum(header, content, DefaultManifestChecksum)
+	if err != nil {
+		return false, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	hash, err := NewChecksum(DefaultManifestChecksum)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(hash, file); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == sum, nil
+}
+
+// headerTypeflag returns the type of the member, the hardlink is compared as the regular file
+func headerTypeflag(header *tar.Header) byte {
+	switch header.Typeflag {
+	case tar.TypeRegA, tar.TypeLink, tar.TypeGNUSparse:
+		return tar.TypeReg
+	}
+	return header.Typeflag
+}
+
+// fileTypeflag returns the tar type of the file
+func fileTypeflag(mode fs.FileMode) byte {
+	switch {
+	case mode.IsRegular():
+		return tar.TypeReg
+	case mode.IsDir():
+		return tar.TypeDir
+	case mode&fs.ModeSymlink != 0:
+		return tar.TypeSymlink
+	case mode&fs.ModeNamedPipe != 0:
+		return tar.TypeFifo
+	case mode&fs.ModeCharDevice != 0:
+		return tar.TypeChar
+	case mode&fs.ModeDevice != 0:
+		return tar.TypeBlock
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilesystemDiff(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "file"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	file := tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: 7, ModTime: mtime}
+	tests := []struct {
+		name    string
+		header  tar.Header
+		content string
+		want    *Difference
+	}{
+		{name: "Same", header: file, content: "content"},
+		{name: "Missing", header: tar.Header{Name: "missing", Typeflag: tar.TypeReg}, want: &Difference{Name: "missing", Only: "archive"}},
+		{name: "Type", header: tar.Header{Name: "file", Typeflag: tar.TypeDir}, want: &Difference{Name: "file", Fields: []string{"type"}}},
+		{
+			name:    "Content",
+			header:  file,
+			content: "CONTENT",
+			want:    &Difference{Name: "file", Fields: []string{"hash"}},
+		},
+		{
+			name:    "Metadata",
+			header:  tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0600, Size: 3, ModTime: mtime.Add(time.Second)},
+			content: "new",
+			want:    &Difference{Name: "file", Fields: []string{"mode", "mtime", "size"}},
+		},
+		{name: "Link", header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "file"}},
+		{
+			name:   "Link target",
+			header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "other"},
+			want:   &Difference{Name: "link", Fields: []string{"link"}},
+		},
+		{name: "Hardlink", header: tar.Header{Name: "file", Typeflag: tar.TypeLink, Linkname: "file"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := &FilesystemDiff{Dir: dir}
+			if err := diff.Compare(&tt.header, strings.NewReader(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if err := diff.Err(); err != nil {
+					t.Errorf("Err() = %v, want nil", err)
+				}
+				return
+			}
+			var diffErr *DiffError
+			if err := diff.Err(); !errors.As(err, &diffErr) {
+				t.Fatalf("Err() = %v, want DiffError", err)
+			}
+			if !reflect.DeepEqual(diffErr.Differences, []Difference{*tt.want}) {
+				t.Errorf("differences = %v, want %v", diffErr.Differences, *tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesystemDiff_Paths(t *testing.T) {
+	source := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "same", "b.txt": "same", "c.txt": "other"} {
+		if err := os.WriteFile(filepath.Join(source, name), []byte(content), DefaultFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	paths := make(map[string]string)
+	entry := Entry{Name: "extra.txt", Content: strings.NewReader("extra")}
+	cflags := CompressFlags{Archiver: archiver, Dedup: true, Manifest: true, Entries: []Entry{entry}, Paths: paths, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 4 {
+		t.Fatalf("paths = %v, want the directory and 3 files", paths)
+	}
+
+	verify := func() *FilesystemDiff {
+		diff := &FilesystemDiff{Paths: paths}
+		if err := List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), ListFlags{Archiver: archiver}, diff.Compare); err != nil {
+			t.Fatal(err)
+		}
+		return diff
+	}
+	// the entries and the manifest aren't from the sources
+	if diff := verify(); diff.Members != 4 || diff.Err() != nil {
+		t.Fatalf("members = %d, differences = %v, want 4 members without the differences", diff.Members, diff.Differences)
+	}
+
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(filepath.Join(source, "c.txt"), []byte("OTHER"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(source, "c.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	for member, path := range paths {
+		if path == filepath.Join(source, "c.txt") {
+			name = member
+		}
+	}
+	want := []Difference{{Name: name, Fields: []string{"mtime", "hash"}}}
+	if diff := verify(); !reflect.DeepEqual(diff.Differences, want) {
+		t.Errorf("differences = %v, want %v", diff.Differences, want)
+	}
+}
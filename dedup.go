@@ -0,0 +1,54 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"io"
+	"os"
+)
+
+// contentDedup finds the regular files with the same content, mode and owner, the subsequent copies
+// are archived as the hardlinks to the first one, which share its metadata on extract
+type contentDedup struct {
+	names map[dedupKey]string
+}
+
+type dedupKey struct {
+	hash         [sha256.Size]byte
+	size         int64
+	mode         int64
+	uid, gid     int
+	uname, gname string
+}
+
+func newContentDedup() *contentDedup {
+	return &contentDedup{names: make(map[dedupKey]string)}
+}
+
+// link hashes the file and converts the header to a hardlink if the same content is archived before,
+// the file is read twice for the first occurrence since the header is written before the content
+func (d *contentDedup) link(absPath string, header *tar.Header) (bool, error) {
+	file, err := os.Open(absPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return false, err
+	}
+
+	key := dedupKey{size: size, mode: header.Mode, uid: header.Uid, gid: header.Gid, uname: header.Uname, gname: header.Gname}
+	copy(key.hash[:], hash.Sum(nil))
+	first, ok := d.names[key]
+	if !ok {
+		d.names[key] = header.Name
+		return false, nil
+	}
+	header.Typeflag = tar.TypeLink
+	header.Linkname = first
+	header.Size = 0
+	return true, nil
+}
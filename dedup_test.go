@@ -0,0 +1,94 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	source := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "same", "b.txt": "same", "c.txt": "other"} {
+		if err := os.WriteFile(filepath.Join(source, name), []byte(content), DefaultFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	cflags := CompressFlags{Archiver: archiver, Relative: true, Dedup: true, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []string
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), ListFlags{Archiver: archiver}, func(header *tar.Header, _ io.Reader) error {
+		entries = append(entries, string(header.Typeflag)+" "+header.Name+" "+header.Linkname)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"5 ./ ", "0 a.txt ", "1 b.txt a.txt", "0 c.txt "}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %q, want %q", entries, want)
+	}
+
+	dest := t.TempDir()
+	dflags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, dflags); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "same" {
+		t.Errorf("b.txt = %q, want %q", data, "same")
+	}
+	a, err := os.Stat(filepath.Join(dest, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.Stat(filepath.Join(dest, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("b.txt should be the hardlink of a.txt")
+	}
+}
+
+func TestContentDedup_Owner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("same"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	dedup := newContentDedup()
+	for _, tt := range []struct {
+		header *tar.Header
+		want   string
+	}{
+		{header: &tar.Header{Name: "a", Mode: 0644, Uid: 1, Uname: "alice"}},
+		{header: &tar.Header{Name: "same", Mode: 0644, Uid: 1, Uname: "alice"}, want: "a"},
+		{header: &tar.Header{Name: "mode", Mode: 0600, Uid: 1, Uname: "alice"}},
+		{header: &tar.Header{Name: "uid", Mode: 0644, Uid: 2, Uname: "alice"}},
+		{header: &tar.Header{Name: "gid", Mode: 0644, Uid: 1, Gid: 1, Uname: "alice"}},
+		{header: &tar.Header{Name: "uname", Mode: 0644, Uid: 1, Uname: "bob"}},
+		{header: &tar.Header{Name: "gname", Mode: 0644, Uid: 1, Uname: "alice", Gname: "staff"}},
+	} {
+		linked, err := dedup.link(path, tt.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked != (tt.want != "") || tt.header.Linkname != tt.want {
+			t.Errorf("%s is linked to %q, want %q", tt.header.Name, tt.header.Linkname, tt.want)
+		}
+	}
+}
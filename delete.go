@@ -0,0 +1,146 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type DeleteFlags struct {
+	// Members are the names of the members to delete like the member arguments of the extraction,
+	// the directory is deleted with its children
+	Members []string
+	// Regex is true if the members are RE2 regular expressions
+	Regex bool
+	// Matching is the same with DecompressFlags
+	Matching MemberMatch
+	// DryRun only logs the members to delete
+	DryRun bool
+	Logger Logger
+
+	S3PartSize int64
+	S3Thread   int
+}
+
+// DeleteMembers rewrites the archive without the members like `tar --delete`, the other members are copied
+// byte for byte, and the archive keeps its compression or it's kept uncompressed, it fails if a member
+// isn't in the archive, so the typo doesn't rewrite the archive for nothing
+func DeleteMembers(ctx context.Context, src io.ReadCloser, dest io.WriteCloser, flags DeleteFlags) (err error) {
+	defer src.Close()
+
+	if len(flags.Members) == 0 {
+		return errors.New("no members to delete")
+	}
+	matcher, err := newMemberMatcher(flags.Members, flags.Regex, 0, flags.Matching)
+	if err != nil {
+		return err
+	}
+
+	var logger = flags.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	defer func() {
+		if err != nil {
+			closeWithError(dest, err)
+		}
+	}()
+
+	br := bufferedReadCloser{Reader: bufio.NewReaderSize(src, readBufferSize), Closer: src}
+	archiver, err := DetectArchiver(br.Reader)
+	if err != nil {
+		return err
+	}
+
+	// the uncompressed archive is copied as is
+	var r io.Reader = br
+	var w io.WriteCloser = nopCloser{dest}
+	if archiver != nil {
+		zr, err := archiver.Reader(br)
+		if err != nil {
+			return err
+		}
+		defer closeReader(zr)
+		if w, err = archiver.Writer(dest); err != nil {
+			return err
+		}
+		r = zr
+	}
+	logger.Debug("flags", "dry-run", flags.DryRun, "members", flags.Members, "regex", flags.Regex,
+		"compressed", archiver != nil, "s3-part-size", flags.S3PartSize, "s3-thread", flags.S3Thread)
+
+	var deleted int
+	kept, err := copyMembers(ctx, w, r, func(header *tar.Header) bool {
+		if matcher.Match(header.Name, header.Typeflag == tar.TypeDir) < 0 {
+			return true
+		}
+		logger.Info("delete", "target", header.Name)
+		deleted++
+		return false
+	})
+	if err == nil {
+		err = matcher.Unmatched()
+	}
+	if err == nil {
+		// the end of archive
+		err = tar.NewWriter(w).Close()
+	}
+	if err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	logger.Info("deleted the members", "deleted", deleted, "kept", kept)
+	return dest.Close()
+}
+
+// DeleteMembers deletes the members from the archive of the s3Key like `tar --delete`, the object can't be changed
+// in place, so the archive is streamed to a temporary object next to it, which is copied over the archive on the server
+// side once it's complete and then removed, the archive is kept as is if it fails, its metadata is kept but the tags aren't
+func (s S3) DeleteMembers(ctx context.Context, flags DeleteFlags, s3Key string) error {
+	info, err := s.Stat(ctx, s3Key)
+	if err != nil {
+		return err
+	}
+	src, _, err := s.Reader(ctx, s3Key)
+	if err != nil {
+		return err
+	}
+	if flags.DryRun {
+		return DeleteMembers(ctx, src, nopCloser{io.Discard}, flags)
+	}
+
+	var logger = flags.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	temp := s3Key + ".gotgz-delete-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	dest := s.writer(ctx, temp, info.ContentType, info.Metadata, flags.S3PartSize, flags.S3Thread)
+	if err := DeleteMembers(ctx, src, dest, flags); err != nil {
+		return err
+	}
+	defer func() {
+		// the temporary object is removed even if the context is canceled
+		removeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+		defer cancel()
+		if _, err := s.s3Client.DeleteObject(removeCtx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(temp)}); err != nil {
+			logger.Warn("can't remove the temporary object", "key", temp, "error", s.wrapError(temp, err))
+		}
+	}()
+	if err := s.Copy(ctx, s, temp, s3Key, flags.S3PartSize); err != nil {
+		return fmt.Errorf("copy the rewritten archive %s over it: %w", temp, err)
+	}
+	return nil
+}
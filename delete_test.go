@@ -0,0 +1,96 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDeleteMembers(t *testing.T) {
+	data := newTestTar(t, tarFile{"a", "1"}, tarFile{"dir/b", "22"}, tarFile{"dir/c", string(bytes.Repeat([]byte("x"), blockSize))}, tarFile{"d", "4444"})
+
+	tests := []struct {
+		name     string
+		members  []string
+		regex    bool
+		compress bool
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:    "File",
+			members: []string{"a"},
+			want:    []string{"dir/b=22", "dir/c=" + string(bytes.Repeat([]byte("x"), blockSize)), "d=4444"},
+		},
+		{
+			name:    "After the padded member",
+			members: []string{"dir/b"},
+			want:    []string{"a=1", "dir/c=" + string(bytes.Repeat([]byte("x"), blockSize)), "d=4444"},
+		},
+		{
+			name:     "Directory",
+			members:  []string{"dir"},
+			compress: true,
+			want:     []string{"a=1", "d=4444"},
+		},
+		{
+			name:    "Last member",
+			members: []string{"d"},
+			want:    []string{"a=1", "dir/b=22", "dir/c=" + string(bytes.Repeat([]byte("x"), blockSize))},
+		},
+		{
+			name:     "Regex",
+			members:  []string{`^(a|dir/c)$`},
+			regex:    true,
+			compress: true,
+			want:     []string{"dir/b=22", "d=4444"},
+		},
+		{
+			name:    "Not found",
+			members: []string{"a", "missing"},
+			wantErr: true,
+		},
+		{
+			name:    "No members",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := data
+			if tt.compress {
+				src = gzipBytes(t, data)
+			}
+			var dest bytes.Buffer
+			flags := DeleteFlags{Members: tt.members, Regex: tt.regex, Logger: discardLogger}
+			err := DeleteMembers(context.Background(), io.NopCloser(bytes.NewReader(src)), nopWriteCloser{&dest}, flags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeleteMembers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// the archive keeps its compression
+			if compressed := bytes.HasPrefix(dest.Bytes(), []byte{0x1f, 0x8b}); compressed != tt.compress {
+				t.Errorf("compressed = %v, want %v", compressed, tt.compress)
+			}
+			archive := dest.Bytes()
+			if !tt.compress {
+				if len(archive)%blockSize != 0 {
+					t.Errorf("the archive size %d isn't aligned", len(archive))
+				}
+				archive = gzipBytes(t, archive)
+			}
+			names, err := listNames(archive, ListFlags{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MemberDigest is the summary of an archive member to compare with the others
+type MemberDigest struct {
+	Typeflag byte
+	Size     int64
+	Mode     int64
+	Linkname string
+	// Hash is the checksum of the content, it's sha256 unless the manifest has another algorithm,
+	// it's empty if the member isn't a regular file
+	Hash string
+}
+
+// Digests collects the digests of the archive members by name
+type Digests map[string]MemberDigest
+
+// Add is a ListFunc which reads the content and adds the digest of the member,
+// the last one wins if the archive has the same member multiple times like tar
+func (d Digests) Add(header *tar.Header, content io.Reader) error {
+	return d.add(header, content, DefaultManifestChecksum)
+}
+
+func (d Digests) add(header *tar.Header, content io.Reader, alg string) error {
+	digest := MemberDigest{
+		Typeflag: header.Typeflag,
+		Size:     header.Size,
+		Mode:     header.Mode,
+		Linkname: header.Linkname,
+	}
+	if header.Typeflag == tar.TypeReg {
+		hash, err := NewChecksum(alg)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(hash, content); err != nil {
+			return err
+		}
+		digest.Hash = hex.EncodeToString(hash.Sum(nil))
+	}
+	d[strings.TrimPrefix(header.Name, "./")] = digest
+	return nil
+}
+
+// Difference is a member which is only in one of the archives or differs between them
+type Difference struct {
+	Name string
+	// Only is "a" or "b" if the member is only in that archive
+	Only string
+	// Fields are the different fields, e.g. size, mode and hash
+	Fields []string
+}
+
+func (d Difference) String() string {
+	if d.Only != "" {
+		return fmt.Sprintf("only in %s: %s", d.Only, d.Name)
+	}
+	return fmt.Sprintf("differ (%s): %s", strings.Join(d.Fields, ", "), d.Name)
+}
+
+// DiffDigests compares the members of two archives, the result is sorted by name
+func DiffDigests(a, b Digests) []Difference {
+	var diffs []Difference
+	for name, da := range a {
+		db, ok := b[name]
+		if !ok {
+			diffs = append(diffs, Difference{Name: name, Only: "a"})
+			continue
+		}
+
+		var fields []string
+		if da.Typeflag != db.Typeflag {
+			fields = append(fields, "type")
+		}
+		if da.Size != db.Size {
+			fields = append(fields, "size")
+		}
+		if da.Mode != db.Mode {
+			fields = append(fields, "mode")
+		}
+		if da.Linkname != db.Linkname {
+			fields = append(fields, "link")
+		}
+		if da.Hash != db.Hash {
+			fields = append(fields, "hash")
+		}
+		if len(fields) > 0 {
+			diffs = append(diffs, Difference{Name: name, Fields: fields})
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			diffs = append(diffs, Difference{Name: name, Only: "b"})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
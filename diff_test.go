@@ -0,0 +1,103 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffDigests(t *testing.T) {
+	a := Digests{
+		"same":      {Typeflag: tar.TypeReg, Size: 1, Mode: 0644, Hash: "x"},
+		"content":   {Typeflag: tar.TypeReg, Size: 1, Mode: 0644, Hash: "x"},
+		"mode":      {Typeflag: tar.TypeReg, Size: 1, Mode: 0644, Hash: "x"},
+		"only-in-a": {Typeflag: tar.TypeDir, Mode: 0755},
+	}
+	b := Digests{
+		"same":      {Typeflag: tar.TypeReg, Size: 1, Mode: 0644, Hash: "x"},
+		"content":   {Typeflag: tar.TypeReg, Size: 2, Mode: 0644, Hash: "y"},
+		"mode":      {Typeflag: tar.TypeReg, Size: 1, Mode: 0600, Hash: "x"},
+		"only-in-b": {Typeflag: tar.TypeSymlink, Linkname: "same"},
+	}
+
+	want := []Difference{
+		{Name: "content", Fields: []string{"size", "hash"}},
+		{Name: "mode", Fields: []string{"mode"}},
+		{Name: "only-in-a", Only: "a"},
+		{Name: "only-in-b", Only: "b"},
+	}
+	if got := DiffDigests(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffDigests() = %v, want %v", got, want)
+	}
+}
+
+func TestDigests_Add(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"./a", "b"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Size: 3, Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, "abc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	digests := Digests{}
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := digests.Add(header, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(digests) != 2 || digests["a"] != digests["b"] {
+		t.Errorf("unexpected digests %v", digests)
+	}
+	if !strings.HasPrefix(digests["a"].Hash, "ba7816bf") {
+		t.Errorf("unexpected hash %s", digests["a"].Hash)
+	}
+}
+
+func TestDiffDigests_Archives(t *testing.T) {
+	digest := func(archiver Archiver) Digests {
+		destPath := filepath.Join(t.TempDir(), "testdata.tar"+archiver.Extension())
+		file, err := os.Create(destPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Compress(context.Background(), file, CompressFlags{Archiver: archiver}, "testdata"); err != nil {
+			t.Fatal(err)
+		}
+
+		source, err := os.Open(destPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests := Digests{}
+		if err := List(context.Background(), source, ListFlags{Archiver: archiver}, digests.Add); err != nil {
+			t.Fatal(err)
+		}
+		return digests
+	}
+
+	if diffs := DiffDigests(digest(GZipArchiver{Level: 1}), digest(ZstdArchiver{Level: 3})); len(diffs) != 0 {
+		t.Errorf("archives should be the same, got %v", diffs)
+	}
+}
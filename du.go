@@ -0,0 +1,60 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DiskUsage sums the sizes of the regular files by the directories of the archive up to the Depth
+type DiskUsage struct {
+	// Depth is the number of the leading directories to group by
+	Depth int
+	Sizes map[string]int64
+	Total int64
+}
+
+type UsageEntry struct {
+	Path string
+	Size int64
+}
+
+func NewDiskUsage(depth int) *DiskUsage {
+	return &DiskUsage{Depth: depth, Sizes: make(map[string]int64)}
+}
+
+// Add is a ListFunc which adds the size of the entry to its leading directories like du,
+// the files in the root are only counted in the total
+func (d *DiskUsage) Add(header *tar.Header, _ io.Reader) error {
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	d.Total += header.Size
+	dir := path.Dir(strings.Trim(path.Clean("/"+header.Name), "/"))
+	if dir == "." {
+		return nil
+	}
+	parts := strings.Split(dir, "/")
+	for i := 1; i <= len(parts) && i <= d.Depth; i++ {
+		d.Sizes[strings.Join(parts[:i], "/")] += header.Size
+	}
+	return nil
+}
+
+// Entries returns the directories sorted by the size in descending order
+func (d *DiskUsage) Entries() []UsageEntry {
+	entries := make([]UsageEntry, 0, len(d.Sizes))
+	for p, size := range d.Sizes {
+		entries = append(entries, UsageEntry{Path: p, Size: size})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Size != entries[j].Size {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
@@ -0,0 +1,52 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"reflect"
+	"testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+	headers := []*tar.Header{
+		{Name: "./README.md", Typeflag: tar.TypeReg, Size: 1},
+		{Name: "data/", Typeflag: tar.TypeDir},
+		{Name: "data/a.bin", Typeflag: tar.TypeReg, Size: 10},
+		{Name: "data/logs/1.log", Typeflag: tar.TypeReg, Size: 20},
+		{Name: "data/logs/2023/2.log", Typeflag: tar.TypeReg, Size: 30},
+		{Name: "etc/nginx/nginx.conf", Typeflag: tar.TypeReg, Size: 5},
+		{Name: "etc/link", Typeflag: tar.TypeSymlink, Linkname: "nginx"},
+	}
+
+	tests := []struct {
+		name  string
+		depth int
+		want  []UsageEntry
+	}{
+		{
+			name:  "Depth 1",
+			depth: 1,
+			want:  []UsageEntry{{"data", 60}, {"etc", 5}},
+		},
+		{
+			name:  "Depth 2",
+			depth: 2,
+			want:  []UsageEntry{{"data", 60}, {"data/logs", 50}, {"etc", 5}, {"etc/nginx", 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			du := NewDiskUsage(tt.depth)
+			for _, header := range headers {
+				if err := du.Add(header, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := du.Entries(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Entries() = %v, want %v", got, tt.want)
+			}
+			if du.Total != 66 {
+				t.Errorf("Total = %d, want 66", du.Total)
+			}
+		})
+	}
+}
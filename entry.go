@@ -0,0 +1,73 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// Entry is the member whose content is read from the reader instead of the file, e.g. the generated config
+// from the stdin, it's owned by root unless the owner is overridden
+type Entry struct {
+	Name string
+	// Mode is the permission bits, DefaultFilePerm is used if it's 0
+	Mode int64
+	// ModTime is the current time if it's zero
+	ModTime time.Time
+	Content io.Reader
+}
+
+// writeEntry writes the entry as a regular file, the content is buffered in the memory for the size
+func writeEntry(tw *tar.Writer, entry Entry, flags CompressFlags, manifest *manifestWriter) error {
+	if isPathInvalid(entry.Name) && !flags.AbsoluteNames {
+		return fmt.Errorf("entry name %q is invalid", entry.Name)
+	}
+	var content bytes.Buffer
+	n, err := io.Copy(&content, entry.Content)
+	flags.Stats.addIn(n)
+	if err != nil {
+		return fmt.Errorf("read the content of %s: %w", entry.Name, err)
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.Name,
+		Size:     n,
+		Mode:     entry.Mode,
+		ModTime:  entry.ModTime,
+	}
+	if header.Mode == 0 {
+		header.Mode = DefaultFilePerm
+	}
+	if header.ModTime.IsZero() {
+		header.ModTime = time.Now()
+	}
+	if flags.Uid != nil {
+		header.Uid = *flags.Uid
+	}
+	if flags.Gid != nil {
+		header.Gid = *flags.Gid
+	}
+	stampRecords(header, flags.PAXRecords)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	flags.Stats.add(tar.TypeReg)
+
+	var hash hash.Hash
+	var w io.Writer = tw
+	if manifest != nil {
+		hash = manifest.hash()
+		w = io.MultiWriter(tw, hash)
+	}
+	if _, err := content.WriteTo(w); err != nil {
+		return err
+	}
+	if manifest != nil {
+		manifest.add(header, hash)
+	}
+	return nil
+}
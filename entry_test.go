@@ -0,0 +1,41 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompress_Entries(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "a"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	flags := CompressFlags{
+		Archiver: GZipArchiver{Level: 1},
+		Relative: true,
+		Logger:   discardLogger,
+		Entries:  []Entry{{Name: "etc/app.conf", Mode: 0600, Content: strings.NewReader("port=80")}},
+	}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, flags, source); err != nil {
+		t.Fatal(err)
+	}
+	names, err := listNames(buf.Bytes(), ListFlags{Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"./=", "a=content", "etc/app.conf=port=80"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	flags.Entries = []Entry{{Name: "../escape", Content: strings.NewReader("")}}
+	if err := Compress(context.Background(), nopWriteCloser{&bytes.Buffer{}}, flags, source); err == nil {
+		t.Error("Compress() error = nil, want the invalid name error")
+	}
+}
@@ -0,0 +1,115 @@
+package gotgz
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// sampleSize is the bytes of every file which are compressed to estimate the compression ratio
+const sampleSize = 64 << 10
+
+// SizeEstimate is the size of a source in the dry run, the compressed size is estimated by the samples
+type SizeEstimate struct {
+	Source string
+	// Files is the count of the regular files and Size is the sum of their sizes
+	Files     int
+	Size      int64
+	Estimated int64
+}
+
+// EstimateSources walks the sources with the exclusion and FollowArgs like CompressSources without reading the files,
+// it returns the counts and the sizes of the files per source, the compressed sizes are not estimated
+func EstimateSources(ctx context.Context, flags CompressFlags, sources ...Source) ([]SizeEstimate, error) {
+	limiter := newScanLimiter(flags.ScanLimit)
+	estimates := make([]SizeEstimate, 0, len(sources))
+	for _, src := range sources {
+		estimate := SizeEstimate{Source: src.Path}
+		rootPath := src.Root()
+		var walkFn filepath.WalkFunc = func(absPath string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := limiter.wait(ctx); err != nil {
+				return err
+			}
+			if _, ok := excluded(flags.Exclude, rootPath, absPath); ok {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if fi.Mode().IsRegular() {
+				estimate.Files++
+				estimate.Size += fi.Size()
+			}
+			return nil
+		}
+		root := rootPath
+		if flags.FollowArgs {
+			var err error
+			if root, walkFn, err = followRoot(root, walkFn); err != nil {
+				return nil, err
+			}
+		}
+		if err := filepath.Walk(root, walkFn); err != nil {
+			return nil, err
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates, nil
+}
+
+// sizeEstimator compresses the samples of the files in a source, the ratio of them estimates the compressed size
+type sizeEstimator struct {
+	files         int
+	size, sampled int64
+	compressed    byteCounter
+	zw            io.WriteCloser
+}
+
+func newSizeEstimator(archiver Archiver) (*sizeEstimator, error) {
+	e := &sizeEstimator{}
+	zw, err := archiver.Writer(nopCloser{&e.compressed})
+	if err != nil {
+		return nil, err
+	}
+	e.zw = zw
+	return e, nil
+}
+
+func (e *sizeEstimator) add(path string, size int64) error {
+	e.files++
+	e.size += size
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	n, err := io.Copy(e.zw, io.LimitReader(file, sampleSize))
+	e.sampled += n
+	return err
+}
+
+// estimate returns the estimated compressed size
+func (e *sizeEstimator) estimate() (int64, error) {
+	if err := e.zw.Close(); err != nil {
+		return 0, err
+	}
+	if e.sampled == 0 {
+		return 0, nil
+	}
+	return int64(float64(e.size) * float64(e.compressed) / float64(e.sampled)), nil
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,64 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDryRun_Estimate(t *testing.T) {
+	source := t.TempDir()
+	for name, size := range map[string]int{"a": 1 << 20, "dir/b": 1000} {
+		path := filepath.Join(source, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, bytes.Repeat([]byte("gotgz"), size/5), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats Stats
+	flags := CompressFlags{Archiver: GZipArchiver{Level: 6}, Relative: true, DryRun: true, Stats: &stats, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{io.Discard}, flags, source); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Estimates) != 1 {
+		t.Fatalf("Estimates = %+v, want one source", stats.Estimates)
+	}
+	got := stats.Estimates[0]
+	if got.Source != source || got.Size != 1<<20/5*5+1000 {
+		t.Errorf("estimate = %+v, want the source and the total size", got)
+	}
+	// the repeated content is highly compressible
+	if got.Estimated <= 0 || got.Estimated >= got.Size/10 {
+		t.Errorf("Estimated = %d, want it much less than %d", got.Estimated, got.Size)
+	}
+}
+
+func TestEstimateSources(t *testing.T) {
+	source := t.TempDir()
+	for name, content := range map[string]string{"a": "content", "dir/b": "data", "logs/c.log": "log", "d.log": "log"} {
+		path := filepath.Join(source, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flags := CompressFlags{Exclude: []string{"logs", "*.log"}}
+	got, err := EstimateSources(context.Background(), flags, Source{Path: source}, Source{Dir: source, Path: "dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SizeEstimate{{Source: source, Files: 2, Size: 11}, {Source: "dir", Files: 1, Size: 4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EstimateSources() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package gotgz
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// the environment variables of the fault injection, they are the probabilities from 0 to 1 of the requests
+// which fail, so the retries and the resume of the uploads can be tested without a flaky network
+const (
+	// FaultUploadPartEnv fails the part uploads with 500 InternalError
+	FaultUploadPartEnv = "GOTGZ_FAULT_UPLOAD_PART"
+	// FaultThrottleEnv fails the requests with 503 SlowDown
+	FaultThrottleEnv = "GOTGZ_FAULT_THROTTLE"
+	// FaultResetEnv fails the requests with the connection reset before they are sent
+	FaultResetEnv = "GOTGZ_FAULT_RESET"
+	// FaultSeedEnv is the seed of the faults, the same seed injects the same faults for the same requests
+	FaultSeedEnv = "GOTGZ_FAULT_SEED"
+)
+
+// faults are the probabilities of the injected faults
+type faults struct {
+	uploadPart float64
+	throttle   float64
+	reset      float64
+	seed       uint64
+}
+
+// faultsFromEnv parses the GOTGZ_FAULT_* environment variables, ok is false if none of the faults is enabled
+func faultsFromEnv() (f faults, ok bool, err error) {
+	for _, p := range []struct {
+		env  string
+		rate *float64
+	}{
+		{FaultUploadPartEnv, &f.uploadPart},
+		{FaultThrottleEnv, &f.throttle},
+		{FaultResetEnv, &f.reset},
+	} {
+		value := os.Getenv(p.env)
+		if value == "" {
+			continue
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return faults{}, false, fmt.Errorf("env %s: the probability must be from 0 to 1: %q", p.env, value)
+		}
+		*p.rate = rate
+	}
+	if value := os.Getenv(FaultSeedEnv); value != "" {
+		if f.seed, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return faults{}, false, fmt.Errorf("env %s: %w", FaultSeedEnv, err)
+		}
+	} else {
+		f.seed = rand.Uint64()
+	}
+	return f, f.uploadPart > 0 || f.throttle > 0 || f.reset > 0, nil
+}
+
+// FaultOptions returns the s3 client option which injects the faults of the GOTGZ_FAULT_* environment variables,
+// it's nil if the fault injection isn't enabled, the clients of the library don't read them unless it's passed
+// to NewWithOptions, e.g. the CLI does it for the testing
+func FaultOptions() (func(*s3.Options), error) {
+	f, ok, err := faultsFromEnv()
+	if err != nil || !ok {
+		return nil, err
+	}
+	slog.Default().Warn("the s3 faults are injected", "upload-part", f.uploadPart, "throttle", f.throttle, "reset", f.reset, "seed", f.seed)
+	return func(o *s3.Options) {
+		next := o.HTTPClient
+		if next == nil {
+			next = awshttp.NewBuildableClient()
+		}
+		o.HTTPClient = &faultClient{next: next, faults: f, rand: rand.New(rand.NewPCG(f.seed, f.seed))}
+	}, nil
+}
+
+// faultClient fails the requests before they are sent to the next client, the responses are the same with s3,
+// so the failures go through the retries of the sdk
+type faultClient struct {
+	next   s3.HTTPClient
+	faults faults
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (c *faultClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	reset, throttle, uploadPart := c.rand.Float64() < c.faults.reset, c.rand.Float64() < c.faults.throttle, c.rand.Float64() < c.faults.uploadPart
+	c.mu.Unlock()
+
+	switch {
+	case reset:
+		slog.Default().Warn("inject the connection reset", "method", req.Method, "url", req.URL.Redacted())
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case throttle:
+		slog.Default().Warn("inject the throttling", "method", req.Method, "url", req.URL.Redacted())
+		closeBody(req)
+		return faultResponse(req, http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate."), nil
+	case uploadPart && isUploadPart(req):
+		slog.Default().Warn("inject the part upload failure", "method", req.Method, "url", req.URL.Redacted())
+		closeBody(req)
+		return faultResponse(req, http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."), nil
+	}
+	return c.next.Do(req)
+}
+
+// isUploadPart reports whether the request uploads a part of the multipart upload
+func isUploadPart(req *http.Request) bool {
+	query := req.URL.Query()
+	return req.Method == http.MethodPut && query.Has("partNumber") && query.Has("uploadId")
+}
+
+// closeBody closes the body of the request like the transport does
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+// faultResponse returns the s3 error response with the status and the code
+func faultResponse(req *http.Request, status int, code, message string) *http.Response {
+	body := fmt.Sprintf("<Error><Code>%s</Code><Message>%s</Message><RequestId>gotgz-fault</RequestId></Error>", code, message)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/xml"}, "X-Amz-Request-Id": []string{"gotgz-fault"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
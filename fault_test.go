@@ -0,0 +1,171 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+func TestFaultsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    faults
+		wantOk  bool
+		wantErr bool
+	}{
+		{name: "Disabled", env: map[string]string{FaultSeedEnv: "1"}, want: faults{seed: 1}},
+		{name: "Zero", env: map[string]string{FaultThrottleEnv: "0", FaultSeedEnv: "1"}, want: faults{seed: 1}},
+		{
+			name:   "Enabled",
+			env:    map[string]string{FaultUploadPartEnv: "0.5", FaultThrottleEnv: "0.1", FaultResetEnv: "1", FaultSeedEnv: "42"},
+			want:   faults{uploadPart: 0.5, throttle: 0.1, reset: 1, seed: 42},
+			wantOk: true,
+		},
+		{name: "Invalid", env: map[string]string{FaultResetEnv: "often"}, wantErr: true},
+		{name: "Out of range", env: map[string]string{FaultUploadPartEnv: "1.5"}, wantErr: true},
+		{name: "Invalid seed", env: map[string]string{FaultThrottleEnv: "1", FaultSeedEnv: "-1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{FaultUploadPartEnv, FaultThrottleEnv, FaultResetEnv, FaultSeedEnv} {
+				t.Setenv(env, tt.env[env])
+			}
+			got, ok, err := faultsFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("faultsFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("faultsFromEnv() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestFaultOptions(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Query().Has("partNumber") {
+			w.Header().Set("ETag", `"etag"`)
+		}
+	}))
+	defer server.Close()
+
+	putObject := func(client *s3.Client) error {
+		_, err := client.PutObject(context.Background(), &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a.tgz"), Body: bytes.NewReader([]byte("data"))})
+		return err
+	}
+	uploadPart := func(client *s3.Client) error {
+		_, err := client.UploadPart(context.Background(), &s3.UploadPartInput{
+			Bucket: aws.String("bucket"), Key: aws.String("a.tgz"), UploadId: aws.String("id"), PartNumber: aws.Int32(1), Body: bytes.NewReader([]byte("data")),
+		})
+		return err
+	}
+
+	tests := []struct {
+		name     string
+		env      string
+		call     func(*s3.Client) error
+		wantCode string
+		wantHits int32
+	}{
+		{name: "Disabled", call: uploadPart, wantHits: 1},
+		{name: "Upload part", env: FaultUploadPartEnv, call: uploadPart, wantCode: "InternalError"},
+		{name: "Not upload part", env: FaultUploadPartEnv, call: putObject, wantHits: 1},
+		{name: "Throttle", env: FaultThrottleEnv, call: putObject, wantCode: "SlowDown"},
+		{name: "Reset", env: FaultResetEnv, call: putObject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{FaultUploadPartEnv, FaultThrottleEnv, FaultResetEnv} {
+				value := ""
+				if env == tt.env {
+					value = "1"
+				}
+				t.Setenv(env, value)
+			}
+			hits.Store(0)
+
+			var attempts atomic.Int32
+			retryer := retry.NewStandard(func(o *retry.StandardOptions) {
+				o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) {
+					attempts.Add(1)
+					return 0, nil
+				})
+			})
+			fault, err := FaultOptions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientFns := []func(*s3.Options){func(o *s3.Options) {
+				o.BaseEndpoint = aws.String(server.URL)
+				o.UsePathStyle = true
+			}}
+			if fault != nil {
+				clientFns = append(clientFns, fault)
+			}
+			client, err := NewWithOptions(context.Background(), "bucket", []func(*config.LoadOptions) error{
+				config.WithRegion("us-east-1"),
+				config.WithCredentialsProvider(aws.AnonymousCredentials{}),
+				config.WithRetryer(func() aws.Retryer { return retryer }),
+			}, clientFns...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tt.call(client.s3Client)
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("the server got %d requests, want %d", got, tt.wantHits)
+			}
+			if tt.env == "" || tt.wantHits > 0 {
+				if err != nil {
+					t.Fatalf("the request failed: %v", err)
+				}
+				return
+			}
+
+			// the faults are retried by the sdk like the real ones
+			if got := attempts.Load(); got != 2 {
+				t.Errorf("the request is retried %d times, want 2", got)
+			}
+			if tt.wantCode == "" {
+				if !errors.Is(err, syscall.ECONNRESET) {
+					t.Errorf("the error = %v, want the connection reset", err)
+				}
+				return
+			}
+			var apiErr smithy.APIError
+			if !errors.As(err, &apiErr) || apiErr.ErrorCode() != tt.wantCode {
+				t.Errorf("the error = %v, want the api error %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestNewWithOptions_NoFaults(t *testing.T) {
+	t.Setenv(FaultResetEnv, "1")
+	client, err := NewWithOptions(context.Background(), "bucket", []func(*config.LoadOptions) error{
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(aws.AnonymousCredentials{}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the library doesn't read the environment variables of the faults
+	if _, ok := client.s3Client.Options().HTTPClient.(*faultClient); ok {
+		t.Error("the faults should not be injected without FaultOptions")
+	}
+}
@@ -0,0 +1,95 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The filters select the types of the entries to extract, so the services which ingest the user archives
+// can enforce the plain files cheaply
+const (
+	// FilterAll extracts all of the supported entries, it's the default
+	FilterAll = "all"
+	// FilterFiles only extracts the regular files and the directories
+	FilterFiles = "files"
+	// FilterNoLinks skips the symbolic links and the hard links
+	FilterNoLinks = "no-links"
+	// FilterNoSpecial skips the devices, the fifos and the other special files
+	FilterNoSpecial = "no-special"
+	// FilterDocs, FilterData and FilterScripts are the presets which only extract the directories and
+	// the regular files with the extensions of the documents, the data files and the scripts
+	FilterDocs    = "docs"
+	FilterData    = "data"
+	FilterScripts = "scripts"
+)
+
+// filterExtensions are the extensions of the regular files which are extracted by the presets
+var filterExtensions = map[string][]string{
+	FilterDocs:    {".md", ".markdown", ".rst", ".adoc", ".txt", ".pdf", ".rtf", ".odt", ".doc", ".docx", ".html", ".htm", ".epub"},
+	FilterData:    {".csv", ".tsv", ".json", ".jsonl", ".ndjson", ".xml", ".yaml", ".yml", ".toml", ".parquet", ".avro", ".orc", ".xls", ".xlsx", ".ods", ".sqlite", ".db"},
+	FilterScripts: {".sh", ".bash", ".zsh", ".fish", ".ps1", ".bat", ".cmd", ".py", ".rb", ".pl", ".php", ".js", ".mjs", ".ts", ".lua", ".tcl"},
+}
+
+// typeFilter returns the function which reports whether the entry is extracted by the filter,
+// it returns nil for FilterAll
+func typeFilter(filter string) (func(header *tar.Header) bool, error) {
+	switch filter {
+	case "", FilterAll:
+		return nil, nil
+	case FilterFiles:
+		return func(header *tar.Header) bool {
+			return header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeDir
+		}, nil
+	case FilterNoLinks:
+		return func(header *tar.Header) bool {
+			return header.Typeflag != tar.TypeSymlink && header.Typeflag != tar.TypeLink
+		}, nil
+	case FilterNoSpecial:
+		return func(header *tar.Header) bool {
+			switch header.Typeflag {
+			case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+				return true
+			default:
+				return false
+			}
+		}, nil
+	case FilterDocs, FilterData, FilterScripts:
+		extensions := filterExtensions[filter]
+		return func(header *tar.Header) bool {
+			switch header.Typeflag {
+			case tar.TypeDir:
+				return true
+			case tar.TypeReg:
+				// the extensions are matched case-insensitively, e.g. README.MD
+				return slices.Contains(extensions, strings.ToLower(path.Ext(header.Name)))
+			default:
+				return false
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid filter %q, it can be %s, %s, %s, %s, %s, %s or %s", filter,
+			FilterAll, FilterFiles, FilterNoLinks, FilterNoSpecial, FilterDocs, FilterData, FilterScripts)
+	}
+}
+
+// TimeRange selects the entries by their modification times in the headers, e.g. the files which are changed
+// in the last day before an incident, the bounds are exclusive and the zero time is unbounded
+type TimeRange struct {
+	NewerThan time.Time
+	OlderThan time.Time
+}
+
+// Contains reports whether the modification time is in the range
+func (r TimeRange) Contains(mtime time.Time) bool {
+	if !r.NewerThan.IsZero() && !mtime.After(r.NewerThan) {
+		return false
+	}
+	if !r.OlderThan.IsZero() && !mtime.Before(r.OlderThan) {
+		return false
+	}
+	return true
+}
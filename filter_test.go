@@ -0,0 +1,207 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDecompress_Filter(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "dir/symlink", Typeflag: tar.TypeSymlink, Linkname: "file", Mode: 0777},
+		{Name: "dir/hardlink", Typeflag: tar.TypeLink, Linkname: "dir/file", Mode: 0644},
+		{Name: "dir/fifo", Typeflag: tar.TypeFifo, Mode: 0644},
+		{Name: "dir/README.MD", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "dir/rows.csv", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "dir/run.sh", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "dir/link.md", Typeflag: tar.TypeSymlink, Linkname: "README.MD", Mode: 0777},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := gzipBytes(t, buf.Bytes())
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{filter: "", want: []string{"dir", "dir/README.MD", "dir/file", "dir/hardlink", "dir/link.md", "dir/rows.csv", "dir/run.sh", "dir/symlink"}},
+		{filter: FilterAll, want: []string{"dir", "dir/README.MD", "dir/file", "dir/hardlink", "dir/link.md", "dir/rows.csv", "dir/run.sh", "dir/symlink"}},
+		{filter: FilterFiles, want: []string{"dir", "dir/README.MD", "dir/file", "dir/rows.csv", "dir/run.sh"}},
+		{filter: FilterNoLinks, want: []string{"dir", "dir/README.MD", "dir/file", "dir/rows.csv", "dir/run.sh"}},
+		{filter: FilterNoSpecial, want: []string{"dir", "dir/README.MD", "dir/file", "dir/hardlink", "dir/link.md", "dir/rows.csv", "dir/run.sh", "dir/symlink"}},
+		{filter: FilterDocs, want: []string{"dir", "dir/README.MD"}},
+		{filter: FilterData, want: []string{"dir", "dir/rows.csv"}},
+		{filter: FilterScripts, want: []string{"dir", "dir/run.sh"}},
+		{filter: "images"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			dest := t.TempDir()
+			flags := DecompressFlags{Archiver: GZipArchiver{}, Filter: tt.filter, NoSameOwner: true, Logger: discardLogger}
+			err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(archive)), dest, flags)
+			if tt.want == nil {
+				if err == nil {
+					t.Error("the invalid filter is accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err = filepath.Walk(dest, func(path string, _ os.FileInfo, err error) error {
+				if rel, _ := filepath.Rel(dest, path); rel != "." {
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	var (
+		day     = time.Date(2025, 1, 30, 0, 0, 0, 0, time.UTC)
+		headers []*tar.Header
+	)
+	for i, name := range []string{"old", "incident", "new"} {
+		headers = append(headers, &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, ModTime: day.Add(time.Duration(i) * 24 * time.Hour)})
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range headers {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := gzipBytes(t, buf.Bytes())
+
+	tests := []struct {
+		name     string
+		modified TimeRange
+		want     []string
+	}{
+		{name: "Unbounded", want: []string{"incident", "new", "old"}},
+		{name: "Newer", modified: TimeRange{NewerThan: day}, want: []string{"incident", "new"}},
+		{name: "Older", modified: TimeRange{OlderThan: day.Add(24 * time.Hour)}, want: []string{"old"}},
+		{name: "Between", modified: TimeRange{NewerThan: day.Add(time.Hour), OlderThan: day.Add(47 * time.Hour)}, want: []string{"incident"}},
+		{name: "Empty", modified: TimeRange{NewerThan: day.Add(72 * time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listed []string
+			flags := ListFlags{Archiver: GZipArchiver{}, Modified: tt.modified, Logger: discardLogger}
+			err := List(context.Background(), io.NopCloser(bytes.NewReader(archive)), flags, func(header *tar.Header, _ io.Reader) error {
+				listed = append(listed, header.Name)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(listed)
+			if !reflect.DeepEqual(listed, tt.want) {
+				t.Errorf("listed %v, want %v", listed, tt.want)
+			}
+
+			dest := t.TempDir()
+			deFlags := DecompressFlags{Archiver: GZipArchiver{}, Modified: tt.modified, NoSameOwner: true, Logger: discardLogger}
+			if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(archive)), dest, deFlags); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var extracted []string
+			for _, entry := range entries {
+				extracted = append(extracted, entry.Name())
+			}
+			if !reflect.DeepEqual(extracted, tt.want) {
+				t.Errorf("extracted %v, want %v", extracted, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeRange_Occurrence(t *testing.T) {
+	day := time.Date(2025, 1, 30, 0, 0, 0, 0, time.UTC)
+	var (
+		buf     bytes.Buffer
+		headers []*tar.Header
+	)
+	tw := tar.NewWriter(&buf)
+	for i := range 3 {
+		header := &tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: 1, ModTime: day.Add(time.Duration(i) * 24 * time.Hour)}
+		headers = append(headers, header)
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte{'0' + byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := gzipBytes(t, buf.Bytes())
+
+	// the first occurrence is the first copy in the time range
+	modified := TimeRange{NewerThan: day.Add(time.Hour)}
+	want := []string{"file=1"}
+	flags := ListFlags{Members: []string{"file"}, Occurrence: 1, Modified: modified}
+	got, err := listNames(archive, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+
+	var listed []string
+	toc := &TOC{Headers: headers}
+	err = toc.List(context.Background(), flags, func(header *tar.Header, _ io.Reader) error {
+		listed = append(listed, header.ModTime.Format(time.DateOnly))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2025-01-31"}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("listed from the toc %v, want %v", listed, want)
+	}
+
+	dest := t.TempDir()
+	deFlags := DecompressFlags{Archiver: GZipArchiver{}, Members: []string{"file"}, Occurrence: 1, Modified: modified, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(archive)), dest, deFlags); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "file")); err != nil || string(data) != "1" {
+		t.Errorf("extracted %q, %v, want 1", data, err)
+	}
+}
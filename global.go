@@ -0,0 +1,169 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the gotgz version, it's set by the linker flags on release
+var Version = "dev"
+
+// GlobalHeaderName is the name of the pax global header entry, it's the same with git archive
+const GlobalHeaderName = "pax_global_header"
+
+// PAXGlobalPrefix is the prefix of the gotgz records in the pax global header
+const PAXGlobalPrefix = "GOTGZ."
+
+// NewGlobalHeader returns the pax global header records which describe the archive, they are the creator,
+// the hostname, the creation time and the gotgz version, the unknown ones are omitted
+func NewGlobalHeader(now time.Time) map[string]string {
+	records := map[string]string{
+		PAXGlobalPrefix + "ctime":   now.UTC().Format(time.RFC3339),
+		PAXGlobalPrefix + "version": Version,
+	}
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		records[PAXGlobalPrefix+"creator"] = current.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		records[PAXGlobalPrefix+"hostname"] = hostname
+	}
+	return records
+}
+
+// writeGlobalHeader writes the pax global header at the start of the archive, the name is GlobalHeaderName if it's empty
+func writeGlobalHeader(tw *tar.Writer, name string, records map[string]string) error {
+	if name == "" {
+		name = GlobalHeaderName
+	}
+	return tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       name,
+		PAXRecords: records,
+		Format:     tar.FormatPAX,
+	})
+}
+
+const (
+	// GlobalHeadersIgnore doesn't list or extract the pax global headers, their records are only passed to
+	// the GlobalHeader callback, it's the default
+	GlobalHeadersIgnore = "ignore"
+	// GlobalHeadersHonor applies the records of the pax global headers to the following entries like POSIX,
+	// they are mtime, atime, uid, gid, uname and gname which are not overridden by the entries
+	GlobalHeadersHonor = "honor"
+	// GlobalHeadersKeep lists and extracts the pax global headers as the regular files with the records,
+	// it's the legacy behavior of the tar implementations without the pax support
+	GlobalHeadersKeep = "keep"
+)
+
+func checkGlobalHeaders(mode string) error {
+	switch mode {
+	case "", GlobalHeadersIgnore, GlobalHeadersHonor, GlobalHeadersKeep:
+		return nil
+	default:
+		return fmt.Errorf("invalid global headers mode %q, it can be ignore, honor or keep", mode)
+	}
+}
+
+// mergeGlobalRecords adds the records of the global header to the ones of the previous global headers,
+// the empty value removes the record
+func mergeGlobalRecords(records, global map[string]string) map[string]string {
+	if records == nil {
+		records = make(map[string]string, len(global))
+	}
+	for key, value := range global {
+		if value == "" {
+			delete(records, key)
+			continue
+		}
+		records[key] = value
+	}
+	return records
+}
+
+// applyGlobalRecords applies the global records which are not in the pax records of the entry
+func applyGlobalRecords(header *tar.Header, records map[string]string) error {
+	for key, value := range records {
+		if _, ok := header.PAXRecords[key]; ok {
+			continue
+		}
+		var err error
+		switch key {
+		case "mtime":
+			header.ModTime, err = parsePAXTime(value)
+		case "atime":
+			header.AccessTime, err = parsePAXTime(value)
+		case "uid":
+			header.Uid, err = strconv.Atoi(value)
+		case "gid":
+			header.Gid, err = strconv.Atoi(value)
+		case "uname":
+			header.Uname = value
+		case "gname":
+			header.Gname = value
+		}
+		if err != nil {
+			return fmt.Errorf("invalid global record %s=%q: %w", key, value, err)
+		}
+	}
+	return nil
+}
+
+// parsePAXTime parses the decimal seconds with the optional fraction, e.g. 1700000000.5
+func parsePAXTime(value string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(value, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsec int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		if nsec, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+		if strings.HasPrefix(secs, "-") {
+			nsec = -nsec
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// globalHeaderFile converts the pax global header to the regular file of the records like the tar implementations
+// without the pax support, the content is the records in the pax format
+func globalHeaderFile(header *tar.Header) (*tar.Header, []byte) {
+	keys := make([]string, 0, len(header.PAXRecords))
+	for key := range header.PAXRecords {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data []byte
+	for _, key := range keys {
+		// the length includes itself
+		record := " " + key + "=" + header.PAXRecords[key] + "\n"
+		size := len(record) + len(strconv.Itoa(len(record)))
+		if len(strconv.Itoa(size)) > len(strconv.Itoa(len(record))) {
+			size++
+		}
+		data = append(data, strconv.Itoa(size)+record...)
+	}
+
+	name := header.Name
+	if name == "" {
+		name = GlobalHeaderName
+	}
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     DefaultFilePerm,
+		ModTime:  header.ModTime,
+		Format:   header.Format,
+	}, data
+}
@@ -0,0 +1,136 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGlobalHeader(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	records := NewGlobalHeader(time.Date(2025, 1, 30, 0, 0, 0, 0, time.UTC))
+	if got := records[PAXGlobalPrefix+"ctime"]; got != "2025-01-30T00:00:00Z" {
+		t.Errorf("ctime = %v, want 2025-01-30T00:00:00Z", got)
+	}
+	if got := records[PAXGlobalPrefix+"version"]; got != Version {
+		t.Errorf("version = %v, want %v", got, Version)
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	cflags := CompressFlags{Archiver: archiver, Relative: true, GlobalHeader: records, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		names  []string
+		global map[string]string
+	)
+	lflags := ListFlags{Archiver: archiver, GlobalHeader: func(records map[string]string) error {
+		global = records
+		return nil
+	}}
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), lflags, func(header *tar.Header, _ io.Reader) error {
+		names = append(names, header.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"./", "a.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+	if !reflect.DeepEqual(global, records) {
+		t.Errorf("global header = %v, want %v", global, records)
+	}
+
+	dest := t.TempDir()
+	dflags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, dflags); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, GlobalHeaderName)); !os.IsNotExist(err) {
+		t.Errorf("the global header is extracted as a file: %v", err)
+	}
+}
+
+func TestGlobalHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeGlobalHeader(tw, "", map[string]string{"mtime": "1700000000.5", "uname": "builder", "comment": "c"}); err != nil {
+		t.Fatal(err)
+	}
+	local := time.Unix(1600000000, 250000000)
+	for _, header := range []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeReg, Mode: 0644, Uname: "alice"},
+		// the sub-second time is written as the local mtime record which overrides the global one
+		{Name: "b", Typeflag: tar.TypeReg, Mode: 0644, ModTime: local, Format: tar.FormatPAX},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := gzipBytes(t, buf.Bytes())
+
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{mode: "", want: []string{"a 1970-01-01T00:00:00Z alice ", "b 2020-09-13T12:26:40Z  "}},
+		{mode: GlobalHeadersHonor, want: []string{"a 2023-11-14T22:13:20Z builder ", "b 2020-09-13T12:26:40Z builder "}},
+		{mode: GlobalHeadersKeep, want: []string{
+			"pax_global_header 0001-01-01T00:00:00Z  13 comment=c\n22 mtime=1700000000.5\n17 uname=builder\n",
+			"a 1970-01-01T00:00:00Z alice ", "b 2020-09-13T12:26:40Z  ",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var got []string
+			flags := ListFlags{Archiver: GZipArchiver{}, GlobalHeaders: tt.mode, Logger: discardLogger}
+			err := List(context.Background(), io.NopCloser(bytes.NewReader(archive)), flags, func(header *tar.Header, content io.Reader) error {
+				data, err := io.ReadAll(content)
+				if err != nil {
+					return err
+				}
+				got = append(got, fmt.Sprintf("%s %s %s %s", header.Name, header.ModTime.UTC().Format(time.RFC3339), header.Uname, data))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the global header is extracted as the file with the records
+	dest := t.TempDir()
+	flags := DecompressFlags{Archiver: GZipArchiver{}, GlobalHeaders: GlobalHeadersKeep, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(archive)), dest, flags); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, GlobalHeaderName)); err != nil || !bytes.Contains(data, []byte("17 uname=builder\n")) {
+		t.Errorf("global header file = %q, %v", data, err)
+	}
+
+	flags.GlobalHeaders = "merge"
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(archive)), dest, flags); err == nil {
+		t.Error("the invalid mode is accepted")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/islishude/gotgz"
+)
+
+// appendArchive appends the sources to the local archive like `tar -r`, the archive is created if it doesn't exist,
+// the compressed archive can't be appended in place, so it's written to a temporary file next to it
+// and renamed over it once it's complete, the archive is kept as is if it fails, the created archive is removed
+// if it fails unless keepPartial is set
+func appendArchive(ctx context.Context, fileName string, flags gotgz.CompressFlags, sources []gotgz.Source, keepPartial bool) error {
+	if isStream(fileName) {
+		return errors.New("can't append to the stream, the archive must be a file")
+	}
+
+	src, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		slog.Info("the archive doesn't exist, it's created", "path", fileName)
+		if flags.DryRun {
+			fileName = os.DevNull
+		}
+		dest, err := createArchive(fileName)
+		if err != nil {
+			return err
+		}
+		if err := gotgz.CompressSources(ctx, dest, flags, sources...); err != nil {
+			if !flags.DryRun && !keepPartial {
+				removePartial(fileName)
+			}
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	existing, archiver, err := gotgz.OpenAppend(src, flags.Archiver)
+	if err != nil {
+		return err
+	}
+	if c, ok := existing.(io.Closer); ok {
+		defer c.Close()
+	}
+	if archiver.Name() != flags.Archiver.Name() {
+		slog.Warn("the archive is appended with its compression", "path", fileName, "archive", archiver.Name())
+	}
+	flags.Existing, flags.Archiver = existing, archiver
+
+	return replaceArchive(fileName, fi.Mode().Perm(), flags.DryRun, func(dest io.WriteCloser) error {
+		return gotgz.CompressSources(ctx, dest, flags, sources...)
+	})
+}
+
+// replaceArchive writes the archive to a temporary file next to it and renames it over the archive with the perm
+// once it's complete, so the archive is kept as is if it fails, it's written to the null device in the dry run
+func replaceArchive(fileName string, perm os.FileMode, dryRun bool, write func(dest io.WriteCloser) error) error {
+	if dryRun {
+		discard, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return write(discard)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := write(temp); err != nil {
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Chmod(temp.Name(), perm); err != nil {
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), fileName)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/islishude/gotgz"
+)
+
+// runAuthCheck checks the credentials and the permissions of the s3 prefix before the archives are written to it
+func runAuthCheck(args []string) error {
+	var common commonFlags
+
+	fs := NewFlagSet("auth-check", "[flags] s3://bucket/prefix")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("the s3 url is required")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	ref, err := url.Parse(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !gotgz.IsS3(ref) {
+		return fmt.Errorf("%s is not an s3 url", fs.Arg(0))
+	}
+	query, err := gotgz.ParseArchiveQuery(ref.RawQuery)
+	if err != nil {
+		return err
+	}
+	client, err := NewS3Client(ctx, ref.Host, query, common.Level())
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, check := range client.CheckAccess(ctx, strings.TrimPrefix(ref.Path, "/")) {
+		status, detail := "ok", check.Detail
+		if check.Err != nil {
+			status = "FAIL"
+			if check.Optional {
+				status = "WARN"
+			} else {
+				failed++
+			}
+			if detail != "" {
+				detail += ": "
+			}
+			detail += check.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, check.Name, detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/islishude/gotgz"
+)
+
+// runCat writes the contents of the members to stdout like `tar -xOf`, the s3 archive is read with the toc cache
+// if it's enabled, so the members in the cached head or in the uncompressed archive aren't downloaded again
+func runCat(args []string) error {
+	var (
+		common   commonFlags
+		opts     Options
+		fileName string
+	)
+
+	fs := NewFlagSet("cat", "-f archive [flags] member...")
+	fs.StringVar(&fileName, "f", "", "alias to -file")
+	fs.StringVar(&fileName, "file", "", "Use archive file")
+	fs.BoolVar(&opts.TOCCache, "toc-cache", false, "cache the table of contents of the s3 archive by its etag in the user cache directory, e.g. ~/.cache/gotgz/toc")
+	registerTOCCacheFlags(fs, &opts)
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fileName == "" {
+		return errors.New("File name is empty")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("the members to cat are required")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	archiver, err := common.Archiver(fileName)
+	if err != nil {
+		return err
+	}
+	flags := gotgz.ListFlags{
+		Archiver: gotgz.AutoArchiver{Archiver: archiver},
+		Logger:   slog.Default(),
+		Members:  fs.Args(),
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	cat := func(header *tar.Header, content io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		_, err := io.Copy(stdout, content)
+		return err
+	}
+
+	source, err := url.Parse(fileName)
+	if err != nil {
+		return err
+	}
+	if !opts.TOCCache || !gotgz.IsS3(source) {
+		err = listArchive(ctx, fileName, common.Level(), flags, cat)
+	} else {
+		err = catCached(ctx, source, common.Level(), opts, flags, cat)
+	}
+	if err != nil {
+		return err
+	}
+	return stdout.Flush()
+}
+
+// catCached reads the members of the s3 archive with the toc cache
+func catCached(ctx context.Context, source *url.URL, level slog.Level, opts Options, flags gotgz.ListFlags, fn gotgz.ListFunc) error {
+	cache, err := opts.TOCCacheConfig()
+	if err != nil {
+		return err
+	}
+	query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+	if err != nil {
+		return err
+	}
+	client, err := NewS3Client(ctx, source.Host, query, level)
+	if err != nil {
+		return err
+	}
+	return client.CatCached(ctx, flags, strings.TrimPrefix(filepath.Clean(source.Path), "/"), cache, fn)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/islishude/gotgz"
+)
+
+// catenateArchive appends the members of the archives to the local archive like `tar -A`, it's created with
+// flags.Archiver if it doesn't exist, otherwise it keeps its compression and it's written to a temporary file
+// next to it and renamed over it once it's complete, the stream is written with the archives only
+func catenateArchive(ctx context.Context, fileName string, flags gotgz.CatenateFlags, archives []gotgz.CatenateSource) error {
+	src, err := os.Open(fileName)
+	if isStream(fileName) || os.IsNotExist(err) {
+		if src != nil {
+			src.Close()
+		}
+		if flags.DryRun {
+			fileName = os.DevNull
+		}
+		dest, err := createArchive(fileName)
+		if err != nil {
+			return err
+		}
+		if err := gotgz.Catenate(ctx, dest, flags, archives...); err != nil {
+			if !flags.DryRun {
+				removePartial(fileName)
+			}
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fi, err := src.Stat()
+	if err == nil {
+		flags.Archiver, err = gotgz.DetectCompression(src)
+	}
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	existing := gotgz.CatenateSource{Name: fileName, Open: func() (io.ReadCloser, error) { return os.Open(fileName) }}
+	return replaceArchive(fileName, fi.Mode().Perm(), flags.DryRun, func(dest io.WriteCloser) error {
+		return gotgz.Catenate(ctx, dest, flags, append([]gotgz.CatenateSource{existing}, archives...)...)
+	})
+}
+
+// catenateSources returns the archives to catenate, they can be the local files, the streams or the s3 urls
+func catenateSources(ctx context.Context, names []string, level slog.Level) []gotgz.CatenateSource {
+	archives := make([]gotgz.CatenateSource, len(names))
+	for i, name := range names {
+		archives[i] = gotgz.CatenateSource{Name: name, Open: func() (io.ReadCloser, error) {
+			src, _, err := openReader(ctx, name, level)
+			return src, err
+		}}
+	}
+	return archives
+}
+
+// catenateArchiver returns the compression of the new archive by its extension, the .tar archive is uncompressed,
+// and it's the archiver of -algo if the extension is unknown
+func catenateArchiver(fileName string, archiver gotgz.Archiver) gotgz.Archiver {
+	if detected, ok := gotgz.GetArchiverByName(fileName); ok {
+		return detected
+	}
+	if filepath.Ext(fileName) == ".tar" {
+		return nil
+	}
+	return archiver
+}
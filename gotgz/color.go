@@ -0,0 +1,91 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+
+	"github.com/islishude/gotgz"
+)
+
+const (
+	colorReset      = "\x1b[0m"
+	colorDir        = "\x1b[1;34m"
+	colorSymlink    = "\x1b[1;36m"
+	colorHardlink   = "\x1b[36m"
+	colorFifo       = "\x1b[33m"
+	colorDevice     = "\x1b[1;33m"
+	colorExecutable = "\x1b[1;32m"
+	colorOverwrite  = "\x1b[33m"
+	colorSkipped    = "\x1b[2m"
+)
+
+// UseColor resolves the -color flag, the auto mode enables color if the file is a terminal
+// and NO_COLOR is not set
+func UseColor(mode string, file *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		return IsTerminal(file), nil
+	default:
+		return false, fmt.Errorf("invalid color mode %q, it should be auto, always or never", mode)
+	}
+}
+
+func IsTerminal(file *os.File) bool {
+	fi, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Colorize colors the name by the entry type like ls
+func Colorize(header *tar.Header, name string) string {
+	var color string
+	switch header.Typeflag {
+	case tar.TypeDir:
+		color = colorDir
+	case tar.TypeSymlink:
+		color = colorSymlink
+	case tar.TypeLink:
+		color = colorHardlink
+	case tar.TypeFifo:
+		color = colorFifo
+	case tar.TypeChar, tar.TypeBlock:
+		color = colorDevice
+	case tar.TypeReg:
+		if header.Mode&0111 != 0 {
+			color = colorExecutable
+		}
+	}
+	if color == "" {
+		return name
+	}
+	return color + name + colorReset
+}
+
+// FormatResult formats the extracted entry of -print-entries, the overwritten and the skipped entries are marked,
+// the created entries are colored by type and the marked ones by the result
+func FormatResult(header *tar.Header, result gotgz.ExtractResult, color bool) string {
+	name := header.Name
+	switch {
+	case result == gotgz.ExtractCreated:
+		if color {
+			name = Colorize(header, name)
+		}
+		return name
+	case !color:
+		return name + " (" + string(result) + ")"
+	case result == gotgz.ExtractOverwritten:
+		return colorOverwrite + name + " (" + string(result) + ")" + colorReset
+	default:
+		return colorSkipped + name + " (" + string(result) + ")" + colorReset
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/tar"
+	"os"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestUseColor(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name    string
+		mode    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "Always", mode: "always", want: true},
+		{name: "Never", mode: "never", want: false},
+		{name: "Auto with regular file", mode: "auto", want: false},
+		{name: "Invalid", mode: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UseColor(tt.mode, file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UseColor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("UseColor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		header *tar.Header
+		want   string
+	}{
+		{
+			name:   "Directory",
+			header: &tar.Header{Typeflag: tar.TypeDir},
+			want:   colorDir + "a" + colorReset,
+		},
+		{
+			name:   "Symlink",
+			header: &tar.Header{Typeflag: tar.TypeSymlink},
+			want:   colorSymlink + "a" + colorReset,
+		},
+		{
+			name:   "Executable",
+			header: &tar.Header{Typeflag: tar.TypeReg, Mode: 0755},
+			want:   colorExecutable + "a" + colorReset,
+		},
+		{
+			name:   "Regular file",
+			header: &tar.Header{Typeflag: tar.TypeReg, Mode: 0644},
+			want:   "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Colorize(tt.header, "a"); got != tt.want {
+				t.Errorf("Colorize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatResult(t *testing.T) {
+	dir := &tar.Header{Typeflag: tar.TypeDir, Name: "a/"}
+	file := &tar.Header{Typeflag: tar.TypeReg, Name: "a/b", Mode: 0644}
+	tests := []struct {
+		name   string
+		header *tar.Header
+		result gotgz.ExtractResult
+		color  bool
+		want   string
+	}{
+		{name: "Created", header: file, result: gotgz.ExtractCreated, want: "a/b"},
+		{name: "Created with color", header: dir, result: gotgz.ExtractCreated, color: true, want: colorDir + "a/" + colorReset},
+		{name: "Overwritten", header: file, result: gotgz.ExtractOverwritten, want: "a/b (overwritten)"},
+		{name: "Overwritten with color", header: file, result: gotgz.ExtractOverwritten, color: true, want: colorOverwrite + "a/b (overwritten)" + colorReset},
+		{name: "Skipped with color", header: file, result: gotgz.ExtractSkipped, color: true, want: colorSkipped + "a/b (skipped)" + colorReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatResult(tt.header, tt.result, tt.color); got != tt.want {
+				t.Errorf("FormatResult() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
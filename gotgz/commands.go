@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/islishude/gotgz"
+)
+
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(args []string) error
+}
+
+var commands []Command
+
+func init() {
+	commands = []Command{
+		{Name: "create", Usage: "create a new archive, the same as -c", Run: runMode("create", ModeCreate)},
+		{Name: "append", Usage: "append files to an archive, the same as -r", Run: runMode("append", ModeAppend)},
+		{Name: "update", Usage: "append files which are newer than their copies in an archive, the same as -u", Run: runMode("update", ModeUpdate)},
+		{Name: "delete", Usage: "delete members from an archive, the same as -delete", Run: runMode("delete", ModeDelete)},
+		{Name: "catenate", Usage: "append the members of archives to an archive, the same as -A", Run: runMode("catenate", ModeCatenate)},
+		{Name: "extract", Usage: "extract files from an archive, the same as -x", Run: runMode("extract", ModeExtract)},
+		{Name: "list", Usage: "list the contents of an archive, the same as -t", Run: runMode("list", ModeList)},
+		{Name: "diff", Usage: "compare the members of an archive with the filesystem, the same as -d", Run: runMode("diff", ModeDiff)},
+		{Name: "diff-archives", Usage: "compare the members of two archives without extracting them", Run: runDiffArchives},
+		{Name: "recompress", Usage: "convert the compression of an archive without extracting it", Run: runConvert("recompress", gotgz.Recompress)},
+		{Name: "repack", Usage: "rewrite an archive to the canonical form which can be compared by the digest", Run: runConvert("repack", gotgz.Repack)},
+		{Name: "copy", Usage: "copy an s3 archive to another bucket or region on the server side", Run: runCopy},
+		{Name: "auth-check", Usage: "check the credentials and the permissions of an s3 prefix before writing the archives to it", Run: runAuthCheck},
+		{Name: "inspect", Usage: "print the attributes of an archive without reading it completely", Run: runInspect},
+		{Name: "verify", Usage: "verify the members of an archive with its embedded manifest", Run: runVerify},
+		{Name: "estimate", Usage: "count the files and their sizes to archive without reading them", Run: runEstimate},
+		{Name: "du", Usage: "summarize the sizes of the directories in an archive", Run: runDiskUsage},
+		{Name: "top", Usage: "list the largest files in an archive", Run: runTop},
+		{Name: "cat", Usage: "write the contents of the members of an archive to stdout", Run: runCat},
+		{Name: "mount", Usage: "mount an archive as a read-only filesystem with FUSE", Run: runMount},
+		{Name: "help", Usage: "print the commands", Run: runHelp},
+	}
+}
+
+func LookupCommand(name string) *Command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func PrintCommands(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.Name, cmd.Usage)
+	}
+	fmt.Fprintln(w, "\nUse \"gotgz <command> -h\" for the flags of a command.")
+}
+
+const envUsage = "\nThe flags can be set by the environment variables, e.g. GOTGZ_S3_PART_SIZE for -s3-part-size.\n"
+
+// NewFlagSet returns a flag set with the usage scoped to the command
+func NewFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gotgz %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+		fmt.Fprint(fs.Output(), envUsage)
+	}
+	return fs
+}
+
+func runMode(name string, mode Mode) func(args []string) error {
+	return func(args []string) error {
+		var usage string
+		switch mode {
+		case ModeCreate, ModeAppend, ModeUpdate:
+			usage = "-f archive [flags] files..."
+		case ModeExtract:
+			usage = "-f archive [flags] directory [members...]"
+		default:
+			usage = "-f archive [flags] [members...]"
+		}
+
+		var opts Options
+		fs := NewFlagSet(name, usage)
+		opts.RegisterFlags(fs, mode)
+		if err := opts.Parse(fs, args); err != nil {
+			return err
+		}
+		opts.SetMode(mode)
+		return Run(&opts)
+	}
+}
+
+func runHelp([]string) error {
+	PrintCommands(os.Stdout)
+	return nil
+}
+
+// commonFlags are the flags shared by the commands which read the archives
+type commonFlags struct {
+	Algorithm   string
+	LogLevel    string
+	Timeout     time.Duration
+	GracePeriod time.Duration
+	ConfigFile  string
+	Profile     string
+}
+
+func (c *commonFlags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&c.Algorithm, "algo", "gzip", "compression algorithm if it can't be detected by the file extension")
+	fs.StringVar(&c.LogLevel, "log-level", slog.LevelInfo.String(), "the log level, it can be debug, info, warn or error")
+	fs.DurationVar(&c.Timeout, "timeout", 0, "timeout in go time.Duration expression, if the value is less than or equal to 0, it will be ignored")
+	fs.DurationVar(&c.GracePeriod, "grace-period", time.Minute, "the time to stop gracefully after SIGINT or SIGTERM, it exits immediately after it or on the second signal, 0 means unlimited")
+	fs.StringVar(&c.ConfigFile, "config", "", "the config file, default is $XDG_CONFIG_HOME/gotgz/config.toml or ~/.config/gotgz/config.toml")
+	fs.StringVar(&c.Profile, "profile", "", "the profile in the config file")
+	registerSSOLogin(fs)
+}
+
+// Parse parses the command line with the environment variables and the config file like Options.Parse,
+// and sets the log level
+func (c *commonFlags) Parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := ApplyEnv(fs); err != nil {
+		return err
+	}
+	if err := ApplyConfigFile(fs, c.ConfigFile, c.Profile); err != nil {
+		return err
+	}
+	slog.SetLogLoggerLevel(c.Level())
+	return nil
+}
+
+func (c *commonFlags) Level() slog.Level {
+	return ParseLogLevel(c.LogLevel)
+}
+
+// Context returns the context with the timeout, it's canceled by SIGINT or SIGTERM as well
+func (c *commonFlags) Context() (context.Context, context.CancelFunc) {
+	ctx, cancel := func() (context.Context, context.CancelFunc) {
+		if c.Timeout <= 0 {
+			return context.WithCancel(context.Background())
+		}
+		return context.WithTimeout(context.Background(), c.Timeout)
+	}()
+	HandleSignals(cancel, c.GracePeriod)
+	return ctx, cancel
+}
+
+// Archiver returns the archiver by the algo and level in the s3 url query, or by the file extension,
+// or by the -algo if it can't be detected
+func (c *commonFlags) Archiver(fileName string) (gotgz.Archiver, error) {
+	path, query, err := parseArchiveRef(fileName)
+	if err != nil {
+		return nil, err
+	}
+	algo := c.Algorithm
+	if archiver, ok := gotgz.GetArchiverByName(path); ok {
+		algo = archiver.Name()
+	}
+	return gotgz.GetCompressionHandlers(query.Compression(algo))
+}
+
+// parseArchiveRef returns the path and the query of the s3 url, the local path has no query
+func parseArchiveRef(fileName string) (string, gotgz.ArchiveQuery, error) {
+	source, err := url.Parse(fileName)
+	if err != nil || !gotgz.IsS3(source) {
+		return fileName, gotgz.ArchiveQuery{}, nil
+	}
+	query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+	return source.Path, query, err
+}
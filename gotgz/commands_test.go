@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestCommonFlags_Archiver(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     gotgz.Archiver
+	}{
+		{name: "Extension", fileName: "backup.tar.zst", want: gotgz.ZstdArchiver{}},
+		{name: "Default", fileName: "backup.tar", want: gotgz.Lz4Archiver{}},
+		{name: "S3 extension", fileName: "s3://bucket/backup.tar.gz?owner=alice", want: gotgz.GZipArchiver{Level: -1}},
+		{name: "S3 query", fileName: "s3://bucket/backup.tar?algo=zstd&level=19", want: gotgz.ZstdArchiver{Level: 19}},
+		{name: "S3 level", fileName: "s3://bucket/backup.tar.gz?level=9", want: gotgz.GZipArchiver{Level: 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common := commonFlags{Algorithm: "lz4"}
+			got, err := common.Archiver(tt.fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Archiver() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
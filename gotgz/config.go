@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is parsed from a toml file, the keys are the flag names.
+//
+//	algo = "zstd?level=3"
+//
+//	[backup]
+//	exclude = [".git/**", "node_modules/**"]
+//	s3-part-size = 64
+//
+// The keys before any table are applied to all of the runs, the table is the profile selected by -profile.
+type Config map[string]map[string][]string
+
+// DefaultConfigPath returns $XDG_CONFIG_HOME/gotgz/config.toml, it's ~/.config/gotgz/config.toml
+// if XDG_CONFIG_HOME isn't set, on macOS and windows as well
+func DefaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	// the relative path is invalid in the xdg base directory specification
+	if dir == "" || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gotgz", "config.toml")
+}
+
+func LoadConfig(path string) (Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseConfig(file)
+}
+
+// ParseConfig parses the subset of toml which is enough for the flags, the tables can't be nested,
+// the key is bare or quoted, and the value can be a string, a number, a boolean or an array of them,
+// the array can span multiple lines with the comments and the trailing comma.
+func ParseConfig(r io.Reader) (Config, error) {
+	var (
+		config  = Config{"": {}}
+		section = ""
+		lineNo  = 0
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("config line %d: invalid table %q", lineNo, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == "" {
+				return nil, fmt.Errorf("config line %d: empty table name", lineNo)
+			}
+			if _, ok := config[section]; !ok {
+				config[section] = map[string][]string{}
+			}
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("config line %d: missing '='", lineNo)
+		}
+		// the multi-line array is joined until its closing bracket
+		for start := lineNo; strings.HasPrefix(strings.TrimSpace(raw), "[") && !closedArray(raw); {
+			if !scanner.Scan() {
+				return nil, fmt.Errorf("config line %d: unclosed array", start)
+			}
+			lineNo++
+			raw += " " + stripComment(scanner.Text())
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		values, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("config line %d: %w", lineNo, err)
+		}
+		config[section][key] = values
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// closedArray reports whether the closing bracket of the array is found, the brackets in the strings are ignored
+func closedArray(raw string) bool {
+	var quote rune
+	for _, c := range raw {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ']':
+			return true
+		}
+	}
+	return false
+}
+
+func parseConfigValue(raw string) ([]string, error) {
+	if strings.HasPrefix(raw, "[") {
+		if !strings.HasSuffix(raw, "]") {
+			return nil, fmt.Errorf("invalid array %q", raw)
+		}
+		var values []string
+		for _, item := range splitConfigArray(raw[1 : len(raw)-1]) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			value, err := parseConfigScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+
+	value, err := parseConfigScalar(raw)
+	if err != nil {
+		return nil, err
+	}
+	return []string{value}, nil
+}
+
+func splitConfigArray(raw string) []string {
+	var (
+		items []string
+		quote rune
+		start int
+	)
+	for i, c := range raw {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, raw[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, raw[start:])
+}
+
+func parseConfigScalar(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		return strconv.Unquote(raw)
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %q", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "":
+		return "", errors.New("missing value")
+	default:
+		// number, boolean and duration are passed to the flag as is
+		return raw, nil
+	}
+}
+
+// Apply sets the flags which are not set by the command line, the values outside of any table are applied first
+// and then the profile, the keys are applied in the sorted order, so the aliases like e and exclude are deterministic
+func (c Config) Apply(fset *flag.FlagSet, profile string) error {
+	// the aliases like -e and -exclude share the same value
+	explicit := make(map[flag.Value]bool)
+	fset.Visit(func(f *flag.Flag) {
+		explicit[f.Value] = true
+	})
+
+	sections := []string{""}
+	if profile != "" {
+		if _, ok := c[profile]; !ok {
+			return fmt.Errorf("profile %s is not found in the config", profile)
+		}
+		sections = append(sections, profile)
+	}
+
+	for _, section := range sections {
+		// the aliases are reset once, so their lists are merged
+		reset := make(map[flag.Value]bool)
+		keys := make([]string, 0, len(c[section]))
+		for key := range c[section] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			values := c[section][key]
+			f := fset.Lookup(key)
+			if f == nil {
+				// the config can be shared by the commands with different flags
+				continue
+			}
+			if explicit[f.Value] {
+				continue
+			}
+			if section != "" && !reset[f.Value] {
+				reset[f.Value] = true
+				// the profile replaces the list instead of appending to it
+				switch v := f.Value.(type) {
+				case *stringsFlag:
+					*v = nil
+				case *filesFlag:
+					*v = nil
+				}
+			}
+			for _, value := range values {
+				if err := fset.Set(key, value); err != nil {
+					return fmt.Errorf("config %s: %w", key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyConfigFile loads the config file and applies it to the flags,
+// the default config file is ignored if it doesn't exist
+func ApplyConfigFile(fset *flag.FlagSet, path, profile string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultConfigPath()
+		if path == "" {
+			return nil
+		}
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			if profile != "" {
+				return fmt.Errorf("profile %s is set but the config file %s doesn't exist", profile, path)
+			}
+			return nil
+		}
+		return err
+	}
+	return config.Apply(fset, profile)
+}
+
+// EnvName returns the environment variable for the flag, e.g. GOTGZ_S3_PART_SIZE for -s3-part-size
+func EnvName(flagName string) string {
+	return "GOTGZ_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv sets the flags which are not set by the command line from the GOTGZ_* environment variables,
+// the single letter aliases are skipped and the list is separated by the os.PathListSeparator
+func ApplyEnv(fset *flag.FlagSet) error {
+	explicit := make(map[flag.Value]bool)
+	fset.Visit(func(f *flag.Flag) {
+		explicit[f.Value] = true
+	})
+
+	var err error
+	fset.VisitAll(func(f *flag.Flag) {
+		if err != nil || len(f.Name) == 1 || explicit[f.Value] {
+			return
+		}
+		value, ok := os.LookupEnv(EnvName(f.Name))
+		if !ok {
+			return
+		}
+
+		values := []string{value}
+		if _, ok := f.Value.(*stringsFlag); ok {
+			values = filepath.SplitList(value)
+		}
+		for _, v := range values {
+			if err = fset.Set(f.Name, v); err != nil {
+				err = fmt.Errorf("env %s: %w", EnvName(f.Name), err)
+				return
+			}
+		}
+	})
+	return err
+}
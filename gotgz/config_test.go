@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name:  "Empty",
+			input: "",
+			want:  Config{"": {}},
+		},
+		{
+			name: "Profiles",
+			input: `
+# the default values
+algo = "zstd?level=3" # inline comment
+relative = true
+
+[backup]
+exclude = [".git/**", 'node_modules/**', "a#b"]
+s3-part-size = 64
+`,
+			want: Config{
+				"": {"algo": {"zstd?level=3"}, "relative": {"true"}},
+				"backup": {
+					"exclude":      {".git/**", "node_modules/**", "a#b"},
+					"s3-part-size": {"64"},
+				},
+			},
+		},
+		{
+			name: "Multi-line array",
+			input: `
+exclude = [
+  ".git/**", # the repository
+  "a]b",
+  'node_modules/**',
+]
+algo = "zstd"
+`,
+			want: Config{"": {"exclude": {".git/**", "a]b", "node_modules/**"}, "algo": {"zstd"}}},
+		},
+		{
+			name:    "Unclosed array",
+			input:   "exclude = [\n\".git/**\",\n",
+			wantErr: true,
+		},
+		{
+			name:    "Missing equal sign",
+			input:   "algo zstd",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid table",
+			input:   "[backup",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid string",
+			input:   `algo = "zstd`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConfig(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	config := Config{
+		"": {"algo": {"zstd"}, "relative": {"true"}, "exclude": {"*.log"}},
+		"backup": {
+			"exclude":      {".git/**", "node_modules/**"},
+			"s3-part-size": {"64"},
+		},
+		"aliases": {"e": {"a"}, "exclude": {"b"}},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		profile string
+		want    Options
+		wantErr bool
+	}{
+		{
+			name: "Default values",
+			args: []string{},
+			want: Options{Algorithm: "zstd", Relative: true, Excludes: stringsFlag{"*.log"}, S3PartSize: 10},
+		},
+		{
+			name:    "Profile",
+			args:    []string{"-profile", "backup"},
+			profile: "backup",
+			want:    Options{Algorithm: "zstd", Relative: true, Excludes: stringsFlag{".git/**", "node_modules/**"}, S3PartSize: 64},
+		},
+		{
+			name:    "Flag takes precedence",
+			args:    []string{"-algo", "lz4", "-e", "tmp/**", "-s3-part-size", "32"},
+			profile: "backup",
+			want:    Options{Algorithm: "lz4", Relative: true, Excludes: stringsFlag{"tmp/**"}, S3PartSize: 32},
+		},
+		{
+			name:    "Aliases in profile",
+			args:    []string{},
+			profile: "aliases",
+			want:    Options{Algorithm: "zstd", Relative: true, Excludes: stringsFlag{"a", "b"}, S3PartSize: 10},
+		},
+		{
+			name:    "Unknown profile",
+			args:    []string{},
+			profile: "unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			fs := flag.NewFlagSet(tt.name, flag.ContinueOnError)
+			opts.RegisterFlags(fs, ModeCreate)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := config.Apply(fs, tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if opts.Algorithm != tt.want.Algorithm || opts.Relative != tt.want.Relative ||
+				opts.S3PartSize != tt.want.S3PartSize || !reflect.DeepEqual(opts.Excludes, tt.want.Excludes) {
+				t.Errorf("Apply() = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	if got, want := DefaultConfigPath(), filepath.Join(home, "xdg", "gotgz", "config.toml"); got != want {
+		t.Errorf("DefaultConfigPath() = %s, want %s", got, want)
+	}
+	for _, xdg := range []string{"", "relative"} {
+		t.Setenv("XDG_CONFIG_HOME", xdg)
+		if got, want := DefaultConfigPath(), filepath.Join(home, ".config", "gotgz", "config.toml"); got != want {
+			t.Errorf("DefaultConfigPath() with %q = %s, want %s", xdg, got, want)
+		}
+	}
+}
+
+func TestOptions_ParseEnv(t *testing.T) {
+	t.Setenv("GOTGZ_ALGO", "lz4")
+	t.Setenv("GOTGZ_S3_PART_SIZE", "32")
+	t.Setenv("GOTGZ_EXCLUDE", ".git/**"+string(filepath.ListSeparator)+"*.log")
+	t.Setenv("GOTGZ_RELATIVE", "true")
+	t.Setenv("GOTGZ_CONFIG", filepath.Join(t.TempDir(), "config.toml"))
+	if err := os.WriteFile(os.Getenv("GOTGZ_CONFIG"), []byte("algo = \"zstd\"\ns3-thread = 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts Options
+	fs := flag.NewFlagSet("env", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeCreate)
+	if err := opts.Parse(fs, []string{"-s3-part-size", "64", "dir"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// flag > env > config > default
+	if opts.S3PartSize != 64 {
+		t.Errorf("S3PartSize = %d, want 64", opts.S3PartSize)
+	}
+	if opts.Algorithm != "lz4" {
+		t.Errorf("Algorithm = %s, want lz4", opts.Algorithm)
+	}
+	if opts.S3Thread != 2 {
+		t.Errorf("S3Thread = %d, want 2", opts.S3Thread)
+	}
+	if !opts.Relative {
+		t.Errorf("Relative = false, want true")
+	}
+	if want := (stringsFlag{".git/**", "*.log"}); !reflect.DeepEqual(opts.Excludes, want) {
+		t.Errorf("Excludes = %v, want %v", opts.Excludes, want)
+	}
+	if !reflect.DeepEqual(opts.Args, []string{"dir"}) {
+		t.Errorf("Args = %v", opts.Args)
+	}
+}
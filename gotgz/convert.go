@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/islishude/gotgz"
+)
+
+// Converter reads the source archive and writes the output, e.g. gotgz.Recompress and gotgz.Repack
+type Converter func(ctx context.Context, src io.ReadCloser, dest io.WriteCloser, flags gotgz.RecompressFlags) error
+
+// runConvert runs the converter by streaming, the source and the output can be s3
+func runConvert(name string, convert Converter) func(args []string) error {
+	return func(args []string) error {
+		var (
+			common                   commonFlags
+			input, output, to, level string
+			keepPartial              bool
+			flags                    gotgz.RecompressFlags
+		)
+
+		fs := NewFlagSet(name, "-f archive [-to algo] -o output")
+		fs.StringVar(&input, "f", "", "alias to -file")
+		fs.StringVar(&input, "file", "", "the source archive")
+		fs.StringVar(&output, "o", "", "alias to -output")
+		fs.StringVar(&output, "output", "", "the output archive")
+		fs.StringVar(&to, "to", "", "compression algorithm of the output, default is detected by the output file extension")
+		fs.StringVar(&level, "compression-level", "", "compression level of the output")
+		fs.Int64Var(&flags.S3PartSize, "s3-part-size", 10, "the part size for s3 upload , the unit is MB")
+		fs.IntVar(&flags.S3Thread, "s3-thread", 5, "the concurrency for s3 upload")
+		fs.BoolVar(&keepPartial, "keep-partial", false, "keep the partially written local output if it fails or is canceled, it's removed by default")
+		common.Register(fs)
+		if err := common.Parse(fs, args); err != nil {
+			return err
+		}
+		if input == "" || output == "" {
+			return errors.New("both of -f and -o are required")
+		}
+
+		var err error
+		if flags.From, err = common.Archiver(input); err != nil {
+			return err
+		}
+		flags.From = gotgz.AutoArchiver{Archiver: flags.From}
+		if flags.To, err = resolveArchiver(output, to, level); err != nil {
+			return err
+		}
+		flags.Logger = slog.Default()
+
+		ctx, cancel := common.Context()
+		defer cancel()
+
+		src, metadata, err := openReader(ctx, input, common.Level())
+		if err != nil {
+			return err
+		}
+		flags.Metadata = metadata
+
+		dest, err := openWriter(ctx, output, common.Level(), &flags)
+		if err != nil {
+			src.Close()
+			return err
+		}
+
+		slog.Debug(name, "from", input, "to", output)
+		err = convert(ctx, src, dest, flags)
+		if err != nil && !keepPartial && !strings.HasPrefix(output, "s3://") {
+			removePartial(output)
+		}
+		return err
+	}
+}
+
+// resolveArchiver returns the archiver of the output, the algorithm is detected by the file extension if it's empty,
+// and the algo and level in the s3 url query take precedence
+func resolveArchiver(fileName, alg, level string) (gotgz.Archiver, error) {
+	path, query, err := parseArchiveRef(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if alg == "" && query.Algorithm == "" {
+		archiver, ok := gotgz.GetArchiverByName(path)
+		if !ok {
+			return nil, fmt.Errorf("can't detect the compression algorithm of %s", fileName)
+		}
+		alg = archiver.Name()
+	}
+	if level != "" {
+		alg += "?level=" + level
+	}
+	return gotgz.GetCompressionHandlers(query.Compression(alg))
+}
+
+// openReader opens the local or s3 archive, the metadata is only available for s3
+func openReader(ctx context.Context, fileName string, level slog.Level) (io.ReadCloser, map[string]string, error) {
+	source, err := url.Parse(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if gotgz.IsS3(source) {
+		query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+		client, err := NewS3Client(ctx, source.Host, query, level)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client.Reader(ctx, strings.TrimPrefix(filepath.Clean(source.Path), "/"))
+	}
+	src, err := openArchive(fileName)
+	return src, nil, err
+}
+
+// openWriter creates the local or s3 archive, the metadata in the s3 url query overrides the source's
+func openWriter(ctx context.Context, fileName string, level slog.Level, flags *gotgz.RecompressFlags) (io.WriteCloser, error) {
+	if isStream(fileName) {
+		return createArchive(fileName)
+	}
+
+	dest, err := url.Parse(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if gotgz.IsS3(dest) {
+		query, err := gotgz.ParseArchiveQuery(dest.RawQuery)
+		if err != nil {
+			return nil, err
+		}
+		if query.Metadata != nil {
+			flags.Metadata = query.Metadata
+		}
+		client, err := NewS3Client(ctx, dest.Host, query, level)
+		if err != nil {
+			return nil, err
+		}
+		return client.Writer(ctx, *flags, strings.TrimPrefix(filepath.Clean(dest.Path), "/")), nil
+	}
+
+	return createArchive(fileName)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/islishude/gotgz"
+)
+
+// runCopy copies the s3 archive to another bucket or region on the server side
+func runCopy(args []string) error {
+	var (
+		common   commonFlags
+		partSize int64
+	)
+
+	fs := NewFlagSet("copy", "[flags] s3://bucket/key s3://bucket/key")
+	fs.Int64Var(&partSize, "s3-part-size", 10, "the part size of the multipart copy of the objects larger than 5GB, the unit is MB, it's increased if the object needs more than 10000 parts")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("both of the source and the destination are required")
+	}
+	if partSize < 5 || partSize > 5*1024 {
+		return errors.New("S3 part size should be between 5MB and 5GB")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	var clients [2]gotgz.S3
+	var keys [2]string
+	for i, fileName := range fs.Args() {
+		ref, err := url.Parse(fileName)
+		if err != nil {
+			return err
+		}
+		if !gotgz.IsS3(ref) {
+			return fmt.Errorf("%s is not an s3 url, the archives are copied on the server side", fileName)
+		}
+		query, err := gotgz.ParseArchiveQuery(ref.RawQuery)
+		if err != nil {
+			return err
+		}
+		if clients[i], err = NewS3Client(ctx, ref.Host, query, common.Level()); err != nil {
+			return err
+		}
+		keys[i] = strings.TrimPrefix(filepath.Clean(ref.Path), "/")
+	}
+
+	slog.Debug("copy", "from", fs.Arg(0), "to", fs.Arg(1))
+	if err := clients[1].Copy(ctx, clients[0], keys[0], keys[1], partSize); err != nil {
+		return err
+	}
+	slog.Info("copied", "from", fs.Arg(0), "to", fs.Arg(1))
+	return nil
+}
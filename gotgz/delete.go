@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/islishude/gotgz"
+)
+
+// deleteMembers deletes the members from the local archive like `tar --delete`, the archive is rewritten
+// to a temporary file next to it and renamed over it once it's complete, the archive is kept as is if it fails
+func deleteMembers(ctx context.Context, fileName string, flags gotgz.DeleteFlags) error {
+	if isStream(fileName) {
+		return errors.New("can't delete from the stream, the archive must be a file")
+	}
+
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	fi, err := src.Stat()
+	if err != nil {
+		src.Close()
+		return err
+	}
+	return replaceArchive(fileName, fi.Mode().Perm(), flags.DryRun, func(dest io.WriteCloser) error {
+		return gotgz.DeleteMembers(ctx, src, dest, flags)
+	})
+}
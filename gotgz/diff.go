@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/islishude/gotgz"
+)
+
+// runDiffArchives compares the members of two archives without extracting them,
+// it returns an error if they differ so the exit code is not zero like diff
+func runDiffArchives(args []string) error {
+	var common commonFlags
+	fs := NewFlagSet("diff-archives", "[flags] archive-a archive-b")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("diff-archives needs two archives")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	var digests [2]gotgz.Digests
+	for i, fileName := range fs.Args() {
+		archiver, err := common.Archiver(fileName)
+		if err != nil {
+			return err
+		}
+
+		digests[i] = gotgz.Digests{}
+		flags := gotgz.ListFlags{Archiver: archiver, Logger: slog.Default()}
+		slog.Debug("read archive", "path", fileName, "archive", archiver.Name())
+		if err := listArchive(ctx, fileName, common.Level(), flags, digests[i].Add); err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+	}
+
+	diffs := gotgz.DiffDigests(digests[0], digests[1])
+	for _, diff := range diffs {
+		fmt.Fprintln(os.Stdout, diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d members differ", len(diffs))
+	}
+	slog.Info("archives are the same", "members", len(digests[0]))
+	return nil
+}
+
+// listArchive lists the local or s3 archive
+func listArchive(ctx context.Context, fileName string, level slog.Level, flags gotgz.ListFlags, fn gotgz.ListFunc) error {
+	source, err := url.Parse(fileName)
+	if err != nil {
+		return err
+	}
+
+	if gotgz.IsS3(source) {
+		query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+		if err != nil {
+			return err
+		}
+		client, err := NewS3Client(ctx, source.Host, query, level)
+		if err != nil {
+			return err
+		}
+		_, err = client.List(ctx, flags, strings.TrimPrefix(filepath.Clean(source.Path), "/"), fn)
+		return err
+	}
+
+	src, err := openArchive(fileName)
+	if err != nil {
+		return err
+	}
+	return gotgz.List(ctx, src, flags, fn)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/islishude/gotgz"
+)
+
+// runDiskUsage prints the sizes of the directories in an archive like du
+func runDiskUsage(args []string) error {
+	var (
+		common   commonFlags
+		fileName string
+		depth    int
+		human    bool
+	)
+
+	fs := NewFlagSet("du", "-f archive [flags]")
+	fs.StringVar(&fileName, "f", "", "alias to -file")
+	fs.StringVar(&fileName, "file", "", "Use archive file")
+	fs.IntVar(&depth, "depth", 1, "print the directories up to the depth")
+	fs.BoolVar(&human, "human", false, "print the sizes in the human readable format, e.g. 1.5M")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fileName == "" {
+		return errors.New("File name is empty")
+	}
+	if depth < 1 {
+		return errors.New("-depth should be greater than 0")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	archiver, err := common.Archiver(fileName)
+	if err != nil {
+		return err
+	}
+
+	du := gotgz.NewDiskUsage(depth)
+	flags := gotgz.ListFlags{Archiver: archiver, Logger: slog.Default()}
+	if err := listArchive(ctx, fileName, common.Level(), flags, du.Add); err != nil {
+		return err
+	}
+
+	format := func(size int64) string {
+		if human {
+			return HumanSize(size)
+		}
+		return fmt.Sprint(size)
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	for _, entry := range du.Entries() {
+		fmt.Fprintf(stdout, "%s\t%s\n", format(entry.Size), entry.Path)
+	}
+	fmt.Fprintf(stdout, "%s\ttotal\n", format(du.Total))
+	return nil
+}
+
+// HumanSize formats the bytes with the binary units like `du -h`
+func HumanSize(size int64) string {
+	const units = "KMGTPE"
+	if size < 1024 {
+		return fmt.Sprint(size)
+	}
+	value, unit := float64(size)/1024, 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f%c", value, units[unit])
+	}
+	return fmt.Sprintf("%.0f%c", value, units[unit])
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/islishude/gotgz"
+)
+
+// runEstimate prints the counts and the sizes of the files to archive without reading them
+func runEstimate(args []string) error {
+	var (
+		common    commonFlags
+		chdir     string
+		excludes  stringsFlag
+		scanLimit float64
+		human     bool
+		follow    bool
+	)
+
+	fs := NewFlagSet("estimate", "[flags] files...")
+	fs.StringVar(&chdir, "C", "", "alias to -directory")
+	fs.StringVar(&chdir, "directory", "", "change to the directory, it can be repeated between the files like create")
+	fs.Var(&excludes, "e", "alias to -exclude")
+	fs.Var(&excludes, "exclude", "exclude files like create, the pattern is the same with shell glob and relative to the root path")
+	fs.Float64Var(&scanLimit, "scan-limit", 0, "the max files to scan per second, 0 means unlimited")
+	fs.BoolVar(&follow, "H", false, "alias to -dereference-args")
+	fs.BoolVar(&follow, "dereference-args", false, "follow the symbolic links in the command line like create")
+	fs.BoolVar(&human, "human", false, "print the sizes in the human readable format, e.g. 1.5M")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+
+	sources, err := ParseSources(chdir, fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return errors.New("No files to estimate")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	flags := gotgz.CompressFlags{Exclude: excludes, ScanLimit: scanLimit, FollowArgs: follow}
+	estimates, err := gotgz.EstimateSources(ctx, flags, sources...)
+	if err != nil {
+		return err
+	}
+
+	format := func(size int64) string {
+		if human {
+			return HumanSize(size)
+		}
+		return fmt.Sprint(size)
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	var total gotgz.SizeEstimate
+	for _, estimate := range estimates {
+		total.Files += estimate.Files
+		total.Size += estimate.Size
+		fmt.Fprintf(stdout, "%d\t%s\t%s\n", estimate.Files, format(estimate.Size), estimate.Source)
+	}
+	fmt.Fprintf(stdout, "%d\t%s\ttotal\n", total.Files, format(total.Size))
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/islishude/gotgz"
+)
+
+// runInspect prints the attributes of an archive and the information in its head, only the head of the archive
+// is read, and the entry count is read from the cached table of contents or the manifest at the end of
+// the uncompressed archive if they are available
+func runInspect(args []string) error {
+	var (
+		common   commonFlags
+		opts     Options
+		fileName string
+	)
+
+	fs := NewFlagSet("inspect", "-f archive [flags]")
+	fs.StringVar(&fileName, "f", "", "alias to -file")
+	fs.StringVar(&fileName, "file", "", "Use archive file")
+	fs.BoolVar(&opts.TOCCache, "toc-cache", false, "count the entries of the s3 archive by its table of contents in the toc cache of list -toc-cache, the archive isn't listed if it's not cached")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fileName == "" {
+		return errors.New("File name is empty")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	archiver, err := common.Archiver(fileName)
+	if err != nil {
+		return err
+	}
+
+	var fields [][2]string
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{name, value})
+		}
+	}
+
+	var cache *gotgz.TOCCache
+	if opts.TOCCache {
+		config, err := opts.TOCCacheConfig()
+		if err != nil {
+			return err
+		}
+		cache = &config
+	}
+	source, err := inspectHead(ctx, fileName, common.Level(), cache, add)
+	if err != nil {
+		return err
+	}
+	if source.head != nil {
+		defer source.head.Close()
+	}
+	if source.size != 0 {
+		info, err := gotgz.Inspect(source.head, archiver, slog.Default())
+		if err != nil {
+			return err
+		}
+		add("compression", info.Compression)
+		add("format", info.Format)
+		add("first-entry", info.FirstEntry)
+		switch {
+		case source.toc != nil:
+			add("entries", fmt.Sprintf("%d (toc cache)", source.toc.Entries()))
+		case source.src != nil && info.Compression == gotgz.CompressionNone:
+			manifest, err := gotgz.ReadManifestAt(source.src, source.size)
+			if err != nil {
+				return err
+			}
+			if manifest != nil {
+				add("entries", fmt.Sprintf("%d (manifest)", len(manifest.Entries)))
+			}
+		}
+		if info.Label != "" {
+			add("label", info.Label)
+		}
+		for _, key := range sortedKeys(info.GlobalHeader) {
+			add("global."+key, info.GlobalHeader[key])
+		}
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	for _, field := range fields {
+		fmt.Fprintf(stdout, "%s: %s\n", field[0], field[1])
+	}
+	return nil
+}
+
+// inspectSource is the archive to inspect
+type inspectSource struct {
+	// head is the reader of the archive head, size is -1 if it's unknown, e.g. the stream
+	head io.ReadCloser
+	size int64
+	// src reads the archive at random for the manifest at its end, it's nil if the size is unknown
+	src io.ReaderAt
+	// toc is the cached table of contents of the s3 archive, it's nil if it's not cached
+	toc *gotgz.TOC
+}
+
+// inspectHead adds the attributes of the local or s3 archive and returns the reader of its head,
+// the cached table of contents of the s3 archive is looked up if the cache is set
+func inspectHead(ctx context.Context, fileName string, level slog.Level, cache *gotgz.TOCCache, add func(name, value string)) (inspectSource, error) {
+	source, err := url.Parse(fileName)
+	if err != nil {
+		return inspectSource{}, err
+	}
+
+	if !gotgz.IsS3(source) {
+		file, err := openArchive(fileName)
+		if err != nil {
+			return inspectSource{}, err
+		}
+		target := inspectSource{head: file, size: -1}
+		if f, ok := file.(*os.File); ok {
+			if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+				target.size, target.src = fi.Size(), f
+				add("size", fmt.Sprint(fi.Size()))
+				add("last-modified", fi.ModTime().Format(time.RFC3339))
+			}
+		}
+		return target, nil
+	}
+
+	query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+	if err != nil {
+		return inspectSource{}, err
+	}
+	client, err := NewS3Client(ctx, source.Host, query, level)
+	if err != nil {
+		return inspectSource{}, err
+	}
+	s3Key := strings.TrimPrefix(filepath.Clean(source.Path), "/")
+	info, err := client.Stat(ctx, s3Key)
+	if err != nil {
+		return inspectSource{}, err
+	}
+	add("size", fmt.Sprint(info.Size))
+	add("last-modified", info.LastModified.Format(time.RFC3339))
+	add("etag", info.ETag)
+	add("content-type", info.ContentType)
+	add("storage-class", info.StorageClass)
+	add("sse", info.SSE)
+	add("sse-kms-key", info.SSEKMSKeyID)
+	for _, key := range sortedKeys(info.Metadata) {
+		add("metadata."+key, info.Metadata[key])
+	}
+	if info.Size == 0 {
+		return inspectSource{}, nil
+	}
+	target := inspectSource{size: info.Size, src: s3ReaderAt{ctx: ctx, client: client, s3Key: s3Key}}
+	if cache != nil && info.ETag != "" {
+		target.toc = client.LookupTOC(s3Key, info.ETag, *cache, gotgz.ListFlags{})
+	}
+	target.head, err = client.RangeReader(ctx, s3Key, min(info.Size, gotgz.InspectSize))
+	return target, err
+}
+
+func sortedKeys(records map[string]string) []string {
+	var keys = make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
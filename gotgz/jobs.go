@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/islishude/gotgz"
+)
+
+// Job is an archive of the jobs file, the line is the archive and the sources like the command line,
+// e.g. `s3://bucket/app.tgz -C /srv app`
+type Job struct {
+	Archive string
+	Sources []gotgz.Source
+}
+
+// ParseJobs parses the lines of the jobs file, the sources are relative to the chdir unless the line has -C
+func ParseJobs(lines []string, chdir string) ([]Job, error) {
+	jobs := make([]Job, 0, len(lines))
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		sources, err := ParseSources(chdir, fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", i+1, err)
+		}
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("job %d: no files to compress to %s", i+1, fields[0])
+		}
+		jobs = append(jobs, Job{Archive: fields[0], Sources: sources})
+	}
+	return jobs, nil
+}
+
+// SplitJobs returns a job for every source with the {name} placeholder of the archive replaced by the base name
+// of the source, e.g. the per-tenant archives of /data/*, the names must be unique
+func SplitJobs(archive string, sources []gotgz.Source) ([]Job, error) {
+	jobs := make([]Job, 0, len(sources))
+	seen := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		name := filepath.Base(source.Path)
+		if archive, dir, ok := ParseNested(source); ok {
+			// the archive of the nested source is named by its directory, e.g. tar+backup.tgz//teams/a is a
+			name = path.Base(dir)
+			if dir == "" {
+				name = path.Base(archive)
+			}
+		}
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			return nil, fmt.Errorf("can't name the archive of %s, it's not under a directory", source.Path)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("the archives of the sources named %s have the same name", name)
+		}
+		seen[name] = true
+
+		// the name is a path segment of the s3 url
+		placeholder := name
+		if strings.HasPrefix(archive, "s3://") {
+			placeholder = url.PathEscape(name)
+		}
+		jobs = append(jobs, Job{Archive: strings.ReplaceAll(archive, "{name}", placeholder), Sources: []gotgz.Source{source}})
+	}
+	return jobs, nil
+}
+
+// s3Clients shares the s3 clients between the jobs of the same bucket and url query,
+// so the connections are reused instead of the new handshakes
+type s3Clients struct {
+	mu      sync.Mutex
+	level   slog.Level
+	clients map[string]gotgz.S3
+}
+
+func (c *s3Clients) get(ctx context.Context, source *url.URL, query gotgz.ArchiveQuery) (gotgz.S3, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := source.Host + "?" + source.RawQuery
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+	client, err := NewS3Client(ctx, source.Host, query, c.level)
+	if err != nil {
+		return gotgz.S3{}, err
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// runJobs creates the archives of the jobs with at most -jobs-parallel of them at the same time,
+// all of the jobs run even if some of them fail, and their counters are added to the stats
+func runJobs(ctx context.Context, opts *Options, flags gotgz.CompressFlags, stats *gotgz.Stats) error {
+	clients := &s3Clients{level: opts.Level(), clients: make(map[string]gotgz.S3)}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, max(opts.JobsParallel, 1))
+	for _, job := range opts.jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(job Job) {
+			defer func() { <-sem; wg.Done() }()
+
+			// the counters and the checksum are per job, since they aren't safe for the concurrent use
+			var jobStats gotgz.Stats
+			flags := flags
+			flags.Stats, flags.Logger = &jobStats, slog.Default().With("archive", job.Archive)
+			err := runJob(ctx, clients, opts, flags, job)
+
+			mu.Lock()
+			defer mu.Unlock()
+			addStats(stats, &jobStats)
+			if err != nil {
+				slog.Error("job failed", "archive", job.Archive, "error", err)
+				errs = append(errs, fmt.Errorf("%s: %w", job.Archive, err))
+			}
+		}(job)
+	}
+	wg.Wait()
+
+	slog.Info("jobs", "total", len(opts.jobs), "failed", len(errs))
+	return errors.Join(errs...)
+}
+
+// runJob creates the archive of the job like the create of the command line
+func runJob(ctx context.Context, clients *s3Clients, opts *Options, flags gotgz.CompressFlags, job Job) (err error) {
+	if opts.Checksum != "" {
+		if flags.Checksum, err = gotgz.NewChecksum(opts.Checksum); err != nil {
+			return err
+		}
+		defer func() {
+			if err == nil {
+				slog.Info("checksum", "archive", job.Archive, opts.Checksum, hex.EncodeToString(flags.Checksum.Sum(nil)))
+			}
+		}()
+	}
+
+	sources, nested := splitNested(ctx, job.Sources, opts.Level())
+	flags.Nested = nested
+
+	source, err := url.Parse(job.Archive)
+	if err != nil {
+		return err
+	}
+	if !gotgz.IsS3(source) {
+		if isStream(job.Archive) {
+			return errors.New("the archive of the job must be a file or an s3 url")
+		}
+		fileName := gotgz.AddTarSuffix(job.Archive, opts.FileSuffix)
+		dest, err := createArchive(fileName)
+		if err != nil {
+			return err
+		}
+		err = gotgz.CompressSources(ctx, dest, flags, sources...)
+		if err != nil && !opts.KeepPartial {
+			removePartial(fileName)
+		}
+		return err
+	}
+
+	query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+	if err != nil {
+		return err
+	}
+	flags.Metadata = query.Metadata
+	if algo := query.Compression(opts.Algorithm); algo != opts.Algorithm {
+		if flags.Archiver, err = gotgz.GetCompressionHandlers(algo); err != nil {
+			return err
+		}
+	}
+	thread, err := DerateS3Thread(jobMemory(opts), opts.S3PartSize, flags.S3Thread, flags.Archiver)
+	if err != nil {
+		return err
+	}
+	if thread != flags.S3Thread {
+		flags.Logger.Warn("s3 concurrency is reduced to fit in the max memory", "from", flags.S3Thread, "to", thread)
+		flags.S3Thread = thread
+	}
+	client, err := clients.get(ctx, source, query)
+	if err != nil {
+		return err
+	}
+	s3Path := gotgz.AddTarSuffix(strings.TrimPrefix(filepath.Clean(source.Path), "/"), opts.FileSuffix)
+	return client.UploadSources(ctx, flags, s3Path, sources...)
+}
+
+// jobMemory returns the memory budget of a job in MB, -max-memory is shared by the jobs which run at the same time
+func jobMemory(opts *Options) int64 {
+	if opts.MaxMemory <= 0 {
+		return opts.MaxMemory
+	}
+	return opts.MaxMemory / int64(max(min(opts.JobsParallel, len(opts.jobs)), 1))
+}
+
+// addStats adds the counters of the job to the total
+func addStats(total, stats *gotgz.Stats) {
+	total.Files += stats.Files
+	total.Dirs += stats.Dirs
+	total.Symlinks += stats.Symlinks
+	total.Hardlinks += stats.Hardlinks
+	total.BytesIn += stats.BytesIn
+	total.BytesOut += stats.BytesOut
+	total.MetadataFailures += stats.MetadataFailures
+	total.Warnings = append(total.Warnings, stats.Warnings...)
+	total.Estimates = append(total.Estimates, stats.Estimates...)
+}
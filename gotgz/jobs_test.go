@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestParseJobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		chdir   string
+		lines   []string
+		want    []Job
+		wantErr bool
+	}{
+		{
+			name:  "Jobs",
+			chdir: "/srv",
+			lines: []string{"a.tgz app", "s3://bucket/b.tgz -C /etc nginx"},
+			want: []Job{
+				{Archive: "a.tgz", Sources: []gotgz.Source{{Dir: "/srv", Path: "app"}}},
+				{Archive: "s3://bucket/b.tgz", Sources: []gotgz.Source{{Dir: "/etc", Path: "nginx"}}},
+			},
+		},
+		{
+			name:    "No files",
+			lines:   []string{"a.tgz app", "b.tgz"},
+			wantErr: true,
+		},
+		{
+			name:    "Missing directory",
+			lines:   []string{"a.tgz app -C"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJobs(tt.lines, tt.chdir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseJobs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseJobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitJobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive string
+		sources []gotgz.Source
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "Local",
+			archive: "backups/{name}.tgz",
+			sources: []gotgz.Source{{Path: "/data/a"}, {Dir: "/srv", Path: "b/"}},
+			want:    []string{"backups/a.tgz", "backups/b.tgz"},
+		},
+		{
+			name:    "S3",
+			archive: "s3://bucket/{name}/{name}.tar.zst",
+			sources: []gotgz.Source{{Path: "/data/a b"}},
+			want:    []string{"s3://bucket/a%20b/a%20b.tar.zst"},
+		},
+		{
+			name:    "Nested",
+			archive: "s3://bucket/{name}.tgz",
+			sources: []gotgz.Source{{Path: "tar+s3://bucket/backup.tgz//teams/a/"}, {Path: "tar+/backups/2025.tar//apps/web"}},
+			want:    []string{"s3://bucket/a.tgz", "s3://bucket/web.tgz"},
+		},
+		{
+			name:    "Same name",
+			archive: "{name}.tgz",
+			sources: []gotgz.Source{{Path: "/data/a"}, {Path: "/srv/a"}},
+			wantErr: true,
+		},
+		{
+			name:    "Current directory",
+			archive: "{name}.tgz",
+			sources: []gotgz.Source{{Dir: "/data", Path: "."}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := SplitJobs(tt.archive, tt.sources)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SplitJobs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var got []string
+			for i, job := range jobs {
+				got = append(got, job.Archive)
+				if !reflect.DeepEqual(job.Sources, tt.sources[i:i+1]) {
+					t.Errorf("sources of %s = %v, want %v", job.Archive, job.Sources, tt.sources[i:i+1])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitJobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_Jobs(t *testing.T) {
+	source := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(source, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(source, name, "file"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := t.TempDir()
+	jobs := filepath.Join(dest, "jobs.txt")
+	lines := "# the archives\n" + filepath.Join(dest, "a.tgz") + " a\n" + filepath.Join(dest, "b.tgz") + " b\n"
+	if err := os.WriteFile(jobs, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeCreate)
+	opts.SetMode(ModeCreate)
+	if err := opts.Parse(fs, []string{"-jobs", jobs, "-jobs-parallel", "2", "-C", source}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(&opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := os.Stat(filepath.Join(dest, name+".tgz")); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestJobMemory(t *testing.T) {
+	jobs := make([]Job, 3)
+	tests := []struct {
+		name string
+		opts Options
+		want int64
+	}{
+		{name: "Unlimited", opts: Options{MaxMemory: 0, JobsParallel: 4, jobs: jobs}, want: 0},
+		{name: "Parallel", opts: Options{MaxMemory: 600, JobsParallel: 2, jobs: jobs}, want: 300},
+		{name: "Fewer jobs", opts: Options{MaxMemory: 600, JobsParallel: 4, jobs: jobs}, want: 200},
+		{name: "Sequential", opts: Options{MaxMemory: 600, JobsParallel: 0, jobs: jobs}, want: 600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jobMemory(&tt.opts); got != tt.want {
+				t.Errorf("jobMemory() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
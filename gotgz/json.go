@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/islishude/gotgz"
+)
+
+// JSONEntry is the entry printed by `-json`, it's one object per line
+type JSONEntry struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Size     int64      `json:"size"`
+	Mode     string     `json:"mode,omitempty"`
+	ModTime  *time.Time `json:"mtime,omitempty"`
+	Linkname string     `json:"linkname,omitempty"`
+	Checksum string     `json:"checksum,omitempty"`
+	// Records are the pax global header records, the type is global then
+	Records map[string]string `json:"records,omitempty"`
+}
+
+// NewJSONEntry converts the header to the json entry
+func NewJSONEntry(header *tar.Header) JSONEntry {
+	return JSONEntry{
+		Name:     header.Name,
+		Type:     TypeName(header.Typeflag),
+		Size:     header.Size,
+		Mode:     header.FileInfo().Mode().String(),
+		ModTime:  &header.ModTime,
+		Linkname: header.Linkname,
+	}
+}
+
+// TypeName returns the readable name of the entry type
+func TypeName(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeReg:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeFifo:
+		return "fifo"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeXGlobalHeader:
+		return "global"
+	case gotgz.TypeGNUVolume:
+		return "volume"
+	default:
+		return "other"
+	}
+}
+
+// JSONLister prints the entries and the global header as json lines
+type JSONLister struct {
+	enc *json.Encoder
+	// Checksum is the algorithm of the regular file checksums, they are not computed if it's empty
+	Checksum string
+}
+
+func NewJSONLister(w io.Writer, checksum string) *JSONLister {
+	return &JSONLister{enc: json.NewEncoder(w), Checksum: checksum}
+}
+
+// Add prints the entry, it's a gotgz.ListFunc
+func (l *JSONLister) Add(header *tar.Header, content io.Reader) error {
+	entry := NewJSONEntry(header)
+	if l.Checksum != "" && header.Typeflag == tar.TypeReg {
+		var err error
+		if entry.Checksum, err = gotgz.EntryChecksum(header, content, l.Checksum); err != nil {
+			return err
+		}
+	}
+	return l.enc.Encode(entry)
+}
+
+// GlobalHeader prints the records of the pax global header
+func (l *JSONLister) GlobalHeader(records map[string]string) error {
+	return l.enc.Encode(JSONEntry{Name: gotgz.GlobalHeaderName, Type: TypeName(tar.TypeXGlobalHeader), Records: records})
+}
+
+// VolumeLabel prints the volume label
+func (l *JSONLister) VolumeLabel(label string) error {
+	return l.enc.Encode(JSONEntry{Name: label, Type: TypeName(gotgz.TypeGNUVolume)})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"strconv"
+)
+
+// LongLister formats the entries like `tar -tv` of GNU tar, i.e. the permissions, the owner/group, the size,
+// the modification time and the name, the width of the owner and the size only grows, so the columns are aligned
+// without buffering the entries
+type LongLister struct {
+	// NumericOwner prints the uid and gid instead of the user and group names
+	NumericOwner bool
+	width        int
+}
+
+// longMinWidth is the initial width of the owner and the size like GNU tar
+const longMinWidth = 19
+
+// Format returns the line of the entry, the name may be colored
+func (l *LongLister) Format(header *tar.Header, name string) string {
+	owner := l.owner(header)
+	size := strconv.FormatInt(header.Size, 10)
+	switch header.Typeflag {
+	case tar.TypeChar, tar.TypeBlock:
+		size = fmt.Sprintf("%d,%d", header.Devmajor, header.Devminor)
+	case tar.TypeSymlink, tar.TypeLink, tar.TypeDir:
+		size = "0"
+	}
+	l.width = max(l.width, longMinWidth, len(owner)+1+len(size))
+
+	line := fmt.Sprintf("%s %s %*s %s %s", ModeString(header), owner, l.width-len(owner)-1, size, header.ModTime.Local().Format("2006-01-02 15:04"), name)
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		line += " -> " + header.Linkname
+	case tar.TypeLink:
+		line += " link to " + header.Linkname
+	}
+	return line
+}
+
+// owner returns user/group, the ids are used if the names are empty or NumericOwner is set
+func (l *LongLister) owner(header *tar.Header) string {
+	user, group := header.Uname, header.Gname
+	if l.NumericOwner || user == "" {
+		user = strconv.Itoa(header.Uid)
+	}
+	if l.NumericOwner || group == "" {
+		group = strconv.Itoa(header.Gid)
+	}
+	return user + "/" + group
+}
+
+// ModeString returns the type and the permissions of the entry like `ls -l`, e.g. drwxr-xr-x,
+// the hardlink is h like GNU tar
+func ModeString(header *tar.Header) string {
+	mode := []byte("-rwxrwxrwx")
+	switch header.Typeflag {
+	case tar.TypeDir:
+		mode[0] = 'd'
+	case tar.TypeSymlink:
+		mode[0] = 'l'
+	case tar.TypeLink:
+		mode[0] = 'h'
+	case tar.TypeChar:
+		mode[0] = 'c'
+	case tar.TypeBlock:
+		mode[0] = 'b'
+	case tar.TypeFifo:
+		mode[0] = 'p'
+	}
+	for i := 0; i < 9; i++ {
+		if header.Mode&(1<<(8-i)) == 0 {
+			mode[i+1] = '-'
+		}
+	}
+	// the setuid, setgid and sticky bits replace the execute bits, they are upper case without the execute bit
+	for _, special := range []struct {
+		bit   int64
+		index int
+		char  byte
+	}{{04000, 3, 's'}, {02000, 6, 's'}, {01000, 9, 't'}} {
+		if header.Mode&special.bit == 0 {
+			continue
+		}
+		if mode[special.index] == '-' {
+			mode[special.index] = special.char - 'a' + 'A'
+		} else {
+			mode[special.index] = special.char
+		}
+	}
+	return string(mode)
+}
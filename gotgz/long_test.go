@@ -0,0 +1,91 @@
+package main
+
+import (
+	"archive/tar"
+	"testing"
+	"time"
+)
+
+func TestModeString(t *testing.T) {
+	tests := []struct {
+		name   string
+		header tar.Header
+		want   string
+	}{
+		{name: "File", header: tar.Header{Typeflag: tar.TypeReg, Mode: 0644}, want: "-rw-r--r--"},
+		{name: "Directory", header: tar.Header{Typeflag: tar.TypeDir, Mode: 0755}, want: "drwxr-xr-x"},
+		{name: "Symlink", header: tar.Header{Typeflag: tar.TypeSymlink, Mode: 0777}, want: "lrwxrwxrwx"},
+		{name: "Hardlink", header: tar.Header{Typeflag: tar.TypeLink, Mode: 0600}, want: "hrw-------"},
+		{name: "Setuid", header: tar.Header{Typeflag: tar.TypeReg, Mode: 04755}, want: "-rwsr-xr-x"},
+		{name: "Setgid without execute", header: tar.Header{Typeflag: tar.TypeReg, Mode: 02644}, want: "-rw-r-Sr--"},
+		{name: "Sticky", header: tar.Header{Typeflag: tar.TypeDir, Mode: 01777}, want: "drwxrwxrwt"},
+		{name: "Fifo", header: tar.Header{Typeflag: tar.TypeFifo, Mode: 0644}, want: "prw-r--r--"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ModeString(&tt.header); got != tt.want {
+				t.Errorf("ModeString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLongLister_Format(t *testing.T) {
+	mtime := time.Date(2025, 1, 30, 19, 19, 36, 0, time.Local)
+	file := tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644, Uname: "root", Gname: "wheel", Size: 1234, ModTime: mtime}
+	tests := []struct {
+		name    string
+		numeric bool
+		headers []tar.Header
+		want    []string
+	}{
+		{
+			name:    "File",
+			headers: []tar.Header{file},
+			want:    []string{"-rw-r--r-- root/wheel     1234 2025-01-30 19:19 a.txt"},
+		},
+		{
+			name:    "Numeric owner",
+			numeric: true,
+			headers: []tar.Header{{Name: "b", Typeflag: tar.TypeReg, Mode: 0600, Uname: "root", Uid: 1000, Gid: 100, ModTime: mtime}},
+			want:    []string{"-rw------- 1000/100          0 2025-01-30 19:19 b"},
+		},
+		{
+			name: "Links",
+			headers: []tar.Header{
+				{Name: "l", Typeflag: tar.TypeSymlink, Mode: 0777, Linkname: "a.txt", ModTime: mtime},
+				{Name: "h", Typeflag: tar.TypeLink, Mode: 0644, Linkname: "a.txt", ModTime: mtime},
+			},
+			want: []string{
+				"lrwxrwxrwx 0/0               0 2025-01-30 19:19 l -> a.txt",
+				"hrw-r--r-- 0/0               0 2025-01-30 19:19 h link to a.txt",
+			},
+		},
+		{
+			name: "Growing width",
+			headers: []tar.Header{
+				{Name: "big", Typeflag: tar.TypeReg, Mode: 0644, Uname: "developer", Gname: "developers", Size: 1 << 40, ModTime: mtime},
+				file,
+			},
+			want: []string{
+				"-rw-r--r-- developer/developers 1099511627776 2025-01-30 19:19 big",
+				"-rw-r--r-- root/wheel                    1234 2025-01-30 19:19 a.txt",
+			},
+		},
+		{
+			name:    "Device",
+			headers: []tar.Header{{Name: "null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3, ModTime: mtime}},
+			want:    []string{"crw-rw-rw- 0/0             1,3 2025-01-30 19:19 null"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			long := &LongLister{NumericOwner: tt.numeric}
+			for i, header := range tt.headers {
+				if got := long.Format(&header, header.Name); got != tt.want[i] {
+					t.Errorf("Format() = %q, want %q", got, tt.want[i])
+				}
+			}
+		})
+	}
+}
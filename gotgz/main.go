@@ -1,16 +1,21 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
 	"context"
+	"encoding/hex"
 	"flag"
+	"fmt"
 	"io"
+	"log"
 	"log/slog"
+	"maps"
 	"net/url"
 	"os"
-	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/islishude/gotgz"
@@ -22,180 +27,615 @@ func init() {
 }
 
 func main() {
-	var (
-		FileName string
-		Create   bool
-		Extract  bool
-
-		Timeout  time.Duration
-		LogLevel string
+	if len(os.Args) > 1 {
+		if cmd := LookupCommand(os.Args[1]); cmd != nil {
+			if err := cmd.Run(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
 
-		Relative  bool
-		Algorithm string
+	var opts Options
+	opts.RegisterFlags(flag.CommandLine, ModeTar)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [command] [flags] [files]\n\n", filepath.Base(os.Args[0]))
+		PrintCommands(flag.CommandLine.Output())
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags without command:\n")
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), envUsage)
+	}
+	if err := opts.Parse(flag.CommandLine, os.Args[1:]); err != nil {
+		faltaln(err.Error())
+	}
 
-		FileSuffix string
-		Excludes   stringsFlag
+	if err := Run(&opts); err != nil {
+		fatal(err)
+	}
+}
 
-		S3PartSize int64
-		S3Thread   int
-	)
+func Run(opts *Options) (err error) {
+	start := time.Now()
+	var stats gotgz.Stats
+	// the metrics are written even if the options are invalid, so the failed runs are alerted as well
+	defer func() {
+		if opts.MetricsTextfile == "" || validateMetricsJob(opts.MetricsJob) != nil {
+			return
+		}
+		metrics := NewMetrics(opts.MetricsJob, opts.Operation(), &stats, start, err)
+		if err := WriteMetrics(opts.MetricsTextfile, metrics); err != nil {
+			slog.Error("write the metrics", "dir", opts.MetricsTextfile, "error", err)
+		}
+	}()
 
-	var deFlags = gotgz.DecompressFlags{Logger: slog.Default()}
-	flag.StringVar(&LogLevel, "v", slog.LevelInfo.String(), "alias to -verbose")
-	flag.StringVar(&LogLevel, "verbose", slog.LevelInfo.String(), "the log level")
-	flag.StringVar(&FileName, "f", "", "alias to -file")
-	flag.StringVar(&FileName, "file", "", "Use archive file")
-	flag.BoolVar(&Create, "c", false, "alias to -create")
-	flag.BoolVar(&Create, "create", false, "create a new local archive")
-	flag.BoolVar(&Extract, "x", false, "alias to -extract")
-	flag.BoolVar(&Extract, "extract", false, "extract files from an archive")
-	flag.DurationVar(&Timeout, "timeout", 0, "timeout in go time.Duration expression, if the value is less than or equal to 0, it will be ignored")
-	flag.BoolVar(&deFlags.NoSameOwner, "no-same-owner", true, "(x mode only) Do not extract owner and group IDs.")
-	flag.BoolVar(&deFlags.NoSamePerm, "no-same-permissions", true, "(x mode only) Do not extract full permissions")
-	flag.BoolVar(&deFlags.NoOverwrite, "no-overwrite", false, "(x mode only) Do not overwrite files")
-	flag.BoolVar(&deFlags.NoSameTime, "no-same-time", true, "(x mode only) Do not extract modification time")
-	flag.IntVar(&deFlags.StripComponents, "strip-components", 0, "(x mode only) strip N leading components from file names on extraction")
-	flag.StringVar(&Algorithm, "algo", "gzip", "compression algorithm")
-	flag.BoolVar(&deFlags.DryRun, "dry-run", false, "only print the file list")
-	flag.Var(&Excludes, "e", "alias to -exclude")
-	flag.Var(&Excludes, "exclude", "(c mode only)exclude files from the tarball, the pattern is the same with shell glob, the pattern should be case-sensitive and relative to the root path")
-	flag.BoolVar(&Relative, "relative", false, "(c mode only) store file names as relative paths")
-	flag.StringVar(&FileSuffix, "suffix", "", "suffix for the archive file name, the buit-in date suffix can add current date to the file name")
-	flag.Int64Var(&S3PartSize, "s3-part-size", 10, "the part size for s3 upload , the unit is MB")
-	flag.IntVar(&S3Thread, "s3-thread", 5, "the concurrency for s3 upload")
-	flag.Parse()
+	if err := opts.ReadLists(context.Background()); err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
 
-	if FileName == "" {
-		faltaln("File name is empty")
+	slog.SetLogLoggerLevel(opts.Level())
+	if opts.NoTimings {
+		log.SetFlags(0)
+	}
+	if err := opts.SetPriority(); err != nil {
+		return err
 	}
+	defer func() {
+		if opts.Create || opts.Appending() || opts.Extract {
+			slog.Info("summary", "files", stats.Files, "dirs", stats.Dirs, "symlinks", stats.Symlinks, "hardlinks", stats.Hardlinks,
+				"bytes-in", stats.BytesIn, "bytes-out", stats.BytesOut, "metadata-failures", stats.MetadataFailures, "warnings", len(stats.Warnings))
+		}
+		if !opts.NoTimings {
+			slog.Info("Time cost:", "period", time.Since(start).String())
+		}
+	}()
 
-	if !Create && !Extract {
-		faltaln("No action :)")
+	stopProfiling, err := StartProfiling(opts.CPUProfile, opts.MemProfile, opts.TraceFile)
+	if err != nil {
+		return err
 	}
+	defer stopProfiling()
+
+	basectx, cancel := func() (context.Context, context.CancelFunc) {
+		if opts.Timeout <= 0 {
+			return context.WithCancel(context.Background())
+		}
+		return context.WithTimeout(context.Background(), opts.Timeout)
+	}()
+	defer cancel()
+	HandleSignals(cancel, opts.GracePeriod)
+
+	archives := opts.Archives()
 
-	if Create && Extract {
-		faltaln("You can't create and extract at the same time")
+	archiver, err := gotgz.GetCompressionHandlers(opts.Algorithm)
+	if err != nil {
+		return err
 	}
 
-	if Extract && len(flag.Args()) != 1 {
-		faltaln("You can't extract and have arguments")
+	// the jobs share the memory budget, every job is derated by its own archiver
+	if (opts.Create || opts.Appending()) && opts.Jobs == "" && !opts.SplitByTopDir && len(archives) > 0 && strings.HasPrefix(archives[0], "s3://") {
+		thread, err := DerateS3Thread(opts.MaxMemory, opts.S3PartSize, opts.S3Thread, archiver)
+		if err != nil {
+			return err
+		}
+		if thread != opts.S3Thread {
+			slog.Warn("s3 concurrency is reduced to fit in the max memory", "from", opts.S3Thread, "to", thread)
+			opts.S3Thread = thread
+		}
 	}
 
-	if Create && len(flag.Args()) == 0 {
-		faltaln("No files to compress")
+	ctFlags := gotgz.CompressFlags{
+		DryRun:           opts.Decompress.DryRun,
+		Relative:         opts.Relative,
+		Archiver:         archiver,
+		Exclude:          opts.Excludes,
+		Logger:           slog.Default(),
+		S3PartSize:       opts.S3PartSize,
+		S3Thread:         opts.S3Thread,
+		AbsoluteNames:    opts.AbsoluteNames,
+		Normalize:        opts.Decompress.Normalize,
+		Manifest:         opts.Manifest,
+		ManifestChecksum: opts.ManifestChecksum,
+		Dedup:            opts.Dedup,
+		NumericOwner:     opts.NumericOwner,
+		Stats:            &stats,
+		Retries:          opts.Decompress.Retries,
+		Spool:            opts.Spool,
+		ScanLimit:        opts.ScanLimit,
+		FollowArgs:       opts.FollowArgs,
+		Label:            opts.Decompress.Label,
+		Update:           opts.Update,
+		Transform:        opts.Decompress.Transform,
+	}
+	if opts.AddStdin != "" {
+		entry, err := ParseEntrySpec(opts.AddStdin, os.Stdin)
+		if err != nil {
+			return err
+		}
+		ctFlags.Entries = []gotgz.Entry{entry}
+	}
+	if opts.Owner >= 0 {
+		ctFlags.Uid = &opts.Owner
+	}
+	if opts.Group >= 0 {
+		ctFlags.Gid = &opts.Group
+	}
+	if opts.GlobalHeader {
+		ctFlags.GlobalHeader = gotgz.NewGlobalHeader(start)
+	}
+	global, records, name, err := ParsePAXOptions(opts.PAXOptions)
+	if err != nil {
+		return err
+	}
+	ctFlags.PAXRecords, ctFlags.GlobalHeaderName = records, name
+	if len(global) > 0 {
+		if ctFlags.GlobalHeader == nil {
+			ctFlags.GlobalHeader = make(map[string]string)
+		}
+		maps.Copy(ctFlags.GlobalHeader, global)
+	}
+	if opts.ScanCommand != "" {
+		ctFlags.Scanner = CommandScanner(basectx, opts.ScanCommand)
+	}
+	var verify *gotgz.FilesystemDiff
+	if opts.Verify {
+		verify = &gotgz.FilesystemDiff{Paths: make(map[string]string)}
+		ctFlags.Paths = verify.Paths
+	}
+	if opts.SplitByTopDir {
+		sources, err := opts.Sources()
+		if err != nil {
+			return err
+		}
+		if opts.jobs, err = SplitJobs(archives[0], sources); err != nil {
+			return err
+		}
+	}
+	if opts.Jobs != "" || opts.SplitByTopDir {
+		return runJobs(basectx, opts, ctFlags, &stats)
 	}
 
-	// https://docs.aws.amazon.com/AmazonS3/latest/userguide/qfacts.html
-	if S3PartSize < 5 || S3PartSize > 5*1024 {
-		faltaln("S3 part size should be between 5MB and 5GB")
+	if opts.Checksum != "" && (opts.Create || opts.Appending()) {
+		ctFlags.Checksum, err = gotgz.NewChecksum(opts.Checksum)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err == nil {
+				slog.Info("checksum", opts.Checksum, hex.EncodeToString(ctFlags.Checksum.Sum(nil)))
+			}
+		}()
 	}
 
-	slog.SetLogLoggerLevel(ParseLogLevel(LogLevel))
-	start := time.Now()
-	defer func() {
-		slog.Info("Time cost:", "period", time.Since(start).String())
-	}()
+	sources, err := opts.Sources()
+	if err != nil {
+		return err
+	}
+	sources, ctFlags.Nested = splitNested(basectx, sources, opts.Level())
+	ctFlags.SourcesFrom = opts.SourcesFrom(basectx)
 
-	basectx, cancel := func() (context.Context, context.CancelFunc) {
-		if Timeout <= 0 {
-			return context.WithCancel(context.Background())
+	deFlags := opts.Decompress
+	// the compression of the archive to read is detected by the magic bytes, e.g. the piped stdin
+	deFlags.Archiver = gotgz.AutoArchiver{Archiver: archiver, Concurrency: opts.DecompressThreads()}
+	deFlags.Members = opts.Members()
+	deFlags.AbsoluteNames = opts.AbsoluteNames
+	deFlags.Stats = &stats
+	if deFlags.Modified, err = opts.Modified(time.Now()); err != nil {
+		return err
+	}
+	if opts.Chown != "" {
+		if deFlags.Uid, deFlags.Gid, err = ParseChown(opts.Chown); err != nil {
+			return err
 		}
-		return context.WithTimeout(context.Background(), Timeout)
-	}()
-	go func() {
-		stopSig := make(chan os.Signal, 1)
-		signal.Notify(stopSig, syscall.SIGINT, syscall.SIGTERM)
-		<-stopSig
-		cancel()
-	}()
+	}
+	if opts.ExplainPolicy && opts.Extract {
+		if err := deFlags.ExplainPolicy(os.Stderr); err != nil {
+			return err
+		}
+	}
 
-	source, err := url.Parse(FileName)
+	color, err := UseColor(opts.Color, os.Stdout)
 	if err != nil {
-		faltaln(err.Error())
+		return err
 	}
 
-	archiver, err := gotgz.GetCompressionHandlers(Algorithm)
-	if err != nil {
-		faltaln(err.Error())
+	var preview *Preview
+	if opts.Preview && opts.Extract {
+		preview = NewPreview(opts.Destination())
+		deFlags.Preview = preview.Add
+	}
+	if opts.Sandbox && opts.Extract {
+		if err := opts.ApplySandbox(); err != nil {
+			return err
+		}
 	}
 
-	ctFlags := gotgz.CompressFlags{
-		DryRun:     deFlags.DryRun,
-		Relative:   Relative,
-		Archiver:   archiver,
-		Exclude:    Excludes,
+	dlFlags := gotgz.DeleteFlags{
+		Members:    opts.Members(),
+		Regex:      opts.Decompress.Regex,
+		Matching:   opts.Decompress.Matching,
+		DryRun:     opts.Decompress.DryRun,
 		Logger:     slog.Default(),
-		S3PartSize: S3PartSize,
-		S3Thread:   S3Thread,
+		S3PartSize: opts.S3PartSize,
+		S3Thread:   opts.S3Thread,
 	}
 
-	deFlags.Archiver = archiver
+	caFlags := gotgz.CatenateFlags{
+		DryRun:     opts.Decompress.DryRun,
+		Logger:     slog.Default(),
+		S3PartSize: opts.S3PartSize,
+		S3Thread:   opts.S3Thread,
+	}
 
-	if gotgz.IsS3(source) {
-		ctFlags.Metadata, err = gotgz.ParseMetadata(source.RawQuery)
+	lsFlags := gotgz.ListFlags{
+		Archiver:      deFlags.Archiver,
+		Logger:        slog.Default(),
+		Members:       opts.Members(),
+		Regex:         opts.Decompress.Regex,
+		Occurrence:    opts.Decompress.Occurrence,
+		Matching:      opts.Decompress.Matching,
+		IgnoreZeros:   opts.Decompress.IgnoreZeros,
+		Recover:       opts.Decompress.Recover,
+		FromEncoding:  opts.Decompress.FromEncoding,
+		Label:         opts.Decompress.Label,
+		GlobalHeaders: opts.Decompress.GlobalHeaders,
+		Modified:      deFlags.Modified,
+	}
+	var sumWidth int
+	if opts.Checksum != "" && opts.List {
+		hash, err := gotgz.NewChecksum(opts.Checksum)
 		if err != nil {
-			faltaln(err.Error())
+			return err
 		}
-
-		client, err := gotgz.New(basectx, source.Host)
-		if err != nil {
-			faltaln(err.Error())
+		sumWidth = hash.Size() * 2
+	}
+	var long *LongLister
+	if opts.Long {
+		long = &LongLister{NumericOwner: opts.NumericOwner}
+	}
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	printEntry := func(header *tar.Header, content io.Reader) error {
+		name := header.Name
+		if color {
+			name = Colorize(header, name)
 		}
-		// remove the leading slash
-		s3Path := gotgz.AddTarSuffix(strings.TrimPrefix(filepath.Clean(source.Path), "/"), FileSuffix)
-		switch {
-		case Create:
-			slog.Debug("s3 upload", "path", s3Path, "source", flag.Args())
-			if err := client.Upload(basectx, ctFlags, s3Path, flag.Args()...); err != nil {
-				faltaln(err.Error())
-			}
-		case Extract:
-			slog.Debug("s3 download", "path", s3Path, "dest", flag.Arg(0))
-			if _, err := client.Download(basectx, deFlags, s3Path, flag.Arg(0)); err != nil {
-				faltaln(err.Error())
+		if long != nil {
+			name = long.Format(header, name)
+		}
+		if sumWidth > 0 {
+			sum := "-"
+			if header.Typeflag == tar.TypeReg {
+				var err error
+				if sum, err = gotgz.EntryChecksum(header, content, opts.Checksum); err != nil {
+					return err
+				}
 			}
+			name = fmt.Sprintf("%-*s  %s", sumWidth, sum, name)
 		}
-		return
+		_, err := fmt.Fprintln(stdout, name)
+		return err
 	}
 
-	if FileName != "-" {
-		if filepath.Ext(FileName) != archiver.Extension() {
-			slog.Warn("File extension might be not match", "archive", archiver.Name())
-		}
-		if err := os.MkdirAll(filepath.Dir(FileName), os.ModePerm); err != nil {
-			faltaln(err.Error())
+	if opts.PrintEntries && opts.Extract {
+		deFlags.Verbose = func(header *tar.Header, _ string, result gotgz.ExtractResult) error {
+			_, err := fmt.Fprintln(stdout, FormatResult(header, result, color))
+			return err
 		}
-		FileName = gotgz.AddTarSuffix(FileName, FileSuffix)
 	}
 
+	listEntry := printEntry
+	var tree *Tree
+	var diff *gotgz.FilesystemDiff
 	switch {
-	case Create:
-		slog.Debug("create", "path", FileName, "source", flag.Args())
-		var buf io.WriteCloser
-		if FileName == "-" {
-			buf = os.Stdout
-		} else {
-			buf, err = os.Create(FileName)
+	case opts.Diff:
+		diff = &gotgz.FilesystemDiff{Dir: opts.Chdir}
+		listEntry = diff.Compare
+	case opts.Tree:
+		tree = NewTree()
+		listEntry = tree.Add
+	case opts.JSON:
+		lister := NewJSONLister(stdout, opts.Checksum)
+		listEntry, lsFlags.GlobalHeader, lsFlags.VolumeLabel = lister.Add, lister.GlobalHeader, lister.VolumeLabel
+	default:
+		// the label is the first line like tar
+		lsFlags.VolumeLabel = func(label string) error {
+			_, err := fmt.Fprintln(stdout, label)
+			return err
+		}
+	}
+
+	// newReport returns the json report of the created archive
+	newReport := func(archive string) ([]byte, error) {
+		var checksum []byte
+		if ctFlags.Checksum != nil {
+			checksum = ctFlags.Checksum.Sum(nil)
+		}
+		return NewReport(archive, opts, sources, &stats, checksum, start).Marshal()
+	}
+
+	// runArchive creates, extracts or lists the archive
+	runArchive := func(fileName string) (err error) {
+		if opts.Create && len(opts.Tee) > 0 {
+			destinations := append([]string{fileName}, opts.Tee...)
+			slog.Debug("create", "path", destinations, "source", sources)
+			if err := createTee(basectx, destinations, opts, ctFlags, sources); err != nil || !opts.UploadReport {
+				return err
+			}
+			return writeTeeReports(basectx, destinations, opts, newReport)
+		}
+
+		source, err := url.Parse(fileName)
+		if err != nil {
+			return err
+		}
+
+		if gotgz.IsS3(source) {
+			query, err := gotgz.ParseArchiveQuery(source.RawQuery)
 			if err != nil {
-				faltaln(err.Error())
+				return err
 			}
+			// the flags are copied since the query only applies to this archive
+			ctFlags, deFlags, lsFlags := ctFlags, deFlags, lsFlags
+			ctFlags.Metadata = query.Metadata
+			if algo := query.Compression(opts.Algorithm); algo != opts.Algorithm {
+				archiver, err := gotgz.GetCompressionHandlers(algo)
+				if err != nil {
+					return err
+				}
+				decompressor := gotgz.WithConcurrency(archiver, opts.DecompressThreads())
+				ctFlags.Archiver, deFlags.Archiver, lsFlags.Archiver = archiver, decompressor, decompressor
+			}
+
+			client, err := NewS3Client(basectx, source.Host, query, opts.Level())
+			if err != nil {
+				return err
+			}
+			// remove the leading slash
+			s3Path := gotgz.AddTarSuffix(strings.TrimPrefix(filepath.Clean(source.Path), "/"), opts.FileSuffix)
+			switch {
+			case opts.Create, opts.Appending():
+				slog.Debug("s3 upload", "path", s3Path, "source", sources, "operation", opts.Operation())
+				upload := client.UploadSources
+				if opts.Appending() {
+					upload = client.AppendSources
+				}
+				if err := upload(basectx, ctFlags, s3Path, sources...); err != nil {
+					return err
+				}
+				if verify != nil {
+					archive, listFlags := fmt.Sprintf("s3://%s/%s", source.Host, s3Path), gotgz.ListFlags{Archiver: lsFlags.Archiver, Logger: slog.Default()}
+					err := verifyArchive(archive, verify, func(fn gotgz.ListFunc) error {
+						_, err := client.List(basectx, listFlags, s3Path, fn)
+						return err
+					})
+					if err != nil {
+						return err
+					}
+				}
+				if opts.UploadReport {
+					report, err := newReport(fmt.Sprintf("s3://%s/%s", source.Host, s3Path))
+					if err != nil {
+						return err
+					}
+					return client.Put(basectx, s3Path+ReportSuffix, "application/json", report)
+				}
+				return nil
+			case opts.Delete:
+				slog.Debug("s3 delete", "path", s3Path, "members", dlFlags.Members)
+				return client.DeleteMembers(basectx, dlFlags, s3Path)
+			case opts.Catenate:
+				slog.Debug("s3 catenate", "path", s3Path, "archives", opts.Args)
+				caFlags := caFlags
+				caFlags.Archiver, caFlags.Metadata = ctFlags.Archiver, query.Metadata
+				if query.Algorithm == "" {
+					caFlags.Archiver = catenateArchiver(s3Path, archiver)
+				}
+				return client.Catenate(basectx, caFlags, s3Path, catenateSources(basectx, opts.Args, opts.Level())...)
+			case opts.Extract:
+				slog.Debug("s3 download", "path", s3Path, "dest", opts.Destination())
+				_, err := client.Download(basectx, deFlags, s3Path, opts.Destination())
+				return err
+			case opts.List, opts.Diff:
+				slog.Debug("s3 list", "path", s3Path)
+				// the checksums and the diff need the contents which aren't in the toc
+				if opts.TOCCache && sumWidth == 0 && diff == nil {
+					cache, err := opts.TOCCacheConfig()
+					if err != nil {
+						return err
+					}
+					return client.ListCached(basectx, lsFlags, s3Path, cache, listEntry)
+				}
+				_, err := client.List(basectx, lsFlags, s3Path, listEntry)
+				return err
+			}
+			return nil
 		}
-		if err := gotgz.Compress(basectx, buf, ctFlags, flag.Args()...); err != nil {
-			faltaln(err.Error())
+
+		if !isStream(fileName) {
+			if filepath.Ext(fileName) != archiver.Extension() {
+				slog.Warn("File extension might be not match", "archive", archiver.Name())
+			}
+			fileName = gotgz.AddTarSuffix(fileName, opts.FileSuffix)
 		}
-	case Extract:
-		slog.Debug("extract", "path", FileName, "dest", flag.Arg(0))
-		var src io.ReadCloser
-		if FileName == "-" {
-			src = os.Stdin
-		} else {
-			src, err = os.Open(FileName)
+
+		switch {
+		case opts.Create, opts.Appending():
+			slog.Debug(opts.Operation(), "path", fileName, "source", sources)
+			if opts.Appending() {
+				err = appendArchive(basectx, fileName, ctFlags, sources, opts.KeepPartial)
+			} else {
+				var buf io.WriteCloser
+				if buf, err = createArchive(fileName); err != nil {
+					return err
+				}
+				err = gotgz.CompressSources(basectx, buf, ctFlags, sources...)
+				if err != nil && !opts.KeepPartial {
+					removePartial(fileName)
+				}
+			}
+			if err == nil && verify != nil {
+				listFlags := gotgz.ListFlags{Archiver: lsFlags.Archiver, Logger: slog.Default()}
+				err = verifyArchive(fileName, verify, func(fn gotgz.ListFunc) error {
+					src, err := openArchive(fileName)
+					if err != nil {
+						return err
+					}
+					return gotgz.List(basectx, src, listFlags, fn)
+				})
+			}
+			if err != nil || !opts.UploadReport {
+				return err
+			}
+			if isStream(fileName) {
+				slog.Warn("the report isn't written for the stream", "path", fileName)
+				return nil
+			}
+			report, err := newReport(fileName)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(fileName+ReportSuffix, report, 0644)
+		case opts.Delete:
+			slog.Debug("delete", "path", fileName, "members", dlFlags.Members)
+			return deleteMembers(basectx, fileName, dlFlags)
+		case opts.Catenate:
+			slog.Debug("catenate", "path", fileName, "archives", opts.Args)
+			caFlags := caFlags
+			caFlags.Archiver = catenateArchiver(fileName, archiver)
+			return catenateArchive(basectx, fileName, caFlags, catenateSources(basectx, opts.Args, opts.Level()))
+		case opts.Extract:
+			slog.Debug("extract", "path", fileName, "dest", opts.Destination())
+			src, err := openArchive(fileName)
 			if err != nil {
-				faltaln(err.Error())
+				return err
+			}
+			deFlags := deFlags
+			if file, ok := src.(*os.File); ok {
+				if deFlags, err = gotgz.SeekResume(file, deFlags); err != nil {
+					return err
+				}
+			}
+			return gotgz.Decompress(basectx, src, opts.Destination(), deFlags)
+		case opts.List, opts.Diff:
+			slog.Debug("list", "path", fileName)
+			src, err := openArchive(fileName)
+			if err != nil {
+				return err
+			}
+			return gotgz.List(basectx, src, lsFlags, listEntry)
+		}
+		return nil
+	}
+
+	for i, fileName := range archives {
+		if len(archives) > 1 {
+			slog.Info("extract archive", "index", i+1, "total", len(archives), "path", fileName)
+			if opts.Decompress.StateFile != "" {
+				deFlags.StateFile = archiveStateFile(opts.Decompress.StateFile, fileName)
+			}
+		}
+		if err := runArchive(fileName); err != nil {
+			if len(archives) > 1 {
+				return fmt.Errorf("%s: %w", fileName, err)
 			}
+			return err
 		}
-		if err := gotgz.Decompress(basectx, src, flag.Arg(0), deFlags); err != nil {
-			faltaln(err.Error())
+	}
+	if tree != nil {
+		return tree.Print(stdout, color)
+	}
+	if diff != nil {
+		for _, difference := range diff.Differences {
+			fmt.Fprintln(stdout, difference)
 		}
+		slog.Info("diff", "members", diff.Members, "differences", len(diff.Differences))
+		return diff.Err()
+	}
+	if preview != nil {
+		return preview.Print(stdout, color)
+	}
+	if len(archives) > 1 {
+		slog.Info("extracted archives", "count", len(archives), "dest", opts.Destination())
+	}
+	return nil
+}
+
+// verifyArchive compares the members of the created archive with their files after it's read again by the list,
+// the differences are logged and the error isn't a warning like the diff since the archive can't be trusted
+func verifyArchive(archive string, verify *gotgz.FilesystemDiff, list func(fn gotgz.ListFunc) error) error {
+	if err := list(verify.Compare); err != nil {
+		return fmt.Errorf("verify %s: %w", archive, err)
+	}
+	for _, difference := range verify.Differences {
+		slog.Error("verify", "archive", archive, "difference", difference.String())
+	}
+	slog.Info("verify", "archive", archive, "members", verify.Members, "differences", len(verify.Differences))
+	if len(verify.Differences) > 0 {
+		return fmt.Errorf("verify %s: %d members differ from the files", archive, len(verify.Differences))
+	}
+	return nil
+}
+
+// openArchive opens the local archive to read, `-` is the stdin and fd://N is the inherited file descriptor
+func openArchive(fileName string) (io.ReadCloser, error) {
+	if fileName == "-" {
+		return os.Stdin, nil
+	}
+	if file, ok, err := openFD(fileName); ok {
+		return file, err
+	}
+	return os.Open(fileName)
+}
+
+// createArchive creates the local archive to write, `-` is the stdout and fd://N is the inherited file descriptor
+func createArchive(fileName string) (io.WriteCloser, error) {
+	if fileName == "-" {
+		return os.Stdout, nil
+	}
+	if file, ok, err := openFD(fileName); ok {
+		return file, err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.Create(fileName)
+}
+
+// removePartial removes the partially written local archive, the streams are kept
+func removePartial(fileName string) {
+	if isStream(fileName) {
+		return
+	}
+	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		slog.Warn("can't remove the partial archive", "path", fileName, "error", err)
+		return
+	}
+	slog.Info("removed the partial archive", "path", fileName)
+}
+
+// isStream reports whether the archive is the stdin, the stdout or a file descriptor,
+// the suffix and the file extension don't apply to them
+func isStream(fileName string) bool {
+	return fileName == "-" || strings.HasPrefix(fileName, fdScheme)
+}
+
+const fdScheme = "fd://"
+
+// openFD returns the file of the fd://N locator, it's used in the process substitution pipelines,
+// e.g. `gotgz -c -f fd://3 data 3> >(ssh host 'cat > data.tgz')`, ok is false if it's not a fd locator
+func openFD(fileName string) (file *os.File, ok bool, err error) {
+	if !strings.HasPrefix(fileName, fdScheme) {
+		return nil, false, nil
+	}
+	fd, err := strconv.ParseUint(strings.TrimPrefix(fileName, fdScheme), 10, 0)
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid file descriptor %q", fileName)
+	}
+	if file = os.NewFile(uintptr(fd), fileName); file == nil {
+		return nil, true, fmt.Errorf("invalid file descriptor %q", fileName)
 	}
+	return file, true, nil
 }
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestRun_Stdin(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, archiver := range []gotgz.Archiver{gotgz.GZipArchiver{Level: 1}, gotgz.Lz4Archiver{}, gotgz.ZstdArchiver{}} {
+		t.Run(archiver.Name(), func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdin := os.Stdin
+			os.Stdin = r
+			defer func() { os.Stdin = stdin }()
+
+			// it's the same with `ssh host cat backup.tar.zst | gotgz -x -f -`, the algo is detected by the magic bytes
+			errChan := make(chan error, 1)
+			go func() {
+				flags := gotgz.CompressFlags{Archiver: archiver, Relative: true, Logger: slog.Default()}
+				errChan <- gotgz.Compress(context.Background(), w, flags, source)
+			}()
+
+			dest := t.TempDir()
+			var opts Options
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			opts.RegisterFlags(fs, ModeTar)
+			if err := opts.Parse(fs, []string{"-x", "-f", "-", "-C", dest, "-no-same-owner"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := Run(&opts); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errChan; err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(dest, "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "content" {
+				t.Errorf("read %q, want %q", got, "content")
+			}
+		})
+	}
+}
+
+func TestRun_Stdout(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	// it's the same with `gotgz -c -f - dir | aws s3 cp - s3://bucket/a.tgz`, only the archive is written to the stdout
+	readChan := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(r)
+		readChan <- data
+	}()
+
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeTar)
+	if err := opts.Parse(fs, []string{"-c", "-f", "-", "-v", "debug", "-relative", source}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(&opts); err != nil {
+		t.Fatal(err)
+	}
+	// the stdout is closed after the archive is written, so the downstream gets EOF without waiting for the exit
+	data := <-readChan
+
+	var names []string
+	flags := gotgz.ListFlags{Archiver: gotgz.GZipArchiver{}, Logger: slog.Default()}
+	err = gotgz.List(context.Background(), io.NopCloser(bytes.NewReader(data)), flags, func(header *tar.Header, _ io.Reader) error {
+		names = append(names, header.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[1] != "file" {
+		t.Errorf("names = %v, want the directory and the file", names)
+	}
+}
+
+func TestRun_Quiet(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		// check checks the stderr
+		check func(t *testing.T, logs string)
+	}{
+		{
+			name: "Quiet",
+			args: []string{"-q"},
+			check: func(t *testing.T, logs string) {
+				if logs != "" {
+					t.Errorf("the stderr isn't empty: %q", logs)
+				}
+			},
+		},
+		{
+			name: "No timings",
+			args: []string{"-no-timings"},
+			check: func(t *testing.T, logs string) {
+				if logs == "" || strings.Contains(logs, "Time cost") {
+					t.Errorf("the stderr has the time cost: %q", logs)
+				}
+				for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+					if !strings.HasPrefix(line, "INFO ") && !strings.HasPrefix(line, "WARN ") {
+						t.Errorf("the log line has the timestamp: %q", line)
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer func() {
+				log.SetOutput(os.Stderr)
+				log.SetFlags(log.LstdFlags)
+				slog.SetLogLoggerLevel(slog.LevelInfo)
+			}()
+
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			stdout := os.Stdout
+			os.Stdout = w
+			defer func() { os.Stdout = stdout }()
+			readChan := make(chan []byte, 1)
+			go func() {
+				data, _ := io.ReadAll(r)
+				readChan <- data
+			}()
+
+			var opts Options
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			opts.RegisterFlags(fs, ModeTar)
+			if err := opts.Parse(fs, append(tt.args, "-c", "-f", "-", "-relative", source)); err != nil {
+				t.Fatal(err)
+			}
+			if err := Run(&opts); err != nil {
+				t.Fatal(err)
+			}
+
+			// nothing but the archive is written to the stdout
+			data := <-readChan
+			flags := gotgz.ListFlags{Archiver: gotgz.GZipArchiver{}, Logger: slog.Default()}
+			if err := gotgz.List(context.Background(), io.NopCloser(bytes.NewReader(data)), flags, func(*tar.Header, io.Reader) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, logs.String())
+		})
+	}
+}
+
+func TestRun_Verify(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "a.tgz")
+
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeTar)
+	if err := opts.Parse(fs, []string{"-c", "-W", "-dedup", "-manifest", "-f", archive, source}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(&opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is changed after it's archived
+	paths := map[string]string{"file": filepath.Join(source, "file")}
+	err := verifyArchive(archive, &gotgz.FilesystemDiff{Paths: paths}, func(fn gotgz.ListFunc) error {
+		header := &tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: 7}
+		return fn(header, strings.NewReader("CONTENT"))
+	})
+	if err == nil {
+		t.Fatal("the differences aren't reported")
+	}
+	if code := ExitCode(err); code != 1 {
+		t.Errorf("ExitCode() = %d, want 1", code)
+	}
+}
+
+func TestRun_GlobalHeader(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want bool
+	}{
+		{args: nil, want: false},
+		{args: []string{"-global-header"}, want: true},
+	} {
+		archive := filepath.Join(t.TempDir(), "a.tgz")
+		var opts Options
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		opts.RegisterFlags(fs, ModeTar)
+		if err := opts.Parse(fs, append(append([]string{"-c", "-f", archive}, tt.args...), source)); err != nil {
+			t.Fatal(err)
+		}
+		if err := Run(&opts); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := os.Open(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var global bool
+		flags := gotgz.ListFlags{
+			Archiver: gotgz.GZipArchiver{},
+			GlobalHeader: func(records map[string]string) error {
+				global = records[gotgz.PAXGlobalPrefix+"hostname"] != ""
+				return nil
+			},
+		}
+		err = gotgz.List(context.Background(), file, flags, func(*tar.Header, io.Reader) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if global != tt.want {
+			t.Errorf("%v: global header = %v, want %v", tt.args, global, tt.want)
+		}
+	}
+}
+
+func TestRun_RemovePartial(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		wantKept bool
+	}{
+		{name: "Failed", args: []string{filepath.Join(source, "missing")}},
+		{name: "Canceled", args: []string{"-timeout", "1ns", source}},
+		{name: "Keep partial", args: []string{"-keep-partial", filepath.Join(source, "missing")}, wantKept: true},
+		{name: "Keep canceled", args: []string{"-keep-partial", "-timeout", "1ns", source}, wantKept: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "a.tgz")
+			var opts Options
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			opts.RegisterFlags(fs, ModeTar)
+			if err := opts.Parse(fs, append([]string{"-c", "-f", archive}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if err := Run(&opts); err == nil {
+				t.Fatal("the creation doesn't fail")
+			}
+			if _, err := os.Stat(archive); (err == nil) != tt.wantKept {
+				t.Errorf("the partial archive is kept = %v, want %v", err == nil, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestRemovePartial(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// the streams are never removed, even if the files of the same names exist
+	for _, fileName := range []string{"-", "fd://3"} {
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		removePartial(fileName)
+		if _, err := os.Stat(fileName); err != nil {
+			t.Errorf("removePartial(%q) removes the file: %v", fileName, err)
+		}
+	}
+
+	removePartial("a.tgz")
+	if err := os.WriteFile("a.tgz", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	removePartial("a.tgz")
+	if _, err := os.Stat("a.tgz"); !os.IsNotExist(err) {
+		t.Errorf("removePartial(%q) keeps the file: %v", "a.tgz", err)
+	}
+}
+
+func TestRun_AppendMissing(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		wantErr  bool
+		wantKept bool
+	}{
+		{name: "Created", args: []string{source}, wantKept: true},
+		{name: "Dry run", args: []string{"-dry-run", source}},
+		{name: "Failed", args: []string{filepath.Join(source, "missing")}, wantErr: true},
+		{name: "Keep partial", args: []string{"-keep-partial", filepath.Join(source, "missing")}, wantErr: true, wantKept: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "a.tgz")
+			var opts Options
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			opts.RegisterFlags(fs, ModeTar)
+			if err := opts.Parse(fs, append([]string{"-r", "-f", archive}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if err := Run(&opts); (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(archive); (err == nil) != tt.wantKept {
+				t.Errorf("the archive exists = %v, want %v", err == nil, tt.wantKept)
+			}
+		})
+	}
+}
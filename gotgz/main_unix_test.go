@@ -0,0 +1,176 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOpenFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// the descriptors are duplicated like the inherited ones, the files of the same descriptor are closed twice otherwise
+	rfd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wfd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := createArchive(fmt.Sprintf("fd://%d", wfd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(dest, "archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := openArchive(fmt.Sprintf("fd://%d", rfd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	got, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "archive" {
+		t.Errorf("read %q, want %q", got, "archive")
+	}
+
+	for _, fileName := range []string{"fd://", "fd://-1", "fd://stdin"} {
+		if _, err := openArchive(fileName); err == nil {
+			t.Errorf("openArchive(%q) error = nil, want an error", fileName)
+		}
+	}
+}
+
+func TestRun_BrokenPipe(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	// the downstream exits before the archive is written, e.g. `gotgz -c -f - dir | head -c 1`
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeTar)
+	if err := opts.Parse(fs, []string{"-c", "-f", "-", source}); err != nil {
+		t.Fatal(err)
+	}
+	err = Run(&opts)
+	if !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("Run() error = %v, want EPIPE", err)
+	}
+	if code := ExitCode(err); code != ExitCodeBrokenPipe {
+		t.Errorf("ExitCode() = %d, want %d", code, ExitCodeBrokenPipe)
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	// the signal handler exits the process, so it's installed in the child process
+	if grace := os.Getenv("GOTGZ_TEST_SIGNALS"); grace != "" {
+		var common commonFlags
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		common.Register(fs)
+		if err := common.Parse(fs, []string{"-grace-period", grace}); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := common.Context()
+		defer cancel()
+		fmt.Println("ready")
+		<-ctx.Done()
+		fmt.Println("canceled")
+		// the process is exited by the second signal or the grace period
+		time.Sleep(time.Minute)
+		t.Fatal("the process isn't exited")
+	}
+
+	tests := []struct {
+		name     string
+		grace    string
+		second   syscall.Signal
+		wantCode int
+	}{
+		{name: "Second signal", grace: "0", second: syscall.SIGTERM, wantCode: 128 + int(syscall.SIGTERM)},
+		{name: "Grace period", grace: "100ms", wantCode: 128 + int(syscall.SIGINT)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestHandleSignals$")
+			cmd.Env = append(os.Environ(), "GOTGZ_TEST_SIGNALS="+tt.grace, "XDG_CONFIG_HOME="+t.TempDir())
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			timer := time.AfterFunc(10*time.Second, func() { cmd.Process.Kill() })
+			defer timer.Stop()
+
+			lines := bufio.NewScanner(stdout)
+			expect := func(want string) {
+				t.Helper()
+				if !lines.Scan() || lines.Text() != want {
+					cmd.Process.Kill()
+					cmd.Wait()
+					t.Fatalf("read %q, want %q", lines.Text(), want)
+				}
+			}
+			expect("ready")
+			// the first signal cancels the context
+			if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+				t.Fatal(err)
+			}
+			expect("canceled")
+			if tt.second != 0 {
+				if err := cmd.Process.Signal(tt.second); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = cmd.Wait()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("Wait() error = %v, want the exit code %d", err, tt.wantCode)
+			}
+			if code := exitErr.ExitCode(); code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/islishude/gotgz"
+)
+
+// MetricsSuffix is the suffix of the textfile which is read by the textfile collector of node_exporter
+const MetricsSuffix = ".prom"
+
+// Metrics are the statistics of a run, they are written in the prometheus text format by -metrics-textfile,
+// e.g. to alert on the cron-driven backups
+type Metrics struct {
+	Job       string
+	Operation string
+	// Result is success, warning or failure
+	Result   string
+	End      time.Time
+	Duration time.Duration
+	Stats    *gotgz.Stats
+}
+
+// NewMetrics returns the metrics of the operation which runs since the start and returns the err
+func NewMetrics(job, operation string, stats *gotgz.Stats, start time.Time, err error) Metrics {
+	result := "success"
+	if err != nil {
+		result = "failure"
+		if ExitCode(err) == ExitCodeWarning {
+			result = "warning"
+		}
+	}
+	end := time.Now()
+	return Metrics{Job: job, Operation: operation, Result: result, End: end, Duration: end.Sub(start), Stats: stats}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Marshal returns the metrics in the prometheus text format
+func (m Metrics) Marshal() []byte {
+	labels := fmt.Sprintf(`{job="%s",operation="%s",result="%s"}`,
+		labelEscaper.Replace(m.Job), labelEscaper.Replace(m.Operation), labelEscaper.Replace(m.Result))
+	success := 0
+	if m.Result != "failure" {
+		success = 1
+	}
+
+	var buf bytes.Buffer
+	for _, metric := range []struct {
+		name, help string
+		value      any
+	}{
+		{"gotgz_last_run_timestamp_seconds", "The end time of the last run.", float64(m.End.UnixMilli()) / 1000},
+		{"gotgz_last_run_duration_seconds", "The duration of the last run.", m.Duration.Seconds()},
+		{"gotgz_last_run_success", "Whether the last run succeeded, the warnings are the success.", success},
+		{"gotgz_last_run_files", "The regular files of the last run.", m.Stats.Files},
+		{"gotgz_last_run_dirs", "The directories of the last run.", m.Stats.Dirs},
+		{"gotgz_last_run_bytes_in", "The bytes read by the last run, the file contents on create and the archive on extract.", m.Stats.BytesIn},
+		{"gotgz_last_run_bytes_out", "The bytes written by the last run, the archive on create and the file contents on extract.", m.Stats.BytesOut},
+		{"gotgz_last_run_metadata_failures", "The failures to restore the owners, the modes and the times of the last run with -warn-metadata.", m.Stats.MetadataFailures},
+		{"gotgz_last_run_warnings", "The warnings of the last run.", len(m.Stats.Warnings)},
+	} {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s%s %v\n", metric.name, metric.help, metric.name, metric.name, labels, metric.value)
+	}
+	return buf.Bytes()
+}
+
+// WriteMetrics writes the metrics to the job file in the directory, the file is replaced atomically,
+// so the collector doesn't read the partial file
+func WriteMetrics(dir string, m Metrics) error {
+	file, err := os.CreateTemp(dir, "."+m.Job+"-*"+MetricsSuffix+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(m.Marshal()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	// the collector runs as the other user
+	if err := file.Chmod(0644); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(dir, m.Job+MetricsSuffix))
+}
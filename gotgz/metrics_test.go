@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestRun_MetricsTextfile(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "a.tgz")
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeTar)
+	if err := opts.Parse(fs, []string{"-c", "-f", archive, "-metrics-textfile", dir, "-metrics-job", "nightly", source}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(&opts); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "nightly"+MetricsSuffix {
+		t.Fatalf("entries = %v, want nightly%s", entries, MetricsSuffix)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "nightly"+MetricsSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE gotgz_last_run_duration_seconds gauge\n",
+		`gotgz_last_run_success{job="nightly",operation="create",result="success"} 1` + "\n",
+		`gotgz_last_run_files{job="nightly",operation="create",result="success"} 1` + "\n",
+		`gotgz_last_run_bytes_in{job="nightly",operation="create",result="success"} 7` + "\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics don't have %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestRun_MetricsInvalidOptions(t *testing.T) {
+	dir := t.TempDir()
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeTar)
+	// the create without the files fails in the validation
+	if err := opts.Parse(fs, []string{"-c", "-f", filepath.Join(t.TempDir(), "a.tgz"), "-metrics-textfile", dir, "-metrics-job", "nightly"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(&opts); err == nil {
+		t.Fatal("Run() should fail without the files")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "nightly"+MetricsSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `gotgz_last_run_success{job="nightly",operation="create",result="failure"} 0` + "\n"; !strings.Contains(string(data), want) {
+		t.Errorf("metrics don't have %q:\n%s", want, data)
+	}
+}
+
+func TestMetrics_Marshal(t *testing.T) {
+	m := NewMetrics(`a"b`, "extract", &gotgz.Stats{}, time.Now(), errors.New("failed"))
+	got := string(m.Marshal())
+	if want := `gotgz_last_run_success{job="a\"b",operation="extract",result="failure"} 0` + "\n"; !strings.Contains(got, want) {
+		t.Errorf("metrics don't have %q:\n%s", want, got)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/islishude/gotgz"
+)
+
+// mountEntry is a member of the mounted archive, the content of the regular file is at the offset of the uncompressed
+// archive, and ordinal is its position in the listed entries, the member of the compressed archive is found by it
+type mountEntry struct {
+	header  *tar.Header
+	offset  int64
+	ordinal int
+}
+
+// mountIndex is the members of the mounted archive by the cleaned names, the root is the empty name,
+// the archive is read once to index the headers, the contents are read when the files are opened,
+// the uncompressed archive is read at the offsets, e.g. with the ranged reads of the s3 object, and
+// the compressed archive can't be read at random, so the member is streamed to a temporary file
+type mountIndex struct {
+	entries map[string]*mountEntry
+	// src reads the uncompressed archive at random, it's nil if the archive is compressed
+	src    io.ReaderAt
+	closer io.Closer
+
+	fileName string
+	level    slog.Level
+	flags    gotgz.ListFlags
+	dir      string
+}
+
+// mountName cleans the member name in the mount, the leading slash and `..` can't escape the root
+func mountName(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// newMountIndex reads the headers of the archive, the last member wins like the extraction, the hardlinks are
+// the regular files with the contents of their targets, the devices and the fifos are omitted, the archive is read
+// again when the files are opened, so the streams can't be mounted
+func newMountIndex(ctx context.Context, fileName string, level slog.Level, flags gotgz.ListFlags, dir string) (*mountIndex, error) {
+	if isStream(fileName) {
+		return nil, errors.New("the stream can't be mounted, the archive is read again when the files are opened")
+	}
+	src, closer, err := openMountSource(ctx, fileName, level)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &mountIndex{
+		entries: make(map[string]*mountEntry),
+		src:     src, closer: closer,
+		fileName: fileName, level: level, flags: flags, dir: dir,
+	}
+	var offset int64
+	var ordinal int
+	indexFlags := flags
+	indexFlags.DataOffset = func(o int64) { offset = o }
+	err = listArchive(ctx, fileName, level, indexFlags, func(header *tar.Header, _ io.Reader) error {
+		defer func() { ordinal++ }()
+		entry := &mountEntry{header: header, offset: -1, ordinal: ordinal}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			if !gotgz.IsSparse(header) {
+				entry.offset = offset
+			}
+		case tar.TypeLink:
+			target, ok := index.entries[mountName(header.Linkname)]
+			if !ok || target.header.Typeflag != tar.TypeReg {
+				slog.Warn("skip the hardlink to the unknown file", "file", header.Name, "link", header.Linkname)
+				return nil
+			}
+			link := *header
+			link.Typeflag, link.Size = tar.TypeReg, target.header.Size
+			entry = &mountEntry{header: &link, offset: target.offset, ordinal: target.ordinal}
+		case tar.TypeDir, tar.TypeSymlink:
+		default:
+			slog.Debug("skip the entry in the mount", "file", header.Name, "type", string(header.Typeflag))
+			return nil
+		}
+		index.entries[mountName(header.Name)] = entry
+		return nil
+	})
+	if err != nil {
+		_ = index.Close()
+		return nil, err
+	}
+	return index, nil
+}
+
+// openMountSource opens the archive to read it at random, it's nil if the archive is compressed
+func openMountSource(ctx context.Context, fileName string, level slog.Level) (io.ReaderAt, io.Closer, error) {
+	source, err := url.Parse(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if gotgz.IsS3(source) {
+		query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+		client, err := NewS3Client(ctx, source.Host, query, level)
+		if err != nil {
+			return nil, nil, err
+		}
+		s3Key := strings.TrimPrefix(filepath.Clean(source.Path), "/")
+		head, err := client.RangeReader(ctx, s3Key, 6)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer head.Close()
+		if archiver, err := gotgz.DetectCompression(head); err != nil || archiver != nil {
+			return nil, nil, nil
+		}
+		return s3ReaderAt{ctx: ctx, client: client, s3Key: s3Key}, nil, nil
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if archiver, err := gotgz.DetectCompression(io.NewSectionReader(file, 0, 6)); err != nil || archiver != nil {
+		return nil, nil, file.Close()
+	}
+	return file, file, nil
+}
+
+// s3ReaderAt reads the object at random with the ranged reads
+type s3ReaderAt struct {
+	ctx    context.Context
+	client gotgz.S3
+	s3Key  string
+}
+
+func (s s3ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return s.client.ReadAt(s.ctx, s.s3Key, p, off)
+}
+
+// mountContent is the content of an opened regular file, the spool is the temporary file of the streamed member
+type mountContent struct {
+	*io.SectionReader
+	spool *os.File
+}
+
+func (c mountContent) Close() error {
+	if c.spool == nil {
+		return nil
+	}
+	return c.spool.Close()
+}
+
+// errMemberFound stops listing the archive once the opened member is streamed
+var errMemberFound = errors.New("member is found")
+
+// Open returns the content of the regular file, the member of the compressed archive is streamed to
+// an unlinked temporary file in the dir, it's removed once the content is closed
+func (m *mountIndex) Open(ctx context.Context, entry *mountEntry) (mountContent, error) {
+	if m.src != nil && entry.offset >= 0 {
+		return mountContent{SectionReader: io.NewSectionReader(m.src, entry.offset, entry.header.Size)}, nil
+	}
+
+	spool, err := os.CreateTemp(m.dir, "gotgz-mount-*")
+	if err != nil {
+		return mountContent{}, err
+	}
+	// the spool is removed once it's opened, so nothing is left after the unmount or a crash
+	if err := os.Remove(spool.Name()); err != nil {
+		_ = spool.Close()
+		return mountContent{}, err
+	}
+
+	var ordinal, size int64
+	err = listArchive(ctx, m.fileName, m.level, m.flags, func(header *tar.Header, content io.Reader) error {
+		if ordinal++; ordinal <= int64(entry.ordinal) {
+			return nil
+		}
+		n, err := io.Copy(spool, content)
+		if err != nil {
+			return err
+		}
+		size = n
+		return errMemberFound
+	})
+	if !errors.Is(err, errMemberFound) {
+		_ = spool.Close()
+		if err == nil {
+			err = errors.New("the member isn't in the archive anymore")
+		}
+		return mountContent{}, err
+	}
+	return mountContent{SectionReader: io.NewSectionReader(spool, 0, size), spool: spool}, nil
+}
+
+func (m *mountIndex) Close() error {
+	if m.closer == nil {
+		return nil
+	}
+	return m.closer.Close()
+}
@@ -0,0 +1,227 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"syscall"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/islishude/gotgz"
+)
+
+// runMount mounts an archive as a read-only filesystem with FUSE until it's unmounted or interrupted
+func runMount(args []string) error {
+	var (
+		common     commonFlags
+		fileName   string
+		spoolDir   string
+		allowOther bool
+	)
+
+	fs := NewFlagSet("mount", "-f archive [flags] mountpoint")
+	fs.StringVar(&fileName, "f", "", "alias to -file")
+	fs.StringVar(&fileName, "file", "", "Use archive file")
+	fs.StringVar(&spoolDir, "spool-dir", "", "the directory of the temporary files which hold the contents of the opened files of the compressed archive, it's the system temporary directory by default")
+	fs.BoolVar(&allowOther, "allow-other", false, "allow the other users to access the mount, it requires user_allow_other in /etc/fuse.conf")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fileName == "" {
+		return errors.New("File name is empty")
+	}
+	if fs.NArg() != 1 {
+		return errors.New("Mount point is required")
+	}
+	mountpoint := fs.Arg(0)
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	archiver, err := common.Archiver(fileName)
+	if err != nil {
+		return err
+	}
+	flags := gotgz.ListFlags{Archiver: gotgz.AutoArchiver{Archiver: archiver}, Logger: slog.Default()}
+	index, err := newMountIndex(ctx, fileName, common.Level(), flags, spoolDir)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	server, err := fusefs.Mount(mountpoint, &mountRoot{index: index}, &fusefs.Options{
+		MountOptions: fuse.MountOptions{
+			AllowOther: allowOther,
+			FsName:     fileName,
+			Name:       "gotgz",
+			Options:    []string{"ro"},
+			// mount(2) is tried first for root, e.g. the containers without fusermount
+			DirectMount: true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("archive is mounted, unmount it or press Ctrl+C to exit", "path", fileName, "mountpoint", mountpoint, "entries", len(index.entries))
+
+	unmounted := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := server.Unmount(); err != nil {
+				slog.Error("unmount", "mountpoint", mountpoint, "error", err)
+			}
+		case <-unmounted:
+		}
+	}()
+	server.Wait()
+	close(unmounted)
+	return nil
+}
+
+// mountRoot is the root directory of the mounted archive, it builds the tree when it's mounted
+type mountRoot struct {
+	mountDir
+	index *mountIndex
+}
+
+var _ = (fusefs.NodeOnAdder)((*mountRoot)(nil))
+
+func (r *mountRoot) OnAdd(ctx context.Context) {
+	names := make([]string, 0, len(r.index.entries))
+	for name := range r.index.entries {
+		names = append(names, name)
+	}
+	// the parents are added before the children
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := r.index.entries[name]
+		if name == "" {
+			r.header = entry.header
+			continue
+		}
+
+		parent := &r.Inode
+		components := strings.Split(name, "/")
+		for _, component := range components[:len(components)-1] {
+			child := parent.GetChild(component)
+			if child == nil {
+				child = parent.NewPersistentInode(ctx, &mountDir{}, fusefs.StableAttr{Mode: fuse.S_IFDIR})
+				parent.AddChild(component, child, true)
+			}
+			parent = child
+		}
+
+		var node fusefs.InodeEmbedder
+		var mode uint32
+		switch entry.header.Typeflag {
+		case tar.TypeDir:
+			// the directory which is created for its children gets the attributes
+			if child := parent.GetChild(components[len(components)-1]); child != nil {
+				if dir, ok := child.Operations().(*mountDir); ok {
+					dir.header = entry.header
+					continue
+				}
+			}
+			node, mode = &mountDir{header: entry.header}, fuse.S_IFDIR
+		case tar.TypeSymlink:
+			symlink := &fusefs.MemSymlink{Data: []byte(entry.header.Linkname)}
+			setMountAttr(&symlink.Attr, entry.header)
+			node, mode = symlink, fuse.S_IFLNK
+		default:
+			node, mode = &mountFile{index: r.index, entry: entry}, fuse.S_IFREG
+		}
+		parent.AddChild(components[len(components)-1], parent.NewPersistentInode(ctx, node, fusefs.StableAttr{Mode: mode}), true)
+	}
+}
+
+// mountDir is a directory of the mounted archive, the header is nil if it's not in the archive
+type mountDir struct {
+	fusefs.Inode
+	header *tar.Header
+}
+
+var _ = (fusefs.NodeGetattrer)((*mountDir)(nil))
+
+func (d *mountDir) Getattr(ctx context.Context, f fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if d.header == nil {
+		out.Mode = uint32(gotgz.DefaultDirPerm)
+		return fusefs.OK
+	}
+	setMountAttr(&out.Attr, d.header)
+	return fusefs.OK
+}
+
+// mountFile is a regular file of the mounted archive, its content is read when it's opened
+type mountFile struct {
+	fusefs.Inode
+	index *mountIndex
+	entry *mountEntry
+}
+
+var (
+	_ = (fusefs.NodeGetattrer)((*mountFile)(nil))
+	_ = (fusefs.NodeOpener)((*mountFile)(nil))
+)
+
+func (f *mountFile) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	setMountAttr(&out.Attr, f.entry.header)
+	return fusefs.OK
+}
+
+func (f *mountFile) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	content, err := f.index.Open(ctx, f.entry)
+	if err != nil {
+		slog.Error("open the member", "file", f.entry.header.Name, "error", err)
+		return nil, 0, syscall.EIO
+	}
+	// the content never changes, so the kernel can cache it
+	return &mountHandle{content: content, name: f.entry.header.Name}, fuse.FOPEN_KEEP_CACHE, fusefs.OK
+}
+
+// mountHandle is an opened regular file, the content is closed when it's released
+type mountHandle struct {
+	content mountContent
+	name    string
+}
+
+var (
+	_ = (fusefs.FileReader)((*mountHandle)(nil))
+	_ = (fusefs.FileReleaser)((*mountHandle)(nil))
+)
+
+func (h *mountHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := h.content.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		slog.Error("read the member", "file", h.name, "error", err)
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(dest[:n]), fusefs.OK
+}
+
+func (h *mountHandle) Release(ctx context.Context) syscall.Errno {
+	if err := h.content.Close(); err != nil {
+		slog.Error("close the member", "file", h.name, "error", err)
+	}
+	return fusefs.OK
+}
+
+// setMountAttr sets the permissions, the size, the owner and the modification time of the member
+func setMountAttr(out *fuse.Attr, header *tar.Header) {
+	out.Mode = uint32(header.Mode & 07777)
+	out.Size = uint64(header.Size)
+	out.Uid, out.Gid = uint32(header.Uid), uint32(header.Gid)
+	out.SetTimes(nil, &header.ModTime, nil)
+}
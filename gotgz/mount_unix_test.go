@@ -0,0 +1,136 @@
+//go:build !windows
+
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestMountIndex(t *testing.T) {
+	for _, compressed := range []bool{true, false} {
+		name := "tar"
+		if compressed {
+			name = "tgz"
+		}
+		t.Run(name, func(t *testing.T) {
+			testMountIndex(t, compressed)
+		})
+	}
+}
+
+func testMountIndex(t *testing.T, compressed bool) {
+	archive := filepath.Join(t.TempDir(), "test.tar")
+	if compressed {
+		archive = filepath.Join(filepath.Dir(archive), "test.tgz")
+	}
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiver := gotgz.GZipArchiver{Level: 1}
+	var zw io.WriteCloser = file
+	if compressed {
+		zw, _ = archiver.Writer(file)
+	}
+	tw := tar.NewWriter(zw)
+	for _, entry := range []struct {
+		header  *tar.Header
+		content string
+	}{
+		{header: &tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: &tar.Header{Name: "dir/a.txt", Typeflag: tar.TypeReg, Mode: 0644}, content: "hello"},
+		{header: &tar.Header{Name: "dir/b.txt", Typeflag: tar.TypeReg, Mode: 0644}, content: "world"},
+		{header: &tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/a.txt"}},
+		{header: &tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "dir/b.txt"}},
+		{header: &tar.Header{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0644}, content: "x"},
+		{header: &tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0644}},
+		// the last one wins
+		{header: &tar.Header{Name: "dir/a.txt", Typeflag: tar.TypeReg, Mode: 0600}, content: "hello again"},
+	} {
+		entry.header.Size = int64(len(entry.content))
+		if err := tw.WriteHeader(entry.header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, entry.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spool := t.TempDir()
+	flags := gotgz.ListFlags{Archiver: gotgz.AutoArchiver{Archiver: archiver}, Logger: slog.Default()}
+	index, err := newMountIndex(context.Background(), archive, slog.LevelError, flags, spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	// only the uncompressed archive is read at random
+	if (index.src == nil) != compressed {
+		t.Errorf("random reads = %v, want %v", index.src != nil, !compressed)
+	}
+
+	var names []string
+	for name := range index.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"", "dir/a.txt", "dir/b.txt", "escape", "hard", "link"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	for name, want := range map[string]string{"dir/a.txt": "hello again", "dir/b.txt": "world", "hard": "world", "escape": "x"} {
+		content, err := index.Open(context.Background(), index.entries[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 32)
+		n, err := content.ReadAt(got, 0)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if string(got[:n]) != want {
+			t.Errorf("%s = %q, want %q", name, got[:n], want)
+		}
+		if err := content.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := index.Open(context.Background(), index.entries["dir/b.txt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	if n, err := content.ReadAt(make([]byte, 8), 3); n != 2 || err != io.EOF {
+		t.Errorf("ReadAt() at 3 = %d, %v, want 2 bytes", n, err)
+	}
+	if _, err := content.ReadAt(make([]byte, 8), 5); err != io.EOF {
+		t.Errorf("ReadAt() at the end error = %v, want EOF", err)
+	}
+
+	// the spool is removed once it's opened
+	if files, _ := os.ReadDir(spool); len(files) != 0 {
+		t.Errorf("spool dir has %d files, want none", len(files))
+	}
+}
+
+func TestMountIndex_Stream(t *testing.T) {
+	if _, err := newMountIndex(context.Background(), "-", slog.LevelError, gotgz.ListFlags{Archiver: gotgz.GZipArchiver{}}, t.TempDir()); err == nil {
+		t.Error("the stream should not be mounted")
+	}
+}
@@ -0,0 +1,774 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/islishude/gotgz"
+)
+
+type Mode int
+
+const (
+	// ModeTar is the tar compatible mode, the action is selected by -c, -x or -t
+	ModeTar Mode = iota
+	ModeCreate
+	ModeExtract
+	ModeList
+	ModeAppend
+	ModeUpdate
+	ModeDelete
+	ModeCatenate
+	ModeDiff
+)
+
+type Options struct {
+	FileNames    filesFlag
+	ArchivesFrom string
+	Create       bool
+	Append       bool
+	Update       bool
+	Delete       bool
+	Catenate     bool
+	Diff         bool
+	Extract      bool
+	List         bool
+
+	// FilesFrom is the list of the files to create or the members to extract or list,
+	// and ExcludeFrom is the list of the exclude patterns, they can be the local files or the s3 urls
+	FilesFrom   string
+	ExcludeFrom string
+	// Null reads the FilesFrom list separated by NUL instead of the lines
+	Null bool
+
+	Timeout     time.Duration
+	GracePeriod time.Duration
+	LogLevel    string
+	Quiet       bool
+	// NoTimings drops the time cost at the end and the timestamps of the log lines
+	NoTimings bool
+
+	Relative      bool
+	AbsoluteNames bool
+	Algorithm     string
+	Chdir         string
+
+	FileSuffix string
+	Excludes   stringsFlag
+
+	S3PartSize int64
+	S3Thread   int
+	MaxMemory  int64
+	Checksum   string
+	Color      string
+	// PrintEntries prints the extracted entries like tar -xv, the overwritten and the skipped ones are marked
+	PrintEntries bool
+	Tree         bool
+	JSON         bool
+	// Long lists the permissions, the owner, the size and the modification time of the entries like tar -tv
+	Long bool
+	// TOCCache caches the table of contents of the s3 archives, so they are listed again without downloading
+	TOCCache bool
+	// TOCCacheHead is the MB of the head of the s3 archive which is cached with the table of contents
+	TOCCacheHead int64
+	// TOCCacheMaxSize and TOCCacheMaxAge evict the least recently used files of the cache, 0 is unlimited
+	TOCCacheMaxSize int64
+	TOCCacheMaxAge  time.Duration
+
+	// GlobalHeader writes the pax global header which describes the archive
+	GlobalHeader bool
+	// PAXOptions are the pax records of the global header and the members, it's a subset of `tar --pax-option`
+	PAXOptions stringsFlag
+	// Manifest appends the manifest member which summarizes the members with the checksums
+	Manifest bool
+	// ManifestChecksum is the checksum algorithm of the manifest
+	ManifestChecksum string
+	// Dedup archives the files with the same content as the hardlinks
+	Dedup bool
+	// NumericOwner, Owner and Group are the owner of the entries on create, the Owner and Group are kept if they are negative
+	NumericOwner bool
+	Owner        int
+	Group        int
+	// KeepPartial keeps the partially written local archive if the creation fails or is canceled
+	KeepPartial bool
+	// Chown is the user:group which owns the extracted entries
+	Chown string
+	// ExplainPolicy prints how the permissions, the owners, the times and the existing files are handled before extracting
+	ExplainPolicy bool
+	// Tee is the other destinations which the same archive is written to
+	Tee stringsFlag
+	// Sandbox confines the extraction to the directory with landlock
+	Sandbox bool
+	// Preview prints the tree of the extraction and the conflicts instead of extracting
+	Preview bool
+	// Spool is the directory or the memory which buffers the archive before the s3 upload
+	Spool string
+	// AddStdin is the entry like `name=etc/app.conf,mode=644` whose content is read from the stdin
+	AddStdin string
+	// FollowArgs archives the targets of the symbolic links in the command line like tar -H
+	FollowArgs bool
+	// ScanCommand is the shell command which vetoes the files by their content on create
+	ScanCommand string
+	// UploadReport writes the json report next to the archive after it's created
+	UploadReport bool
+	// ScanLimit is the max entries to scan per second on create
+	ScanLimit float64
+	// Nice and IONice are the cpu and the io priorities of the process, they are kept if they are empty
+	Nice   int
+	IONice string
+	// Threads is the decompression concurrency, it's the count of the cpus if it's 0
+	Threads int
+	// Jobs is the file of the archives to create, and JobsParallel is how many of them run at the same time
+	Jobs         string
+	JobsParallel int
+	// SplitByTopDir creates an archive for every source, the {name} of the archive is the base name of the source
+	SplitByTopDir bool
+	// Verify reads the created archive again and compares the members with their files
+	Verify bool
+	// NewerThan and OlderThan select the entries to list and extract by their modification times,
+	// they are the durations before now or the times
+	NewerThan string
+	OlderThan string
+
+	// MetricsTextfile is the directory of the textfile collector, the metrics of the run are written to
+	// the MetricsJob file in it
+	MetricsTextfile string
+	MetricsJob      string
+
+	CPUProfile string
+	MemProfile string
+	TraceFile  string
+
+	ConfigFile string
+	Profile    string
+
+	Decompress gotgz.DecompressFlags
+
+	// Args are the positional arguments
+	Args []string
+
+	// listed are the names read from FilesFrom
+	listed []string
+	// listedArchives are the archives read from ArchivesFrom
+	listedArchives []string
+	// jobs are read from Jobs
+	jobs []Job
+}
+
+func (o *Options) RegisterFlags(fs *flag.FlagSet, mode Mode) {
+	o.Decompress.Logger = slog.Default()
+
+	fs.StringVar(&o.LogLevel, "v", slog.LevelInfo.String(), "alias to -verbose")
+	fs.StringVar(&o.LogLevel, "verbose", slog.LevelInfo.String(), "alias to -log-level")
+	fs.StringVar(&o.LogLevel, "log-level", slog.LevelInfo.String(), "the log level, it can be debug, info, warn or error, the debug level also logs the s3 responses and retries")
+	fs.BoolVar(&o.Quiet, "q", false, "alias to -quiet")
+	fs.BoolVar(&o.Quiet, "quiet", false, "only log the errors, it's the same as -log-level=error, so nothing but the archive or the listing is written to the stdout and nothing but the errors to the stderr")
+	fs.BoolVar(&o.NoTimings, "no-timings", false, "don't log the time cost at the end and the timestamps of the log lines, e.g. the logs collected by docker, which adds its own timestamps, or compared by the tests")
+	fs.Var(&o.FileNames, "f", "alias to -file")
+	fs.StringVar(&o.FilesFrom, "T", "", "alias to -files-from")
+	fs.StringVar(&o.FilesFrom, "files-from", "", "read the files to create or the members to extract, list or delete from the file, one per line as is like tar -T, it can be the s3 url to share the list across the hosts or - for the stdin")
+	fs.BoolVar(&o.Null, "0", false, "alias to -null")
+	fs.BoolVar(&o.Null, "null", false, "the names of -files-from are separated by NUL like the output of 'find -print0', so they can have the spaces and the newlines")
+	fs.StringVar(&o.Decompress.Label, "V", "", "alias to -label")
+	fs.StringVar(&o.Decompress.Label, "label", "", "in c mode write the volume label like tar -V, in x and t mode it's the shell pattern which the volume label of the archive must match, e.g. the guard of the legacy backup workflows")
+	fs.Var(&o.FileNames, "file", "Use archive file, it can be repeated in x mode to extract the archives one by one")
+	if mode == ModeTar {
+		fs.BoolVar(&o.Create, "c", false, "alias to -create")
+		fs.BoolVar(&o.Create, "create", false, "create a new local archive")
+		fs.BoolVar(&o.Append, "r", false, "alias to -append")
+		fs.BoolVar(&o.Append, "append", false, "append the files to the end of an archive, it's created if it doesn't exist, the compressed archive is rewritten with the same compression and the existing members are copied as is")
+		fs.BoolVar(&o.Update, "u", false, "alias to -update")
+		fs.BoolVar(&o.Update, "update", false, "append the files which are newer than their copies in an archive like -append, e.g. the incremental refresh")
+		fs.BoolVar(&o.Delete, "delete", false, "delete the members from an archive like tar --delete, the archive is rewritten with the same compression and the other members are copied as is")
+		fs.BoolVar(&o.Catenate, "A", false, "alias to -catenate")
+		fs.BoolVar(&o.Catenate, "catenate", false, "append the members of the archives to the end of an archive like tar -A, it's created if it doesn't exist, the archives can be compressed with the different algorithms and the archive keeps its compression")
+		fs.BoolVar(&o.Catenate, "concatenate", false, "alias to -catenate")
+		fs.BoolVar(&o.Diff, "d", false, "alias to -diff")
+		fs.BoolVar(&o.Diff, "diff", false, "compare the members of an archive with the files under -C like tar -d, the type, size, mode, modification time, content hash and link target are compared, and the exit code is 2 if any of them differs")
+		fs.BoolVar(&o.Diff, "compare", false, "alias to -diff")
+		fs.BoolVar(&o.Extract, "x", false, "alias to -extract")
+		fs.BoolVar(&o.Extract, "extract", false, "extract files from an archive")
+		fs.BoolVar(&o.List, "t", false, "alias to -list")
+		fs.BoolVar(&o.List, "list", false, "list the contents of an archive")
+	}
+	fs.DurationVar(&o.Timeout, "timeout", 0, "timeout in go time.Duration expression, if the value is less than or equal to 0, it will be ignored")
+	fs.DurationVar(&o.GracePeriod, "grace-period", time.Minute, "the time to stop gracefully after SIGINT or SIGTERM, it exits immediately after it or on the second signal, 0 means unlimited")
+	fs.StringVar(&o.Algorithm, "algo", "gzip", "compression algorithm")
+	fs.StringVar(&o.FileSuffix, "suffix", "", "suffix for the archive file name, the buit-in date suffix can add current date to the file name, it supports {hostname}, {unix} and go time layout like {20060102}")
+	fs.StringVar(&o.ConfigFile, "config", "", "the config file, default is $XDG_CONFIG_HOME/gotgz/config.toml or ~/.config/gotgz/config.toml")
+	fs.StringVar(&o.Profile, "profile", "", "the profile in the config file")
+	fs.StringVar(&o.MetricsTextfile, "metrics-textfile", "", "write the metrics of the run like the duration, the bytes and the result to the directory of the node_exporter textfile collector")
+	fs.StringVar(&o.MetricsJob, "metrics-job", "gotgz", "the job label of the metrics and the name of the file in -metrics-textfile, e.g. the name of the backup")
+	fs.StringVar(&o.CPUProfile, "cpuprofile", "", "write cpu profile to the file")
+	fs.StringVar(&o.MemProfile, "memprofile", "", "write memory profile to the file")
+	fs.StringVar(&o.TraceFile, "trace", "", "write execution trace to the file")
+	registerSSOLogin(fs)
+
+	if mode == ModeTar || mode == ModeCreate || mode == ModeAppend || mode == ModeUpdate || mode == ModeExtract {
+		fs.BoolVar(&o.Decompress.DryRun, "dry-run", false, "only print the file list, in c mode it also logs the estimated compressed size of every source")
+		fs.StringVar(&o.Chdir, "C", "", "alias to -directory")
+		fs.BoolVar(&o.AbsoluteNames, "P", false, "alias to -absolute-names")
+		fs.BoolVar(&o.AbsoluteNames, "absolute-names", false, "keep the leading slash and '..' in the names on create, and allow to extract to the absolute paths, it's dangerous for the untrusted archives")
+		fs.StringVar(&o.Chdir, "directory", "", "change to the directory, in c mode it can be repeated between the files like tar, in x mode it's the directory to extract")
+		fs.StringVar(&o.Decompress.Normalize, "normalize", "", "normalize the unicode form of the names on create and the paths on extract, it can be nfc or nfd")
+		fs.IntVar(&o.Nice, "nice", 0, "the nice value of the process like the nice command, it's from -20 (highest) to 19 (lowest) and 0 keeps it, linux only")
+		fs.StringVar(&o.IONice, "ionice", "", "the io priority of the process like the ionice command, it's class[:level], the class is realtime, best-effort or idle and the level is 0 (highest) to 7 (lowest), linux only")
+		fs.IntVar(&o.Decompress.Retries, "retries", 0, "retry the transient errors like EIO and ESTALE to walk and read the files on create and to write the files and their metadata on extract, e.g. the network mounts, the delay starts from 100ms and is doubled")
+	}
+
+	if mode == ModeTar || mode == ModeCreate || mode == ModeAppend || mode == ModeUpdate {
+		fs.Var(&o.Excludes, "e", "alias to -exclude")
+		fs.StringVar(&o.ExcludeFrom, "X", "", "alias to -exclude-from")
+		fs.StringVar(&o.ExcludeFrom, "exclude-from", "", "(c mode only) read the exclude patterns from the file, one per line, it can be the s3 url to share the policy across the hosts")
+		fs.BoolVar(&o.FollowArgs, "H", false, "alias to -dereference-args")
+		fs.BoolVar(&o.FollowArgs, "dereference-args", false, "(c mode only) archive the targets of the symbolic links in the command line like bsdtar -H, the symbolic links under the directories are archived as the links")
+		fs.Var(&o.Excludes, "exclude", "(c mode only)exclude files from the tarball, the pattern is the same with shell glob, the pattern should be case-sensitive and relative to the root path")
+		fs.BoolVar(&o.Relative, "relative", false, "(c mode only) store file names as relative paths")
+		fs.Int64Var(&o.S3PartSize, "s3-part-size", 10, "the part size for s3 upload , the unit is MB")
+		fs.IntVar(&o.S3Thread, "s3-thread", 5, "the concurrency for s3 upload")
+		fs.BoolVar(&o.GlobalHeader, "global-header", false, "(c mode only) write the pax global header with the creator, the hostname, the creation time and the gotgz version, it's off by default since the user and host names can be private")
+		fs.Var(&o.PAXOptions, "pax-option", "(c mode only) add the pax record, key=value is written to the global header, key:=value is written to every member, e.g. build.id:=1234 to stamp the provenance, and globexthdr.name=template is the name of the global header, %p is the pid and %n is always 1, it can be repeated, it's a subset of tar --pax-option and exthdr.name, delete and the comma separated options aren't supported")
+		fs.BoolVar(&o.Manifest, "manifest", false, "(c mode only) append the .gotgz/manifest.json member with the checksums of the members, it's verified by the verify command")
+		fs.StringVar(&o.ManifestChecksum, "manifest-checksum", gotgz.DefaultManifestChecksum, "(c mode only) the checksum algorithm of -manifest, it can be sha256, sha512, blake3, xxh64 or crc32, xxh64 is much faster to verify the large archives but it doesn't detect the tampering")
+		fs.BoolVar(&o.Dedup, "dedup", false, "(c mode only) archive the files with the same content, mode and owner as the hardlinks to the first one, the files are read twice and the modification times of the copies are not kept")
+		fs.BoolVar(&o.NumericOwner, "numeric-owner", false, "(c and t mode only) store the uid and gid without the user and group names, so the archive is reproducible across the hosts, in t mode -long prints the ids instead of the names")
+		fs.IntVar(&o.Owner, "owner", -1, "(c mode only) override the uid of the entries and the user name is the one of the uid, it's kept if it's negative")
+		fs.IntVar(&o.Group, "group", -1, "(c mode only) override the gid of the entries and the group name is the one of the gid, it's kept if it's negative")
+		fs.Var(&o.Tee, "tee", "(c mode only) write the same archive to the destination too, e.g. the local path and the s3 url, it can be repeated and the archive is compressed once")
+		fs.BoolVar(&o.KeepPartial, "keep-partial", false, "(c mode only) keep the partially written local archive if the creation fails or is canceled, it's removed by default")
+		fs.StringVar(&o.AddStdin, "add-stdin", "", "(c mode only) append the entry whose content is read from the stdin, e.g. name=etc/app.conf,mode=644 for the generated config, the mode is 644 by default and the content is buffered in the memory")
+		fs.StringVar(&o.ScanCommand, "scan-command", "", "(c mode only) the shell command which scans every regular file before it's archived, e.g. the secret detection, the content is the stdin and the path is $1, the exit code 0 includes the file, 1 skips it and the others abort the creation")
+		fs.BoolVar(&o.UploadReport, "upload-report", false, "(c mode only) write the json report with the sources, the counters, the checksum and the times next to the archive after it's created, the name has the "+ReportSuffix+" suffix, e.g. the s3 object as the audit trail")
+		fs.Float64Var(&o.ScanLimit, "scan-limit", 0, "(c mode only) the max files to scan per second, so the backup on the busy host doesn't degrade the foreground I/O, 0 means unlimited")
+		fs.StringVar(&o.Spool, "s3-spool", "", "(c mode only) buffer the archive in the directory or the memory before the s3 upload, so the compression isn't stalled by the slow or retried parts, it's the directory of the temporary file which can grow to the archive size, or memory which is unbounded and can't be used with -max-memory")
+		fs.StringVar(&o.Jobs, "jobs", "", "(c mode only) create the archives of the jobs file instead of -file, every line is an archive and its files like the command line, e.g. 's3://bucket/app.tgz -C /srv app', it can be the s3 url too")
+		fs.IntVar(&o.JobsParallel, "jobs-parallel", 4, "(c mode only) how many jobs of -jobs and -split-by-top-dir run at the same time, the s3 clients are shared by the jobs of the same bucket")
+		fs.BoolVar(&o.SplitByTopDir, "split-by-top-dir", false, "(c mode only) create an archive for every file or directory in the command line, the {name} placeholder of -file is its base name, e.g. '-f s3://bucket/backups/{name}.tar.zst /data/*' for the per-tenant archives")
+		fs.BoolVar(&o.Verify, "W", false, "alias to -verify")
+		fs.BoolVar(&o.Verify, "verify", false, "(c mode only) read the archive again after it's created, the local file or the s3 object, and compare the members with their files like tar -W, it fails if any of them differs")
+		fs.Int64Var(&o.MaxMemory, "max-memory", 0, "the memory budget in MB for the s3 part buffers and the compressor, the s3 concurrency is reduced to fit in it, it's shared by the jobs which run at the same time, 0 means unlimited")
+	}
+
+	if mode == ModeDelete || mode == ModeCatenate {
+		fs.BoolVar(&o.Decompress.DryRun, "dry-run", false, "only log the changes, the archive isn't written")
+		fs.Int64Var(&o.S3PartSize, "s3-part-size", 10, "the part size for s3 upload , the unit is MB")
+		fs.IntVar(&o.S3Thread, "s3-thread", 5, "the concurrency for s3 upload")
+	}
+	if mode == ModeDiff {
+		fs.StringVar(&o.Chdir, "C", "", "alias to -directory")
+		fs.StringVar(&o.Chdir, "directory", "", "the directory to compare with, it's the current directory by default")
+	}
+	if mode == ModeDelete {
+		fs.BoolVar(&o.Decompress.Regex, "regex", false, "the member arguments are RE2 regular expressions")
+		fs.BoolVar(&o.Decompress.Matching.Unanchored, "no-anchored", false, "the member arguments match after any slash of the names")
+		fs.Var(invertBool{&o.Decompress.Matching.Unanchored}, "anchored", "the member arguments match from the start of the names, it's the default")
+		fs.BoolVar(&o.Decompress.Matching.IgnoreCase, "ignore-case", false, "the member arguments match the names case-insensitively")
+		fs.BoolVar(&o.Decompress.Matching.Literal, "no-wildcards", false, "the member arguments are the names instead of the glob patterns")
+		fs.Var(invertBool{&o.Decompress.Matching.Literal}, "wildcards", "the member arguments are the glob patterns with **, it's the default")
+	}
+
+	if mode == ModeTar || mode == ModeExtract || mode == ModeList || mode == ModeDiff {
+		fs.BoolVar(&o.Decompress.Regex, "regex", false, "(x, t, d and delete mode only) the member arguments are RE2 regular expressions")
+		fs.BoolVar(&o.Decompress.Matching.Unanchored, "no-anchored", false, "(x, t, d and delete mode only) the member arguments match after any slash of the names like tar, e.g. *.sql matches db/a.sql")
+		fs.Var(invertBool{&o.Decompress.Matching.Unanchored}, "anchored", "(x, t, d and delete mode only) the member arguments match from the start of the names, it's the default")
+		fs.BoolVar(&o.Decompress.Matching.IgnoreCase, "ignore-case", false, "(x, t, d and delete mode only) the member arguments match the names case-insensitively")
+		fs.BoolVar(&o.Decompress.Matching.Literal, "no-wildcards", false, "(x, t, d and delete mode only) the member arguments are the names instead of the glob patterns, e.g. the names with [ and *")
+		fs.Var(invertBool{&o.Decompress.Matching.Literal}, "wildcards", "(x, t, d and delete mode only) the member arguments are the glob patterns with ** like tar, it's the default")
+		fs.IntVar(&o.Decompress.Occurrence, "occurrence", 0, "(x, t and d mode only) process only the Nth occurrence of each member, and stop reading once all of the members are found")
+		fs.BoolVar(&o.Decompress.IgnoreZeros, "ignore-zeros", false, "(x, t and d mode only) continue reading after the end of archive blocks, e.g. the concatenated archives")
+		fs.StringVar(&o.Decompress.FromEncoding, "from-encoding", "", "(x, t and d mode only) the charset of the names in the legacy archive, e.g. latin1 and shift_jis, they are transcoded to UTF-8")
+		fs.IntVar(&o.Threads, "decompress-threads", 0, "(x, t and d mode only) the concurrency of the zstd decompression and the read ahead blocks of the gzip decompression, 0 is the count of the cpus and 1 disables it")
+		fs.StringVar(&o.Decompress.GlobalHeaders, "pax-global-headers", gotgz.GlobalHeadersIgnore, "(x, t and d mode only) how to read the pax global headers, ignore only prints them with -json, honor applies their mtime, atime, uid, gid, uname and gname to the following entries like POSIX, and keep lists and extracts them as the files like the legacy tars")
+		fs.BoolVar(&o.Decompress.Recover, "recover", false, "(x, t and d mode only) skip the corrupt regions and read everything salvageable from the damaged archive, the losses are reported at the end")
+	}
+
+	if mode == ModeTar || mode == ModeCreate || mode == ModeAppend || mode == ModeUpdate || mode == ModeList {
+		fs.StringVar(&o.Checksum, "checksum", "", "compute the checksum, it can be sha256, sha512, blake3, xxh64 or crc32, in c mode it's the checksum of the archive, in t mode it's printed for every regular file")
+	}
+
+	if mode == ModeTar || mode == ModeList {
+		fs.BoolVar(&o.Tree, "tree", false, "(t mode only) print the entries as a tree with the entry counts of the directories")
+		fs.BoolVar(&o.JSON, "json", false, "(t mode only) print the entries and the pax global header as json lines")
+		fs.BoolVar(&o.Long, "long", false, "(t mode only) print the permissions, the owner/group, the size and the modification time of the entries like tar -tv, the names are the ids with -numeric-owner")
+		fs.BoolVar(&o.TOCCache, "toc-cache", false, "(t mode only) cache the table of contents of the s3 archive by its etag in the user cache directory, e.g. ~/.cache/gotgz/toc, so the same archive is listed again without downloading it, it's ignored with -checksum")
+		registerTOCCacheFlags(fs, o)
+	}
+
+	if mode == ModeTar || mode == ModeExtract || mode == ModeList {
+		fs.StringVar(&o.Color, "color", "auto", "(x and t mode only) color the entries by type, and the overwritten and the skipped entries of -print-entries, it can be auto, always or never")
+		fs.StringVar(&o.NewerThan, "newer-than", "", "(x and t mode only) only the entries modified after the time, it's the duration before now like 24h or the time like 2025-01-30T19:00:00Z or 2025-01-30, e.g. restore everything changed in the last day before the incident")
+		fs.StringVar(&o.OlderThan, "older-than", "", "(x and t mode only) only the entries modified before the time, it's the same format as -newer-than")
+	}
+
+	if mode == ModeList {
+		fs.BoolVar(&o.NumericOwner, "numeric-owner", false, "print the uid and gid instead of the user and group names with -long")
+	}
+
+	if mode == ModeTar || mode == ModeExtract {
+		fs.BoolVar(&o.Decompress.NoSameOwner, "no-same-owner", true, "(x mode only) Do not extract owner and group IDs.")
+		fs.BoolVar(&o.Decompress.NoSamePerm, "no-same-permissions", true, "(x mode only) Do not extract full permissions")
+		fs.BoolVar(&o.Decompress.NoOverwrite, "no-overwrite", false, "(x mode only) Do not overwrite files")
+		fs.BoolVar(&o.Decompress.NoSameTime, "no-same-time", true, "(x mode only) Do not extract modification time")
+		fs.BoolVar(&o.Decompress.NoSameTime, "m", true, "alias to -touch")
+		fs.BoolVar(&o.Decompress.NoSameTime, "touch", true, "(x mode only) alias to -no-same-time, the extracted files have the current time")
+		fs.Var(invertBool{&o.Decompress.NoSameTime}, "same-time", "(x mode only) extract the modification time, the directory times are restored after their entries, it's the same as -no-same-time=false")
+		fs.Var(invertBool{&o.Decompress.NoSameOwner}, "same-owner", "(x mode only) extract the owner and group IDs, it's the same as -no-same-owner=false")
+		fs.Var(invertBool{&o.Decompress.NoSamePerm}, "same-permissions", "(x mode only) extract the full permissions, it's the same as -no-same-permissions=false")
+		fs.StringVar(&o.Decompress.OwnerFrom, "owner-from", gotgz.OwnerFromIDs, "(x mode only) restore the owners by the ids, the user and group names with the ids as the fallback, or skip it, it can be ids, names or skip, it works with -same-owner")
+		fs.StringVar(&o.Chown, "chown", "", "(x mode only) the user:group which owns the extracted entries, e.g. the service account of the staging restore, the user or the group can be omitted and they can be the names or the ids")
+		fs.BoolVar(&o.ExplainPolicy, "explain-policy", false, "(x mode only) print how the permissions, the owners, the times and the existing files are handled to the stderr before extracting, the defaults are the same for root unlike tar, e.g. check them in the containers")
+		fs.BoolVar(&o.Decompress.WarnMetadata, "warn-metadata", false, "(x mode only) log and count the failures to restore the owners and the times instead of failing, the exit code is 2 if there is any")
+		fs.BoolVar(&o.Decompress.RecursiveUnlink, "recursive-unlink", false, "(x mode only) remove the non-empty directory which is replaced by a file or a link in the archive")
+		fs.StringVar(&o.Decompress.StateFile, "state-file", "", "(x mode only) record the extracted entries to the file, the entries in it are skipped to resume the interrupted extraction, it's removed once the extraction is complete, the uncompressed archive is read from where it stopped")
+		fs.StringVar(&o.ArchivesFrom, "archives-from", "", "(x mode only) read the archives to extract from the file, one per line, they are extracted after the -f archives")
+		fs.IntVar(&o.Decompress.StripComponents, "strip-components", 0, "(x mode only) strip N leading components from file names on extraction")
+		fs.StringVar(&o.Decompress.Filter, "filter", gotgz.FilterAll, "(x mode only) the types of the entries to extract, all, files (only the regular files and the directories), no-links (skip the symbolic and hard links) or no-special (skip the devices and the fifos), or the presets docs, data and scripts (only the directories and the regular files with their extensions), e.g. the services ingesting the user archives")
+		fs.BoolVar(&o.Sandbox, "sandbox", false, "(x mode only) confine the process with landlock, so nothing outside of the directory can be changed even if the path checks are bypassed, e.g. the untrusted archives, the directories of -state-file, -memprofile and -metrics-textfile are writable too, linux 5.13+ and the build without cgo only")
+		fs.BoolVar(&o.PrintEntries, "print-entries", false, "(x mode only) print the extracted entries to the stdout like tar -xv, the overwritten existing files and the ones kept by -no-overwrite are marked")
+		fs.BoolVar(&o.Preview, "preview", false, "(x mode only) extract to the memory and print the tree of the result and the conflicts with the entries and the existing files, nothing is written, e.g. check -strip-components and -transform")
+		fs.BoolVar(&o.Decompress.TransformLinks, "transform-links", false, "(x mode only) apply -transform to the targets of the symbolic links too")
+		fs.BoolVar(&o.Decompress.RelativeLinks, "relative-links", false, "(x mode only) rewrite the absolute targets of the symbolic links to the relative ones in the destination, e.g. restore the system backup into a different root")
+	}
+
+	if mode == ModeTar || mode == ModeCreate || mode == ModeAppend || mode == ModeUpdate || mode == ModeExtract {
+		fs.Var((*stringsFlag)(&o.Decompress.Transform), "transform", "(c and x mode only) rename the entries with the sed replace expression like tar, e.g. s,^build/,release/, it can be repeated, in c mode the directories keep the trailing slash, in x mode it's applied after -strip-components and the members are matched before them")
+		fs.Var((*stringsFlag)(&o.Decompress.Transform), "xform", "alias to -transform")
+	}
+}
+
+// Parse parses the command line and then applies the environment variables and the config file
+// to the flags which are not set, so the precedence is flag > env > config > default
+func (o *Options) Parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := ApplyEnv(fs); err != nil {
+		return err
+	}
+	if err := ApplyConfigFile(fs, o.ConfigFile, o.Profile); err != nil {
+		return err
+	}
+	o.Args = fs.Args()
+	return nil
+}
+
+// Archives returns the -f archives and the ones in the -archives-from file
+func (o *Options) Archives() []string {
+	return append([]string(o.FileNames), o.listedArchives...)
+}
+
+// Sources returns the files to compress with the -C directories
+func (o *Options) Sources() ([]gotgz.Source, error) {
+	sources, err := ParseSources(o.Chdir, o.Args)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range o.listed {
+		sources = append(sources, gotgz.Source{Dir: o.Chdir, Path: name})
+	}
+	return sources, nil
+}
+
+// SourcesFrom returns the function which streams the files of -files-from to compress, they are read
+// while they are archived instead of ReadLists, it's nil if they are read by ReadLists
+func (o *Options) SourcesFrom(ctx context.Context) func(fn func(gotgz.Source) error) error {
+	if o.FilesFrom == "" || !o.Create && !o.Appending() || o.SplitByTopDir {
+		return nil
+	}
+	return func(fn func(gotgz.Source) error) error {
+		// the names are the paths as is, the `tar+` archives are only the arguments
+		err := ScanList(ctx, o.FilesFrom, o.filesFormat(), o.Level(), func(name string) error {
+			return fn(gotgz.Source{Dir: o.Chdir, Path: name})
+		})
+		if err != nil {
+			return fmt.Errorf("read the files from %s: %w", o.FilesFrom, err)
+		}
+		return nil
+	}
+}
+
+// Destination returns the directory to extract
+func (o *Options) Destination() string {
+	if o.Chdir != "" {
+		return o.Chdir
+	}
+	return o.Args[0]
+}
+
+// SetPriority applies -nice and -ionice to the process
+func (o *Options) SetPriority() error {
+	var ioClass, ioLevel int
+	if o.IONice != "" {
+		var err error
+		if ioClass, ioLevel, err = ParseIOPriority(o.IONice); err != nil {
+			return err
+		}
+	}
+	if o.Nice == 0 && ioClass == 0 {
+		return nil
+	}
+	return SetPriority(o.Nice, ioClass, ioLevel)
+}
+
+// ApplySandbox confines the process to the directory to extract,
+// the directories of the state file, the memory profile and the metrics are writable as well
+func (o *Options) ApplySandbox() error {
+	var dirs []string
+	if !o.Decompress.DryRun && !o.Preview {
+		dest := o.Destination()
+		if err := os.MkdirAll(dest, gotgz.DefaultDirPerm); err != nil {
+			return err
+		}
+		dirs = append(dirs, dest)
+	}
+	for _, file := range []string{o.Decompress.StateFile, o.MemProfile} {
+		if file != "" {
+			dirs = append(dirs, filepath.Dir(file))
+		}
+	}
+	if o.MetricsTextfile != "" {
+		dirs = append(dirs, o.MetricsTextfile)
+	}
+	return Sandbox(dirs...)
+}
+
+// DecompressThreads returns the decompression concurrency, it's the count of the cpus by default
+func (o *Options) DecompressThreads() int {
+	if o.Threads <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Threads
+}
+
+// Members returns the member arguments to extract or list
+func (o *Options) Members() []string {
+	members := o.Args
+	if o.Extract && o.Chdir == "" {
+		members = o.Args[1:]
+	}
+	if len(o.listed) > 0 {
+		return append(members[:len(members):len(members)], o.listed...)
+	}
+	return members
+}
+
+// Modified returns the range of -newer-than and -older-than, the durations are before now
+func (o *Options) Modified(now time.Time) (gotgz.TimeRange, error) {
+	var (
+		r   gotgz.TimeRange
+		err error
+	)
+	if r.NewerThan, err = ParseTime(o.NewerThan, now); err != nil {
+		return r, fmt.Errorf("invalid -newer-than: %w", err)
+	}
+	if r.OlderThan, err = ParseTime(o.OlderThan, now); err != nil {
+		return r, fmt.Errorf("invalid -older-than: %w", err)
+	}
+	if !r.NewerThan.IsZero() && !r.OlderThan.IsZero() && !r.NewerThan.Before(r.OlderThan) {
+		return r, errors.New("-newer-than should be before -older-than")
+	}
+	return r, nil
+}
+
+// filesFormat returns the format of -files-from, the lines are the names as is like `tar -T`
+func (o *Options) filesFormat() ListFormat {
+	if o.Null {
+		return ListNull
+	}
+	return ListVerbatim
+}
+
+// ReadLists reads -files-from, -archives-from, -exclude-from and -jobs, the lists are read once before the validation
+func (o *Options) ReadLists(ctx context.Context) error {
+	// the files to create are streamed by SourcesFrom, the split needs all of them
+	if o.FilesFrom != "" && (!o.Create && !o.Appending() || o.SplitByTopDir) {
+		listed, err := readList(ctx, o.FilesFrom, o.filesFormat(), o.Level())
+		if err != nil {
+			return fmt.Errorf("read the files from %s: %w", o.FilesFrom, err)
+		}
+		o.listed = listed
+	}
+	// the archives are read once, so the list can be the stdin or a fifo
+	if o.ArchivesFrom != "" {
+		archives, err := ReadList(ctx, o.ArchivesFrom, o.Level())
+		if err != nil {
+			return fmt.Errorf("read the archives from %s: %w", o.ArchivesFrom, err)
+		}
+		o.listedArchives = archives
+	}
+	if o.ExcludeFrom != "" {
+		patterns, err := ReadList(ctx, o.ExcludeFrom, o.Level())
+		if err != nil {
+			return fmt.Errorf("read the exclude patterns from %s: %w", o.ExcludeFrom, err)
+		}
+		o.Excludes = append(o.Excludes, patterns...)
+	}
+	if o.Jobs != "" {
+		lines, err := ReadList(ctx, o.Jobs, o.Level())
+		if err != nil {
+			return fmt.Errorf("read the jobs from %s: %w", o.Jobs, err)
+		}
+		if o.jobs, err = ParseJobs(lines, o.Chdir); err != nil {
+			return fmt.Errorf("%s: %w", o.Jobs, err)
+		}
+	}
+	return nil
+}
+
+func (o *Options) Level() slog.Level {
+	if o.Quiet {
+		return slog.LevelError
+	}
+	return ParseLogLevel(o.LogLevel)
+}
+
+// Operation returns the name of the action
+func (o *Options) Operation() string {
+	switch {
+	case o.Create:
+		return "create"
+	case o.Append:
+		return "append"
+	case o.Update:
+		return "update"
+	case o.Delete:
+		return "delete"
+	case o.Catenate:
+		return "catenate"
+	case o.Diff:
+		return "diff"
+	case o.Extract:
+		return "extract"
+	default:
+		return "list"
+	}
+}
+
+// validateJobs validates -jobs, the archives and their files are in the jobs file
+func (o *Options) validateJobs(archives []string) error {
+	switch {
+	case !o.Create:
+		return errors.New("-jobs is only for the create")
+	case len(archives) > 0:
+		return errors.New("-jobs can't be used with -file")
+	case len(o.Args) > 0 || o.FilesFrom != "":
+		return errors.New("-jobs can't be used with the files, they are in the jobs file")
+	case len(o.Tee) > 0 || o.UploadReport || o.AddStdin != "" || o.Verify:
+		return errors.New("-jobs can't be used with -tee, -upload-report, -add-stdin or -verify")
+	case len(o.jobs) == 0:
+		return errors.New("No jobs")
+	case o.S3PartSize < 5 || o.S3PartSize > 5*1024:
+		return errors.New("S3 part size should be between 5MB and 5GB")
+	}
+	return nil
+}
+
+// Appending reports whether the files are appended to the archive, i.e. -append or -update
+func (o *Options) Appending() bool {
+	return o.Append || o.Update
+}
+
+// SetMode selects the action for the subcommand
+func (o *Options) SetMode(mode Mode) {
+	switch mode {
+	case ModeCreate:
+		o.Create = true
+	case ModeAppend:
+		o.Append = true
+	case ModeUpdate:
+		o.Update = true
+	case ModeDelete:
+		o.Delete = true
+	case ModeCatenate:
+		o.Catenate = true
+	case ModeDiff:
+		o.Diff = true
+	case ModeExtract:
+		o.Extract = true
+	case ModeList:
+		o.List = true
+	}
+}
+
+func (o *Options) Validate() error {
+	archives := o.Archives()
+	if len(archives) == 0 && o.Jobs == "" {
+		return errors.New("File name is empty")
+	}
+
+	var actions int
+	for _, action := range []bool{o.Create, o.Append, o.Update, o.Delete, o.Catenate, o.Diff, o.Extract, o.List} {
+		if action {
+			actions++
+		}
+	}
+
+	if actions == 0 {
+		return errors.New("No action :)")
+	}
+
+	if actions > 1 {
+		return errors.New("You can only create, append, update, delete, catenate, diff, extract or list at the same time")
+	}
+
+	if len(archives) > 1 && !o.Extract {
+		return errors.New("Only the extraction supports multiple archives")
+	}
+
+	if o.Extract && o.Chdir == "" && len(o.Args) == 0 {
+		return errors.New("No directory to extract")
+	}
+
+	if o.ArchivesFrom == "-" && (o.FilesFrom == "-" || slices.Contains([]string(o.FileNames), "-")) {
+		return errors.New("-archives-from - reads the stdin, it can't be read by -files-from or -f too")
+	}
+	if o.FilesFrom == "-" && (o.AddStdin != "" || !o.Create && slices.Contains(archives, "-")) {
+		return errors.New("-files-from can't read the stdin which is the archive or -add-stdin")
+	}
+
+	// the memory spool isn't bounded, it holds the archive which isn't uploaded yet
+	if o.Spool == gotgz.SpoolMemory && o.MaxMemory > 0 {
+		return errors.New("-s3-spool=memory isn't limited by -max-memory, use the directory of the temporary file instead")
+	}
+
+	if err := validateMetricsJob(o.MetricsJob); err != nil {
+		return err
+	}
+
+	if o.JSON && o.Tree {
+		return errors.New("-json and -tree can't be used together")
+	}
+
+	if o.Long && (o.JSON || o.Tree) {
+		return errors.New("-long can't be used with -json or -tree")
+	}
+
+	if _, err := o.Modified(time.Now()); err != nil {
+		return err
+	}
+
+	if _, _, _, err := ParsePAXOptions(o.PAXOptions); err != nil {
+		return err
+	}
+
+	if o.Decompress.Occurrence > 0 && (o.Extract || o.List) && len(o.Members()) == 0 {
+		return errors.New("-occurrence is meaningless without the members")
+	}
+
+	if o.Jobs != "" {
+		return o.validateJobs(archives)
+	}
+
+	if o.SplitByTopDir {
+		switch {
+		case !o.Create:
+			return errors.New("-split-by-top-dir is only for the create")
+		case !strings.Contains(archives[0], "{name}"):
+			return errors.New("-split-by-top-dir needs the {name} placeholder in -file")
+		case isStream(archives[0]):
+			return errors.New("-split-by-top-dir can't write to the stream")
+		case len(o.Tee) > 0 || o.UploadReport || o.AddStdin != "":
+			return errors.New("-split-by-top-dir can't be used with -tee, -upload-report or -add-stdin")
+		}
+	}
+
+	if o.Verify {
+		switch {
+		case !o.Create:
+			return errors.New("-verify is only for the create")
+		case isStream(archives[0]):
+			return errors.New("-verify can't read the stream again")
+		case o.Decompress.DryRun:
+			return errors.New("-verify can't be used with -dry-run, the archive isn't written")
+		case len(o.Tee) > 0 || o.SplitByTopDir:
+			return errors.New("-verify can't be used with -tee or -split-by-top-dir")
+		}
+	}
+
+	if o.Appending() && len(o.Tee) > 0 {
+		return errors.New("-tee can't be used with -append or -update")
+	}
+
+	if o.Appending() && o.Manifest {
+		return errors.New("-manifest can't be used with -append or -update, the manifest of the existing archive would be stale")
+	}
+
+	if o.Delete && len(o.Members()) == 0 {
+		return errors.New("No members to delete")
+	}
+
+	if o.Catenate && len(o.Args) == 0 {
+		return errors.New("No archives to catenate")
+	}
+
+	if o.Create || o.Appending() {
+		sources, err := o.Sources()
+		if err != nil {
+			return err
+		}
+		// the streamed list can be empty, it's the same as tar
+		if len(sources) == 0 && o.AddStdin == "" && o.SourcesFrom(context.Background()) == nil {
+			return errors.New("No files to compress")
+		}
+	}
+
+	// https://docs.aws.amazon.com/AmazonS3/latest/userguide/qfacts.html
+	if (o.Create || o.Appending() || o.Delete || o.Catenate) && (o.S3PartSize < 5 || o.S3PartSize > 5*1024) {
+		return errors.New("S3 part size should be between 5MB and 5GB")
+	}
+	return nil
+}
+
+// validateMetricsJob returns the error if the job can't be the name of the file in -metrics-textfile
+func validateMetricsJob(job string) error {
+	switch {
+	case job == "":
+		return errors.New("-metrics-job can't be empty")
+	case strings.ContainsAny(job, `/\`):
+		return errors.New("-metrics-job can't have the path separators")
+	}
+	return nil
+}
+
+// registerTOCCacheFlags registers the flags of the toc cache, they are shared by the t mode and the cat command
+func registerTOCCacheFlags(fs *flag.FlagSet, o *Options) {
+	fs.Int64Var(&o.TOCCacheHead, "toc-cache-head", 0, "cache the first MB of the s3 archive with its table of contents, so cat reads the members in it without downloading the archive")
+	fs.Int64Var(&o.TOCCacheMaxSize, "toc-cache-max-size", 0, "the max MB of the toc cache, the least recently used archives are evicted, 0 means unlimited")
+	fs.DurationVar(&o.TOCCacheMaxAge, "toc-cache-max-age", 0, "evict the archives in the toc cache which aren't used in the duration, e.g. 168h, 0 means unlimited")
+}
+
+// TOCCacheConfig returns the toc cache in the user cache directory with the limits in bytes
+func (o *Options) TOCCacheConfig() (gotgz.TOCCache, error) {
+	if o.TOCCacheHead < 0 || o.TOCCacheMaxSize < 0 || o.TOCCacheMaxAge < 0 {
+		return gotgz.TOCCache{}, errors.New("the toc cache limits can't be negative")
+	}
+	dir, err := o.TOCCacheDir()
+	if err != nil {
+		return gotgz.TOCCache{}, err
+	}
+	return gotgz.TOCCache{
+		Dir:      dir,
+		HeadSize: o.TOCCacheHead << 20,
+		MaxSize:  o.TOCCacheMaxSize << 20,
+		MaxAge:   o.TOCCacheMaxAge,
+	}, nil
+}
+
+// TOCCacheDir returns the directory of the cached table of contents, it's under the user cache directory,
+// e.g. ~/.cache/gotgz/toc on Linux or $XDG_CACHE_HOME/gotgz/toc
+func (o *Options) TOCCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gotgz", "toc"), nil
+}
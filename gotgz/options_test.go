@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    Mode
+		args    []string
+		wantErr bool
+	}{
+		{
+			name: "Create",
+			args: []string{"-c", "-f", "a.tgz", "dir"},
+		},
+		{
+			name: "Create command",
+			mode: ModeCreate,
+			args: []string{"-f", "a.tgz", "dir1", "dir2"},
+		},
+		{
+			name:    "Create without files",
+			mode:    ModeCreate,
+			args:    []string{"-f", "a.tgz"},
+			wantErr: true,
+		},
+		{
+			name:    "Empty metrics job",
+			args:    []string{"-c", "-f", "a.tgz", "-metrics-textfile", "metrics", "-metrics-job", "", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Metrics job with the path",
+			args:    []string{"-c", "-f", "a.tgz", "-metrics-textfile", "metrics", "-metrics-job", "a/b", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Memory spool with max memory",
+			args:    []string{"-c", "-f", "s3://bucket/a.tgz", "-s3-spool", "memory", "-max-memory", "256", "dir"},
+			wantErr: true,
+		},
+		{
+			name: "File spool with max memory",
+			args: []string{"-c", "-f", "s3://bucket/a.tgz", "-s3-spool", "/tmp", "-max-memory", "256", "dir"},
+		},
+		{
+			name: "Append",
+			args: []string{"-r", "-f", "a.tgz", "dir"},
+		},
+		{
+			name: "Append command",
+			mode: ModeAppend,
+			args: []string{"-f", "a.tgz", "dir"},
+		},
+		{
+			name: "Update command",
+			mode: ModeUpdate,
+			args: []string{"-f", "a.tgz", "dir"},
+		},
+		{
+			name:    "Append and update",
+			args:    []string{"-r", "-u", "-f", "a.tgz", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Append with manifest",
+			mode:    ModeAppend,
+			args:    []string{"-f", "a.tgz", "-manifest", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Append with tee",
+			args:    []string{"-r", "-f", "a.tgz", "-tee", "b.tgz", "dir"},
+			wantErr: true,
+		},
+		{
+			name: "Extract command",
+			mode: ModeExtract,
+			args: []string{"-f", "a.tgz", "dir"},
+		},
+		{
+			name: "List",
+			args: []string{"-t", "-f", "a.tgz"},
+		},
+		{
+			name: "List members",
+			mode: ModeList,
+			args: []string{"-f", "a.tgz", "dir"},
+		},
+		{
+			name:    "Extract without directory",
+			mode:    ModeExtract,
+			args:    []string{"-f", "a.tgz"},
+			wantErr: true,
+		},
+		{
+			name: "Extract members to directory",
+			mode: ModeExtract,
+			args: []string{"-f", "a.tgz", "-C", "dir", "etc/nginx"},
+		},
+		{
+			name: "Extract multiple archives",
+			mode: ModeExtract,
+			args: []string{"-f", "a.tgz", "-f", "s3://bucket/b.tgz", "-C", "dir"},
+		},
+		{
+			name:    "Create multiple archives",
+			mode:    ModeCreate,
+			args:    []string{"-f", "a.tgz", "-f", "b.tgz", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Archives from missing file",
+			mode:    ModeExtract,
+			args:    []string{"-archives-from", "testdata/missing.txt", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Multiple actions",
+			args:    []string{"-c", "-x", "-f", "a.tgz", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "No action",
+			args:    []string{"-f", "a.tgz", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "No file name",
+			mode:    ModeExtract,
+			args:    []string{"dir"},
+			wantErr: true,
+		},
+		{
+			name: "Delete command",
+			mode: ModeDelete,
+			args: []string{"-f", "a.tar", "dir/file"},
+		},
+		{
+			name:    "Delete without members",
+			args:    []string{"-delete", "-f", "a.tar"},
+			wantErr: true,
+		},
+		{
+			name: "Catenate",
+			args: []string{"-A", "-f", "a.tar", "b.tar", "c.tar.gz"},
+		},
+		{
+			name:    "Catenate without archives",
+			mode:    ModeCatenate,
+			args:    []string{"-f", "a.tar"},
+			wantErr: true,
+		},
+		{
+			name: "Split by top dir",
+			args: []string{"-c", "-split-by-top-dir", "-f", "s3://bucket/{name}.tgz", "a", "b"},
+		},
+		{
+			name:    "Split by top dir without placeholder",
+			args:    []string{"-c", "-split-by-top-dir", "-f", "s3://bucket/a.tgz", "a", "b"},
+			wantErr: true,
+		},
+		{
+			name: "Diff",
+			args: []string{"-d", "-f", "a.tgz", "-C", "/data"},
+		},
+		{
+			name:    "Diff and extract",
+			args:    []string{"-d", "-x", "-f", "a.tgz", "-C", "/data"},
+			wantErr: true,
+		},
+		{
+			name: "Long",
+			mode: ModeList,
+			args: []string{"-long", "-numeric-owner", "-f", "a.tgz"},
+		},
+		{
+			name:    "Long and json",
+			args:    []string{"-t", "-long", "-json", "-f", "a.tgz"},
+			wantErr: true,
+		},
+		{
+			name: "Files from the stdin",
+			args: []string{"-c", "-null", "-T", "-", "-f", "a.tgz", "dir"},
+		},
+		{
+			name:    "Files from the stdin archive",
+			args:    []string{"-x", "-0", "-T", "-", "-f", "-", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Archives and files from the stdin",
+			args:    []string{"-x", "-archives-from", "-", "-T", "-", "dir"},
+			wantErr: true,
+		},
+		{
+			name: "Member matching",
+			args: []string{"-x", "-no-anchored", "-ignore-case", "-wildcards", "-f", "a.tgz", "dir", "*.sql"},
+		},
+		{
+			name: "Modified",
+			args: []string{"-x", "-newer-than", "24h", "-older-than", "1h", "-f", "a.tgz", "dir"},
+		},
+		{
+			name:    "Modified the other way round",
+			mode:    ModeList,
+			args:    []string{"-newer-than", "2025-01-30", "-older-than", "2025-01-29", "-f", "a.tgz"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid newer than",
+			args:    []string{"-t", "-newer-than", "yesterday", "-f", "a.tgz"},
+			wantErr: true,
+		},
+		{
+			name: "Verify",
+			args: []string{"-c", "-W", "-f", "s3://bucket/a.tgz", "dir"},
+		},
+		{
+			name:    "Verify the stream",
+			args:    []string{"-c", "-verify", "-f", "-", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Verify the dry run",
+			args:    []string{"-c", "-verify", "-dry-run", "-f", "a.tgz", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Verify the append",
+			args:    []string{"-r", "-verify", "-f", "a.tgz", "dir"},
+			wantErr: true,
+		},
+		{
+			name:    "Jobs with file name",
+			args:    []string{"-c", "-f", "a.tgz", "-jobs", "jobs.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "Jobs with extract",
+			args:    []string{"-x", "-jobs", "jobs.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid part size",
+			args:    []string{"-c", "-f", "a.tgz", "-s3-part-size", "1", "dir"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			fs := flag.NewFlagSet(tt.name, flag.ContinueOnError)
+			opts.RegisterFlags(fs, tt.mode)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			opts.SetMode(tt.mode)
+			opts.Args = fs.Args()
+			if err := opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptions_Level(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want slog.Level
+	}{
+		{name: "Default", args: []string{}, want: slog.LevelInfo},
+		{name: "Verbose", args: []string{"-v", "debug"}, want: slog.LevelDebug},
+		{name: "Log level", args: []string{"-log-level", "warn"}, want: slog.LevelWarn},
+		{name: "Quiet", args: []string{"-q", "-log-level", "debug"}, want: slog.LevelError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			fs := flag.NewFlagSet(tt.name, flag.ContinueOnError)
+			opts.RegisterFlags(fs, ModeTar)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if got := opts.Level(); got != tt.want {
+				t.Errorf("Level() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions_Archives(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "archives.txt")
+	if err := os.WriteFile(list, []byte("# chain\nfull.tgz\n\n  s3://bucket/inc-1.tgz  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{FileNames: filesFlag{"base.tgz"}, ArchivesFrom: list}
+	if err := opts.ReadLists(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the list is read once, so it can be the stdin
+	if err := os.Remove(list); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"base.tgz", "full.tgz", "s3://bucket/inc-1.tgz"}; !reflect.DeepEqual(opts.Archives(), want) {
+		t.Errorf("Archives() = %v, want %v", opts.Archives(), want)
+	}
+}
+
+func TestOptions_SameTime(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: nil, want: true},
+		{args: []string{"-same-time"}, want: false},
+		{args: []string{"-same-time", "-touch"}, want: true},
+		{args: []string{"-no-same-time=false"}, want: false},
+		{args: []string{"-same-time=false"}, want: true},
+	}
+	for _, tt := range tests {
+		var opts Options
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		opts.RegisterFlags(fs, ModeExtract)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if opts.Decompress.NoSameTime != tt.want {
+			t.Errorf("%v: NoSameTime = %v, want %v", tt.args, opts.Decompress.NoSameTime, tt.want)
+		}
+	}
+}
+
+func TestOptions_ReadLists(t *testing.T) {
+	dir := t.TempDir()
+	files, excludes := filepath.Join(dir, "files.txt"), filepath.Join(dir, "excludes.txt")
+	if err := os.WriteFile(files, []byte("etc/nginx\n# not comment\n\n var/www\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(excludes, []byte("*.log\n\n**/cache/**\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeCreate)
+	if err := fs.Parse([]string{"-f", "a.tgz", "-C", "/", "-T", files, "-exclude-from", excludes, "-e", "*.tmp", "home"}); err != nil {
+		t.Fatal(err)
+	}
+	opts.SetMode(ModeCreate)
+	opts.Args = fs.Args()
+	if err := opts.ReadLists(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := opts.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the listed files are streamed while they are archived
+	err = opts.SourcesFrom(context.Background())(func(source gotgz.Source) error {
+		sources = append(sources, source)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lines are the names as is like tar -T
+	want := []gotgz.Source{{Dir: "/", Path: "home"}, {Dir: "/", Path: "etc/nginx"}, {Dir: "/", Path: "# not comment"}, {Dir: "/", Path: " var/www"}}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("Sources() = %v, want %v", sources, want)
+	}
+	if want := (stringsFlag{"*.tmp", "*.log", "**/cache/**"}); !reflect.DeepEqual(opts.Excludes, want) {
+		t.Errorf("Excludes = %v, want %v", opts.Excludes, want)
+	}
+
+	// the listed names are the members on extract
+	opts = Options{Extract: true, Args: []string{"dest", "etc/hosts"}, FilesFrom: files}
+	if err := opts.ReadLists(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if opts.SourcesFrom(context.Background()) != nil {
+		t.Error("SourcesFrom() should be nil on extract")
+	}
+	if got, want := opts.Members(), []string{"etc/hosts", "etc/nginx", "# not comment", " var/www"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Members() = %v, want %v", got, want)
+	}
+
+	// the names separated by NUL are kept as is
+	nulls := filepath.Join(dir, "files.nul")
+	if err := os.WriteFile(nulls, []byte("my docs/a b\x00line\nbreak\x00\x00# not comment"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts = Options{List: true, FilesFrom: nulls, Null: true}
+	if err := opts.ReadLists(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := opts.Members(), []string{"my docs/a b", "line\nbreak", "# not comment"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Members() = %q, want %q", got, want)
+	}
+
+	opts = Options{FilesFrom: filepath.Join(dir, "missing.txt")}
+	if err := opts.ReadLists(context.Background()); err == nil {
+		t.Error("ReadLists() error = nil, want the missing file error")
+	}
+	opts = Options{Create: true, FilesFrom: filepath.Join(dir, "missing.txt")}
+	if err := opts.SourcesFrom(context.Background())(func(gotgz.Source) error { return nil }); err == nil {
+		t.Error("SourcesFrom() error = nil, want the missing file error")
+	}
+}
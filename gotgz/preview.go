@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Preview is the in-memory result of the extraction, the entries are added by their target paths,
+// so the later entries replace the earlier ones like the extraction, and the conflicts with
+// the other entries and the existing files are recorded
+type Preview struct {
+	dir       string
+	tree      *Tree
+	entries   map[string]*tar.Header
+	conflicts []string
+}
+
+func NewPreview(dir string) *Preview {
+	return &Preview{dir: dir, tree: NewTree(), entries: make(map[string]*tar.Header)}
+}
+
+// Add is the gotgz.DecompressFlags.Preview which adds the entry to the tree instead of extracting it
+func (p *Preview) Add(header *tar.Header, dest string) error {
+	isDir := header.Typeflag == tar.TypeDir
+	if prev, ok := p.entries[dest]; ok {
+		if !isDir || prev.Typeflag != tar.TypeDir {
+			p.conflicts = append(p.conflicts, fmt.Sprintf("%s: the %s %s replaces the %s %s in the archive",
+				dest, entryKind(header.Typeflag), header.Name, entryKind(prev.Typeflag), prev.Name))
+		}
+	} else if fi, err := os.Lstat(dest); err == nil && !(isDir && fi.IsDir()) {
+		p.conflicts = append(p.conflicts, fmt.Sprintf("%s: the %s %s replaces the existing %s",
+			dest, entryKind(header.Typeflag), header.Name, fileKind(fi.Mode())))
+	}
+	p.entries[dest] = header
+
+	// the entries outside of the directory are kept by their absolute paths
+	name := dest
+	if rel, err := filepath.Rel(p.dir, dest); err == nil && filepath.IsLocal(rel) {
+		name = rel
+	}
+	entry := *header
+	entry.Name = filepath.ToSlash(name)
+	return p.tree.Add(&entry, nil)
+}
+
+// Print writes the tree of the extracted entries and then the conflicts
+func (p *Preview) Print(w io.Writer, color bool) error {
+	if err := p.tree.Print(w, color); err != nil {
+		return err
+	}
+	if len(p.conflicts) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "\nconflicts (%d):\n", len(p.conflicts)); err != nil {
+		return err
+	}
+	for _, conflict := range p.conflicts {
+		if _, err := fmt.Fprintln(w, conflict); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func entryKind(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeDir:
+		return "directory"
+	case tar.TypeReg:
+		return "file"
+	case tar.TypeSymlink:
+		return "symbolic link"
+	case tar.TypeLink:
+		return "hard link"
+	default:
+		return "special file"
+	}
+}
+
+func fileKind(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode.IsRegular():
+		return "file"
+	case mode&fs.ModeSymlink != 0:
+		return "symbolic link"
+	default:
+		return "special file"
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestPreview(t *testing.T) {
+	var archive bytes.Buffer
+	zw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(zw)
+	for _, header := range []*tar.Header{
+		{Name: "app-1.0/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "app-1.0/bin/app", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "app-1.0/etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "app-1.1/etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "app", "bin", "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "app")
+	preview := NewPreview(dir)
+	flags := gotgz.DecompressFlags{
+		Archiver:        gotgz.GZipArchiver{},
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		StripComponents: 1,
+		Preview:         preview.Add,
+	}
+	if err := gotgz.Decompress(context.Background(), io.NopCloser(&archive), dir, flags); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := preview.Print(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `├── bin/ (1)
+│   └── app
+└── etc/ (1)
+    └── app.conf
+
+conflicts (2):
+` + filepath.Join(dir, "bin/app") + `: the file app-1.0/bin/app replaces the existing directory
+` + filepath.Join(dir, "etc/app.conf") + `: the file app-1.1/etc/app.conf replaces the file app-1.0/etc/app.conf in the archive
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+	// nothing is written to the disk
+	if _, err := os.Stat(filepath.Join(dir, "etc")); !os.IsNotExist(err) {
+		t.Errorf("the preview writes to the disk, stat error = %v", err)
+	}
+}
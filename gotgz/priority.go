@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the io scheduling classes of ioprio_set
+const (
+	IOClassRealtime   = 1
+	IOClassBestEffort = 2
+	IOClassIdle       = 3
+)
+
+// ParseIOPriority parses the io priority like class[:level], the class is realtime, best-effort or idle,
+// and the level is 0 (highest) to 7 (lowest), it's 4 by default and it's ignored for idle
+func ParseIOPriority(spec string) (class, level int, err error) {
+	name, levelSpec, hasLevel := strings.Cut(spec, ":")
+	switch name {
+	case "realtime", "rt":
+		class = IOClassRealtime
+	case "best-effort", "be":
+		class = IOClassBestEffort
+	case "idle":
+		class = IOClassIdle
+	default:
+		return 0, 0, fmt.Errorf("invalid io priority class %q, it should be realtime, best-effort or idle", name)
+	}
+	level = 4
+	if hasLevel {
+		if level, err = strconv.Atoi(levelSpec); err != nil || level < 0 || level > 7 {
+			return 0, 0, fmt.Errorf("invalid io priority level %q, it should be 0 to 7", levelSpec)
+		}
+	}
+	if class == IOClassIdle {
+		level = 0
+	}
+	return class, level, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioprioWhoProcess is IOPRIO_WHO_PROCESS of ioprio_set, it's the thread id on linux
+const ioprioWhoProcess = 1
+
+// SetPriority sets the nice value and the io priority of the process, they are per thread on linux,
+// so every thread is set and the new threads inherit them, they are not set if they are 0
+func SetPriority(nice, ioClass, ioLevel int) error {
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if nice != 0 {
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil {
+				return os.NewSyscallError("setpriority", err)
+			}
+		}
+		if ioClass != 0 {
+			if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioClass<<13|ioLevel)); errno != 0 {
+				return os.NewSyscallError("ioprio_set", errno)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// SetPriority is only supported on linux
+func SetPriority(nice, ioClass, ioLevel int) error {
+	return errors.New("-nice and -ionice are only supported on linux")
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseIOPriority(t *testing.T) {
+	tests := []struct {
+		spec         string
+		class, level int
+		wantErr      bool
+	}{
+		{spec: "idle", class: IOClassIdle},
+		{spec: "idle:3", class: IOClassIdle},
+		{spec: "best-effort", class: IOClassBestEffort, level: 4},
+		{spec: "be:7", class: IOClassBestEffort, level: 7},
+		{spec: "realtime:0", class: IOClassRealtime},
+		{spec: "be:8", wantErr: true},
+		{spec: "be:", wantErr: true},
+		{spec: "low", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			class, level, err := ParseIOPriority(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIOPriority() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if class != tt.class || level != tt.level {
+				t.Errorf("ParseIOPriority() = %d, %d, want %d, %d", class, level, tt.class, tt.level)
+			}
+		})
+	}
+}
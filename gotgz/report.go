@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/islishude/gotgz"
+)
+
+// ReportSuffix is the suffix of the report which is written next to the archive
+const ReportSuffix = ".report.json"
+
+// Report is the json summary of the created archive, it's written by -upload-report as the audit trail
+type Report struct {
+	Archive   string            `json:"archive"`
+	Sources   []string          `json:"sources"`
+	Algorithm string            `json:"algorithm"`
+	Checksum  map[string]string `json:"checksum,omitempty"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Version   string            `json:"version"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Duration  string            `json:"duration"`
+	Files     int               `json:"files"`
+	Dirs      int               `json:"dirs"`
+	Symlinks  int               `json:"symlinks"`
+	Hardlinks int               `json:"hardlinks"`
+	BytesIn   int64             `json:"bytes_in"`
+	BytesOut  int64             `json:"bytes_out"`
+	Warnings  []string          `json:"warnings,omitempty"`
+}
+
+// NewReport returns the report of the archive which is created since the start
+func NewReport(archive string, opts *Options, sources []gotgz.Source, stats *gotgz.Stats, checksum []byte, start time.Time) Report {
+	end := time.Now()
+	report := Report{
+		Archive:   archive,
+		Algorithm: opts.Algorithm,
+		Version:   gotgz.Version,
+		Start:     start,
+		End:       end,
+		Duration:  end.Sub(start).String(),
+		Files:     stats.Files,
+		Dirs:      stats.Dirs,
+		Symlinks:  stats.Symlinks,
+		Hardlinks: stats.Hardlinks,
+		BytesIn:   stats.BytesIn,
+		BytesOut:  stats.BytesOut,
+		Warnings:  stats.Warnings,
+	}
+	for _, src := range sources {
+		report.Sources = append(report.Sources, src.Root())
+	}
+	if checksum != nil {
+		report.Checksum = map[string]string{opts.Checksum: hex.EncodeToString(checksum)}
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		report.Hostname = hostname
+	}
+	return report
+}
+
+// Marshal returns the indented json of the report
+func (r Report) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
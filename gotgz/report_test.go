@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun_UploadReport(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "a.tgz")
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeTar)
+	if err := opts.Parse(fs, []string{"-c", "-f", archive, "-checksum", "sha256", "-upload-report", source}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(&opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(archive + ReportSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Archive != archive || report.Files != 1 || report.Dirs != 1 || report.BytesIn != 7 || report.BytesOut != info.Size() {
+		t.Errorf("report = %+v, want the archive with 1 file and 1 directory", report)
+	}
+	if len(report.Sources) != 1 || report.Sources[0] != source {
+		t.Errorf("Sources = %v, want %v", report.Sources, source)
+	}
+	if len(report.Checksum["sha256"]) != 64 {
+		t.Errorf("Checksum = %v, want the sha256 of the archive", report.Checksum)
+	}
+}
+
+func TestRun_UploadReportTee(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	archive, tee := filepath.Join(dir, "a.tgz"), filepath.Join(dir, "b.tgz")
+	var opts Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs, ModeTar)
+	if err := opts.Parse(fs, []string{"-c", "-f", archive, "-tee", tee, "-upload-report", source}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(&opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// every destination has its own report
+	for _, path := range []string{archive, tee} {
+		data, err := os.ReadFile(path + ReportSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Archive != path || report.Files != 1 {
+			t.Errorf("report = %+v, want the archive %s with 1 file", report, path)
+		}
+	}
+}
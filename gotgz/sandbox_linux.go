@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxAccess are the rights to change the files which are only granted in the sandbox directories,
+// the reads are not restricted, so the archive, the config and the certificates can be read
+const sandboxAccess = unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+	unix.LANDLOCK_ACCESS_FS_REMOVE_FILE | unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+	unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_MAKE_SOCK | unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+	unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK | unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+
+// Sandbox confines the process with landlock, so only the directories and their children can be changed,
+// it's enforced by the kernel for all of the threads and it can't be undone
+func Sandbox(dirs ...string) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return fmt.Errorf("the sandbox isn't supported, landlock is disabled or the kernel is older than 5.13: %w", errno)
+	}
+	access := uint64(sandboxAccess)
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: access}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return os.NewSyscallError("landlock_create_ruleset", errno)
+	}
+	defer unix.Close(int(fd))
+
+	for _, dir := range dirs {
+		if err := addSandboxDir(int(fd), dir, access); err != nil {
+			return err
+		}
+	}
+
+	// the threads without CAP_SYS_ADMIN can't be restricted without no_new_privs,
+	// and the go runtime can only run the syscalls on all of the threads without cgo
+	for _, call := range []struct {
+		name         string
+		trap, a1, a2 uintptr
+	}{
+		{name: "prctl", trap: unix.SYS_PRCTL, a1: unix.PR_SET_NO_NEW_PRIVS, a2: 1},
+		{name: "landlock_restrict_self", trap: unix.SYS_LANDLOCK_RESTRICT_SELF, a1: fd},
+	} {
+		if _, _, errno := syscall.AllThreadsSyscall(call.trap, call.a1, call.a2, 0); errno != 0 {
+			if errors.Is(errno, syscall.ENOTSUP) {
+				return errors.New("the sandbox isn't supported by the cgo build, build it with CGO_ENABLED=0")
+			}
+			return os.NewSyscallError(call.name, errno)
+		}
+	}
+	return nil
+}
+
+func addSandboxDir(ruleset int, dir string, access uint64) error {
+	fd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	defer unix.Close(fd)
+
+	attr := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return os.NewSyscallError("landlock_add_rule", errno)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandbox(t *testing.T) {
+	// the sandbox can't be undone, so it's applied in the child process
+	if dir := os.Getenv("GOTGZ_TEST_SANDBOX"); dir != "" {
+		if err := Sandbox(filepath.Join(dir, "inside")); err != nil {
+			t.Skip(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "inside", "file"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "outside"), nil, 0644); !errors.Is(err, os.ErrPermission) {
+			t.Fatalf("write outside of the sandbox: %v", err)
+		}
+		return
+	}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "inside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSandbox$", "-test.v")
+	cmd.Env = append(os.Environ(), "GOTGZ_TEST_SANDBOX="+dir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if strings.Contains(string(output), "--- SKIP") {
+		t.Skipf("%s", output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "inside", "file")); err != nil {
+		t.Error(err)
+	}
+}
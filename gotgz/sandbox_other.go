@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Sandbox is only supported on linux
+func Sandbox(dirs ...string) error {
+	return errors.New("-sandbox is only supported on linux")
+}
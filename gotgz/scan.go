@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/islishude/gotgz"
+)
+
+// CommandScanner returns the scanner which runs the shell command for every regular file,
+// the content is the stdin, the path is the first argument and the GOTGZ_FILE environment variable,
+// the exit code 0 includes the file, 1 skips it and the others abort the creation,
+// the output of the command is written to the stderr, so it doesn't mix with the archive stream
+func CommandScanner(ctx context.Context, command string) gotgz.Scanner {
+	return func(path string, content io.Reader) (gotgz.ScanResult, error) {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command, path)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", command, "gotgz", path)
+		}
+		cmd.Env = append(os.Environ(), "GOTGZ_FILE="+path)
+		cmd.Stdin = content
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			return gotgz.ScanInclude, nil
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+			return gotgz.ScanSkip, nil
+		case errors.As(err, &exitErr):
+			return gotgz.ScanAbort, nil
+		default:
+			return gotgz.ScanAbort, err
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/islishude/gotgz"
+)
+
+func TestCommandScanner(t *testing.T) {
+	tests := []struct {
+		command string
+		content string
+		want    gotgz.ScanResult
+		wantErr bool
+	}{
+		{command: "! grep -q SECRET || exit 1", content: "data", want: gotgz.ScanInclude},
+		{command: "! grep -q SECRET || exit 1", content: "SECRET", want: gotgz.ScanSkip},
+		{command: `test "$1" = "$GOTGZ_FILE" && exit 3`, content: "data", want: gotgz.ScanAbort},
+		{command: "true", content: "data", want: gotgz.ScanInclude},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			scanner := CommandScanner(context.Background(), tt.command)
+			got, err := scanner("dir/file", strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scan error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("scan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
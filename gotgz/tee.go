@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/islishude/gotgz"
+)
+
+// createTee writes the same archive to all of the destinations, the sources are read and compressed once,
+// the s3 uploads are aborted and the local archives are removed if any of them fails
+func createTee(ctx context.Context, destinations []string, opts *Options, flags gotgz.CompressFlags, sources []gotgz.Source) (err error) {
+	var writers []io.WriteCloser
+	var locals []string
+	defer func() {
+		if err != nil && !opts.KeepPartial {
+			for _, fileName := range locals {
+				removePartial(fileName)
+			}
+		}
+	}()
+
+	for _, fileName := range destinations {
+		fileName, err := teeDestination(fileName, opts.FileSuffix)
+		if err != nil {
+			return err
+		}
+		// the metadata in the s3 url query is only for the upload
+		wFlags := gotgz.RecompressFlags{
+			To:         flags.Archiver,
+			Logger:     flags.Logger,
+			S3PartSize: flags.S3PartSize,
+			S3Thread:   flags.S3Thread,
+		}
+		w, err := openWriter(ctx, fileName, opts.Level(), &wFlags)
+		if err != nil {
+			abortWriters(writers, err)
+			return err
+		}
+		writers = append(writers, w)
+		if !strings.HasPrefix(fileName, "s3://") {
+			locals = append(locals, fileName)
+		}
+	}
+	return gotgz.CompressSources(ctx, gotgz.NewTeeWriter(writers...), flags, sources...)
+}
+
+// writeTeeReports writes the report next to every archive of -tee after they are created, the streams are skipped
+func writeTeeReports(ctx context.Context, destinations []string, opts *Options, newReport func(archive string) ([]byte, error)) error {
+	for _, fileName := range destinations {
+		fileName, err := teeDestination(fileName, opts.FileSuffix)
+		if err != nil {
+			return err
+		}
+		if isStream(fileName) {
+			slog.Warn("the report isn't written for the stream", "path", fileName)
+			continue
+		}
+		dest, err := url.Parse(fileName)
+		if err != nil {
+			return err
+		}
+		if !gotgz.IsS3(dest) {
+			report, err := newReport(fileName)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(fileName+ReportSuffix, report, 0644); err != nil {
+				return err
+			}
+			continue
+		}
+
+		query, err := gotgz.ParseArchiveQuery(dest.RawQuery)
+		if err != nil {
+			return err
+		}
+		client, err := NewS3Client(ctx, dest.Host, query, opts.Level())
+		if err != nil {
+			return err
+		}
+		s3Path := strings.TrimPrefix(filepath.Clean(dest.Path), "/")
+		report, err := newReport(fmt.Sprintf("s3://%s/%s", dest.Host, s3Path))
+		if err != nil {
+			return err
+		}
+		if err := client.Put(ctx, s3Path+ReportSuffix, "application/json", report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teeDestination adds the suffix to the local path or the s3 key
+func teeDestination(fileName, suffix string) (string, error) {
+	if isStream(fileName) {
+		return fileName, nil
+	}
+	dest, err := url.Parse(fileName)
+	if err != nil {
+		return "", err
+	}
+	if !gotgz.IsS3(dest) {
+		return gotgz.AddTarSuffix(fileName, suffix), nil
+	}
+	dest.Path = gotgz.AddTarSuffix(dest.Path, suffix)
+	return dest.String(), nil
+}
+
+// abortWriters closes the opened writers, the s3 uploads are aborted
+func abortWriters(writers []io.WriteCloser, err error) {
+	for _, w := range writers {
+		if c, ok := w.(interface{ CloseWithError(error) error }); ok {
+			c.CloseWithError(err)
+			continue
+		}
+		w.Close()
+	}
+}
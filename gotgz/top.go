@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/islishude/gotgz"
+)
+
+// runTop prints the largest regular files in an archive with the estimated share of the compressed size
+func runTop(args []string) error {
+	var (
+		common   commonFlags
+		fileName string
+		n        int
+		human    bool
+	)
+
+	fs := NewFlagSet("top", "-f archive [flags]")
+	fs.StringVar(&fileName, "f", "", "alias to -file")
+	fs.StringVar(&fileName, "file", "", "Use archive file")
+	fs.IntVar(&n, "n", 20, "the number of the largest files to print")
+	fs.BoolVar(&human, "human", false, "print the sizes in the human readable format, e.g. 1.5M")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fileName == "" {
+		return errors.New("File name is empty")
+	}
+	if n < 1 {
+		return errors.New("-n should be greater than 0")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	archiver, err := common.Archiver(fileName)
+	if err != nil {
+		return err
+	}
+	src, _, err := openReader(ctx, fileName, common.Level())
+	if err != nil {
+		return err
+	}
+
+	report, err := gotgz.Top(ctx, src, gotgz.ListFlags{Archiver: archiver, Logger: slog.Default()}, n)
+	if err != nil {
+		return err
+	}
+
+	format := func(size int64) string {
+		if human {
+			return HumanSize(size)
+		}
+		return fmt.Sprint(size)
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	fmt.Fprintln(stdout, "SIZE\tCOMPRESSED\tSHARE\tNAME")
+	for _, member := range report.Members {
+		var share float64
+		if report.Compressed > 0 {
+			share = float64(member.Compressed) * 100 / float64(report.Compressed)
+		}
+		fmt.Fprintf(stdout, "%s\t~%s\t%.1f%%\t%s\n", format(member.Size), format(member.Compressed), share, member.Name)
+	}
+	return nil
+}
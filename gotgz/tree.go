@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Tree is the member list as a tree, the parent directories are created
+// even if they are not in the archive
+type Tree struct {
+	name     string
+	header   *tar.Header
+	children map[string]*Tree
+}
+
+func NewTree() *Tree {
+	return &Tree{children: make(map[string]*Tree)}
+}
+
+// Add is a gotgz.ListFunc which adds the entry to the tree
+func (t *Tree) Add(header *tar.Header, _ io.Reader) error {
+	name := strings.Trim(path.Clean("/"+header.Name), "/")
+	if name == "" {
+		return nil
+	}
+
+	node := t
+	for _, part := range strings.Split(name, "/") {
+		child, ok := node.children[part]
+		if !ok {
+			child = &Tree{name: part, children: make(map[string]*Tree)}
+			node.children[part] = child
+		}
+		node = child
+	}
+	node.header = header
+	return nil
+}
+
+func (t *Tree) isDir() bool {
+	return len(t.children) > 0 || t.header == nil || t.header.Typeflag == tar.TypeDir
+}
+
+// Print writes the tree with the entry counts of the directories
+func (t *Tree) Print(w io.Writer, color bool) error {
+	return t.print(w, "", color)
+}
+
+func (t *Tree) print(w io.Writer, prefix string, color bool) error {
+	names := make([]string, 0, len(t.children))
+	for name := range t.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		child := t.children[name]
+		connector, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			connector, indent = "└── ", "    "
+		}
+
+		header := child.header
+		if header == nil {
+			header = &tar.Header{Typeflag: tar.TypeDir}
+		}
+		label := child.name
+		if color {
+			label = Colorize(header, label)
+		}
+		if header.Typeflag == tar.TypeSymlink {
+			label += " -> " + header.Linkname
+		}
+		if child.isDir() {
+			label = fmt.Sprintf("%s/ (%d)", label, len(child.children))
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s%s\n", prefix, connector, label); err != nil {
+			return err
+		}
+		if err := child.print(w, prefix+indent, color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
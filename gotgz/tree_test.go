@@ -0,0 +1,38 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	tree := NewTree()
+	for _, header := range []*tar.Header{
+		{Name: "./etc/", Typeflag: tar.TypeDir},
+		{Name: "etc/nginx/nginx.conf", Typeflag: tar.TypeReg},
+		{Name: "etc/hosts", Typeflag: tar.TypeReg},
+		{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "bash"},
+		{Name: "empty/", Typeflag: tar.TypeDir},
+	} {
+		if err := tree.Add(header, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tree.Print(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `├── bin/ (1)
+│   └── sh -> bash
+├── empty/ (0)
+└── etc/ (2)
+    ├── hosts
+    └── nginx/ (1)
+        └── nginx.conf
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
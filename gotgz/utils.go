@@ -1,17 +1,109 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go/logging"
+	"github.com/islishude/gotgz"
 )
 
+// faltaln prints to the stderr and exits, the stdout may be the archive stream
 func faltaln(args ...any) {
-	fmt.Println(args...)
+	fmt.Fprintln(os.Stderr, args...)
 	os.Exit(1)
 }
 
+const (
+	// ExitCodeWarning is the exit code if the archive is extracted with the warnings, e.g. the metadata failures,
+	// or the members differ from the filesystem
+	ExitCodeWarning = 2
+	// ExitCodeBrokenPipe is the exit code if the downstream of the pipe is closed, it's the same as the shell
+	// for the process killed by SIGPIPE
+	ExitCodeBrokenPipe = 128 + 13
+)
+
+// fatal prints the error to the stderr and exits with the code of it,
+// the closed downstream is a cancellation rather than a failure, so only a warning is logged
+func fatal(err error) {
+	if errors.Is(err, syscall.EPIPE) {
+		slog.Warn("stopped, the downstream of the pipe is closed")
+		os.Exit(ExitCodeBrokenPipe)
+	}
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(ExitCode(err))
+}
+
+// ExitCode returns ExitCodeWarning if the error is only the metadata failures or the differences, ExitCodeBrokenPipe if the
+// downstream of the pipe is closed and 1 for the other errors
+func ExitCode(err error) int {
+	if errors.Is(err, syscall.EPIPE) {
+		return ExitCodeBrokenPipe
+	}
+	for err != nil {
+		switch e := err.(type) {
+		case *gotgz.MetadataError, *gotgz.DiffError:
+			return ExitCodeWarning
+		case interface{ Unwrap() []error }:
+			if errs := e.Unwrap(); len(errs) == 1 {
+				err = errs[0]
+				continue
+			}
+			return 1
+		default:
+			err = errors.Unwrap(err)
+		}
+	}
+	return 1
+}
+
+// invertBool is the bool flag which sets the inverse of the value,
+// e.g. -same-time is the same as -no-same-time=false
+type invertBool struct {
+	p *bool
+}
+
+func (b invertBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*b.p = !v
+	return nil
+}
+
+func (b invertBool) String() string {
+	if b.p == nil {
+		return "false"
+	}
+	return strconv.FormatBool(!*b.p)
+}
+
+func (invertBool) IsBoolFlag() bool {
+	return true
+}
+
 type stringsFlag []string
 
 func (a *stringsFlag) Set(s string) error {
@@ -23,6 +115,384 @@ func (a *stringsFlag) String() string {
 	return strings.Join(*a, " ")
 }
 
+// filesFlag is like stringsFlag, but the environment variable is not split
+// since the s3 url has the colon
+type filesFlag []string
+
+func (a *filesFlag) Set(s string) error {
+	*a = append(*a, s)
+	return nil
+}
+
+func (a *filesFlag) String() string {
+	return strings.Join(*a, " ")
+}
+
+// ListFormat is how the names of the list are separated
+type ListFormat int
+
+const (
+	// ListLines are the lines, the spaces around them are trimmed, and the empty lines and the lines start with # are ignored
+	ListLines ListFormat = iota
+	// ListVerbatim are the lines as is like `tar -T`, so the names can have the leading spaces and start with #,
+	// only the empty lines are ignored
+	ListVerbatim
+	// ListNull are the names separated by NUL like `find -print0`, the empty names are ignored
+	ListNull
+)
+
+// ReadList reads the lines of the local file or the s3 object,
+// the empty lines and the lines start with # are ignored
+func ReadList(ctx context.Context, path string, level slog.Level) ([]string, error) {
+	return readList(ctx, path, ListLines, level)
+}
+
+// ReadNullList reads the names separated by NUL like `find -print0`, the names are kept as is,
+// so they can have the spaces and the newlines, and only the empty names are ignored
+func ReadNullList(ctx context.Context, path string, level slog.Level) ([]string, error) {
+	return readList(ctx, path, ListNull, level)
+}
+
+func readList(ctx context.Context, path string, format ListFormat, level slog.Level) ([]string, error) {
+	var names []string
+	err := ScanList(ctx, path, format, level, func(name string) error {
+		names = append(names, name)
+		return nil
+	})
+	return names, err
+}
+
+// ScanList calls fn with the names of the list one by one while it's read, so the long lists aren't kept
+// in the memory, the names are separated by the format
+func ScanList(ctx context.Context, path string, format ListFormat, level slog.Level, fn func(name string) error) error {
+	file, err := openList(ctx, path, level)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if format == ListNull {
+		scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+			if i := bytes.IndexByte(data, 0); i >= 0 {
+				return i + 1, data[:i], nil
+			}
+			if atEOF && len(data) > 0 {
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		})
+	}
+	for scanner.Scan() {
+		name := scanner.Text()
+		if format == ListLines {
+			name = strings.TrimSpace(name)
+			if strings.HasPrefix(name, "#") {
+				continue
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// openList opens the local file, the s3 object or the stdin if the path is -
+func openList(ctx context.Context, path string, level slog.Level) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	source, err := url.Parse(path)
+	if err != nil || !gotgz.IsS3(source) {
+		return os.Open(path)
+	}
+	query, err := gotgz.ParseArchiveQuery(source.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewS3Client(ctx, source.Host, query, level)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := client.Reader(ctx, strings.TrimPrefix(source.Path, "/"))
+	return body, err
+}
+
+// S3LogOptions logs the s3 responses which have the request ids and the retry attempts in the debug level
+func S3LogOptions(level slog.Level) []func(*config.LoadOptions) error {
+	if level > slog.LevelDebug {
+		return nil
+	}
+	logger := logging.LoggerFunc(func(classification logging.Classification, format string, v ...any) {
+		msg := fmt.Sprintf(format, v...)
+		if classification == logging.Warn {
+			slog.Warn("s3", "message", msg)
+			return
+		}
+		slog.Debug("s3", "message", msg)
+	})
+	return []func(*config.LoadOptions) error{
+		config.WithLogger(logger),
+		config.WithClientLogMode(aws.LogRetries | aws.LogResponse),
+	}
+}
+
+// HandleSignals cancels the context on the first SIGINT or SIGTERM to stop gracefully, e.g. the s3 multipart upload
+// is aborted, the second signal or the grace period exits immediately, so a hung s3 call can't make it unkillable,
+// the grace period is unlimited if it's less than or equal to 0
+func HandleSignals(cancel context.CancelFunc, grace time.Duration) {
+	stopSig := make(chan os.Signal, 2)
+	signal.Notify(stopSig, syscall.SIGINT, syscall.SIGTERM)
+	// the write to the closed stdout returns EPIPE rather than killing the process,
+	// so the s3 uploads are aborted and the partial archives are removed
+	signal.Ignore(syscall.SIGPIPE)
+	go func() {
+		sig := <-stopSig
+		slog.Warn("stopping, send the signal again to exit immediately", "signal", sig.String(), "grace-period", grace.String())
+		cancel()
+
+		var timeout <-chan time.Time
+		if grace > 0 {
+			timeout = time.After(grace)
+		}
+		select {
+		case sig = <-stopSig:
+			slog.Error("exit immediately", "signal", sig.String())
+		case <-timeout:
+			slog.Error("exit immediately, the grace period is over", "grace-period", grace.String())
+		}
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}()
+}
+
+// NewS3Client creates the s3 client of the bucket, the endpoint, the storage class and the encryption
+// in the url query are applied to it
+func NewS3Client(ctx context.Context, bucket string, query gotgz.ArchiveQuery, level slog.Level) (gotgz.S3, error) {
+	clientFns := query.ClientOptions()
+	if ssoLogin {
+		clientFns = append(clientFns, gotgz.WithSSOLogin(os.Stderr))
+	}
+	// the faults are only injected by the CLI, the library callers opt in with FaultOptions
+	fault, err := gotgz.FaultOptions()
+	if err != nil {
+		return gotgz.S3{}, err
+	}
+	if fault != nil {
+		clientFns = append(clientFns, fault)
+	}
+	client, err := gotgz.NewWithOptions(ctx, bucket, S3LogOptions(level), clientFns...)
+	if err != nil {
+		return gotgz.S3{}, err
+	}
+	return client.WithPutOptions(query.PutOptions()...), nil
+}
+
+// ssoLogin signs in the expired AWS SSO session instead of failing, it's set by -sso-login
+// and applies to all of the s3 clients of the process
+var ssoLogin bool
+
+// registerSSOLogin registers -sso-login for the commands which can read or write s3
+func registerSSOLogin(fs *flag.FlagSet) {
+	fs.BoolVar(&ssoLogin, "sso-login", false, "sign in the expired AWS SSO (IAM Identity Center) session of AWS_PROFILE with the device authorization like 'aws sso login' instead of failing, the url and the code to confirm are printed to the stderr")
+}
+
+// ParseChown parses the user:group, the user or the group can be omitted, they are the names or the ids
+func ParseChown(spec string) (uid, gid *int, err error) {
+	name, group, _ := strings.Cut(spec, ":")
+	if name != "" {
+		id, err := lookupOwner(name, gotgz.LookupUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		uid = &id
+	}
+	if group != "" {
+		id, err := lookupOwner(group, gotgz.LookupGID)
+		if err != nil {
+			return nil, nil, err
+		}
+		gid = &id
+	}
+	if uid == nil && gid == nil {
+		return nil, nil, fmt.Errorf("invalid owner %q, it should be user:group", spec)
+	}
+	return uid, gid, nil
+}
+
+// ParseTime parses the duration before now like 24h, the RFC 3339 time or the local date like 2025-01-30,
+// it's the zero time if the value is empty
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("negative duration %q", value)
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q isn't a duration like 24h or a time like 2025-01-30T19:00:00Z or 2025-01-30", value)
+}
+
+// lookupOwner returns the id if the name is numeric like tar, or looks up the name on this host
+func lookupOwner(name string, lookup func(string) (int, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	return lookup(name)
+}
+
+// ParseSources parses the files to compress, the `-C dir` between the files changes the directory
+// for the following files like tar, the chdir is the directory set before the files
+func ParseSources(chdir string, args []string) ([]gotgz.Source, error) {
+	var sources []gotgz.Source
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value, hasValue, ok := parseDirectoryFlag(arg)
+		switch {
+		case ok && hasValue:
+			chdir = value
+		case ok:
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			chdir = args[i]
+		default:
+			sources = append(sources, gotgz.Source{Dir: chdir, Path: arg})
+		}
+	}
+	return sources, nil
+}
+
+// parseDirectoryFlag parses the `-C` flag between the files like the flag package, it can be `-C`, `-directory`
+// or `--directory` with one or two dashes, and the value can follow `=`, ok is false if it's not the flag
+func parseDirectoryFlag(arg string) (value string, hasValue, ok bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return "", false, false
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	name, value, hasValue = strings.Cut(name, "=")
+	if name != "C" && name != "directory" {
+		return "", false, false
+	}
+	return value, hasValue, true
+}
+
+// NestedScheme is the prefix of the source which is another archive, e.g. tar+s3://bucket/backup.tgz//teams/a
+const NestedScheme = "tar+"
+
+// ParseNested parses the source like `tar+s3://bucket/backup.tgz//teams/a`, the archive is the local path or the s3 url,
+// and only the members under the directory after the first `//` of the path are archived, the relative local archive
+// is under the directory of the source, ok is false if it's not another archive
+func ParseNested(source gotgz.Source) (archive, dir string, ok bool) {
+	rest, ok := strings.CutPrefix(source.Path, NestedScheme)
+	if !ok {
+		return "", "", false
+	}
+	var start int
+	if strings.HasPrefix(rest, "s3://") {
+		start = len("s3://")
+	}
+	archive = rest
+	if i := strings.Index(rest[start:], "//"); i >= 0 {
+		archive, dir = rest[:start+i], rest[start+i+2:]
+	}
+	if start == 0 && source.Dir != "" && !filepath.IsAbs(archive) && !isStream(archive) {
+		archive = filepath.Join(source.Dir, archive)
+	}
+	return archive, dir, true
+}
+
+// splitNested splits the sources into the files and the other archives, the archives are opened when they are copied
+func splitNested(ctx context.Context, sources []gotgz.Source, level slog.Level) ([]gotgz.Source, []gotgz.NestedSource) {
+	var (
+		files  []gotgz.Source
+		nested []gotgz.NestedSource
+	)
+	for _, source := range sources {
+		archive, dir, ok := ParseNested(source)
+		if !ok {
+			files = append(files, source)
+			continue
+		}
+		nested = append(nested, gotgz.NestedSource{Name: archive, Dir: dir, Open: func() (io.ReadCloser, error) {
+			src, _, err := openReader(ctx, archive, level)
+			return src, err
+		}})
+	}
+	return files, nested
+}
+
+// ParsePAXOptions parses the -pax-option values like GNU tar, key=value is the record of the global header,
+// key:=value is the record of every member and globexthdr.name=template is the name of the global header
+func ParsePAXOptions(options []string) (global, records map[string]string, name string, err error) {
+	for _, option := range options {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok || key == "" || key == ":" {
+			return nil, nil, "", fmt.Errorf("invalid pax option %q, it should be key=value or key:=value", option)
+		}
+		switch {
+		case key == "globexthdr.name":
+			if name, err = gotgz.ExpandHeaderName(value); err != nil {
+				return nil, nil, "", err
+			}
+		case key == "exthdr.name":
+			return nil, nil, "", errors.New("exthdr.name isn't supported, the extended headers of the members are named by archive/tar")
+		case strings.HasSuffix(key, ":"):
+			if records == nil {
+				records = make(map[string]string)
+			}
+			records[strings.TrimSuffix(key, ":")] = value
+		default:
+			if global == nil {
+				global = make(map[string]string)
+			}
+			global[key] = value
+		}
+	}
+	return global, records, name, nil
+}
+
+// ParseEntrySpec parses the entry like `name=etc/app.conf,mode=644` whose content is read from the reader,
+// the mode is octal and it's 644 by default
+func ParseEntrySpec(spec string, content io.Reader) (gotgz.Entry, error) {
+	entry := gotgz.Entry{Content: content}
+	for _, field := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "name":
+			entry.Name = value
+		case "mode":
+			mode, err := strconv.ParseInt(value, 8, 64)
+			if err != nil || mode < 0 || mode > 07777 {
+				return gotgz.Entry{}, fmt.Errorf("invalid mode %q of the entry %s", value, spec)
+			}
+			entry.Mode = mode
+		default:
+			return gotgz.Entry{}, fmt.Errorf("unknown key %q of the entry %s, it can be name or mode", key, spec)
+		}
+	}
+	if entry.Name == "" {
+		return gotgz.Entry{}, fmt.Errorf("no name of the entry %s, e.g. name=etc/app.conf", spec)
+	}
+	return entry, nil
+}
+
 func ParseLogLevel(name string) slog.Level {
 	var l slog.Level
 	if err := l.UnmarshalText([]byte(name)); err == nil {
@@ -30,3 +500,97 @@ func ParseLogLevel(name string) slog.Level {
 	}
 	return slog.LevelInfo
 }
+
+// StartProfiling starts cpu profiling and execution tracing if the file names are not empty,
+// the returned function stops them and writes the heap profile.
+func StartProfiling(cpuProfile, memProfile, traceFile string) (_ func(), err error) {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+
+	if cpuProfile != "" {
+		file, err := os.Create(cpuProfile)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(file); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			_ = file.Close()
+		})
+	}
+
+	if traceFile != "" {
+		file, err := os.Create(traceFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := trace.Start(file); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			_ = file.Close()
+		})
+	}
+
+	if memProfile != "" {
+		stops = append(stops, func() {
+			file, err := os.Create(memProfile)
+			if err != nil {
+				slog.Error("create memory profile", "error", err)
+				return
+			}
+			defer file.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(file); err != nil {
+				slog.Error("write memory profile", "error", err)
+			}
+		})
+	}
+	return stop, nil
+}
+
+// CompressionMemory returns the estimated memory in MB used by the compressor window and buffers
+func CompressionMemory(archiver gotgz.Archiver) int64 {
+	switch archiver.(type) {
+	case gotgz.ZstdArchiver, *gotgz.ZstdArchiver:
+		return 16
+	case gotgz.Lz4Archiver, *gotgz.Lz4Archiver:
+		return 8
+	default:
+		return 1
+	}
+}
+
+// DerateS3Thread reduces the s3 upload concurrency so that the s3 part buffers and the compressor
+// fit in maxMemory MB, it returns the thread unchanged if maxMemory is less than or equal to 0
+func DerateS3Thread(maxMemory, partSize int64, thread int, archiver gotgz.Archiver) (int, error) {
+	if maxMemory <= 0 {
+		return thread, nil
+	}
+	available := maxMemory - CompressionMemory(archiver)
+	if available < partSize {
+		return 0, fmt.Errorf("max memory %dMB is too small for the s3 part size %dMB", maxMemory, partSize)
+	}
+	return int(min(int64(thread), available/partSize)), nil
+}
+
+// archiveStateFile returns the state file of the archive if there are multiple archives, the entries of every archive
+// are recorded to its own state file, which has the short hash of the archive path as the suffix
+func archiveStateFile(stateFile, archive string) string {
+	sum := sha256.Sum256([]byte(archive))
+	return stateFile + "." + hex.EncodeToString(sum[:4])
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"reflect"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/islishude/gotgz"
 )
 
 func TestParseLogLevel(t *testing.T) {
@@ -108,3 +116,314 @@ func TestStringsFlag_String(t *testing.T) {
 		})
 	}
 }
+
+func TestDerateS3Thread(t *testing.T) {
+	type args struct {
+		maxMemory int64
+		partSize  int64
+		thread    int
+		archiver  gotgz.Archiver
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "Unlimited",
+			args: args{maxMemory: 0, partSize: 10, thread: 5, archiver: gotgz.GZipArchiver{}},
+			want: 5,
+		},
+		{
+			name: "Enough memory",
+			args: args{maxMemory: 256, partSize: 10, thread: 5, archiver: gotgz.GZipArchiver{}},
+			want: 5,
+		},
+		{
+			name: "Derate concurrency",
+			args: args{maxMemory: 64, partSize: 16, thread: 5, archiver: gotgz.ZstdArchiver{}},
+			want: 3,
+		},
+		{
+			name:    "Too small",
+			args:    args{maxMemory: 16, partSize: 16, thread: 5, archiver: gotgz.Lz4Archiver{}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DerateS3Thread(tt.args.maxMemory, tt.args.partSize, tt.args.thread, tt.args.archiver)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DerateS3Thread() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("DerateS3Thread() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		chdir   string
+		args    []string
+		want    []gotgz.Source
+		wantErr bool
+	}{
+		{
+			name: "Without directory",
+			args: []string{"a", "b"},
+			want: []gotgz.Source{{Path: "a"}, {Path: "b"}},
+		},
+		{
+			name:  "Global directory",
+			chdir: "/etc",
+			args:  []string{"nginx"},
+			want:  []gotgz.Source{{Dir: "/etc", Path: "nginx"}},
+		},
+		{
+			name:  "Interleaved directories",
+			chdir: "/etc",
+			args:  []string{"nginx", "-C", "/var/log", "nginx", "-C=/opt", "app"},
+			want: []gotgz.Source{
+				{Dir: "/etc", Path: "nginx"},
+				{Dir: "/var/log", Path: "nginx"},
+				{Dir: "/opt", Path: "app"},
+			},
+		},
+		{
+			name: "Directory with the equal sign",
+			args: []string{"-directory=/etc", "nginx", "--directory=/var/log", "nginx", "--C=/opt", "app", "--directory", "/srv", "www"},
+			want: []gotgz.Source{
+				{Dir: "/etc", Path: "nginx"},
+				{Dir: "/var/log", Path: "nginx"},
+				{Dir: "/opt", Path: "app"},
+				{Dir: "/srv", Path: "www"},
+			},
+		},
+		{
+			name: "Not directory",
+			args: []string{"C", "-directory-x", "-Cx"},
+			want: []gotgz.Source{{Path: "C"}, {Path: "-directory-x"}, {Path: "-Cx"}},
+		},
+		{
+			name:    "Missing directory",
+			args:    []string{"a", "-C"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSources(tt.chdir, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNested(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      gotgz.Source
+		wantArchive string
+		wantDir     string
+		wantOk      bool
+	}{
+		{name: "Files", source: gotgz.Source{Path: "data"}},
+		{
+			name:        "S3",
+			source:      gotgz.Source{Dir: "/srv", Path: "tar+s3://bucket/backup.tar.gz//teams/a"},
+			wantArchive: "s3://bucket/backup.tar.gz",
+			wantDir:     "teams/a",
+			wantOk:      true,
+		},
+		{
+			name:        "Without directory",
+			source:      gotgz.Source{Path: "tar+s3://bucket/backup.tar.gz"},
+			wantArchive: "s3://bucket/backup.tar.gz",
+			wantOk:      true,
+		},
+		{
+			name:        "Relative",
+			source:      gotgz.Source{Dir: "/srv", Path: "tar+backup.tgz//teams/a"},
+			wantArchive: filepath.Join("/srv", "backup.tgz"),
+			wantDir:     "teams/a",
+			wantOk:      true,
+		},
+		{
+			name:        "Stdin",
+			source:      gotgz.Source{Dir: "/srv", Path: "tar+-"},
+			wantArchive: "-",
+			wantOk:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive, dir, ok := ParseNested(tt.source)
+			if archive != tt.wantArchive || dir != tt.wantDir || ok != tt.wantOk {
+				t.Errorf("ParseNested() = %q, %q, %v, want %q, %q, %v", archive, dir, ok, tt.wantArchive, tt.wantDir, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0"},
+		{size: 1023, want: "1023"},
+		{size: 1536, want: "1.5K"},
+		{size: 20 * 1024 * 1024, want: "20M"},
+		{size: 3 << 40, want: "3.0T"},
+	}
+	for _, tt := range tests {
+		if got := HumanSize(tt.size); got != tt.want {
+			t.Errorf("HumanSize(%d) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	metadataErr := &gotgz.MetadataError{Failures: []gotgz.MetadataFailure{{Path: "a", Op: "chown", Err: os.ErrPermission}}}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "Error", err: errors.New("error"), want: 1},
+		{name: "Metadata", err: metadataErr, want: ExitCodeWarning},
+		{name: "Wrapped", err: fmt.Errorf("a.tar.gz: %w", errors.Join(nil, metadataErr)), want: ExitCodeWarning},
+		{name: "Diff", err: &gotgz.DiffError{Differences: []gotgz.Difference{{Name: "a", Only: "archive"}}}, want: ExitCodeWarning},
+		{name: "Damaged", err: errors.Join(errors.New("the archive is damaged"), metadataErr), want: 1},
+		{name: "Broken pipe", err: fmt.Errorf("compress: %w", &os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.EPIPE}), want: ExitCodeBrokenPipe},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChown(t *testing.T) {
+	ptr := func(id int) *int { return &id }
+	tests := []struct {
+		spec     string
+		uid, gid *int
+		wantErr  bool
+	}{
+		{spec: "1000:1001", uid: ptr(1000), gid: ptr(1001)},
+		{spec: "1000", uid: ptr(1000)},
+		{spec: ":1001", gid: ptr(1001)},
+		{spec: ":", wantErr: true},
+		{spec: "gotgz-no-such-user", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			uid, gid, err := ParseChown(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseChown() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(uid, tt.uid) || !reflect.DeepEqual(gid, tt.gid) {
+				t.Errorf("ParseChown() = %v, %v, want %v, %v", uid, gid, tt.uid, tt.gid)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2025, 1, 30, 19, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "24h", want: now.Add(-24 * time.Hour)},
+		{value: "1h30m", want: now.Add(-90 * time.Minute)},
+		{value: "2025-01-29T08:00:00Z", want: time.Date(2025, 1, 29, 8, 0, 0, 0, time.UTC)},
+		{value: "2025-01-29", want: time.Date(2025, 1, 29, 0, 0, 0, 0, time.Local)},
+		{value: "-1h", wantErr: true},
+		{value: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTime(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePAXOptions(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         []string
+		global, records map[string]string
+		header          string
+		wantErr         bool
+	}{
+		{name: "Empty"},
+		{
+			name:    "Records",
+			options: []string{"vcs.ref=abc", "build.id:=42", "comment:=a=b", "globexthdr.name=GlobalHead.%n"},
+			global:  map[string]string{"vcs.ref": "abc"},
+			records: map[string]string{"build.id": "42", "comment": "a=b"},
+			header:  "GlobalHead.1",
+		},
+		{name: "Without value", options: []string{"build.id"}, wantErr: true},
+		{name: "Empty key", options: []string{":=42"}, wantErr: true},
+		{name: "Member header name", options: []string{"exthdr.name=%d/PaxHeaders/%f"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global, records, header, err := ParsePAXOptions(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePAXOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(global, tt.global) || !reflect.DeepEqual(records, tt.records) || header != tt.header {
+				t.Errorf("ParsePAXOptions() = %v, %v, %q, want %v, %v, %q", global, records, header, tt.global, tt.records, tt.header)
+			}
+		})
+	}
+}
+
+func TestParseEntrySpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    gotgz.Entry
+		wantErr bool
+	}{
+		{spec: "name=etc/app.conf", want: gotgz.Entry{Name: "etc/app.conf"}},
+		{spec: "name=etc/app.conf,mode=600", want: gotgz.Entry{Name: "etc/app.conf", Mode: 0600}},
+		{spec: "mode=644", wantErr: true},
+		{spec: "name=a,mode=9", wantErr: true},
+		{spec: "name=a,owner=root", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseEntrySpec(tt.spec, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEntrySpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEntrySpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
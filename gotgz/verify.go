@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/islishude/gotgz"
+)
+
+// runVerify verifies the members of an archive with its embedded manifest,
+// it returns an error if any member is missing or differs
+func runVerify(args []string) error {
+	var (
+		common   commonFlags
+		fileName string
+		checksum string
+	)
+
+	fs := NewFlagSet("verify", "-f archive [flags]")
+	fs.StringVar(&fileName, "f", "", "alias to -file")
+	fs.StringVar(&fileName, "file", "", "Use archive file")
+	fs.StringVar(&checksum, "checksum", gotgz.DefaultManifestChecksum, "the checksum algorithm of the manifest, it's the -manifest-checksum of the archive, it's detected by the pax global header of the archives with the other algorithms than sha256")
+	common.Register(fs)
+	if err := common.Parse(fs, args); err != nil {
+		return err
+	}
+	if fileName == "" {
+		return errors.New("File name is empty")
+	}
+
+	ctx, cancel := common.Context()
+	defer cancel()
+
+	archiver, err := common.Archiver(fileName)
+	if err != nil {
+		return err
+	}
+
+	verifier, err := gotgz.NewManifestVerifier(checksum)
+	if err != nil {
+		return err
+	}
+	flags := gotgz.ListFlags{Archiver: archiver, Logger: slog.Default(), GlobalHeader: verifier.GlobalHeader}
+	if err := listArchive(ctx, fileName, common.Level(), flags, verifier.Add); err != nil {
+		return err
+	}
+
+	diffs, err := verifier.Verify()
+	if err != nil {
+		return err
+	}
+	for _, diff := range diffs {
+		fmt.Fprintln(os.Stdout, diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d members don't match the manifest", len(diffs))
+	}
+	slog.Info("archive is verified")
+	return nil
+}
@@ -0,0 +1,68 @@
+package gotgz
+
+import (
+	"bufio"
+	"io"
+)
+
+// InspectSize is the bytes of the archive head which are enough for the global header and the first entry
+const InspectSize = 1 << 20
+
+// CompressionNone is the compression of the uncompressed tar archive
+const CompressionNone = "none"
+
+// ArchiveInfo describes the archive by its head, the archive isn't read completely
+type ArchiveInfo struct {
+	// Compression is detected by the magic bytes, it's the fallback archiver if they are unknown
+	Compression string
+	// Format is the tar format of the first entry, e.g. USTAR, PAX and GNU
+	Format string
+	// FirstEntry is the name of the first entry
+	FirstEntry string
+	// GlobalHeader is the records of the pax global header
+	GlobalHeader map[string]string
+	// Label is the volume label
+	Label string
+}
+
+// Inspect reads the head of the archive for the compression, the tar format, the volume label and the pax global header,
+// the src can be the head only, e.g. the range of the s3 object
+func Inspect(src io.Reader, fallback Archiver, logger Logger) (ArchiveInfo, error) {
+	var info ArchiveInfo
+	br := bufio.NewReaderSize(src, readBufferSize)
+	archiver, err := DetectArchiver(br)
+	if err != nil {
+		return info, err
+	}
+	var zr io.Reader = br
+	if block, _ := br.Peek(blockSize); archiver == nil && len(block) == blockSize && isHeaderBlock(block) {
+		info.Compression = CompressionNone
+	} else {
+		if archiver == nil {
+			archiver = fallback
+		}
+		info.Compression = archiver.Name()
+		if zr, err = archiver.Reader(bufferedReadCloser{Reader: br, Closer: io.NopCloser(src)}); err != nil {
+			return info, err
+		}
+		defer closeReader(zr)
+	}
+	tr := newTarReader(zr, false, false, logger)
+	tr.global = func(records map[string]string) error {
+		info.GlobalHeader = records
+		return nil
+	}
+	tr.volume = func(label string) error {
+		info.Label = label
+		return nil
+	}
+	header, err := tr.Next()
+	if err == io.EOF {
+		return info, nil
+	}
+	if err != nil {
+		return info, err
+	}
+	info.Format, info.FirstEntry = header.Format.String(), header.Name
+	return info, nil
+}
@@ -0,0 +1,52 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	for _, archiver := range []Archiver{GZipArchiver{Level: 1}, ZstdArchiver{}} {
+		t.Run(archiver.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			flags := CompressFlags{
+				Archiver:     archiver,
+				Logger:       discardLogger,
+				GlobalHeader: map[string]string{PAXGlobalPrefix + "version": "v1.0.0"},
+			}
+			if err := Compress(context.Background(), nopWriteCloser{&buf}, flags, "testdata"); err != nil {
+				t.Fatal(err)
+			}
+
+			// the fallback isn't used since the magic bytes are known
+			info, err := Inspect(&buf, Lz4Archiver{}, discardLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Compression != archiver.Name() {
+				t.Errorf("Compression = %s, want %s", info.Compression, archiver.Name())
+			}
+			if info.FirstEntry != "testdata/" {
+				t.Errorf("FirstEntry = %s, want testdata/", info.FirstEntry)
+			}
+			if info.Format == "" {
+				t.Errorf("Format is empty")
+			}
+			if got := info.GlobalHeader[PAXGlobalPrefix+"version"]; got != "v1.0.0" {
+				t.Errorf("GlobalHeader = %v, want the version", info.GlobalHeader)
+			}
+		})
+	}
+}
+
+func TestInspect_Uncompressed(t *testing.T) {
+	archive := newTestTar(t, tarFile{"a.txt", "abc"})
+	info, err := Inspect(bytes.NewReader(archive), GZipArchiver{}, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Compression != CompressionNone || info.FirstEntry != "a.txt" {
+		t.Errorf("Inspect() = %+v, want the uncompressed a.txt", info)
+	}
+}
@@ -0,0 +1,36 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"time"
+)
+
+// TypeGNUVolume is the type of the GNU volume header which names the archive like `tar -V`
+const TypeGNUVolume = 'V'
+
+// paxVolumeLabel is the volume label record of the pax global header which is written by GNU tar in the posix format
+const paxVolumeLabel = "GNU.volume.label"
+
+// writeVolumeLabel writes the GNU volume header at the start of the archive
+func writeVolumeLabel(tw *tar.Writer, label string) error {
+	return tw.WriteHeader(&tar.Header{
+		Typeflag: TypeGNUVolume,
+		Name:     label,
+		ModTime:  time.Now(),
+		Format:   tar.FormatGNU,
+	})
+}
+
+// matchVolumeLabel checks the volume label with the shell pattern like `tar --label`
+func matchVolumeLabel(pattern, label string) error {
+	ok, err := path.Match(pattern, label)
+	if err != nil {
+		return fmt.Errorf("invalid volume label pattern %q: %w", pattern, err)
+	}
+	if !ok {
+		return fmt.Errorf("volume label %q doesn't match %q", label, pattern)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVolumeLabel(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "a"), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cflags := CompressFlags{Archiver: GZipArchiver{}, Relative: true, Label: "backup 2024-01", Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	var labels []string
+	names, err := listNames(buf.Bytes(), ListFlags{VolumeLabel: func(label string) error {
+		labels = append(labels, label)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(labels, []string{"backup 2024-01"}) || !reflect.DeepEqual(names, []string{"./=", "a=a"}) {
+		t.Errorf("labels = %q and names = %q", labels, names)
+	}
+
+	// the label of GNU tar in the posix format is in the global header
+	posix := gzipBytes(t, func() []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := writeGlobalHeader(tw, "", map[string]string{paxVolumeLabel: "backup 2024-02"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}())
+	unlabelled := gzipBytes(t, newTestTar(t, tarFile{"a", "a"}))
+
+	tests := []struct {
+		name    string
+		archive []byte
+		label   string
+		wantErr string
+	}{
+		{name: "No guard", archive: unlabelled},
+		{name: "Exact", archive: buf.Bytes(), label: "backup 2024-01"},
+		{name: "Pattern", archive: buf.Bytes(), label: "backup *"},
+		{name: "Posix", archive: posix, label: "backup 2024-0[12]"},
+		{name: "Mismatch", archive: buf.Bytes(), label: "backup 2023-*", wantErr: `volume label "backup 2024-01" doesn't match`},
+		{name: "Unlabelled", archive: unlabelled, label: "backup *", wantErr: "archive doesn't have the volume label"},
+		{name: "Invalid pattern", archive: buf.Bytes(), label: "[", wantErr: "invalid volume label pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			flags := DecompressFlags{Archiver: GZipArchiver{}, Label: tt.label, NoSameOwner: true, Logger: discardLogger}
+			err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(tt.archive)), dest, flags)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				if _, err := os.Stat(filepath.Join(dest, "a")); !os.IsNotExist(err) {
+					t.Errorf("the file is extracted: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(dest, "a")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+//go:build !windows
+
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecompress_SymlinkMetadata(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	zw, _ := archiver.Writer(nopWriteCloser{&buf})
+	tw := tar.NewWriter(zw)
+	for _, header := range []*tar.Header{
+		{Name: "file", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "file", Mode: 0777, ModTime: mtime, Uid: os.Getuid(), Gid: os.Getgid()},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	flags := DecompressFlags{Archiver: archiver, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := os.Lstat(filepath.Join(dest, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.ModTime().Equal(mtime) {
+		t.Errorf("link mtime = %v, want %v", link.ModTime(), mtime)
+	}
+	// the target is not changed by the link metadata
+	file, err := os.Stat(filepath.Join(dest, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ModTime().Equal(mtime) || file.Mode().Perm() != 0644&^umask() {
+		t.Errorf("file = %v %v, the link metadata is applied to the target", file.Mode(), file.ModTime())
+	}
+}
+
+func TestCompress_FollowArgs(t *testing.T) {
+	source := t.TempDir()
+	target := filepath.Join(source, "target")
+	if err := os.Mkdir(target, DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "a"), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a", filepath.Join(target, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target", filepath.Join(source, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target/a", filepath.Join(source, "file")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		followArgs bool
+		want       []string
+	}{
+		{name: "Links", want: []string{"2 dir -> target", "2 file -> target/a"}},
+		{name: "Follow args", followArgs: true, want: []string{"5 dir/", "0 dir/a", "2 dir/b -> a", "0 file"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			flags := CompressFlags{Archiver: GZipArchiver{}, FollowArgs: tt.followArgs, Logger: discardLogger}
+			sources := []Source{{Dir: source, Path: "dir"}, {Dir: source, Path: "file"}}
+			if err := CompressSources(context.Background(), nopWriteCloser{&buf}, flags, sources...); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err := List(context.Background(), io.NopCloser(&buf), ListFlags{Archiver: GZipArchiver{}}, func(header *tar.Header, _ io.Reader) error {
+				entry := string(header.Typeflag) + " " + header.Name
+				if header.Linkname != "" {
+					entry += " -> " + header.Linkname
+				}
+				got = append(got, entry)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecompress_RelativeLinks(t *testing.T) {
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	zw, _ := archiver.Writer(nopWriteCloser{&buf})
+	tw := tar.NewWriter(zw)
+	for _, header := range []*tar.Header{
+		{Name: "opt/app/lib/libapp.so", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "usr/lib/libapp.so", Typeflag: tar.TypeSymlink, Linkname: "/opt/app/lib/libapp.so", Mode: 0777},
+		{Name: "usr/bin/app", Typeflag: tar.TypeSymlink, Linkname: "../../opt/app/bin/app", Mode: 0777},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		flags DecompressFlags
+		want  map[string]string
+	}{
+		{
+			name:  "Keep",
+			flags: DecompressFlags{},
+			want:  map[string]string{"usr/lib/libapp.so": "/opt/app/lib/libapp.so", "usr/bin/app": "../../opt/app/bin/app"},
+		},
+		{
+			// the transform applies to the names only by default
+			name:  "Transform",
+			flags: DecompressFlags{Transform: []string{"s,^opt/app,srv/app,"}},
+			want:  map[string]string{"usr/lib/libapp.so": "/opt/app/lib/libapp.so", "usr/bin/app": "../../opt/app/bin/app"},
+		},
+		{
+			name:  "Relative",
+			flags: DecompressFlags{RelativeLinks: true},
+			want:  map[string]string{"usr/lib/libapp.so": "../../opt/app/lib/libapp.so", "usr/bin/app": "../../opt/app/bin/app"},
+		},
+		{
+			name:  "Transform links",
+			flags: DecompressFlags{Transform: []string{"s,^/opt/app,/srv/app,"}, TransformLinks: true, RelativeLinks: true},
+			want:  map[string]string{"usr/lib/libapp.so": "../../srv/app/lib/libapp.so", "usr/bin/app": "../../opt/app/bin/app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			flags := tt.flags
+			flags.Archiver, flags.NoSameOwner, flags.Logger = archiver, true, discardLogger
+			if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				got, err := os.Readlink(filepath.Join(dest, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("%s -> %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
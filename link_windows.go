@@ -0,0 +1,21 @@
+package gotgz
+
+import (
+	"io/fs"
+	"time"
+)
+
+// lchown is skipped since the symbolic links on windows have no uid and gid
+func lchown(path string, uid, gid int) error {
+	return nil
+}
+
+// lchmod is skipped since the symbolic links on windows have no mode
+func lchmod(path string, mode fs.FileMode) error {
+	return nil
+}
+
+// lutimes is skipped since the symbolic links on windows can't be changed without following them
+func lutimes(path string, atime, mtime time.Time) error {
+	return nil
+}
@@ -0,0 +1,116 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+type ListFlags struct {
+	Archiver Archiver
+	Logger   Logger
+	// Members selects the entries to list, it's the same with DecompressFlags.Members
+	Members    []string
+	Regex      bool
+	Occurrence int
+	// Matching is the same with DecompressFlags
+	Matching MemberMatch
+	// IgnoreZeros and Recover are the same with DecompressFlags
+	IgnoreZeros bool
+	Recover     bool
+	// FromEncoding is the same with DecompressFlags
+	FromEncoding string
+	// GlobalHeader is called with the records of the pax global header, it's not listed as an entry
+	GlobalHeader func(records map[string]string) error
+	// Label is the same with DecompressFlags, and VolumeLabel is called with the volume label,
+	// it's not listed as an entry
+	Label       string
+	VolumeLabel func(label string) error
+	// GlobalHeaders is the same with DecompressFlags
+	GlobalHeaders string
+	// Modified is the same with DecompressFlags
+	Modified TimeRange
+	// DataOffset is called with the offset of the data of every listed entry in the uncompressed tar stream
+	// before fn, so the uncompressed archive can be read at random later
+	DataOffset func(offset int64)
+}
+
+// ListFunc is called for every entry in the archive, the content reads the data of the entry
+type ListFunc func(header *tar.Header, content io.Reader) error
+
+func List(ctx context.Context, src io.ReadCloser, flags ListFlags, fn ListFunc) error {
+	defer src.Close()
+
+	if flags.Archiver == nil {
+		return fmt.Errorf("archiver is nil")
+	}
+
+	matcher, err := newMemberMatcher(flags.Members, flags.Regex, flags.Occurrence, flags.Matching)
+	if err != nil {
+		return err
+	}
+
+	decode, err := NameDecoder(flags.FromEncoding)
+	if err != nil {
+		return err
+	}
+	if err := checkGlobalHeaders(flags.GlobalHeaders); err != nil {
+		return err
+	}
+
+	zr, err := flags.Archiver.Reader(src)
+	if err != nil {
+		return err
+	}
+	defer closeReader(zr)
+
+	var logger = flags.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Debug("flags", "archiver", flags.Archiver.Name(), "members", flags.Members, "regex", flags.Regex)
+
+	tr := newTarReader(zr, flags.IgnoreZeros, flags.Recover, logger)
+	tr.global = flags.GlobalHeader
+	tr.decode = decode
+	tr.label, tr.volume = flags.Label, flags.VolumeLabel
+	tr.globals = flags.GlobalHeaders
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if matcher.Done() {
+			return nil
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			if err := matcher.Unmatched(); err != nil {
+				return err
+			}
+			return tr.Damaged()
+		}
+		if err != nil {
+			return err
+		}
+
+		if !flags.Modified.Contains(header.ModTime) || matcher.Match(header.Name, header.Typeflag == tar.TypeDir) < 0 {
+			continue
+		}
+
+		if flags.DataOffset != nil {
+			flags.DataOffset(tr.Offset())
+		}
+		if err := fn(header, tr); err != nil {
+			if tr.Truncated(header.Name, err) {
+				return tr.Damaged()
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	destPath := filepath.Join(t.TempDir(), "testdata.tar.gz")
+	file, err := os.Create(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archiver := GZipArchiver{Level: 1}
+	if err := Compress(context.Background(), file, CompressFlags{Archiver: archiver}, "testdata"); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	err = filepath.Walk("testdata", func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			path += "/"
+		}
+		want = append(want, path)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := os.Open(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = List(context.Background(), source, ListFlags{Archiver: archiver}, func(header *tar.Header, content io.Reader) error {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != header.Size {
+			t.Errorf("file %s size %d not match %d", header.Name, len(data), header.Size)
+		}
+		got = append(got, header.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d is %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCompressSources(t *testing.T) {
+	destPath := filepath.Join(t.TempDir(), "testdata.tar.gz")
+	file, err := os.Create(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archiver := GZipArchiver{Level: 1}
+	sources := []Source{
+		{Dir: "testdata/parent", Path: "css"},
+		{Dir: "testdata", Path: "parent/js"},
+	}
+	if err := CompressSources(context.Background(), file, CompressFlags{Archiver: archiver}, sources...); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := os.Open(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = List(context.Background(), source, ListFlags{Archiver: archiver}, func(header *tar.Header, _ io.Reader) error {
+		got = append(got, header.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"css/", "css/index.css", "parent/js/", "parent/js/index.js"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestList_FromEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range []*tar.Header{
+		// the GNU names in latin1 from the legacy tar
+		{Name: "caf\xe9/", Typeflag: tar.TypeDir, Mode: 0755, Format: tar.FormatGNU},
+		{Name: "caf\xe9/link", Typeflag: tar.TypeSymlink, Linkname: "men\xfa", Mode: 0777, Format: tar.FormatGNU},
+		// the pax path is UTF-8 already
+		{Name: "naïve", Typeflag: tar.TypeReg, Mode: 0644, Format: tar.FormatPAX},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := gzipBytes(t, buf.Bytes())
+
+	var got []string
+	flags := ListFlags{Archiver: GZipArchiver{}, FromEncoding: "latin1", Logger: discardLogger}
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(data)), flags, func(header *tar.Header, _ io.Reader) error {
+		got = append(got, header.Name+"->"+header.Linkname)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"café/->", "café/link->menú", "naïve->"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+}
+
+func TestList_DataOffset(t *testing.T) {
+	archive := newTestTar(t, tarFile{"a", "1"}, tarFile{"b", string(bytes.Repeat([]byte("x"), 600))}, tarFile{"c", "3"})
+	var offsets []int64
+	var data []string
+	flags := ListFlags{Archiver: AutoArchiver{Archiver: GZipArchiver{}}, DataOffset: func(offset int64) { offsets = append(offsets, offset) }}
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(archive)), flags, func(header *tar.Header, _ io.Reader) error {
+		offset := offsets[len(offsets)-1]
+		data = append(data, string(archive[offset:offset+header.Size]))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{512, 1536, 3072}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+	if want := []string{"1", string(bytes.Repeat([]byte("x"), 600)), "3"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("data = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,247 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestName is the name of the manifest member which is appended at the end of the archive
+const ManifestName = ".gotgz/manifest.json"
+
+// DefaultManifestChecksum is the checksum algorithm of the manifest if it's not set
+const DefaultManifestChecksum = "sha256"
+
+// PAXManifestChecksum is the record of the pax global header with the checksum algorithm of the manifest,
+// it's written if the algorithm isn't DefaultManifestChecksum, so the verifier knows it before the members are hashed
+const PAXManifestChecksum = PAXGlobalPrefix + "manifest.checksum"
+
+// Manifest summarizes the archive members with the checksums, it's appended as the last member
+// by CompressFlags.Manifest, so the archive can be verified without the sidecar files
+type Manifest struct {
+	// Checksum is the algorithm of the checksums, it's empty for sha256 like the manifests of the older versions
+	Checksum string          `json:"checksum,omitempty"`
+	Entries  []ManifestEntry `json:"entries"`
+}
+
+type ManifestEntry struct {
+	Name     string `json:"name"`
+	Typeflag string `json:"type"`
+	Size     int64  `json:"size"`
+	Mode     int64  `json:"mode"`
+	Linkname string `json:"linkname,omitempty"`
+	// SHA256 is the checksum of the content, it's empty if the member isn't a regular file
+	SHA256 string `json:"sha256,omitempty"`
+	// Sum is the checksum of the content if the algorithm of the manifest isn't sha256
+	Sum string `json:"sum,omitempty"`
+}
+
+// NewManifest converts the digests to the manifest, the entries are sorted by name,
+// alg is the checksum algorithm of the digests, it's DefaultManifestChecksum if it's empty
+func NewManifest(digests Digests, alg string) Manifest {
+	if alg == DefaultManifestChecksum {
+		alg = ""
+	}
+	manifest := Manifest{Checksum: alg, Entries: make([]ManifestEntry, 0, len(digests))}
+	for name, digest := range digests {
+		entry := ManifestEntry{
+			Name:     name,
+			Typeflag: string(digest.Typeflag),
+			Size:     digest.Size,
+			Mode:     digest.Mode,
+			Linkname: digest.Linkname,
+		}
+		if alg == "" {
+			entry.SHA256 = digest.Hash
+		} else {
+			entry.Sum = digest.Hash
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].Name < manifest.Entries[j].Name
+	})
+	return manifest
+}
+
+// Algorithm returns the checksum algorithm of the manifest
+func (m Manifest) Algorithm() string {
+	if m.Checksum == "" {
+		return DefaultManifestChecksum
+	}
+	return m.Checksum
+}
+
+// Digests returns the digests of the members in the manifest
+func (m Manifest) Digests() Digests {
+	digests := make(Digests, len(m.Entries))
+	for _, entry := range m.Entries {
+		var typeflag byte
+		if entry.Typeflag != "" {
+			typeflag = entry.Typeflag[0]
+		}
+		digests[entry.Name] = MemberDigest{
+			Typeflag: typeflag,
+			Size:     entry.Size,
+			Mode:     entry.Mode,
+			Linkname: entry.Linkname,
+			Hash:     entry.SHA256 + entry.Sum,
+		}
+	}
+	return digests
+}
+
+// manifestWriter collects the digests of the members while the archive is written
+type manifestWriter struct {
+	digests Digests
+	alg     string
+}
+
+// hash returns the hash of the content, the algorithm is checked when the writer is created
+func (m *manifestWriter) hash() hash.Hash {
+	hash, _ := NewChecksum(m.alg)
+	return hash
+}
+
+// add adds the digest of the member, the hash is the checksum of the content if it's a regular file
+func (m *manifestWriter) add(header *tar.Header, hash hash.Hash) {
+	digest := MemberDigest{
+		Typeflag: header.Typeflag,
+		Size:     header.Size,
+		Mode:     header.Mode,
+		Linkname: header.Linkname,
+	}
+	if hash != nil {
+		digest.Hash = hex.EncodeToString(hash.Sum(nil))
+	}
+	m.digests[strings.TrimPrefix(header.Name, "./")] = digest
+}
+
+// write appends the manifest member to the archive
+func (m *manifestWriter) write(tw *tar.Writer) error {
+	data, err := json.Marshal(NewManifest(m.digests, m.alg))
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     ManifestName,
+		Mode:     DefaultFilePerm,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// manifestTailSize is the max bytes at the end of the archive which are searched for the manifest
+const manifestTailSize = 64 << 20
+
+// ReadManifestAt reads the manifest member at the end of the uncompressed archive with the random reads, e.g. the ranged
+// reads of the s3 object, its header is searched backward in the last 64MB by the chunks of InspectSize,
+// the manifest is nil if it's not found
+func ReadManifestAt(r io.ReaderAt, size int64) (*Manifest, error) {
+	if size%blockSize != 0 {
+		return nil, nil
+	}
+	name := []byte(ManifestName + "\x00")
+	chunk := make([]byte, InspectSize)
+	for end := size; end > 0 && size-end < manifestTailSize; end -= InspectSize {
+		start := max(end-InspectSize, 0)
+		buf := chunk[:end-start]
+		if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		for off := len(buf) - blockSize; off >= 0; off -= blockSize {
+			block := buf[off : off+blockSize]
+			if !bytes.HasPrefix(block, name) || !isHeaderBlock(block) {
+				continue
+			}
+			offset := start + int64(off)
+			tr := tar.NewReader(io.NewSectionReader(r, offset, size-offset))
+			if header, err := tr.Next(); err != nil || header.Name != ManifestName {
+				continue
+			}
+			var manifest Manifest
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest at %d: %w", offset, err)
+			}
+			return &manifest, nil
+		}
+	}
+	return nil, nil
+}
+
+// ManifestVerifier collects the digests of the members and reads the manifest member,
+// the members are verified with the manifest after the archive is listed
+type ManifestVerifier struct {
+	digests  Digests
+	manifest *Manifest
+	alg      string
+}
+
+// NewManifestVerifier returns the verifier which hashes the members with the algorithm before the manifest is read,
+// so it must be the one of the manifest, it's DefaultManifestChecksum if it's empty, and it's replaced by
+// the PAXManifestChecksum record if ListFlags.GlobalHeader is the GlobalHeader of the verifier
+func NewManifestVerifier(alg string) (*ManifestVerifier, error) {
+	if alg == "" {
+		alg = DefaultManifestChecksum
+	}
+	if _, err := NewChecksum(alg); err != nil {
+		return nil, err
+	}
+	return &ManifestVerifier{digests: make(Digests), alg: alg}, nil
+}
+
+// GlobalHeader detects the checksum algorithm of the manifest with the PAXManifestChecksum record,
+// the pax global header is at the start of the archive, so the members are not hashed yet
+func (v *ManifestVerifier) GlobalHeader(records map[string]string) error {
+	alg, ok := records[PAXManifestChecksum]
+	if !ok || alg == v.alg {
+		return nil
+	}
+	if len(v.digests) > 0 {
+		return fmt.Errorf("the manifest checksum %s is recorded after the members", alg)
+	}
+	if _, err := NewChecksum(alg); err != nil {
+		return err
+	}
+	v.alg = alg
+	return nil
+}
+
+// Add is a ListFunc which reads the manifest or adds the digest of the member
+func (v *ManifestVerifier) Add(header *tar.Header, content io.Reader) error {
+	if header.Name != ManifestName {
+		return v.digests.add(header, content, v.alg)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(content).Decode(&manifest); err != nil {
+		return err
+	}
+	v.manifest = &manifest
+	return nil
+}
+
+// Verify compares the members with the manifest, the member is only in "a" if it's missing in the archive,
+// and it's only in "b" if it's not in the manifest
+func (v *ManifestVerifier) Verify() ([]Difference, error) {
+	if v.manifest == nil {
+		return nil, errors.New("the archive has no manifest")
+	}
+	if alg := v.manifest.Algorithm(); alg != v.alg {
+		return nil, fmt.Errorf("the manifest checksum is %s but the members are hashed with %s", alg, v.alg)
+	}
+	return DiffDigests(v.manifest.Digests(), v.digests), nil
+}
@@ -0,0 +1,187 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	source := t.TempDir()
+	if err := os.Mkdir(filepath.Join(source, "dir"), DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "dir", "a.txt"), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	cflags := CompressFlags{Archiver: archiver, Relative: true, Manifest: true, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(data []byte) []Difference {
+		t.Helper()
+		verifier, err := NewManifestVerifier("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := List(context.Background(), io.NopCloser(bytes.NewReader(data)), ListFlags{Archiver: archiver}, verifier.Add); err != nil {
+			t.Fatal(err)
+		}
+		diffs, err := verifier.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return diffs
+	}
+	if diffs := verify(buf.Bytes()); len(diffs) != 0 {
+		t.Errorf("Verify() = %v, want no differences", diffs)
+	}
+
+	// drop the file from the archive but keep the manifest
+	var dropped bytes.Buffer
+	zw, _ := archiver.Writer(nopWriteCloser{&dropped})
+	tw := tar.NewWriter(zw)
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), ListFlags{Archiver: archiver}, func(header *tar.Header, content io.Reader) error {
+		if header.Name == "dir/a.txt" {
+			return nil
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []Difference{{Name: "dir/a.txt", Only: "a"}}
+	if diffs := verify(dropped.Bytes()); !reflect.DeepEqual(diffs, want) {
+		t.Errorf("Verify() = %v, want %v", diffs, want)
+	}
+
+	verifier, err := NewManifestVerifier("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(); err == nil {
+		t.Error("Verify() without the manifest should fail")
+	}
+}
+
+func TestManifest_Checksum(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("abc"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	cflags := CompressFlags{Archiver: archiver, Relative: true, Manifest: true, ManifestChecksum: "xxh64", Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(alg string, detect bool) (*ManifestVerifier, error) {
+		verifier, err := NewManifestVerifier(alg)
+		if err != nil {
+			return nil, err
+		}
+		lflags := ListFlags{Archiver: archiver}
+		if detect {
+			lflags.GlobalHeader = verifier.GlobalHeader
+		}
+		if err := List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), lflags, verifier.Add); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.Verify(); err != nil {
+			return nil, err
+		}
+		return verifier, nil
+	}
+	verifier, err := verify("xxh64", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := verifier.manifest.Checksum; got != "xxh64" {
+		t.Errorf("manifest checksum = %q, want xxh64", got)
+	}
+	for _, entry := range verifier.manifest.Entries {
+		if entry.Name == "a.txt" && (entry.Sum != "44bc2cf5ad770999" || entry.SHA256 != "") {
+			t.Errorf("manifest entry = %+v, want the xxh64 sum", entry)
+		}
+	}
+
+	// the algorithm is detected by the pax global header
+	if verifier, err := verify("", true); err != nil {
+		t.Errorf("Verify() with the detected algorithm error = %v", err)
+	} else if verifier.alg != "xxh64" {
+		t.Errorf("detected algorithm = %q, want xxh64", verifier.alg)
+	}
+	// the members are hashed before the manifest is read
+	if _, err := verify("", false); err == nil {
+		t.Error("Verify() with sha256 should fail for the xxh64 manifest")
+	}
+	if _, err := verify("md5", false); err == nil {
+		t.Error("NewManifestVerifier() should fail for the unsupported algorithm")
+	}
+
+	cflags.ManifestChecksum = "md5"
+	if err := Compress(context.Background(), nopWriteCloser{io.Discard}, cflags, source); err == nil {
+		t.Error("Compress() should fail for the unsupported manifest checksum")
+	}
+}
+
+func TestReadManifestAt(t *testing.T) {
+	// the manifest is larger than a chunk, so its header is found in the previous one
+	manifest := &manifestWriter{digests: make(Digests), alg: DefaultManifestChecksum}
+	for i := range 20000 {
+		manifest.add(&tar.Header{Name: fmt.Sprintf("dir/file-%05d.txt", i), Typeflag: tar.TypeReg, Mode: 0644}, sha256.New())
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(tw, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.write(tw); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() < 2*InspectSize {
+		t.Fatalf("the archive is %d bytes, the manifest should be larger than a chunk", buf.Len())
+	}
+
+	got, err := ReadManifestAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || len(got.Entries) != 20000 {
+		t.Fatal("ReadManifestAt() should read the manifest with 20000 entries")
+	}
+
+	archive := newTestTar(t, tarFile{"a.txt", "abc"})
+	if got, err := ReadManifestAt(bytes.NewReader(archive), int64(len(archive))); got != nil || err != nil {
+		t.Errorf("ReadManifestAt() without the manifest = %v, %v, want nil", got, err)
+	}
+}
@@ -0,0 +1,162 @@
+package gotgz
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// MemberMatch are the options of matching the member arguments, the zero value matches them like GNU tar on extract,
+// i.e. the patterns are anchored at the start of the names, case-sensitive and the globs with ** are expanded
+type MemberMatch struct {
+	// Unanchored matches the patterns after any slash of the names like `tar --no-anchored`,
+	// e.g. `*.sql` matches `db/a.sql`
+	Unanchored bool
+	// IgnoreCase matches the names case-insensitively like `tar --ignore-case`
+	IgnoreCase bool
+	// Literal matches the patterns as the names without the globs like `tar --no-wildcards`
+	Literal bool
+}
+
+// memberMatcher selects the archive members by the names like the member arguments of tar command,
+// a pattern matches the member with the same name and its children, or it's a glob pattern,
+// the pattern with the trailing slash like `dir/` doesn't match the file with the same name,
+// or it's a RE2 regular expression if the regex is enabled.
+// If the occurrence is greater than 0, only the Nth occurrence of each member is matched.
+type memberMatcher struct {
+	patterns   []string
+	globs      []string
+	options    MemberMatch
+	regexps    []*regexp.Regexp
+	matched    []int
+	occurrence int
+	seen       map[string]int
+	done       []bool
+}
+
+func newMemberMatcher(patterns []string, regex bool, occurrence int, options MemberMatch) (*memberMatcher, error) {
+	m := &memberMatcher{
+		patterns:   patterns,
+		globs:      make([]string, len(patterns)),
+		options:    options,
+		matched:    make([]int, len(patterns)),
+		occurrence: occurrence,
+		seen:       make(map[string]int),
+		done:       make([]bool, len(patterns)),
+	}
+	for i, pattern := range patterns {
+		m.globs[i] = cleanMemberName(pattern)
+		if options.IgnoreCase {
+			m.globs[i] = strings.ToLower(m.globs[i])
+		}
+	}
+	if regex {
+		m.regexps = make([]*regexp.Regexp, len(patterns))
+		for i, pattern := range patterns {
+			if options.IgnoreCase {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid member regex %q: %w", pattern, err)
+			}
+			m.regexps[i] = re
+		}
+	}
+	return m, nil
+}
+
+func cleanMemberName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+}
+
+// Match returns the index of the first pattern which matches the name, it returns 0 if there is no pattern
+// and -1 if the name is not matched
+func (m *memberMatcher) Match(name string, isDir bool) int {
+	if len(m.patterns) == 0 {
+		return 0
+	}
+
+	name = cleanMemberName(name)
+	subject := name
+	if m.options.IgnoreCase {
+		subject = strings.ToLower(name)
+	}
+	for i, pattern := range m.patterns {
+		var ok, exact bool
+		if m.regexps != nil {
+			ok = m.regexps[i].MatchString(name)
+		} else {
+			// the pattern with the trailing slash only matches the directory
+			if ok, exact = m.matchName(m.globs[i], subject); exact && !isDir && strings.HasSuffix(pattern, "/") {
+				continue
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		if m.occurrence > 0 {
+			m.seen[name]++
+			if m.seen[name] != m.occurrence {
+				return -1
+			}
+			// the children of a directory follow it, so only a file completes the pattern,
+			// and the other members can match it without the anchor or the case
+			if exact && !isDir && !m.options.Unanchored && !m.options.IgnoreCase {
+				m.done[i] = true
+			}
+		}
+		m.matched[i]++
+		return i
+	}
+	return -1
+}
+
+// matchName reports whether the pattern matches the name or its parent directory, exact is true if it's the name,
+// the pattern is also matched after every slash of the name if it's unanchored
+func (m *memberMatcher) matchName(pattern, name string) (ok, exact bool) {
+	for {
+		if name == pattern {
+			return true, true
+		}
+		if strings.HasPrefix(name, pattern+"/") || !m.options.Literal && doublestar.MatchUnvalidated(pattern, name) {
+			return true, false
+		}
+		i := strings.IndexByte(name, '/')
+		if !m.options.Unanchored || i < 0 {
+			return false, false
+		}
+		name = name[i+1:]
+	}
+}
+
+// Done reports whether every member has been found with the occurrence,
+// so the rest of the archive doesn't need to be read
+func (m *memberMatcher) Done() bool {
+	if m.occurrence <= 0 || len(m.patterns) == 0 {
+		return false
+	}
+	for _, done := range m.done {
+		if !done {
+			return false
+		}
+	}
+	return true
+}
+
+// Unmatched returns an error for the patterns which don't match any member
+func (m *memberMatcher) Unmatched() error {
+	var missing []string
+	for i, count := range m.matched {
+		if count == 0 {
+			missing = append(missing, m.patterns[i])
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("not found in archive: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package gotgz
+
+import (
+	"testing"
+)
+
+func TestMemberMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		regex    bool
+		options  MemberMatch
+		member   string
+		want     int
+	}{
+		{name: "No pattern", patterns: nil, member: "a/b", want: 0},
+		{name: "Exact", patterns: []string{"a/b"}, member: "a/b", want: 0},
+		{name: "Directory children", patterns: []string{"x", "a"}, member: "a/b/c", want: 1},
+		{name: "Directory with trailing slash", patterns: []string{"a/"}, member: "./a/b", want: 0},
+		{name: "Directory pattern doesn't match the file", patterns: []string{"a/"}, member: "a", want: -1},
+		{name: "Prefix is not a directory", patterns: []string{"a"}, member: "ab/c", want: -1},
+		{name: "Glob", patterns: []string{"etc/*.conf"}, member: "etc/nginx.conf", want: 0},
+		{name: "Double star glob", patterns: []string{"**/*.conf"}, member: "opt/etc/app.conf", want: 0},
+		{name: "Glob not matched", patterns: []string{"etc/*.conf"}, member: "etc/nginx/nginx.conf", want: -1},
+		{name: "Regex", patterns: []string{`(^|/)etc/.*\.conf$`}, regex: true, member: "opt/etc/nginx/nginx.conf", want: 0},
+		{name: "Regex not matched", patterns: []string{`(^|/)etc/.*\.conf$`}, regex: true, member: "opt/etc/nginx/mime.types", want: -1},
+		{name: "Anchored", patterns: []string{"*.sql"}, member: "db/a.sql", want: -1},
+		{name: "Unanchored glob", patterns: []string{"*.sql"}, options: MemberMatch{Unanchored: true}, member: "db/a.sql", want: 0},
+		{name: "Unanchored name", patterns: []string{"etc"}, options: MemberMatch{Unanchored: true}, member: "./opt/etc/app.conf", want: 0},
+		{name: "Unanchored after the slash", patterns: []string{"tc"}, options: MemberMatch{Unanchored: true}, member: "opt/etc", want: -1},
+		{name: "Ignore case", patterns: []string{"Etc/*.CONF"}, options: MemberMatch{IgnoreCase: true}, member: "etc/App.conf", want: 0},
+		{name: "Case-sensitive", patterns: []string{"Etc"}, member: "etc", want: -1},
+		{name: "Ignore case regex", patterns: []string{`\.SQL$`}, regex: true, options: MemberMatch{IgnoreCase: true}, member: "a.sql", want: 0},
+		{name: "Literal", patterns: []string{"*.sql"}, options: MemberMatch{Literal: true}, member: "a.sql", want: -1},
+		{name: "Literal name", patterns: []string{"[draft].sql"}, options: MemberMatch{Literal: true}, member: "[draft].sql", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMemberMatcher(tt.patterns, tt.regex, 0, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Match(tt.member, false); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemberMatcher_Unmatched(t *testing.T) {
+	m, err := newMemberMatcher([]string{"a", "b"}, false, 0, MemberMatch{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Match("a/1", false)
+	if err := m.Unmatched(); err == nil || err.Error() != "not found in archive: b" {
+		t.Errorf("Unmatched() = %v", err)
+	}
+
+	if _, err := newMemberMatcher([]string{"("}, true, 0, MemberMatch{}); err == nil {
+		t.Errorf("invalid regex should return error")
+	}
+}
+
+func TestMemberMatcher_Occurrence(t *testing.T) {
+	m, err := newMemberMatcher([]string{"a", "b.txt"}, false, 2, MemberMatch{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []struct {
+		name  string
+		isDir bool
+		want  int
+		done  bool
+	}{
+		{name: "a", isDir: true, want: -1},
+		{name: "a/1", want: -1},
+		{name: "b.txt", want: -1},
+		{name: "a", isDir: true, want: 0},
+		{name: "a/1", want: 0},
+		{name: "b.txt", want: 1},
+		{name: "b.txt", want: -1},
+	}
+	for _, entry := range entries {
+		if got := m.Match(entry.name, entry.isDir); got != entry.want {
+			t.Errorf("Match(%s) = %v, want %v", entry.name, got, entry.want)
+		}
+	}
+	if m.Done() {
+		t.Errorf("Done() should be false because the directory can have more children")
+	}
+
+	m, err = newMemberMatcher([]string{"b.txt"}, false, 1, MemberMatch{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Match("b.txt", false); got != 0 || !m.Done() {
+		t.Errorf("Match() = %v, Done() = %v", got, m.Done())
+	}
+}
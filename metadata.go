@@ -0,0 +1,54 @@
+package gotgz
+
+import (
+	"fmt"
+)
+
+// MetadataFailure is a failure to restore the owner or the times of an extracted entry
+type MetadataFailure struct {
+	Path string
+	// Op is the operation, e.g. chown and chtimes
+	Op  string
+	Err error
+}
+
+func (f MetadataFailure) String() string {
+	return fmt.Sprintf("%s %s: %v", f.Op, f.Path, f.Err)
+}
+
+// MetadataError reports the metadata failures with DecompressFlags.WarnMetadata,
+// the entries are extracted but their owners or times are not restored
+type MetadataError struct {
+	Failures []MetadataFailure
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("failed to restore the metadata of %d entries, the first is %s", len(e.Failures), e.Failures[0])
+}
+
+// metadataFailures collects the metadata failures in the warn mode
+type metadataFailures struct {
+	warn     bool
+	logger   Logger
+	stats    *Stats
+	failures []MetadataFailure
+}
+
+// check returns the error unless it's in the warn mode, the failure is logged and counted then
+func (m *metadataFailures) check(path, op string, err error) error {
+	if err == nil || !m.warn {
+		return err
+	}
+	m.logger.Warn("failed to restore the metadata", "path", path, "op", op, "error", err)
+	m.failures = append(m.failures, MetadataFailure{Path: path, Op: op, Err: err})
+	m.stats.addMetadataFailure()
+	return nil
+}
+
+// Err returns the MetadataError if there is any failure
+func (m *metadataFailures) Err() error {
+	if len(m.failures) == 0 {
+		return nil
+	}
+	return &MetadataError{Failures: m.failures}
+}
@@ -0,0 +1,61 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompress_WarnMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	zw, _ := archiver.Writer(nopWriteCloser{&buf})
+	tw := tar.NewWriter(zw)
+	// the times of dir/sub can't be restored since it's removed by the file which replaces dir
+	for _, header := range []*tar.Header{
+		{Name: "dir/sub/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "dir", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "file", Typeflag: tar.TypeReg, Mode: 0644},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	flags := DecompressFlags{Archiver: archiver, NoSameOwner: true, RecursiveUnlink: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err == nil {
+		t.Fatal("the chtimes failure should fail the extraction")
+	}
+
+	dest = t.TempDir()
+	flags.WarnMetadata = true
+	flags.Stats = &Stats{}
+	err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags)
+	var metadataErr *MetadataError
+	if !errors.As(err, &metadataErr) {
+		t.Fatalf("Decompress() error = %v, want MetadataError", err)
+	}
+	if len(metadataErr.Failures) != 1 || metadataErr.Failures[0].Op != "chtimes" {
+		t.Errorf("Failures = %v, want the chtimes failure", metadataErr.Failures)
+	}
+	if flags.Stats.MetadataFailures != 1 {
+		t.Errorf("MetadataFailures = %d, want 1", flags.Stats.MetadataFailures)
+	}
+	for _, name := range []string{"dir", "file"} {
+		if _, err := os.Lstat(filepath.Join(dest, name)); err != nil {
+			t.Errorf("%s is not extracted: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"hash"
+	"io"
+	"maps"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// NestedSource is the members of another archive which are archived like the files, e.g. slice a huge backup
+// into the smaller per-team archives in a single stream without extracting it
+type NestedSource struct {
+	// Name is the archive for the logs
+	Name string
+	// Dir selects the members under it, all of the members are archived if it's empty
+	Dir string
+	// Open opens the archive, its compression is detected by the magic bytes
+	Open func() (io.ReadCloser, error)
+}
+
+// match returns the name relative to Dir, ok is false if the member isn't under it
+func (n NestedSource) match(name string) (rel string, ok bool) {
+	dir := strings.Trim(n.Dir, "/")
+	name = strings.TrimSuffix(name, "/")
+	switch {
+	case dir == "":
+		return name, true
+	case name == dir:
+		return ".", true
+	case strings.HasPrefix(name, dir+"/"):
+		return name[len(dir)+1:], true
+	}
+	return "", false
+}
+
+// writeNested copies the members of the nested source under its Dir, the names are kept unless flags.Relative
+// is set, then they are relative to the Dir like the files, the exclude patterns are relative to the Dir too
+func writeNested(ctx context.Context, tw *tar.Writer, nested NestedSource, flags CompressFlags, logger Logger, manifest *manifestWriter, normalize, transform func(string) string) error {
+	src, err := nested.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	r, err := readDetected(src)
+	if err != nil {
+		return err
+	}
+	defer closeReader(r)
+
+	// written are the names of the copied members, the hardlinks to the others can't be copied
+	var (
+		written = make(map[string]string)
+		tr      = tar.NewReader(contextReader{ctx: ctx, Reader: r})
+	)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// the global header and the label describe the nested archive
+		if header.Typeflag == tar.TypeXGlobalHeader || header.Typeflag == TypeGNUVolume {
+			continue
+		}
+		rel, ok := nested.match(header.Name)
+		if !ok {
+			continue
+		}
+		if pattern, ok := excludedName(flags.Exclude, rel); ok {
+			logger.Debug("exclude", "target", header.Name, "parttern", pattern)
+			continue
+		}
+
+		original := header.Name
+		if flags.Relative {
+			header.Name = path.Join(".", rel)
+			if header.Name == "." {
+				header.Name = "./"
+			}
+		}
+		// the members of the nested archive can't escape the directory on extract like the files
+		if !flags.AbsoluteNames {
+			header.Name = trimUnsafePrefix(header.Name)
+			if isPathInvalid(header.Name) {
+				logger.Warn("skip the member with the invalid name", "archive", nested.Name, "target", original)
+				continue
+			}
+		}
+		if header.Typeflag == tar.TypeDir && !strings.HasSuffix(header.Name, "/") {
+			header.Name += "/"
+		}
+		if header.Typeflag == tar.TypeLink {
+			target, ok := written[header.Linkname]
+			if !ok {
+				logger.Warn("skip the hardlink to the member which isn't archived", "target", header.Name, "link", header.Linkname)
+				continue
+			}
+			header.Linkname = target
+		}
+		if normalize != nil {
+			header.Name = normalize(header.Name)
+			if header.Typeflag != tar.TypeLink {
+				header.Linkname = normalize(header.Linkname)
+			}
+		}
+		if transform != nil {
+			ok, err := renameMember(transform, header, flags.AbsoluteNames)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				logger.Debug("skip the empty name after the transform", "target", original)
+				continue
+			}
+		}
+		if flags.NumericOwner {
+			header.Uname, header.Gname = "", ""
+		}
+		if flags.Uid != nil {
+			header.Uid = *flags.Uid
+		}
+		if flags.Gid != nil {
+			header.Gid = *flags.Gid
+		}
+		// the records override the renamed fields
+		if len(header.PAXRecords) > 0 {
+			header.PAXRecords = maps.Clone(header.PAXRecords)
+			delete(header.PAXRecords, "path")
+			delete(header.PAXRecords, "linkpath")
+		}
+		logger.Info("append", "archive", nested.Name, "target", original)
+		written[original] = header.Name
+
+		if flags.DryRun {
+			continue
+		}
+		logger.Debug("tar", "path", header.Name)
+		stampRecords(header, flags.PAXRecords)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		flags.Stats.add(header.Typeflag)
+
+		var hash hash.Hash
+		if header.Typeflag == tar.TypeReg {
+			var w io.Writer = tw
+			if manifest != nil {
+				hash = manifest.hash()
+				w = io.MultiWriter(tw, hash)
+			}
+			n, err := io.Copy(w, tr)
+			flags.Stats.addIn(n)
+			if err != nil {
+				return err
+			}
+		}
+		if manifest != nil {
+			manifest.add(header, hash)
+		}
+	}
+}
+
+// excludedName returns the pattern which excludes the relative name
+func excludedName(patterns []string, name string) (string, bool) {
+	for _, pattern := range patterns {
+		if doublestar.MatchUnvalidated(pattern, name) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// readDetected returns the tar stream of the archive, its compression is detected by the magic bytes
+// and it's read as is if it's uncompressed
+func readDetected(src io.ReadCloser) (io.Reader, error) {
+	br := bufferedReadCloser{Reader: bufio.NewReaderSize(src, readBufferSize), Closer: src}
+	archiver, err := DetectArchiver(br.Reader)
+	if err != nil || archiver == nil {
+		return br, err
+	}
+	return archiver.Reader(br)
+}
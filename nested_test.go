@@ -0,0 +1,63 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestCompressSources_Nested(t *testing.T) {
+	inner := newTestTar(t,
+		tarFile{"teams/a/x", "x"},
+		tarFile{"teams/a/sub/y", "y"},
+		tarFile{"teams/ab/w", "w"},
+		tarFile{"teams/b/z", "z"},
+	)
+	unsafe := newTestTar(t,
+		tarFile{"/etc/passwd", "p"},
+		tarFile{"../../x", "x"},
+		tarFile{"a/../../y", "y"},
+		tarFile{`dir\z`, "z"},
+	)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		dir      string
+		relative bool
+		exclude  []string
+		want     []string
+	}{
+		{name: "All", data: inner, want: []string{"teams/a/x=x", "teams/a/sub/y=y", "teams/ab/w=w", "teams/b/z=z"}},
+		{name: "Directory", data: inner, dir: "teams/a", want: []string{"teams/a/x=x", "teams/a/sub/y=y"}},
+		{name: "Compressed", data: gzipBytes(t, inner), dir: "/teams/b/", want: []string{"teams/b/z=z"}},
+		{name: "Relative", data: inner, dir: "teams/a", relative: true, want: []string{"x=x", "sub/y=y"}},
+		{name: "Exclude", data: inner, dir: "teams/a", exclude: []string{"sub/**"}, want: []string{"teams/a/x=x"}},
+		{name: "Unsafe", data: unsafe, want: []string{"etc/passwd=p", "x=x", "y=y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nested := NestedSource{Name: "inner.tar", Dir: tt.dir, Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(tt.data)), nil
+			}}
+			var buf bytes.Buffer
+			var stats Stats
+			flags := CompressFlags{Archiver: GZipArchiver{Level: 1}, Relative: tt.relative, Exclude: tt.exclude, Nested: []NestedSource{nested}, Stats: &stats, Logger: discardLogger}
+			if err := CompressSources(context.Background(), nopWriteCloser{&buf}, flags); err != nil {
+				t.Fatal(err)
+			}
+			got, err := listNames(buf.Bytes(), ListFlags{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("members = %q, want %q", got, tt.want)
+			}
+			if stats.Files != len(tt.want) {
+				t.Errorf("files = %d, want %d", stats.Files, len(tt.want))
+			}
+		})
+	}
+}
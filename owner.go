@@ -0,0 +1,132 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// The sources of the owners on extract
+const (
+	OwnerFromIDs   = "ids"
+	OwnerFromNames = "names"
+	OwnerFromSkip  = "skip"
+)
+
+// ownerResolver resolves the owners to restore on extract
+type ownerResolver struct {
+	from     string
+	uid, gid *int
+	users    map[string]int
+	groups   map[string]int
+}
+
+func newOwnerResolver(flags DecompressFlags) (*ownerResolver, error) {
+	from := flags.OwnerFrom
+	switch from {
+	case "":
+		from = OwnerFromIDs
+	case OwnerFromIDs, OwnerFromNames, OwnerFromSkip:
+	default:
+		return nil, fmt.Errorf("unsupported owner source %q, it can be ids, names or skip", from)
+	}
+	if flags.NoSameOwner {
+		from = OwnerFromSkip
+	}
+	return &ownerResolver{
+		from:   from,
+		uid:    flags.Uid,
+		gid:    flags.Gid,
+		users:  make(map[string]int),
+		groups: make(map[string]int),
+	}, nil
+}
+
+// owner returns the uid and gid to restore, -1 keeps the current one, ok is false if nothing is restored
+func (o *ownerResolver) owner(header *tar.Header) (uid, gid int, ok bool) {
+	uid, gid = -1, -1
+	switch o.from {
+	case OwnerFromIDs:
+		uid, gid = header.Uid, header.Gid
+	case OwnerFromNames:
+		// the ids are the fallback if the names are unknown on this host
+		uid = lookupID(o.users, header.Uname, header.Uid, LookupUID)
+		gid = lookupID(o.groups, header.Gname, header.Gid, LookupGID)
+	}
+	if o.uid != nil {
+		uid = *o.uid
+	}
+	if o.gid != nil {
+		gid = *o.gid
+	}
+	return uid, gid, uid != -1 || gid != -1
+}
+
+func lookupID(cache map[string]int, name string, fallback int, lookup func(name string) (int, error)) int {
+	if name == "" {
+		return fallback
+	}
+	if id, ok := cache[name]; ok {
+		return id
+	}
+	id, err := lookup(name)
+	if err != nil {
+		id = fallback
+	}
+	cache[name] = id
+	return id
+}
+
+// LookupUID returns the uid of the user name on this host
+func LookupUID(name string) (int, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// LookupGID returns the gid of the group name on this host
+func LookupGID(name string) (int, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// ownerNames looks up the user and group names of the ids once
+type ownerNames struct {
+	users, groups map[int]string
+}
+
+func newOwnerNames() *ownerNames {
+	return &ownerNames{users: make(map[int]string), groups: make(map[int]string)}
+}
+
+// user returns the name of the uid, it's empty if the uid is unknown
+func (o *ownerNames) user(uid int) string {
+	if name, ok := o.users[uid]; ok {
+		return name
+	}
+	var name string
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	o.users[uid] = name
+	return name
+}
+
+// group returns the name of the gid, it's empty if the gid is unknown
+func (o *ownerNames) group(gid int) string {
+	if name, ok := o.groups[gid]; ok {
+		return name
+	}
+	var name string
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		name = g.Name
+	}
+	o.groups[gid] = name
+	return name
+}
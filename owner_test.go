@@ -0,0 +1,54 @@
+//go:build !windows
+
+package gotgz
+
+import (
+	"archive/tar"
+	"testing"
+)
+
+func TestOwnerResolver(t *testing.T) {
+	zero, override := 0, 1234
+	header := &tar.Header{Uid: 1000, Gid: 1001, Uname: "root", Gname: "gotgz-no-such-group"}
+	tests := []struct {
+		name     string
+		flags    DecompressFlags
+		uid, gid int
+		ok       bool
+	}{
+		{name: "Default", flags: DecompressFlags{}, uid: 1000, gid: 1001, ok: true},
+		{name: "Names", flags: DecompressFlags{OwnerFrom: OwnerFromNames}, uid: 0, gid: 1001, ok: true},
+		{name: "Skip", flags: DecompressFlags{OwnerFrom: OwnerFromSkip}, uid: -1, gid: -1},
+		{name: "No same owner", flags: DecompressFlags{NoSameOwner: true}, uid: -1, gid: -1},
+		{name: "Override", flags: DecompressFlags{NoSameOwner: true, Uid: &override}, uid: 1234, gid: -1, ok: true},
+		{name: "Override both", flags: DecompressFlags{OwnerFrom: OwnerFromNames, Uid: &override, Gid: &zero}, uid: 1234, gid: 0, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owners, err := newOwnerResolver(tt.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uid, gid, ok := owners.owner(header)
+			if uid != tt.uid || gid != tt.gid || ok != tt.ok {
+				t.Errorf("owner() = %d, %d, %v, want %d, %d, %v", uid, gid, ok, tt.uid, tt.gid, tt.ok)
+			}
+		})
+	}
+
+	if _, err := newOwnerResolver(DecompressFlags{OwnerFrom: "uids"}); err == nil {
+		t.Errorf("newOwnerResolver() error = nil, want an error")
+	}
+}
+
+func TestLookupID(t *testing.T) {
+	if uid, err := LookupUID("root"); err != nil || uid != 0 {
+		t.Errorf("LookupUID(root) = %d, %v, want 0", uid, err)
+	}
+	if _, err := LookupUID("gotgz-no-such-user"); err == nil {
+		t.Error("LookupUID() should fail for the unknown user")
+	}
+	if _, err := LookupGID("gotgz-no-such-group"); err == nil {
+		t.Error("LookupGID() should fail for the unknown group")
+	}
+}
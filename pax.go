@@ -0,0 +1,76 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// paxBasicKeys are the pax records of the header fields, archive/tar writes them from the fields
+// and ignores them in the records of the members
+var paxBasicKeys = map[string]bool{
+	"path": true, "linkpath": true, "size": true, "uid": true, "gid": true,
+	"uname": true, "gname": true, "mtime": true, "atime": true, "ctime": true,
+}
+
+// checkPAXRecords returns the error if the records of the members can't be written
+func checkPAXRecords(records map[string]string) error {
+	for key, value := range records {
+		switch {
+		case key == "" || strings.ContainsAny(key, "= \x00") || strings.Contains(value, "\x00"):
+			return fmt.Errorf("invalid pax record %q", key+"="+value)
+		case paxBasicKeys[key]:
+			return fmt.Errorf("the pax record %s is the header field, it can't be set for every member", key)
+		}
+	}
+	return nil
+}
+
+// stampRecords adds the records to the pax records of the member, its own records are kept,
+// the member is written in the pax format since only it has the records, e.g. the members of the GNU archives
+func stampRecords(header *tar.Header, records map[string]string) {
+	if len(records) == 0 {
+		return
+	}
+	merged := maps.Clone(records)
+	maps.Copy(merged, header.PAXRecords)
+	header.PAXRecords = merged
+	header.Format = tar.FormatPAX
+}
+
+// ExpandHeaderName expands the name template of the pax global header, it's the subset of `globexthdr.name`
+// of GNU tar, %p is the process id, %n is always 1 since gotgz only writes one global header, and %% is the percent sign
+func ExpandHeaderName(template string) (string, error) {
+	var (
+		name    strings.Builder
+		escaped bool
+	)
+	for _, r := range template {
+		if !escaped {
+			if r == '%' {
+				escaped = true
+			} else {
+				name.WriteRune(r)
+			}
+			continue
+		}
+		escaped = false
+		switch r {
+		case 'p':
+			name.WriteString(strconv.Itoa(os.Getpid()))
+		case 'n':
+			name.WriteString("1")
+		case '%':
+			name.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unsupported %%%c in the header name %q, it can be %%p, %%n or %%%%", r, template)
+		}
+	}
+	if escaped {
+		return "", fmt.Errorf("the header name %q ends with %%", template)
+	}
+	return name.String(), nil
+}
@@ -0,0 +1,141 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCompressSources_PAXRecords(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		records map[string]string
+		wantErr bool
+	}{
+		{name: "Records", records: map[string]string{"build.id": "42", "SCHILY.xattr.user.origin": "ci"}},
+		{name: "Header field", records: map[string]string{"mtime": "0"}, wantErr: true},
+		{name: "Invalid key", records: map[string]string{"a=b": "c"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			flags := CompressFlags{
+				Archiver:         GZipArchiver{Level: 1},
+				Relative:         true,
+				GlobalHeader:     map[string]string{"vcs.ref": "abc"},
+				GlobalHeaderName: "GlobalHead.1",
+				PAXRecords:       tt.records,
+				Entries:          []Entry{{Name: "b", Content: bytes.NewReader([]byte("b"))}},
+				Logger:           discardLogger,
+			}
+			err := CompressSources(context.Background(), nopWriteCloser{&buf}, flags, Source{Path: dir + "/a"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CompressSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			zr, err := GZipArchiver{}.Reader(io.NopCloser(&buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := tar.NewReader(zr)
+			var members int
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if header.Typeflag == tar.TypeXGlobalHeader {
+					if header.Name != "GlobalHead.1" || header.PAXRecords["vcs.ref"] != "abc" {
+						t.Errorf("global header %s = %v", header.Name, header.PAXRecords)
+					}
+					continue
+				}
+				members++
+				for key, value := range tt.records {
+					if header.PAXRecords[key] != value {
+						t.Errorf("the record %s of %s = %q, want %q", key, header.Name, header.PAXRecords[key], value)
+					}
+				}
+			}
+			if members != 2 {
+				t.Errorf("members = %d, want 2", members)
+			}
+		})
+	}
+}
+
+func TestExpandHeaderName(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{template: "pax_global_header", want: "pax_global_header"},
+		{template: "%p/GlobalHead.%n", want: pid + "/GlobalHead.1"},
+		{template: "100%%", want: "100%"},
+		{template: "%d/GlobalHead", wantErr: true},
+		{template: "GlobalHead%", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := ExpandHeaderName(tt.template)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandHeaderName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandHeaderName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressSources_PAXRecordsNestedGNU(t *testing.T) {
+	var inner bytes.Buffer
+	tw := tar.NewWriter(&inner)
+	if err := tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0644, Size: 1, Format: tar.FormatGNU}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nested := NestedSource{Name: "gnu.tgz", Open: func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(gzipBytes(t, inner.Bytes()))), nil
+	}}
+	var buf bytes.Buffer
+	flags := CompressFlags{Archiver: GZipArchiver{Level: 1}, PAXRecords: map[string]string{"build": "1"}, Nested: []NestedSource{nested}, Logger: discardLogger}
+	if err := CompressSources(context.Background(), nopWriteCloser{&buf}, flags); err != nil {
+		t.Fatal(err)
+	}
+	var records []string
+	err := List(context.Background(), io.NopCloser(&buf), ListFlags{Archiver: GZipArchiver{}}, func(header *tar.Header, _ io.Reader) error {
+		records = append(records, header.Name+"="+header.PAXRecords["build"])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0] != "a=1" {
+		t.Errorf("members = %q, want the record of a", records)
+	}
+}
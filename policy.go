@@ -0,0 +1,78 @@
+package gotgz
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ExplainPolicy writes how the permissions, the owners, the times and the existing files are handled on extract
+// with the flags, the defaults are the same for root unlike tar, so the surprises in the containers can be checked
+// before the extraction
+func (f DecompressFlags) ExplainPolicy(w io.Writer) error {
+	owners, err := newOwnerResolver(f)
+	if err != nil {
+		return err
+	}
+
+	var perm string
+	switch {
+	case !f.NoSamePerm:
+		perm = "the modes in the archive"
+	case f.ApplyUmask:
+		perm = fmt.Sprintf("the modes in the archive without the umask %03o", umask())
+	default:
+		perm = fmt.Sprintf("%04o for the directories and %04o for the files", f.dirPerm(), f.filePerm())
+	}
+
+	var owner string
+	switch owners.from {
+	case OwnerFromIDs:
+		owner = "the uids and gids in the archive"
+	case OwnerFromNames:
+		owner = "the user and group names in the archive, the ids if they are unknown on this host"
+	default:
+		owner = "not restored, the entries are owned by the user of the process"
+	}
+	if owners.uid != nil {
+		owner += fmt.Sprintf(", but the uid is %d", *owners.uid)
+	}
+	if owners.gid != nil {
+		owner += fmt.Sprintf(", but the gid is %d", *owners.gid)
+	}
+
+	times := "the modification times in the archive"
+	if f.NoSameTime {
+		times = "not restored, the entries have the current time"
+	}
+
+	failures := "fail the extraction"
+	if f.WarnMetadata {
+		failures = "logged and counted, the exit code is 2"
+	}
+
+	var overwrite string
+	switch {
+	case f.NoOverwrite:
+		overwrite = "keep the existing files, the entries are skipped"
+	case f.RecursiveUnlink:
+		overwrite = "replace the existing files, the links and the directories"
+	default:
+		overwrite = "replace the existing files, the links and the empty directories"
+	}
+
+	for _, line := range [][2]string{
+		{"euid", strconv.Itoa(os.Geteuid())},
+		{"permissions", perm},
+		{"owners", owner},
+		{"times", times},
+		{"metadata failures", failures},
+		{"overwrite", overwrite},
+	} {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", line[0], line[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
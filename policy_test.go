@@ -0,0 +1,64 @@
+package gotgz
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecompressFlags_ExplainPolicy(t *testing.T) {
+	id := 1000
+	tests := []struct {
+		name    string
+		flags   DecompressFlags
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "Default",
+			flags: DecompressFlags{NoSamePerm: true, NoSameOwner: true, NoSameTime: true},
+			want: []string{
+				"permissions: 0755 for the directories and 0644 for the files\n",
+				"owners: not restored, the entries are owned by the user of the process\n",
+				"times: not restored, the entries have the current time\n",
+				"metadata failures: fail the extraction\n",
+				"overwrite: replace the existing files, the links and the empty directories\n",
+			},
+		},
+		{
+			name:  "Same",
+			flags: DecompressFlags{OwnerFrom: OwnerFromNames, WarnMetadata: true, NoOverwrite: true},
+			want: []string{
+				"permissions: the modes in the archive\n",
+				"owners: the user and group names in the archive, the ids if they are unknown on this host\n",
+				"times: the modification times in the archive\n",
+				"metadata failures: logged and counted, the exit code is 2\n",
+				"overwrite: keep the existing files, the entries are skipped\n",
+			},
+		},
+		{
+			name:  "Chown",
+			flags: DecompressFlags{NoSamePerm: true, DirPerm: 0700, FilePerm: 0600, NoSameOwner: true, Uid: &id, RecursiveUnlink: true},
+			want: []string{
+				"permissions: 0700 for the directories and 0600 for the files\n",
+				"owners: not restored, the entries are owned by the user of the process, but the uid is 1000\n",
+				"overwrite: replace the existing files, the links and the directories\n",
+			},
+		},
+		{name: "Invalid owner source", flags: DecompressFlags{OwnerFrom: "sid"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := tt.flags.ExplainPolicy(&buf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExplainPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(buf.String(), line) {
+					t.Errorf("ExplainPolicy() = %q, want the line %q", buf.String(), line)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package gotgz
+
+import (
+	"io"
+	"sync"
+)
+
+// readAheadBlockSize is the size of the decompressed blocks which are read ahead
+const readAheadBlockSize = 1 << 20
+
+// readAhead reads the blocks of the reader in the background, so the decompression overlaps the consumer,
+// e.g. writing the extracted files, it's the same as the reader of pgzip
+type readAhead struct {
+	blocks chan []byte
+	done   chan struct{}
+	once   sync.Once
+	block  []byte
+	// err is the error of the source, it's set before the blocks are closed
+	err error
+}
+
+// newReadAhead reads up to count blocks ahead
+func newReadAhead(src io.Reader, count int) *readAhead {
+	r := &readAhead{blocks: make(chan []byte, count), done: make(chan struct{})}
+	go func() {
+		defer close(r.blocks)
+		for {
+			block := make([]byte, readAheadBlockSize)
+			var n int
+			var err error
+			// io.ReadFull can't be used, it hides io.ErrUnexpectedEOF of the truncated archive
+			for n < len(block) && err == nil {
+				var read int
+				read, err = src.Read(block[n:])
+				n += read
+			}
+			if n > 0 {
+				select {
+				case r.blocks <- block[:n]:
+				case <-r.done:
+					return
+				}
+			}
+			if err != nil {
+				r.err = err
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func (r *readAhead) Read(p []byte) (int, error) {
+	for len(r.block) == 0 {
+		block, ok := <-r.blocks
+		if !ok {
+			return 0, r.err
+		}
+		r.block = block
+	}
+	n := copy(p, r.block)
+	r.block = r.block[n:]
+	return n, nil
+}
+
+// Close stops reading ahead, the blocked read of the source isn't interrupted
+func (r *readAhead) Close() error {
+	r.once.Do(func() { close(r.done) })
+	return nil
+}
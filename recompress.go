@@ -0,0 +1,88 @@
+package gotgz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+type RecompressFlags struct {
+	// From decodes the source archive
+	From Archiver
+	// To encodes the destination archive
+	To     Archiver
+	Logger Logger
+
+	S3PartSize int64
+	S3Thread   int
+	Metadata   map[string]string
+}
+
+// Recompress converts the compression of the archive, the tar stream is copied as is
+// so it isn't extracted to the disk and the members are kept byte for byte
+func Recompress(ctx context.Context, src io.ReadCloser, dest io.WriteCloser, flags RecompressFlags) (err error) {
+	defer src.Close()
+
+	if flags.From == nil || flags.To == nil {
+		return fmt.Errorf("archiver is nil")
+	}
+
+	var logger = flags.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Debug("flags", "from", flags.From.Name(), "to", flags.To.Name(),
+		"s3-part-size", flags.S3PartSize, "s3-thread", flags.S3Thread)
+
+	defer func() {
+		if err != nil {
+			closeWithError(dest, err)
+		}
+	}()
+
+	zr, err := flags.From.Reader(src)
+	if err != nil {
+		return err
+	}
+	defer closeReader(zr)
+
+	zw, err := flags.To.Writer(dest)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(zw, contextReader{ctx: ctx, Reader: zr})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	logger.Info("recompress", "size", written)
+	return dest.Close()
+}
+
+// closeWithError closes the writer with the error if it's supported,
+// e.g. the s3 upload is aborted instead of completed with the partial data
+func closeWithError(w io.WriteCloser, err error) {
+	if c, ok := w.(interface{ CloseWithError(error) error }); ok {
+		c.CloseWithError(err)
+		return
+	}
+	w.Close()
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
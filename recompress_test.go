@@ -0,0 +1,79 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecompress(t *testing.T) {
+	tempDir := t.TempDir()
+	srcPath := filepath.Join(tempDir, "testdata.tar.gz")
+	file, err := os.Create(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := GZipArchiver{Level: 1}
+	if err := Compress(context.Background(), file, CompressFlags{Archiver: from}, "testdata"); err != nil {
+		t.Fatal(err)
+	}
+
+	tarStream := func(path string, archiver Archiver) []byte {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		zr, err := archiver.Reader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	destPath := filepath.Join(tempDir, "testdata.tar.zst")
+	src, err := os.Open(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := os.Create(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := ZstdArchiver{Level: 19}
+	if err := Recompress(context.Background(), src, dest, RecompressFlags{From: from, To: to}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(tarStream(srcPath, from), tarStream(destPath, to)) {
+		t.Error("the tar stream should be the same after recompress")
+	}
+}
+
+func TestRecompress_Canceled(t *testing.T) {
+	var buf bytes.Buffer
+	zw, err := GZipArchiver{Level: 1}.Writer(nopWriteCloser{&buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Recompress(ctx, io.NopCloser(&buf), nopWriteCloser{io.Discard}, RecompressFlags{From: GZipArchiver{}, To: ZstdArchiver{}})
+	if err != context.Canceled {
+		t.Errorf("Recompress() error = %v, want %v", err, context.Canceled)
+	}
+}
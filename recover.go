@@ -0,0 +1,347 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const blockSize = 512
+
+// gnuLongLinkName is the name of the GNU entries which hold the long name or the long link name of the next entry
+const gnuLongLinkName = "././@LongLink"
+
+// tarReader is the tar reader which can continue after the end of archive blocks with ignoreZeros,
+// and resynchronize on the next valid header after a corrupt region with recover
+type tarReader struct {
+	*tar.Reader
+	src         *lastBlockReader
+	ignoreZeros bool
+	recover     bool
+	logger      Logger
+	// global is called with the records of the pax global headers, they are not returned as the entries
+	global func(records map[string]string) error
+	// decode transcodes the names of the legacy archives to UTF-8, the pax records are UTF-8 already
+	decode func(string) (string, error)
+	// label is the pattern of the volume label, the archive without the matched label is rejected if it's not empty,
+	// and volume is called with the volume label, it's not returned as the entry
+	label    string
+	volume   func(label string) error
+	labelled bool
+	// globals is the GlobalHeaders mode, records are the merged records of the global headers to honor,
+	// and pending is the content of the global header which is kept as the file
+	globals string
+	records map[string]string
+	pending *bytes.Reader
+
+	// readErr is the error of reading the content of the entry
+	readErr   error
+	skipped   int64
+	regions   int
+	truncated string
+}
+
+func newTarReader(r io.Reader, ignoreZeros, recover bool, logger Logger) *tarReader {
+	src := &lastBlockReader{r: r}
+	return &tarReader{
+		Reader:      tar.NewReader(src),
+		src:         src,
+		ignoreZeros: ignoreZeros,
+		recover:     recover,
+		logger:      logger,
+	}
+}
+
+func (t *tarReader) Next() (*tar.Header, error) {
+	t.pending = nil
+	for {
+		header, err := t.Reader.Next()
+		switch {
+		case err == nil && header.Typeflag == tar.TypeXGlobalHeader:
+			t.logger.Debug("global header", "records", header.PAXRecords)
+			if t.global != nil {
+				if err := t.global(header.PAXRecords); err != nil {
+					return nil, err
+				}
+			}
+			if label, ok := header.PAXRecords[paxVolumeLabel]; ok {
+				if err := t.volumeLabel(label); err != nil {
+					return nil, err
+				}
+			}
+			switch t.globals {
+			case GlobalHeadersHonor:
+				t.records = mergeGlobalRecords(t.records, header.PAXRecords)
+			case GlobalHeadersKeep:
+				if err := t.unlabelled(); err != nil {
+					return nil, err
+				}
+				file, data := globalHeaderFile(header)
+				t.pending = bytes.NewReader(data)
+				return file, nil
+			}
+		case err == nil && header.Typeflag == 'X':
+			// the obsolete extended header of solaris tar isn't supported by the tar reader
+			t.logger.Warn("skip the solaris extended header", "name", header.Name, "size", header.Size)
+		case err == nil && header.Typeflag == TypeGNUVolume:
+			if err := t.volumeLabel(header.Name); err != nil {
+				return nil, err
+			}
+		case err == nil && header.Name == gnuLongLinkName:
+			// the tar reader only consumes the long name entries with the L or K type,
+			// the others from the broken tars are not the members
+			t.logger.Warn("skip the synthetic long name entry", "type", string(header.Typeflag), "size", header.Size)
+		case err == nil:
+			if err := t.unlabelled(); err != nil {
+				return nil, err
+			}
+			if err := applyGlobalRecords(header, t.records); err != nil {
+				return nil, err
+			}
+			return header, t.decodeNames(header)
+		case err == io.EOF && (t.ignoreZeros || t.recover):
+			// the end of archive blocks can be followed by another archive
+			if err := t.skip(false); err != nil {
+				return nil, err
+			}
+		case err == io.EOF:
+			if err := t.unlabelled(); err != nil {
+				return nil, err
+			}
+			if !t.concatenated() {
+				return nil, io.EOF
+			}
+		case errors.Is(err, tar.ErrHeader) && t.recover:
+			if err := t.skip(true); err != nil {
+				return nil, err
+			}
+		case t.recover:
+			t.truncate("", err)
+			return nil, io.EOF
+		default:
+			return nil, err
+		}
+	}
+}
+
+// volumeLabel checks the volume label with the label pattern and passes it to the volume callback
+func (t *tarReader) volumeLabel(label string) error {
+	t.labelled = true
+	t.logger.Debug("volume label", "label", label)
+	if t.label != "" {
+		if err := matchVolumeLabel(t.label, label); err != nil {
+			return err
+		}
+	}
+	if t.volume != nil {
+		return t.volume(label)
+	}
+	return nil
+}
+
+// unlabelled returns the error if the label pattern is set but the archive doesn't start with the volume label
+func (t *tarReader) unlabelled() error {
+	if t.label != "" && !t.labelled {
+		return fmt.Errorf("archive doesn't have the volume label which matches %q", t.label)
+	}
+	return nil
+}
+
+// decodeNames transcodes the name and the link name which are not from the pax records
+func (t *tarReader) decodeNames(header *tar.Header) (err error) {
+	if t.decode == nil {
+		return nil
+	}
+	if _, ok := header.PAXRecords["path"]; !ok {
+		if header.Name, err = t.decode(header.Name); err != nil {
+			return fmt.Errorf("decode the name %q: %w", header.Name, err)
+		}
+	}
+	if _, ok := header.PAXRecords["linkpath"]; !ok && header.Linkname != "" {
+		if header.Linkname, err = t.decode(header.Linkname); err != nil {
+			return fmt.Errorf("decode the link name %q: %w", header.Linkname, err)
+		}
+	}
+	return nil
+}
+
+// skip resyncs to the next header and reports the skipped bytes
+func (t *tarReader) skip(withLast bool) error {
+	offset, skipped := t.src.offset, t.skipped
+	err := t.resync(withLast)
+	if t.skipped > skipped {
+		t.regions++
+		t.logger.Warn("skip the corrupt region", "offset", offset, "size", t.skipped-skipped)
+	}
+	return err
+}
+
+// Offset returns the bytes read from the decompressed stream
+func (t *tarReader) Offset() int64 {
+	return t.src.offset
+}
+
+func (t *tarReader) Read(p []byte) (int, error) {
+	if t.pending != nil {
+		return t.pending.Read(p)
+	}
+	n, err := t.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		t.readErr = err
+	}
+	return n, err
+}
+
+// Truncated returns true if the error is from reading the entry in the recover mode,
+// the rest of the archive can't be read since the stream is broken
+func (t *tarReader) Truncated(name string, err error) bool {
+	if !t.recover || t.readErr == nil || !errors.Is(err, t.readErr) {
+		return false
+	}
+	t.truncate(name, err)
+	return true
+}
+
+func (t *tarReader) truncate(name string, err error) {
+	t.logger.Warn("the archive is truncated, the rest is lost", "entry", name, "offset", t.src.offset, "error", err)
+	t.truncated = name
+	if name == "" {
+		t.truncated = "<header>"
+	}
+}
+
+// Damaged reports what is lost in the recover mode
+func (t *tarReader) Damaged() error {
+	if t.regions == 0 && t.truncated == "" {
+		return nil
+	}
+	var lost []string
+	if t.regions > 0 {
+		lost = append(lost, fmt.Sprintf("%d corrupt regions with %d bytes are skipped", t.regions, t.skipped))
+	}
+	if t.truncated != "" {
+		lost = append(lost, fmt.Sprintf("the archive is truncated at %s", t.truncated))
+	}
+	return fmt.Errorf("the archive is damaged: %s", strings.Join(lost, ", "))
+}
+
+// resync scans the blocks until a valid header is found and resets the tar reader to it,
+// the last block read by the tar reader is scanned first if withLast is true
+func (t *tarReader) resync(withLast bool) error {
+	var block [blockSize]byte
+	if withLast && t.src.size == blockSize {
+		block = t.src.last
+	} else if _, err := t.readBlock(block[:]); err != nil {
+		return err
+	}
+
+	for {
+		if isHeaderBlock(block[:]) {
+			t.src.last, t.src.size = [blockSize]byte{}, 0
+			t.Reader = tar.NewReader(io.MultiReader(bytes.NewReader(block[:]), t.src))
+			return nil
+		}
+		if block != ([blockSize]byte{}) {
+			t.skipped += blockSize
+		}
+		if _, err := t.readBlock(block[:]); err != nil {
+			return err
+		}
+	}
+}
+
+// concatenated reports whether another archive follows the end of archive blocks, e.g. `cat a.tar.gz b.tar.gz`,
+// the tar reader is reset to it if so, the trailing garbage still ends the archive like tar
+func (t *tarReader) concatenated() bool {
+	var block [blockSize]byte
+	for {
+		if _, err := io.ReadFull(t.src, block[:]); err != nil {
+			if err != io.EOF {
+				t.logger.Debug("ignore the trailing data", "offset", t.src.offset, "error", err)
+			}
+			return false
+		}
+		if block == ([blockSize]byte{}) {
+			continue
+		}
+		if !isHeaderBlock(block[:]) {
+			t.logger.Debug("ignore the trailing data", "offset", t.src.offset)
+			return false
+		}
+		t.logger.Debug("read the concatenated archive", "offset", t.src.offset-blockSize)
+		t.src.last, t.src.size = [blockSize]byte{}, 0
+		t.Reader = tar.NewReader(io.MultiReader(bytes.NewReader(block[:]), t.src))
+		return true
+	}
+}
+
+func (t *tarReader) readBlock(block []byte) (int, error) {
+	n, err := io.ReadFull(t.src, block)
+	switch {
+	case err == io.EOF:
+		return n, io.EOF
+	case err == io.ErrUnexpectedEOF:
+		// the trailing bytes are less than a block
+		if !bytes.Equal(block[:n], make([]byte, n)) {
+			t.skipped += int64(n)
+		}
+		return n, io.EOF
+	case err != nil:
+		if t.recover {
+			t.truncate("", err)
+			return n, io.EOF
+		}
+		return n, err
+	}
+	return n, nil
+}
+
+// isHeaderBlock reports whether the block has a valid header checksum
+func isHeaderBlock(block []byte) bool {
+	field := strings.TrimRight(strings.TrimSpace(string(bytes.Trim(block[148:156], "\x00"))), " \x00")
+	if field == "" {
+		return false
+	}
+	want, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+
+	var unsigned, signed int64
+	for i, c := range block {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		unsigned += int64(c)
+		signed += int64(int8(c))
+	}
+	return want == unsigned || want == signed
+}
+
+// lastBlockReader remembers the last block read, the header which is read by the tar reader
+// before it finds the header is invalid can be scanned again
+type lastBlockReader struct {
+	r      io.Reader
+	last   [blockSize]byte
+	size   int
+	offset int64
+}
+
+func (l *lastBlockReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if n >= blockSize {
+		copy(l.last[:], p[n-blockSize:n])
+		l.size = blockSize
+	} else if n > 0 {
+		keep := min(l.size, blockSize-n)
+		copy(l.last[:], l.last[l.size-keep:l.size])
+		copy(l.last[keep:], p[:n])
+		l.size = keep + n
+	}
+	l.offset += int64(n)
+	return n, err
+}
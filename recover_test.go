@@ -0,0 +1,212 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tarFile struct {
+	name    string
+	content string
+}
+
+func newTestTar(t *testing.T, files ...tarFile) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw, err := GZipArchiver{Level: 1}.Writer(nopWriteCloser{&buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func listNames(data []byte, flags ListFlags) ([]string, error) {
+	var names []string
+	flags.Archiver = GZipArchiver{}
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(data)), flags, func(header *tar.Header, content io.Reader) error {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		names = append(names, header.Name+"="+string(data))
+		return nil
+	})
+	return names, err
+}
+
+func TestList_IgnoreZeros(t *testing.T) {
+	data := append(newTestTar(t, tarFile{"a", "1"}), newTestTar(t, tarFile{"b", "2"})...)
+	archive := gzipBytes(t, data)
+
+	// the concatenated archive is read without IgnoreZeros, e.g. `cat a.tar.gz b.tar.gz`
+	got, err := listNames(archive, ListFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a=1", "b=2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// but the trailing garbage ends the archive
+	garbage := append(newTestTar(t, tarFile{"a", "1"}), bytes.Repeat([]byte("x"), blockSize)...)
+	got, err = listNames(gzipBytes(t, append(garbage, newTestTar(t, tarFile{"b", "2"})...)), ListFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got, err = listNames(archive, ListFlags{IgnoreZeros: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a=1", "b=2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestList_Recover(t *testing.T) {
+	data := newTestTar(t, tarFile{"a", "1"}, tarFile{"b", strings.Repeat("x", 1000)}, tarFile{"c", "3"})
+	// corrupt the header of b
+	copy(data[2*blockSize:], "corrupt")
+	archive := gzipBytes(t, data)
+
+	if _, err := listNames(archive, ListFlags{}); err == nil {
+		t.Fatal("the corrupt archive should fail without recover")
+	}
+
+	got, err := listNames(archive, ListFlags{Recover: true})
+	if err == nil || !strings.Contains(err.Error(), "1 corrupt regions with 1536 bytes are skipped") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if want := []string{"a=1", "c=3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestList_RecoverTruncated(t *testing.T) {
+	data := newTestTar(t, tarFile{"a", "1"}, tarFile{"b", strings.Repeat("x", 100000)})
+	archive := gzipBytes(t, data)
+	archive = archive[:len(archive)/2]
+
+	if _, err := listNames(archive, ListFlags{}); err == nil {
+		t.Fatal("the truncated archive should fail without recover")
+	}
+
+	got, err := listNames(archive, ListFlags{Recover: true})
+	if err == nil || !strings.Contains(err.Error(), "truncated at b") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if want := []string{"a=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDecompress_RecoverTruncated(t *testing.T) {
+	data := newTestTar(t, tarFile{"a", "1"}, tarFile{"b", strings.Repeat("x", 100000)})
+	archive := gzipBytes(t, data)
+	archive = archive[:len(archive)/2]
+
+	dir := t.TempDir()
+	flags := DecompressFlags{Archiver: GZipArchiver{}, NoSameOwner: true, NoSameTime: true, Recover: true}
+	err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(archive)), dir, flags)
+	if err == nil || !strings.Contains(err.Error(), "truncated at b") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a")); err != nil || string(data) != "1" {
+		t.Errorf("a should be extracted, got %q, %v", data, err)
+	}
+}
+
+func TestList_GNULongName(t *testing.T) {
+	// the deep path is longer than the ustar and the GNU header fields
+	var dirs []string
+	for i := 0; i < 8; i++ {
+		dirs = append(dirs, strings.Repeat(string(rune('a'+i)), 120))
+	}
+	long := strings.Join(dirs, "/")
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range []*tar.Header{
+		{Name: long + "/", Typeflag: tar.TypeDir, Mode: 0755, Format: tar.FormatGNU},
+		{Name: long + "/file", Typeflag: tar.TypeReg, Mode: 0644, Size: 4, Format: tar.FormatGNU},
+		{Name: long + "/link", Typeflag: tar.TypeSymlink, Linkname: strings.Repeat("../", len(dirs)) + long + "/file", Mode: 0777, Format: tar.FormatGNU},
+		{Name: long + "/hardlink", Typeflag: tar.TypeLink, Linkname: long + "/file", Format: tar.FormatGNU},
+		// the broken tar writes the long name entry with a regular file type
+		{Name: gnuLongLinkName, Typeflag: tar.TypeReg, Mode: 0644, Size: 4, Format: tar.FormatGNU},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := io.WriteString(tw, "data"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(gnuLongLinkName+"\x00")) {
+		t.Fatal("the archive has no GNU long name entries")
+	}
+	data := gzipBytes(t, buf.Bytes())
+
+	names, err := listNames(data, ListFlags{Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{long + "/=", long + "/file=data", long + "/link=", long + "/hardlink="}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %v, want %v", names, want)
+	}
+
+	dest := t.TempDir()
+	flags := DecompressFlags{Archiver: GZipArchiver{}, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(data)), dest, flags); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"file", "link", "hardlink"} {
+		got, err := os.ReadFile(filepath.Join(dest, long, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "data" {
+			t.Errorf("%s content = %q, want %q", name, got, "data")
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dest, gnuLongLinkName)); !os.IsNotExist(err) {
+		t.Errorf("the long name entry is extracted: %v", err)
+	}
+}
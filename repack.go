@@ -0,0 +1,183 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// repackEntry is the member in the spool file
+type repackEntry struct {
+	header *tar.Header
+	offset int64
+	hash   [sha256.Size]byte
+}
+
+// Repack rewrites the archive to the canonical form, the flags are the same with Recompress.
+// The entries are sorted by name, the regular files with the same content are stored once
+// and the others are hardlinks to it, the owners are stripped and the PAX records are dropped,
+// so the digests of the archives with the same content are the same across the producers.
+// The contents are spooled to a temporary file since the entries are sorted.
+func Repack(ctx context.Context, src io.ReadCloser, dest io.WriteCloser, flags RecompressFlags) (err error) {
+	defer src.Close()
+
+	if flags.From == nil || flags.To == nil {
+		return fmt.Errorf("archiver is nil")
+	}
+
+	var logger = flags.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Debug("flags", "from", flags.From.Name(), "to", flags.To.Name())
+
+	defer func() {
+		if err != nil {
+			closeWithError(dest, err)
+		}
+	}()
+
+	spool, err := os.CreateTemp("", "gotgz-repack-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	zr, err := flags.From.Reader(src)
+	if err != nil {
+		return err
+	}
+	defer closeReader(zr)
+
+	var (
+		entries = make(map[string]*repackEntry)
+		offset  int64
+		tr      = tar.NewReader(contextReader{ctx: ctx, Reader: zr})
+	)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// the global header describes the source archive, it's not kept in the canonical form
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		entry := &repackEntry{header: normalizeHeader(header), offset: offset}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			hash := sha256.New()
+			written, err := io.Copy(io.MultiWriter(spool, hash), tr)
+			if err != nil {
+				return err
+			}
+			offset += written
+			copy(entry.hash[:], hash.Sum(nil))
+		case tar.TypeLink:
+			// the hardlink is resolved to the content, it's linked again by the hash
+			target, ok := entries[entry.header.Linkname]
+			if !ok || target.header.Typeflag != tar.TypeReg {
+				return fmt.Errorf("hardlink %s to the unknown file %s", header.Name, header.Linkname)
+			}
+			entry.header.Typeflag = tar.TypeReg
+			entry.header.Size = target.header.Size
+			entry.header.Mode = target.header.Mode
+			entry.header.ModTime = target.header.ModTime
+			entry.header.Linkname = ""
+			entry.offset, entry.hash = target.offset, target.hash
+		}
+		// the last one wins like the extraction
+		entries[entry.header.Name] = entry
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw, err := flags.To.Writer(dest)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	// the hardlinks share the mode and the modification time as well
+	type contentKey struct {
+		hash    [sha256.Size]byte
+		mode    int64
+		modTime time.Time
+	}
+	var (
+		stored = make(map[contentKey]string)
+		links  int
+	)
+	for _, name := range names {
+		entry := entries[name]
+		header := entry.header
+		if header.Typeflag == tar.TypeReg {
+			key := contentKey{hash: entry.hash, mode: header.Mode, modTime: header.ModTime}
+			if first, ok := stored[key]; ok {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+				links++
+			} else {
+				stored[key] = name
+			}
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(tw, contextReader{ctx: ctx, Reader: io.NewSectionReader(spool, entry.offset, header.Size)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	logger.Info("repack", "entries", len(names), "hardlinks", links)
+	return dest.Close()
+}
+
+// normalizeHeader keeps the fields which are the same across the producers
+func normalizeHeader(header *tar.Header) *tar.Header {
+	name := strings.TrimPrefix(header.Name, "./")
+	if header.Typeflag == tar.TypeDir && !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	var size int64
+	if header.Typeflag == tar.TypeReg {
+		size = header.Size
+	}
+	return &tar.Header{
+		Typeflag: header.Typeflag,
+		Name:     name,
+		Linkname: strings.TrimPrefix(header.Linkname, "./"),
+		Size:     size,
+		Mode:     header.Mode & 07777,
+		ModTime:  header.ModTime.Truncate(time.Second).UTC(),
+		Devmajor: header.Devmajor,
+		Devminor: header.Devminor,
+		Format:   tar.FormatPAX,
+	}
+}
@@ -0,0 +1,98 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRepack(t *testing.T) {
+	type file struct {
+		header  tar.Header
+		content string
+	}
+
+	archive := func(files ...file) io.ReadCloser {
+		var buf bytes.Buffer
+		zw, err := GZipArchiver{Level: 1}.Writer(nopWriteCloser{&buf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := tar.NewWriter(zw)
+		for _, f := range files {
+			f.header.Size = int64(len(f.content))
+			if err := tw.WriteHeader(&f.header); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(tw, f.content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return io.NopCloser(&buf)
+	}
+
+	repack := func(src io.ReadCloser) []byte {
+		var buf bytes.Buffer
+		err := Repack(context.Background(), src, nopWriteCloser{&buf}, RecompressFlags{From: GZipArchiver{}, To: GZipArchiver{Level: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	modTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := repack(archive(
+		file{header: tar.Header{Name: "dir", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime}},
+		file{header: tar.Header{Name: "dir/b", Typeflag: tar.TypeReg, Mode: 0644, ModTime: modTime, Uid: 1000, Uname: "alice"}, content: "same"},
+		file{header: tar.Header{Name: "dir/a", Typeflag: tar.TypeReg, Mode: 0644, ModTime: modTime, Uid: 1000, Uname: "alice"}, content: "same"},
+		file{header: tar.Header{Name: "dir/c", Typeflag: tar.TypeReg, Mode: 0600, ModTime: modTime}, content: "other"},
+	))
+	b := repack(archive(
+		file{header: tar.Header{Name: "./dir/c", Typeflag: tar.TypeReg, Mode: 0600, ModTime: modTime.Add(time.Millisecond), Format: tar.FormatPAX,
+			PAXRecords: map[string]string{"SCHILY.xattr.user.foo": "bar"}}, content: "other"},
+		file{header: tar.Header{Name: "./dir/a", Typeflag: tar.TypeReg, Mode: 0644, ModTime: modTime, Gid: 20, Gname: "staff"}, content: "same"},
+		file{header: tar.Header{Name: "./dir/b", Typeflag: tar.TypeLink, Linkname: "./dir/a"}},
+		file{header: tar.Header{Name: "./dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime}},
+	))
+	if !bytes.Equal(a, b) {
+		t.Fatal("the repacked archives should be the same")
+	}
+
+	zr, err := GZipArchiver{}.Reader(io.NopCloser(bytes.NewReader(a)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Uid != 0 || header.Uname != "" || len(header.PAXRecords) != 0 {
+			t.Errorf("header %s is not normalized", header.Name)
+		}
+		got = append(got, string(header.Typeflag)+header.Name+"->"+header.Linkname)
+	}
+	want := []string{"5dir/->", "0dir/a->", "1dir/b->dir/a", "0dir/c->"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d is %s, want %s", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package gotgz
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// retryBackoff is the delay of the first retry, it's doubled after every retry
+var retryBackoff = 100 * time.Millisecond
+
+// isTransient returns true if the error may be gone after a while, e.g. the network mounts like NFS and SMB
+// return them when the server is unavailable for a moment
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EAGAIN)
+}
+
+// fsRetry retries the filesystem operations with the transient errors
+type fsRetry struct {
+	ctx     context.Context
+	retries int
+	logger  Logger
+}
+
+// do calls fn until it succeeds, the error isn't transient, the retries are exhausted or the context is done
+func (r fsRetry) do(op, path string, fn func() error) error {
+	delay := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > r.retries || !isTransient(err) {
+			return err
+		}
+		r.logger.Warn("retry the transient error", "op", op, "path", path, "attempt", attempt, "delay", delay.String(), "error", err)
+		select {
+		case <-r.ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// mkdirAll creates the directory and its parents like os.MkdirAll with the retries
+func (r fsRetry) mkdirAll(path string, perm fs.FileMode) error {
+	return r.do("mkdir", path, func() error {
+		return os.MkdirAll(path, perm)
+	})
+}
+
+// lstat returns the file info like os.Lstat with the retries
+func (r fsRetry) lstat(path string) (fi fs.FileInfo, err error) {
+	err = r.do("lstat", path, func() error {
+		fi, err = os.Lstat(path)
+		return err
+	})
+	return fi, err
+}
+
+// readDirNames returns the sorted names in the directory with the retries, the directory is opened again
+// by every retry, so the names aren't read partially
+func (r fsRetry) readDirNames(path string) (names []string, err error) {
+	err = r.do("readdir", path, func() error {
+		dir, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		names, err = dir.Readdirnames(-1)
+		return err
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// walk walks the file tree like filepath.Walk, but the Lstat and the ReadDir are retried
+func (r fsRetry) walk(root string, fn filepath.WalkFunc) error {
+	info, err := r.lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = r.walkDir(root, info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (r fsRetry) walkDir(path string, info fs.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	names, err := r.readDirNames(path)
+	if err1 := fn(path, info, err); err != nil || err1 != nil {
+		// the error of the directory is reported once, and it's skipped if the fn returns nil
+		return err1
+	}
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileInfo, err := r.lstat(filename)
+		if err != nil {
+			if err := fn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := r.walkDir(filename, fileInfo, fn); err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reader returns the reader which retries the reads, the offset isn't changed by the failed reads
+func (r fsRetry) reader(path string, src io.Reader) io.Reader {
+	if r.retries <= 0 {
+		return src
+	}
+	return retryReader{Reader: src, retry: r, path: path}
+}
+
+// writer returns the writer which retries the remaining bytes of the failed writes
+func (r fsRetry) writer(path string, dst io.Writer) io.Writer {
+	if r.retries <= 0 {
+		return dst
+	}
+	return retryWriter{Writer: dst, retry: r, path: path}
+}
+
+type retryReader struct {
+	io.Reader
+	retry fsRetry
+	path  string
+}
+
+func (r retryReader) Read(p []byte) (n int, err error) {
+	err = r.retry.do("read", r.path, func() error {
+		n, err = r.Reader.Read(p)
+		if n > 0 && isTransient(err) {
+			// the error is returned again by the next read
+			return nil
+		}
+		return err
+	})
+	return n, err
+}
+
+type retryWriter struct {
+	io.Writer
+	retry fsRetry
+	path  string
+}
+
+func (w retryWriter) Write(p []byte) (n int, err error) {
+	err = w.retry.do("write", w.path, func() error {
+		written, err := w.Writer.Write(p[n:])
+		n += written
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,147 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyReader returns the errors before the reads of the reader
+type flakyReader struct {
+	io.Reader
+	errs []error
+}
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+// flakyWriter writes one byte and fails with the errors before the writes of the writer
+type flakyWriter struct {
+	io.Writer
+	errs []error
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if len(w.errs) > 0 {
+		err := w.errs[0]
+		w.errs = w.errs[1:]
+		n, _ := w.Writer.Write(p[:1])
+		return n, err
+	}
+	return w.Writer.Write(p)
+}
+
+func TestFSRetry(t *testing.T) {
+	backoff := retryBackoff
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = backoff }()
+
+	stale := &os.PathError{Op: "read", Path: "a", Err: syscall.ESTALE}
+	tests := []struct {
+		name    string
+		retries int
+		errs    []error
+		wantErr error
+	}{
+		{name: "No error", retries: 2},
+		{name: "Transient", retries: 2, errs: []error{syscall.EIO, stale}},
+		{name: "Exhausted", retries: 1, errs: []error{syscall.EAGAIN, syscall.EIO}, wantErr: syscall.EIO},
+		{name: "No retry", errs: []error{syscall.EIO}, wantErr: syscall.EIO},
+		{name: "Permanent", retries: 2, errs: []error{syscall.EACCES}, wantErr: syscall.EACCES},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry := fsRetry{ctx: context.Background(), retries: tt.retries, logger: discardLogger}
+
+			got, err := io.ReadAll(retry.reader("a", &flakyReader{Reader: bytes.NewReader([]byte("content")), errs: tt.errs}))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("read error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && string(got) != "content" {
+				t.Errorf("read %q, want %q", got, "content")
+			}
+
+			var buf bytes.Buffer
+			_, err = retry.writer("a", &flakyWriter{Writer: &buf, errs: tt.errs}).Write([]byte("content"))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("write error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && buf.String() != "content" {
+				t.Errorf("write %q, want %q", buf.String(), "content")
+			}
+		})
+	}
+}
+
+func TestFSRetry_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	retry := fsRetry{ctx: ctx, retries: 10, logger: discardLogger}
+	var calls int
+	err := retry.do("open", "a", func() error {
+		calls++
+		return syscall.EIO
+	})
+	if !errors.Is(err, syscall.EIO) || calls != 1 {
+		t.Errorf("do() = %v after %d calls, want EIO after 1 call", err, calls)
+	}
+}
+
+func TestFSRetry_Walk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"b/c", "a", "skip/d", "b/a"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the walk is the same as filepath.Walk, e.g. the order and SkipDir
+	walk := func(walker func(string, filepath.WalkFunc) error) []string {
+		var got []string
+		err := walker(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			got = append(got, rel)
+			if fi.IsDir() && fi.Name() == "skip" {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	retry := fsRetry{ctx: context.Background(), retries: 3, logger: discardLogger}
+	if got, want := walk(retry.walk), walk(filepath.Walk); !reflect.DeepEqual(got, want) {
+		t.Errorf("walk() = %v, want %v", got, want)
+	}
+
+	var missing error
+	_ = retry.walk(filepath.Join(root, "missing"), func(_ string, _ os.FileInfo, err error) error {
+		missing = err
+		return err
+	})
+	if !os.IsNotExist(missing) {
+		t.Errorf("walk() of the missing root error = %v, want not exist", missing)
+	}
+}
@@ -1,31 +1,43 @@
 package gotgz
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 type S3 struct {
 	uploader *s3manager.Uploader
 	s3Client *s3.Client
 	bucket   string
+	// putOptions are applied to the uploads, e.g. the storage class and the encryption
+	putOptions []func(*s3.PutObjectInput)
 }
 
-func New(basectx context.Context, bucket string) (S3, error) {
-	sdkConfig, err := config.LoadDefaultConfig(basectx)
+func New(basectx context.Context, bucket string, optFns ...func(*config.LoadOptions) error) (S3, error) {
+	return NewWithOptions(basectx, bucket, optFns)
+}
+
+// NewWithOptions is the same with New, but the s3 client options like the endpoint can be set,
+// e.g. FaultOptions injects the faults to the requests for the testing
+func NewWithOptions(basectx context.Context, bucket string, optFns []func(*config.LoadOptions) error, clientFns ...func(*s3.Options)) (S3, error) {
+	sdkConfig, err := config.LoadDefaultConfig(basectx, optFns...)
 	if err != nil {
 		return S3{}, err
 	}
 
-	s3Client := s3.NewFromConfig(sdkConfig)
+	s3Client := s3.NewFromConfig(sdkConfig, clientFns...)
 	return NewWithClient(s3Client, bucket), nil
 }
 
@@ -37,49 +49,300 @@ func NewWithClient(s3c *s3.Client, bucket string) S3 {
 	}
 }
 
+// WithPutOptions returns the S3 which applies the options to the uploads
+func (s S3) WithPutOptions(fns ...func(*s3.PutObjectInput)) S3 {
+	s.putOptions = append(s.putOptions[:len(s.putOptions):len(s.putOptions)], fns...)
+	return s
+}
+
+func (s S3) putObjectInput(s3Key, contentType string, metadata map[string]string, body io.Reader) *s3.PutObjectInput {
+	input := &s3.PutObjectInput{
+		Body:        body,
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s3Key),
+		ContentType: aws.String(contentType),
+		Metadata:    metadata,
+	}
+	for _, fn := range s.putOptions {
+		fn(input)
+	}
+	return input
+}
+
 func (s S3) Upload(ctx context.Context, flags CompressFlags, s3Key string, sources ...string) error {
-	reader, writer := io.Pipe()
+	var items = make([]Source, len(sources))
+	for i, src := range sources {
+		items[i] = Source{Path: src}
+	}
+	return s.UploadSources(ctx, flags, s3Key, items...)
+}
+
+func (s S3) UploadSources(ctx context.Context, flags CompressFlags, s3Key string, sources ...Source) error {
+	reader, writer, err := newUploadPipe(flags.Spool)
+	if err != nil {
+		return err
+	}
 
-	errChan := make(chan error)
+	errChan := make(chan error, 1)
 	go func() {
-		errChan <- Compress(ctx, writer, flags, sources...)
+		// the upload is aborted if the archive is not complete, the pipe is closed with the error
+		// instead of the CompressSources closing it, otherwise the partial archive is uploaded
+		err := CompressSources(ctx, nopCloser{writer}, flags, sources...)
+		writer.CloseWithError(err)
+		errChan <- err
 	}()
 
-	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
-		Body:        reader,
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(s3Key),
-		ContentType: aws.String(flags.Archiver.MediaType()),
-		Metadata:    flags.Metadata,
-	}, func(u *s3manager.Uploader) {
-		size := flags.S3PartSize * 1024 * 1024
+	err = s.upload(ctx, s.putObjectInput(s3Key, flags.Archiver.MediaType(), flags.Metadata, reader), flags.S3PartSize, flags.S3Thread)
+	// unblock the compression if the upload fails
+	reader.CloseWithError(err)
+	if compressErr := <-errChan; compressErr != nil {
+		return compressErr
+	}
+	return err
+}
+
+// Put uploads the small object with the put options, e.g. the report of the archive
+func (s S3) Put(ctx context.Context, s3Key, contentType string, body []byte) error {
+	_, err := s.s3Client.PutObject(ctx, s.putObjectInput(s3Key, contentType, nil, bytes.NewReader(body)))
+	return s.wrapError(s3Key, err)
+}
+
+// pipeReader and pipeWriter are the sides of io.Pipe or the spool
+type pipeReader interface {
+	io.Reader
+	CloseWithError(error) error
+}
+
+type pipeWriter interface {
+	io.Writer
+	CloseWithError(error) error
+}
+
+// newUploadPipe returns the pipe between the compression and the upload, it's the spool if the spool is set
+func newUploadPipe(spoolDir string) (pipeReader, pipeWriter, error) {
+	if spoolDir == "" {
+		reader, writer := io.Pipe()
+		return reader, writer, nil
+	}
+	spool, err := newSpool(spoolDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return spoolReader{spool}, spool, nil
+}
+
+// upload uploads the body with the multipart upload, the multipart upload is aborted if it fails,
+// even if the context is canceled, so the uploaded parts are not left behind
+func (s S3) upload(ctx context.Context, input *s3.PutObjectInput, partSize int64, thread int) error {
+	_, err := s.uploader.Upload(ctx, input, func(u *s3manager.Uploader) {
+		size := partSize * 1024 * 1024
 		if size > s3manager.MinUploadPartSize {
 			u.PartSize = size
 		}
-		if flags.S3Thread > 0 {
-			u.Concurrency = flags.S3Thread
+		if thread > 0 {
+			u.Concurrency = thread
 		}
 	})
-	if err != nil {
-		return err
+
+	var failure s3manager.MultiUploadFailure
+	if err != nil && ctx.Err() != nil && errors.As(err, &failure) {
+		// the uploader fails to abort with the canceled context
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+		defer cancel()
+		_, abortErr := s.s3Client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   input.Bucket,
+			Key:      input.Key,
+			UploadId: aws.String(failure.UploadID()),
+		})
+		if abortErr != nil {
+			return errors.Join(s.wrapError(aws.ToString(input.Key), err),
+				fmt.Errorf("abort the multipart upload %s: %w", failure.UploadID(), s.wrapError(aws.ToString(input.Key), abortErr)))
+		}
 	}
-	return <-errChan
+	return s.wrapError(aws.ToString(input.Key), err)
+}
+
+// abortTimeout is the timeout to abort the multipart upload after the context is canceled
+const abortTimeout = 30 * time.Second
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
 }
 
+// Download extracts the object to the destination, the uncompressed object is read from the ResumeOffset
+// of the state file with the ranged read, so the entries extracted by the previous run aren't downloaded again
 func (s S3) Download(ctx context.Context, flags DecompressFlags, s3Key, destination string) (metadata map[string]string, err error) {
-	data, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(s3Key),
-	})
+	}
+	offset, err := ResumeOffset(flags)
 	if err != nil {
 		return nil, err
 	}
+	if offset > 0 {
+		head, err := s.RangeReader(ctx, s3Key, 6)
+		if err != nil {
+			return nil, err
+		}
+		raw := isTar(head)
+		_ = head.Close()
+		if raw {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+			flags.Offset = offset
+		}
+	}
+	data, err := s.s3Client.GetObject(ctx, input)
+	if err != nil {
+		return nil, s.wrapError(s3Key, err)
+	}
 	if err := Decompress(ctx, data.Body, destination, flags); err != nil {
 		return nil, err
 	}
 	return data.Metadata, nil
 }
 
+func (s S3) List(ctx context.Context, flags ListFlags, s3Key string, fn ListFunc) (metadata map[string]string, err error) {
+	data, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return nil, s.wrapError(s3Key, err)
+	}
+	if err := List(ctx, data.Body, flags, fn); err != nil {
+		return nil, err
+	}
+	return data.Metadata, nil
+}
+
+// Reader returns the object and its metadata
+func (s S3) Reader(ctx context.Context, s3Key string) (io.ReadCloser, map[string]string, error) {
+	data, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return nil, nil, s.wrapError(s3Key, err)
+	}
+	return data.Body, data.Metadata, nil
+}
+
+// Writer returns a writer which uploads the data to the s3Key with the multipart upload,
+// the Close waits for the upload to finish
+func (s S3) Writer(ctx context.Context, flags RecompressFlags, s3Key string) io.WriteCloser {
+	return s.writer(ctx, s3Key, flags.To.MediaType(), flags.Metadata, flags.S3PartSize, flags.S3Thread)
+}
+
+func (s S3) writer(ctx context.Context, s3Key, contentType string, metadata map[string]string, partSize int64, thread int) io.WriteCloser {
+	reader, writer := io.Pipe()
+	w := &s3Writer{PipeWriter: writer, done: make(chan struct{})}
+	go func() {
+		err := s.upload(ctx, s.putObjectInput(s3Key, contentType, metadata, reader), partSize, thread)
+		// unblock the writer if the upload fails
+		reader.CloseWithError(err)
+		w.err = err
+		close(w.done)
+	}()
+	return w
+}
+
+type s3Writer struct {
+	*io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+func (w *s3Writer) Close() error {
+	w.PipeWriter.Close()
+	<-w.done
+	return w.err
+}
+
+// CloseWithError aborts the upload
+func (w *s3Writer) CloseWithError(err error) error {
+	w.PipeWriter.CloseWithError(err)
+	<-w.done
+	return nil
+}
+
+// ObjectInfo is the attributes of the s3 object
+type ObjectInfo struct {
+	Size         int64
+	ContentType  string
+	StorageClass string
+	SSE          string
+	SSEKMSKeyID  string
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+// Stat returns the attributes of the object without reading it
+func (s S3) Stat(ctx context.Context, s3Key string) (ObjectInfo, error) {
+	head, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return ObjectInfo{}, s.wrapError(s3Key, err)
+	}
+	info := ObjectInfo{
+		Size:         aws.ToInt64(head.ContentLength),
+		ContentType:  aws.ToString(head.ContentType),
+		StorageClass: string(head.StorageClass),
+		SSE:          string(head.ServerSideEncryption),
+		SSEKMSKeyID:  aws.ToString(head.SSEKMSKeyId),
+		ETag:         aws.ToString(head.ETag),
+		LastModified: aws.ToTime(head.LastModified),
+		Metadata:     head.Metadata,
+	}
+	// the standard storage class isn't returned
+	if info.StorageClass == "" {
+		info.StorageClass = string(types.StorageClassStandard)
+	}
+	return info, nil
+}
+
+// RangeReader returns the first size bytes of the object
+func (s S3) RangeReader(ctx context.Context, s3Key string, size int64) (io.ReadCloser, error) {
+	data, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", size-1)),
+	})
+	if err != nil {
+		return nil, s.wrapError(s3Key, err)
+	}
+	return data.Body, nil
+}
+
+// ReadAt reads len(p) bytes of the object at the offset with the ranged read, it returns io.EOF
+// if the object ends before
+func (s S3) ReadAt(ctx context.Context, s3Key string, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	data, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s3Key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)),
+	})
+	if err != nil {
+		return 0, s.wrapError(s3Key, err)
+	}
+	defer data.Body.Close()
+	n, err := io.ReadFull(data.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
 func (s S3) IsExist(ctx context.Context, s3Key string) (bool, error) {
 	_, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -90,7 +353,7 @@ func (s S3) IsExist(ctx context.Context, s3Key string) (bool, error) {
 		if nfe := (*types.NotFound)(nil); errors.As(err, &nfe) {
 			return false, nil
 		}
-		return false, err
+		return false, s.wrapError(s3Key, err)
 	}
 	return true, nil
 }
@@ -98,3 +361,203 @@ func (s S3) IsExist(ctx context.Context, s3Key string) (bool, error) {
 func IsS3(u *url.URL) bool {
 	return u.Scheme == "s3"
 }
+
+const (
+	// maxCopyObjectSize is the limit of CopyObject, the larger objects are copied by the parts
+	maxCopyObjectSize = 5 << 30
+	// maxCopyParts and maxCopyPartSize are the limits of the parts of the multipart copy,
+	// and minCopyPartSize is the limit of the parts except the last one
+	maxCopyParts    = 10000
+	maxCopyPartSize = 5 << 30
+	minCopyPartSize = 5 << 20
+)
+
+// copyPartSize returns the part size of the multipart copy in bytes, it's partSize in MB, but it's larger
+// if the object needs more than 10000 parts, it's rounded up to MB and it's between 5MB and 5GB
+func copyPartSize(size, partSize int64) int64 {
+	part := max(partSize<<20, (size+maxCopyParts-1)/maxCopyParts, minCopyPartSize)
+	part = (part + 1<<20 - 1) >> 20 << 20
+	return min(part, maxCopyPartSize)
+}
+
+// Copy copies the object of the src to the s3Key on the server side, the data isn't transferred through the client,
+// so the archives can be replicated across the buckets and the regions, the metadata and the tags are kept,
+// and the storage class is kept if it's not set by the put options, the objects larger than 5GB are copied by
+// the parts of partSize in MB
+func (s S3) Copy(ctx context.Context, src S3, srcKey, s3Key string, partSize int64) error {
+	head, err := src.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(src.bucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return src.wrapError(srcKey, err)
+	}
+	copySource := (&url.URL{Path: src.bucket + "/" + srcKey}).EscapedPath()
+	input := s.putObjectInput(s3Key, aws.ToString(head.ContentType), head.Metadata, nil)
+	if input.StorageClass == "" && head.StorageClass != types.StorageClassStandard {
+		input.StorageClass = head.StorageClass
+	}
+
+	size := aws.ToInt64(head.ContentLength)
+	if size <= maxCopyObjectSize {
+		_, err := s.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:               input.Bucket,
+			Key:                  input.Key,
+			CopySource:           aws.String(copySource),
+			MetadataDirective:    types.MetadataDirectiveCopy,
+			TaggingDirective:     types.TaggingDirectiveCopy,
+			StorageClass:         input.StorageClass,
+			ServerSideEncryption: input.ServerSideEncryption,
+			SSEKMSKeyId:          input.SSEKMSKeyId,
+		})
+		return s.wrapError(s3Key, err)
+	}
+
+	tags, err := src.s3Client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(src.bucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return src.wrapError(srcKey, err)
+	}
+	tagging := make(url.Values)
+	for _, tag := range tags.TagSet {
+		tagging.Add(aws.ToString(tag.Key), aws.ToString(tag.Value))
+	}
+	upload, err := s.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ContentType:          input.ContentType,
+		Metadata:             input.Metadata,
+		Tagging:              aws.String(tagging.Encode()),
+		StorageClass:         input.StorageClass,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+	})
+	if err != nil {
+		return s.wrapError(s3Key, err)
+	}
+
+	parts, err := s.copyParts(ctx, copySource, input, upload.UploadId, size, copyPartSize(size, partSize))
+	if err == nil {
+		_, err = s.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          input.Bucket,
+			Key:             input.Key,
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		err = s.wrapError(s3Key, err)
+		// the copied parts are not left behind even if the context is canceled
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+		defer cancel()
+		_, abortErr := s.s3Client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   input.Bucket,
+			Key:      input.Key,
+			UploadId: upload.UploadId,
+		})
+		if abortErr != nil {
+			return errors.Join(err, fmt.Errorf("abort the multipart upload %s: %w", aws.ToString(upload.UploadId), s.wrapError(s3Key, abortErr)))
+		}
+	}
+	return err
+}
+
+func (s S3) copyParts(ctx context.Context, copySource string, input *s3.PutObjectInput, uploadID *string, size, partSize int64) ([]types.CompletedPart, error) {
+	var parts []types.CompletedPart
+	for i, byteRange := range copyRanges(size, partSize) {
+		partNumber := aws.Int32(int32(i + 1))
+		part, err := s.s3Client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          input.Bucket,
+			Key:             input.Key,
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(byteRange),
+			PartNumber:      partNumber,
+			UploadId:        uploadID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: partNumber})
+	}
+	return parts, nil
+}
+
+// copyRanges splits the size to the byte ranges of the parts
+func copyRanges(size, partSize int64) []string {
+	var ranges []string
+	for start := int64(0); start < size; start += partSize {
+		end := min(start+partSize, size) - 1
+		ranges = append(ranges, fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+	return ranges
+}
+
+// S3Error is the error of the s3 request with the object and the ids of the request,
+// which are required by the aws support cases
+type S3Error struct {
+	Bucket string
+	Key    string
+	// Operation is the name of the s3 api, e.g. GetObject
+	Operation string
+	// StatusCode is the http status code, it's 0 if the request isn't responded, e.g. the network errors
+	StatusCode int
+	// RequestID is the x-amz-request-id and HostID is the x-amz-id-2 of the response
+	RequestID string
+	HostID    string
+	Err       error
+}
+
+func (e *S3Error) Error() string {
+	msg := fmt.Sprintf("s3://%s/%s: ", e.Bucket, e.Key)
+	if e.Operation != "" {
+		msg += e.Operation + ": "
+	}
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf("status %d, request id %s, host id %s: ", e.StatusCode, e.RequestID, e.HostID)
+	}
+	return msg + errorCause(e.Err)
+}
+
+func (e *S3Error) Unwrap() error {
+	return e.Err
+}
+
+// errorCause returns the message of the api error without the operation and the response ids,
+// which are already in the S3Error, the wrapped errors are kept, e.g. the upload id of the multipart upload
+func errorCause(err error) string {
+	if _, ok := err.(*smithy.OperationError); ok {
+		if apiErr := smithy.APIError(nil); errors.As(err, &apiErr) {
+			return apiErr.Error()
+		}
+	}
+	return err.Error()
+}
+
+// wrapError wraps the error of the request to the key as S3Error
+func (s S3) wrapError(s3Key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if e := (*S3Error)(nil); errors.As(err, &e) {
+		return err
+	}
+	e := &S3Error{Bucket: s.bucket, Key: s3Key, Err: err}
+	if IsSSOSessionError(err) {
+		e.Err = &SSOSessionError{Profile: ssoProfile(), Err: err}
+	}
+	if opErr := (*smithy.OperationError)(nil); errors.As(err, &opErr) {
+		e.Operation = opErr.Operation()
+	}
+	if resp := (interface{ HTTPStatusCode() int })(nil); errors.As(err, &resp) {
+		e.StatusCode = resp.HTTPStatusCode()
+	}
+	if resp := (interface{ ServiceRequestID() string })(nil); errors.As(err, &resp) {
+		e.RequestID = resp.ServiceRequestID()
+	}
+	if resp := (interface{ ServiceHostID() string })(nil); errors.As(err, &resp) {
+		e.HostID = resp.ServiceHostID()
+	}
+	return e
+}
@@ -1,17 +1,28 @@
 package gotgz
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"sync"
 	"syscall"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 // Use this command to run test locally:
@@ -73,6 +84,110 @@ func TestS3(t *testing.T) {
 		t.Errorf("metadata not equal: %v, %v", metadata, metadata2)
 	}
 
+	if err := client.Copy(basectx, client, fileName, "copy/"+fileName, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, metadata3, err := client.Reader(basectx, "copy/"+fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(metadata, metadata3) {
+		t.Errorf("metadata of the copy not equal: %v, %v", metadata, metadata3)
+	}
+
+	// the second listing is from the cached toc
+	tocDir := t.TempDir()
+	var listed [2][]string
+	for i := range listed {
+		err := client.ListCached(basectx, ListFlags{Archiver: gzip}, fileName, TOCCache{Dir: tocDir}, func(header *tar.Header, _ io.Reader) error {
+			listed[i] = append(listed[i], header.Name)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(listed[0]) == 0 || !reflect.DeepEqual(listed[0], listed[1]) {
+		t.Errorf("cached listing = %v, want %v", listed[1], listed[0])
+	}
+
+	for _, check := range client.CheckAccess(basectx, "backups/") {
+		if check.Err != nil && !check.Optional {
+			t.Errorf("check %s: %v", check.Name, check.Err)
+		}
+	}
+
+	// the appended object keeps the members and the metadata
+	appendKey := "append/" + fileName
+	if err := client.Copy(basectx, client, fileName, appendKey, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AppendSources(basectx, CompressFlags{Archiver: gzip}, appendKey, Source{Path: "testdata"}); err != nil {
+		t.Fatal(err)
+	}
+	var appended []string
+	_, err = client.List(basectx, ListFlags{Archiver: gzip}, appendKey, func(header *tar.Header, _ io.Reader) error {
+		appended = append(appended, header.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appended) != 2*len(listed[0]) {
+		t.Errorf("appended %d entries, want %d", len(appended), 2*len(listed[0]))
+	}
+	if _, metadata4, err := client.Reader(basectx, appendKey); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(metadata, metadata4) {
+		t.Errorf("metadata of the appended object not equal: %v, %v", metadata, metadata4)
+	}
+
+	// the object without the deleted member keeps the metadata
+	deleteKey := "delete/" + fileName
+	if err := client.Copy(basectx, client, fileName, deleteKey, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteMembers(basectx, DeleteFlags{Members: listed[0][len(listed[0])-1:]}, deleteKey); err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	metadata5, err := client.List(basectx, ListFlags{Archiver: gzip}, deleteKey, func(header *tar.Header, _ io.Reader) error {
+		kept = append(kept, header.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kept, listed[0][:len(listed[0])-1]) {
+		t.Errorf("kept = %v, want %v", kept, listed[0][:len(listed[0])-1])
+	}
+	if !reflect.DeepEqual(metadata, metadata5) {
+		t.Errorf("metadata of the deleted object not equal: %v, %v", metadata, metadata5)
+	}
+
+	// the catenated object has the members of both archives
+	catenateKey := "catenate/" + fileName
+	if err := client.Copy(basectx, client, fileName, catenateKey, 0); err != nil {
+		t.Fatal(err)
+	}
+	catenated := CatenateSource{Name: fileName, Open: func() (io.ReadCloser, error) {
+		src, _, err := client.Reader(basectx, fileName)
+		return src, err
+	}}
+	if err := client.Catenate(basectx, CatenateFlags{}, catenateKey, catenated); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if _, err := client.List(basectx, ListFlags{Archiver: gzip}, catenateKey, func(*tar.Header, io.Reader) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2*len(listed[0]) {
+		t.Errorf("catenated %d entries, want %d", count, 2*len(listed[0]))
+	}
+
 	{
 		origin := make(map[string]TestFileInfo)
 		err := filepath.Walk("testdata", func(path string, info os.FileInfo, err error) error {
@@ -187,3 +302,144 @@ func TestS3(t *testing.T) {
 		}
 	}
 }
+
+func TestCopyRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		want []string
+	}{
+		{name: "Empty", size: 0},
+		{name: "One part", size: 10, want: []string{"bytes=0-9"}},
+		{name: "Exact", size: 20, want: []string{"bytes=0-9", "bytes=10-19"}},
+		{name: "Last part", size: 25, want: []string{"bytes=0-9", "bytes=10-19", "bytes=20-24"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := copyRanges(tt.size, 10); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("copyRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyPartSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		partSize int64
+		want     int64
+	}{
+		{name: "Part size", size: 6 << 30, partSize: 10, want: 10 << 20},
+		{name: "Minimum", size: 6 << 30, want: 5 << 20},
+		{name: "Too many parts", size: 1 << 40, partSize: 10, want: 105 << 20},
+		{name: "Rounded up", size: 60000<<20 + 1, partSize: 5, want: 7 << 20},
+		{name: "Maximum", size: 5 << 40, partSize: 10 << 10, want: 5 << 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := copyPartSize(tt.size, tt.partSize)
+			if got != tt.want {
+				t.Errorf("copyPartSize() = %d, want %d", got, tt.want)
+			}
+			if parts := (tt.size + got - 1) / got; parts > maxCopyParts {
+				t.Errorf("copyPartSize() = %d needs %d parts", got, parts)
+			}
+		})
+	}
+}
+
+func TestS3_WrapError(t *testing.T) {
+	apiErr := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+	err := &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "GetObject",
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusForbidden}},
+				Err:      apiErr,
+			},
+			RequestID: "4442587FB7D0A2F9",
+		},
+	}
+
+	client := S3{bucket: "bucket"}
+	wrapped := client.wrapError("a.tgz", err)
+	var s3Err *S3Error
+	if !errors.As(wrapped, &s3Err) {
+		t.Fatalf("wrapError() = %T, want *S3Error", wrapped)
+	}
+	want := S3Error{Bucket: "bucket", Key: "a.tgz", Operation: "GetObject", StatusCode: http.StatusForbidden, RequestID: "4442587FB7D0A2F9", Err: err}
+	if *s3Err != want {
+		t.Errorf("wrapError() = %+v, want %+v", *s3Err, want)
+	}
+	if msg := "s3://bucket/a.tgz: GetObject: status 403, request id 4442587FB7D0A2F9, host id : api error AccessDenied: Access Denied"; s3Err.Error() != msg {
+		t.Errorf("Error() = %q, want %q", s3Err.Error(), msg)
+	}
+	if !errors.Is(wrapped, apiErr) {
+		t.Error("the api error isn't wrapped")
+	}
+
+	// the network errors don't have the response
+	wrapped = client.wrapError("a.tgz", context.DeadlineExceeded)
+	if msg := "s3://bucket/a.tgz: context deadline exceeded"; wrapped.Error() != msg || !errors.Is(wrapped, context.DeadlineExceeded) {
+		t.Errorf("wrapError() = %q, want %q", wrapped, msg)
+	}
+	if client.wrapError("a.tgz", nil) != nil {
+		t.Error("wrapError(nil) != nil")
+	}
+}
+
+func TestS3_UploadAbort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		aborted []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			io.WriteString(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>a.tgz</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && query.Has("partNumber"):
+			io.Copy(io.Discard, r.Body)
+			// the upload is canceled after the first part, e.g. by SIGINT
+			cancel()
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodDelete && query.Has("uploadId"):
+			mu.Lock()
+			aborted = append(aborted, query.Get("uploadId"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewWithOptions(context.Background(), "bucket", []func(*config.LoadOptions) error{
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(aws.AnonymousCredentials{}),
+	}, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(server.URL)
+		o.UsePathStyle = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the body has more than one part, so the multipart upload is used
+	body := bytes.NewReader(make([]byte, 6<<20))
+	err = client.upload(ctx, client.putObjectInput("a.tgz", "application/gzip", nil, body), 0, 1)
+	if err == nil {
+		t.Fatal("the canceled upload doesn't fail")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(aborted) == 0 || aborted[len(aborted)-1] != "upload" {
+		t.Errorf("aborted uploads = %q, want the upload aborted", aborted)
+	}
+}
@@ -0,0 +1,56 @@
+package gotgz
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ScanResult is the decision of the Scanner
+type ScanResult int
+
+const (
+	// ScanInclude archives the file
+	ScanInclude ScanResult = iota
+	// ScanSkip skips the file with a warning
+	ScanSkip
+	// ScanAbort stops the creation with an error
+	ScanAbort
+)
+
+// Scanner decides whether the regular file is archived by its path and content before it leaves the host,
+// e.g. the secret detection and the virus scan, the file is archived from the same descriptor after the scan,
+// so the file which is replaced after the scan isn't archived instead
+type Scanner func(path string, content io.Reader) (ScanResult, error)
+
+// scanFile scans the file with the retries of the transient errors, skip is true if the scanner skips it,
+// otherwise the file is returned at the beginning to archive the scanned content, the caller closes it
+func scanFile(scanner Scanner, retry fsRetry, path string) (file *os.File, skip bool, err error) {
+	err = retry.do("open", path, func() (err error) {
+		file, err = os.Open(path)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if skip || err != nil {
+			_ = file.Close()
+			file = nil
+		}
+	}()
+
+	result, err := scanner(path, retry.reader(path, file))
+	if err != nil {
+		return file, false, fmt.Errorf("scan %s: %w", path, err)
+	}
+	switch result {
+	case ScanInclude:
+		_, err = file.Seek(0, io.SeekStart)
+		return file, false, err
+	case ScanSkip:
+		return file, true, nil
+	default:
+		return file, false, fmt.Errorf("%s is rejected by the scanner", path)
+	}
+}
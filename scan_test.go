@@ -0,0 +1,88 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompress_Scanner(t *testing.T) {
+	source := t.TempDir()
+	for name, content := range map[string]string{"a": "content", "secret": "password=1", "virus": "EICAR"} {
+		if err := os.WriteFile(filepath.Join(source, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := func(abort bool) Scanner {
+		return func(path string, content io.Reader) (ScanResult, error) {
+			data, err := io.ReadAll(content)
+			if err != nil {
+				return ScanAbort, err
+			}
+			switch {
+			case bytes.Contains(data, []byte("password")):
+				return ScanSkip, nil
+			case abort && bytes.Contains(data, []byte("EICAR")):
+				return ScanAbort, nil
+			}
+			return ScanInclude, nil
+		}
+	}
+
+	var buf bytes.Buffer
+	flags := CompressFlags{Archiver: GZipArchiver{Level: 1}, Relative: true, Scanner: scanner(false), Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, flags, source); err != nil {
+		t.Fatal(err)
+	}
+	names, err := listNames(buf.Bytes(), ListFlags{Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"./=", "a=content", "virus=EICAR"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	flags.Scanner = scanner(true)
+	err = Compress(context.Background(), nopWriteCloser{io.Discard}, flags, source)
+	if err == nil || !strings.Contains(err.Error(), "rejected by the scanner") {
+		t.Errorf("Compress() error = %v, want the rejected error", err)
+	}
+}
+
+func TestCompress_ScannerReplaced(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "a"), []byte("scanned"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is replaced after the scan, the scanned content is archived
+	scanner := func(path string, content io.Reader) (ScanResult, error) {
+		if _, err := io.ReadAll(content); err != nil {
+			return ScanAbort, err
+		}
+		replaced := filepath.Join(t.TempDir(), "a")
+		if err := os.WriteFile(replaced, []byte("unscanned"), 0644); err != nil {
+			return ScanAbort, err
+		}
+		return ScanInclude, os.Rename(replaced, path)
+	}
+
+	var buf bytes.Buffer
+	flags := CompressFlags{Archiver: GZipArchiver{Level: 1}, Relative: true, Scanner: scanner, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, flags, source); err != nil {
+		t.Fatal(err)
+	}
+	names, err := listNames(buf.Bytes(), ListFlags{Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"./=", "a=scanned"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,139 @@
+package gotgz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// SpoolMemory is the Spool which buffers the archive in the memory
+const SpoolMemory = "memory"
+
+// spool is the pipe with the unbounded buffer in the memory or the temporary file, the writes never wait for the reads,
+// so the compression isn't stalled by the slow consumer, e.g. the s3 parts which are retried, and the buffer can
+// grow to the whole archive if the consumer stalls
+type spool struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	store io.ReadWriter
+	// pending is the count of the written bytes which are not read
+	pending int64
+	// werr is the error of the writer which is returned after the pending bytes are read
+	werr error
+	// rerr is the error of the reader which is returned to the writes
+	rerr  error
+	close func() error
+}
+
+// newSpool returns the spool of the memory if the dir is SpoolMemory or the temporary file in the dir
+func newSpool(dir string) (*spool, error) {
+	s := &spool{store: new(bytes.Buffer), close: func() error { return nil }}
+	if dir != SpoolMemory {
+		file, err := os.CreateTemp(dir, "gotgz-spool-*")
+		if err != nil {
+			return nil, err
+		}
+		s.store = &fileStore{file: file}
+		s.close = func() error {
+			return errors.Join(file.Close(), os.Remove(file.Name()))
+		}
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s, nil
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rerr != nil {
+		return 0, s.rerr
+	}
+	if s.werr != nil {
+		return 0, io.ErrClosedPipe
+	}
+	n, err := s.store.Write(p)
+	s.pending += int64(n)
+	s.cond.Broadcast()
+	return n, err
+}
+
+func (s *spool) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.pending == 0 && s.werr == nil && s.rerr == nil {
+		s.cond.Wait()
+	}
+	if s.rerr != nil {
+		return 0, io.ErrClosedPipe
+	}
+	if s.pending == 0 {
+		return 0, s.werr
+	}
+	if int64(len(p)) > s.pending {
+		p = p[:s.pending]
+	}
+	n, err := s.store.Read(p)
+	s.pending -= int64(n)
+	return n, err
+}
+
+// CloseWithError closes the writer, the reads return the error after the pending bytes, it's io.EOF if err is nil
+func (s *spool) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.werr == nil {
+		s.werr = err
+	}
+	s.cond.Broadcast()
+	return nil
+}
+
+// CloseRead closes the reader and releases the buffer, the writes return the error, it's io.ErrClosedPipe if err is nil
+func (s *spool) CloseRead(err error) error {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rerr != nil {
+		return nil
+	}
+	s.rerr = err
+	s.cond.Broadcast()
+	return s.close()
+}
+
+// spoolReader is the reader side of the spool like io.PipeReader
+type spoolReader struct {
+	*spool
+}
+
+func (r spoolReader) CloseWithError(err error) error {
+	return r.spool.CloseRead(err)
+}
+
+// fileStore appends to the file and reads it from the start
+type fileStore struct {
+	file       *os.File
+	woff, roff int64
+}
+
+func (f *fileStore) Write(p []byte) (int, error) {
+	n, err := f.file.WriteAt(p, f.woff)
+	f.woff += int64(n)
+	return n, err
+}
+
+func (f *fileStore) Read(p []byte) (int, error) {
+	n, err := f.file.ReadAt(p, f.roff)
+	f.roff += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+package gotgz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	content := bytes.Repeat([]byte("gotgz"), 100<<10)
+	for _, dir := range []string{SpoolMemory, t.TempDir()} {
+		t.Run(dir, func(t *testing.T) {
+			s, err := newSpool(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the writes don't wait for the reads
+			for i := 0; i < len(content); i += 1000 {
+				if _, err := s.Write(content[i:min(i+1000, len(content))]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.CloseWithError(nil); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(spoolReader{s})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("read %d bytes, want %d bytes", len(got), len(content))
+			}
+
+			if err := (spoolReader{s}).CloseWithError(nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Write([]byte("data")); !errors.Is(err, io.ErrClosedPipe) {
+				t.Errorf("write after the reader is closed error = %v, want %v", err, io.ErrClosedPipe)
+			}
+			if dir != SpoolMemory {
+				if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+					t.Errorf("the spool file isn't removed: %v", entries)
+				}
+			}
+		})
+	}
+}
+
+func TestSpool_Error(t *testing.T) {
+	s, err := newSpool(SpoolMemory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan []byte)
+	go func() {
+		// the read waits for the writes
+		data, _ := io.ReadAll(io.LimitReader(s, 4))
+		done <- data
+	}()
+	if _, err := s.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-done; string(data) != "data" {
+		t.Errorf("read %q, want %q", data, "data")
+	}
+
+	// the error of the writer is returned after the pending bytes
+	if _, err := s.Write([]byte("rest")); err != nil {
+		t.Fatal(err)
+	}
+	abort := errors.New("abort")
+	if err := s.CloseWithError(abort); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(s)
+	if string(got) != "rest" || !errors.Is(err, abort) {
+		t.Errorf("ReadAll() = %q, %v, want %q, %v", got, err, "rest", abort)
+	}
+}
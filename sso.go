@@ -0,0 +1,245 @@
+package gotgz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ssooidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+)
+
+// SSOSessionError is the error of the expired or invalid AWS SSO (IAM Identity Center) session,
+// the raw error chain of the sdk is replaced by the hint to sign in again
+type SSOSessionError struct {
+	// Profile is the aws profile, it's empty for the default profile
+	Profile string
+	Err     error
+}
+
+func (e *SSOSessionError) Error() string {
+	login := "aws sso login"
+	if e.Profile != "" {
+		login += " --profile " + e.Profile
+	}
+	return fmt.Sprintf("the AWS SSO session has expired or is invalid, sign in again with `%s`", login)
+}
+
+func (e *SSOSessionError) Unwrap() error {
+	return e.Err
+}
+
+// IsSSOSessionError reports whether the error is caused by the expired or invalid AWS SSO session
+func IsSSOSessionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var (
+		invalidToken *ssocreds.InvalidTokenError
+		unauthorized *ssotypes.UnauthorizedException
+		invalidGrant *ssooidctypes.InvalidGrantException
+		expiredToken *ssooidctypes.ExpiredTokenException
+	)
+	if errors.As(err, &invalidToken) || errors.As(err, &unauthorized) || errors.As(err, &invalidGrant) || errors.As(err, &expiredToken) {
+		return true
+	}
+	// the token provider of the sso-session returns the untyped errors for the missing or unrefreshable token
+	return strings.Contains(err.Error(), "SSO token")
+}
+
+// ssoProfile returns the aws profile of the shared config like the sdk, it's empty for the default profile
+func ssoProfile() string {
+	return os.Getenv("AWS_PROFILE")
+}
+
+// ssoToken is the cached token of the AWS CLI in ~/.aws/sso/cache, the client registration is only kept
+// for the sso-session, so the sdk can refresh the token
+type ssoToken struct {
+	StartURL              string `json:"startUrl"`
+	Region                string `json:"region"`
+	AccessToken           string `json:"accessToken"`
+	ExpiresAt             string `json:"expiresAt"`
+	ClientID              string `json:"clientId,omitempty"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt string `json:"registrationExpiresAt,omitempty"`
+	RefreshToken          string `json:"refreshToken,omitempty"`
+}
+
+// SSOLogin signs in the AWS SSO session of the profile with the device authorization like `aws sso login`,
+// the url and the code to confirm are written to the prompt, and the token is cached where the sdk
+// and the AWS CLI read it
+func SSOLogin(ctx context.Context, profile string, prompt io.Writer) error {
+	name := profile
+	if name == "" {
+		name = "default"
+	}
+	shared, err := config.LoadSharedConfigProfile(ctx, name, func(o *config.LoadSharedConfigOptions) {
+		// the sdk only reads it in LoadDefaultConfig
+		if file := os.Getenv("AWS_CONFIG_FILE"); file != "" {
+			o.ConfigFiles = []string{file}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// the sso-session is keyed by its name and the legacy profile is keyed by the start url
+	key, region, startURL := shared.SSOStartURL, shared.SSORegion, shared.SSOStartURL
+	if shared.SSOSession != nil {
+		key, region, startURL = shared.SSOSession.Name, shared.SSOSession.SSORegion, shared.SSOSession.SSOStartURL
+	}
+	if startURL == "" || region == "" {
+		return fmt.Errorf("profile %s isn't configured for AWS SSO", name)
+	}
+	cachePath, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		return err
+	}
+
+	client := ssooidc.New(ssooidc.Options{Region: region})
+	register := &ssooidc.RegisterClientInput{ClientName: aws.String("gotgz"), ClientType: aws.String("public")}
+	if shared.SSOSession != nil {
+		register.GrantTypes = []string{deviceCodeGrantType, "refresh_token"}
+		register.Scopes = []string{"sso:account:access"}
+	}
+	registered, err := client.RegisterClient(ctx, register)
+	if err != nil {
+		return fmt.Errorf("register the sso client: %w", err)
+	}
+	device, err := client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     registered.ClientId,
+		ClientSecret: registered.ClientSecret,
+		StartUrl:     aws.String(startURL),
+	})
+	if err != nil {
+		return fmt.Errorf("start the sso device authorization: %w", err)
+	}
+
+	fmt.Fprintf(prompt, "Open %s in the browser and confirm the code %s to sign in the AWS SSO session\n",
+		aws.ToString(device.VerificationUriComplete), aws.ToString(device.UserCode))
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		created, err := client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     registered.ClientId,
+			ClientSecret: registered.ClientSecret,
+			DeviceCode:   device.DeviceCode,
+			GrantType:    aws.String(deviceCodeGrantType),
+		})
+		var pending *ssooidctypes.AuthorizationPendingException
+		var slowDown *ssooidctypes.SlowDownException
+		switch {
+		case errors.As(err, &pending):
+			if time.Now().After(deadline) {
+				return errors.New("the sso device authorization has expired before it's confirmed")
+			}
+			continue
+		case errors.As(err, &slowDown):
+			interval += 5 * time.Second
+			continue
+		case err != nil:
+			return fmt.Errorf("create the sso token: %w", err)
+		}
+
+		token := ssoToken{
+			StartURL:    startURL,
+			Region:      region,
+			AccessToken: aws.ToString(created.AccessToken),
+			ExpiresAt:   time.Now().Add(time.Duration(created.ExpiresIn) * time.Second).UTC().Format(time.RFC3339),
+		}
+		if shared.SSOSession != nil {
+			token.ClientID, token.ClientSecret = aws.ToString(registered.ClientId), aws.ToString(registered.ClientSecret)
+			token.RegistrationExpiresAt = time.Unix(registered.ClientSecretExpiresAt, 0).UTC().Format(time.RFC3339)
+			token.RefreshToken = aws.ToString(created.RefreshToken)
+		}
+		return writeSSOToken(cachePath, token)
+	}
+}
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// writeSSOToken writes the token which is only readable by the user, it's renamed from the temporary file
+func writeSSOToken(path string, token ssoToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".token-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// ssoLoginProvider signs in the AWS SSO session once the credentials fail with the expired session,
+// and retrieves them again
+type ssoLoginProvider struct {
+	aws.CredentialsProvider
+	profile string
+	prompt  io.Writer
+
+	mu     sync.Mutex
+	signed bool
+}
+
+func (p *ssoLoginProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.CredentialsProvider.Retrieve(ctx)
+	if !IsSSOSessionError(err) {
+		return creds, err
+	}
+
+	// the concurrent requests sign in once
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.signed {
+		if err := SSOLogin(ctx, p.profile, p.prompt); err != nil {
+			return aws.Credentials{}, fmt.Errorf("sign in the AWS SSO session: %w", err)
+		}
+		p.signed = true
+	}
+	return p.CredentialsProvider.Retrieve(ctx)
+}
+
+// WithSSOLogin signs in the AWS SSO session of the AWS_PROFILE with the device authorization like `aws sso login`
+// if it has expired, instead of failing the requests, the url and the code to confirm are written to the prompt
+func WithSSOLogin(prompt io.Writer) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if o.Credentials != nil {
+			o.Credentials = &ssoLoginProvider{CredentialsProvider: o.Credentials, profile: ssoProfile(), prompt: prompt}
+		}
+	}
+}
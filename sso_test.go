@@ -0,0 +1,62 @@
+package gotgz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+)
+
+func TestIsSSOSessionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{name: "other", err: errors.New("access denied")},
+		{name: "invalid token", err: fmt.Errorf("get credentials: %w", &ssocreds.InvalidTokenError{}), want: true},
+		{name: "unauthorized", err: fmt.Errorf("get credentials: %w", &ssotypes.UnauthorizedException{}), want: true},
+		{name: "sso session", err: errors.New("refresh cached SSO token failed, unable to refresh SSO token"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSSOSessionError(tt.err); got != tt.want {
+				t.Errorf("IsSSOSessionError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3_wrapError_SSOSession(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "dev")
+	err := S3{bucket: "bucket"}.wrapError("key", &ssocreds.InvalidTokenError{})
+
+	var sessionErr *SSOSessionError
+	if !errors.As(err, &sessionErr) {
+		t.Fatalf("error %v isn't SSOSessionError", err)
+	}
+	if want := "sign in again with `aws sso login --profile dev`"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestSSOLogin_NotConfigured(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configFile, []byte("[profile static]\nregion = us-east-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+
+	err := SSOLogin(context.Background(), "static", io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "isn't configured for AWS SSO") {
+		t.Errorf("SSOLogin() error = %v", err)
+	}
+}
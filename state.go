@@ -0,0 +1,239 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// extractState records the extracted entries to the state file, one `offset\t"name"\tend\ttype\t"dest"` per line,
+// so the interrupted extraction can skip them on the next run. The end is the offset of the next header in the tar stream,
+// the uncompressed archive is read from the end of the last extracted entry by ResumeOffset, and the compressed archive
+// can't be seeked, so it's still read from the beginning.
+type extractState struct {
+	file *os.File
+	// done are the entries extracted by the previous run
+	done  []doneEntry
+	index int
+	// base is the offset of the tar stream where the archive is read from
+	base int64
+	// pending is the entry in progress, it's recorded once the next entry is read
+	pending doneEntry
+	offset  int64
+	synced  int
+}
+
+// doneEntry is the entry extracted by the previous run, end is -1 if it's unknown
+type doneEntry struct {
+	name     string
+	end      int64
+	typeflag byte
+	dest     string
+}
+
+// openExtractState loads the state file, it returns nil if the path is empty
+func openExtractState(path string) (*extractState, error) {
+	if path == "" {
+		return nil, nil
+	}
+	done, err := readExtractState(path)
+	if err != nil {
+		return nil, err
+	}
+	state := extractState{done: done}
+	state.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// readExtractState reads the entries in the state file, the lines of the older versions only have the offset and the name
+func readExtractState(path string) ([]doneEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var done []doneEntry
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		invalid := fmt.Errorf("invalid state file %s: %q", path, scanner.Text())
+		if len(fields) != 2 && len(fields) != 5 {
+			return nil, invalid
+		}
+		entry := doneEntry{end: -1}
+		if _, err := strconv.ParseInt(fields[0], 10, 64); err != nil {
+			return nil, invalid
+		}
+		if entry.name, err = strconv.Unquote(fields[1]); err != nil {
+			return nil, invalid
+		}
+		if len(fields) == 5 {
+			typeflag, err := strconv.ParseUint(fields[3], 10, 8)
+			if err != nil {
+				return nil, invalid
+			}
+			entry.typeflag = byte(typeflag)
+			if entry.end, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+				return nil, invalid
+			}
+			if entry.dest, err = strconv.Unquote(fields[4]); err != nil {
+				return nil, invalid
+			}
+		}
+		done = append(done, entry)
+	}
+	return done, nil
+}
+
+// ResumeOffset returns the offset of the uncompressed tar archive to resume the extraction of the StateFile from,
+// i.e. the end of the last extracted entry, so the extracted entries aren't read again, e.g. with the ranged read
+// of the s3 object. It's 0 if the archive must be read from the beginning, e.g. the symbolic links and the times of
+// the directories are restored after all of the entries, and the members and the label need the whole archive.
+// Set it to DecompressFlags.Offset with the archive which starts at it.
+func ResumeOffset(flags DecompressFlags) (int64, error) {
+	if flags.StateFile == "" || flags.DryRun || len(flags.Members) > 0 || flags.Label != "" ||
+		flags.GlobalHeaders == GlobalHeadersHonor || flags.Occurrence > 0 {
+		return 0, nil
+	}
+	done, err := readExtractState(flags.StateFile)
+	if err != nil || len(done) == 0 {
+		return 0, err
+	}
+	for _, entry := range done {
+		switch {
+		case entry.end < 0, entry.typeflag == tar.TypeSymlink, entry.typeflag == tar.TypeDir && !flags.NoSameTime:
+			return 0, nil
+		}
+	}
+	return done[len(done)-1].end, nil
+}
+
+// SeekResume seeks the uncompressed archive to the ResumeOffset of the StateFile and returns the flags with the Offset,
+// the compressed archives and the streams which can't be seeked, e.g. the pipes, are read from the beginning
+func SeekResume(src io.ReadSeeker, flags DecompressFlags) (DecompressFlags, error) {
+	offset, err := ResumeOffset(flags)
+	if err != nil || offset == 0 {
+		return flags, err
+	}
+	start, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return flags, nil
+	}
+	target := start
+	if isTar(src) {
+		target += offset
+		flags.Offset = offset
+	}
+	if _, err := src.Seek(target, io.SeekStart); err != nil {
+		return flags, err
+	}
+	return flags, nil
+}
+
+// isTar reports whether the archive isn't compressed, the offsets in the state file are of the tar stream,
+// so only the uncompressed archive can be read from them
+func isTar(r io.Reader) bool {
+	archiver, err := DetectArchiver(bufio.NewReaderSize(r, 16))
+	return err == nil && archiver == nil
+}
+
+// Resumed returns the number of the entries extracted by the previous run
+func (s *extractState) Resumed() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.done)
+}
+
+// SkipDone skips all of the entries of the previous run since the archive is read from the offset,
+// it returns the destinations of the regular files, so the hardlinks to them can be created
+func (s *extractState) SkipDone(offset int64) (map[string]string, error) {
+	if len(s.done) == 0 || s.done[len(s.done)-1].end != offset {
+		return nil, fmt.Errorf("the offset %d isn't where the extraction of the state file is resumed from", offset)
+	}
+	files := make(map[string]string)
+	for _, entry := range s.done {
+		if (entry.typeflag == tar.TypeReg || entry.typeflag == tar.TypeLink) && entry.dest != "" {
+			files[entry.name] = entry.dest
+		}
+	}
+	s.index, s.base = len(s.done), offset
+	return files, nil
+}
+
+// End sets the end of the entry in progress, it's the offset of the next header
+func (s *extractState) End(end int64) {
+	if s != nil && s.pending.name != "" {
+		s.pending.end = s.base + end
+	}
+}
+
+// Target sets the type and the destination of the entry in progress
+func (s *extractState) Target(typeflag byte, dest string) {
+	if s != nil {
+		s.pending.typeflag, s.pending.dest = typeflag, dest
+	}
+}
+
+// Begin records the previous entry as done and returns true if the entry is extracted by the previous run,
+// the state is reset if the archive doesn't match it
+func (s *extractState) Begin(name string, offset int64, logger Logger) (skip bool, err error) {
+	if s == nil {
+		return false, nil
+	}
+	if err := s.flush(); err != nil {
+		return false, err
+	}
+
+	if s.index < len(s.done) {
+		if s.done[s.index].name == name {
+			s.index++
+			return true, nil
+		}
+		logger.Warn("the state file doesn't match the archive, start over", "entry", name, "want", s.done[s.index].name)
+		if err := s.file.Truncate(0); err != nil {
+			return false, err
+		}
+		s.done, s.index = nil, 0
+	}
+	s.pending, s.offset = doneEntry{name: name, end: -1}, s.base+offset
+	return false, nil
+}
+
+func (s *extractState) flush() error {
+	if s.pending.name == "" {
+		return nil
+	}
+	pending := s.pending
+	if _, err := fmt.Fprintf(s.file, "%d\t%q\t%d\t%d\t%q\n", s.offset, pending.name, pending.end, pending.typeflag, pending.dest); err != nil {
+		return err
+	}
+	s.pending = doneEntry{}
+	// the state is synced periodically since it's approximate anyway
+	if s.synced++; s.synced%100 == 0 {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// Close saves the state, or removes the state file if the extraction is complete
+func (s *extractState) Close(complete bool) error {
+	if s == nil {
+		return nil
+	}
+	if !complete {
+		return s.file.Close()
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(s.file.Name())
+}
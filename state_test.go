@@ -0,0 +1,163 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecompress_StateFile(t *testing.T) {
+	archive := gzipBytes(t, newTestTar(t, tarFile{"a", "1"}, tarFile{"b", "2"}, tarFile{"c", "3"}))
+
+	dir := t.TempDir()
+	stateFile := filepath.Join(t.TempDir(), "state")
+	// the previous run extracted a and b
+	if err := os.WriteFile(stateFile, []byte("512\t\"a\"\n1536\t\"b\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := DecompressFlags{Archiver: GZipArchiver{}, NoSameOwner: true, NoSameTime: true, StateFile: stateFile}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(archive)), dir, flags); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"a": false, "b": false, "c": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("%s is extracted %v, want %v", name, err == nil, want)
+		}
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("the state file should be removed, got %v", err)
+	}
+}
+
+func TestExtractState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state")
+	state, err := openExtractState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a", "b\nc", "d"} {
+		if skip, err := state.Begin(name, int64(i*512), discardLogger); err != nil || skip {
+			t.Fatalf("Begin() = %v, %v", skip, err)
+		}
+	}
+	// d is in progress
+	if err := state.Close(false); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = openExtractState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close(false)
+	if got := state.Resumed(); got != 2 {
+		t.Fatalf("Resumed() = %d, want 2", got)
+	}
+	for _, name := range []string{"a", "b\nc"} {
+		if skip, err := state.Begin(name, 0, discardLogger); err != nil || !skip {
+			t.Errorf("%q should be skipped, got %v, %v", name, skip, err)
+		}
+	}
+	if skip, _ := state.Begin("d", 0, discardLogger); skip {
+		t.Error("d should not be skipped")
+	}
+}
+
+func TestDecompress_ResumeOffset(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		{Name: "b", Typeflag: tar.TypeReg, Mode: 0644, Size: 600},
+		{Name: "l", Typeflag: tar.TypeLink, Linkname: "a"},
+		{Name: "c", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(bytes.Repeat([]byte("x"), int(header.Size))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	dir := t.TempDir()
+	stateFile := filepath.Join(t.TempDir(), "state")
+	flags := DecompressFlags{Archiver: AutoArchiver{Archiver: GZipArchiver{}}, NoSameOwner: true, NoSameTime: true, StateFile: stateFile}
+
+	// the first run is interrupted in the data of b
+	interrupted := io.MultiReader(bytes.NewReader(archive[:3*blockSize]), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if err := Decompress(context.Background(), io.NopCloser(interrupted), dir, flags); err == nil {
+		t.Fatal("the interrupted extraction should fail")
+	}
+	if offset, err := ResumeOffset(flags); err != nil || offset != 2*blockSize {
+		t.Fatalf("ResumeOffset() = %d, %v, want %d", offset, err, 2*blockSize)
+	}
+
+	src := bytes.NewReader(archive)
+	resumed, err := SeekResume(src, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Offset != 2*blockSize {
+		t.Fatalf("SeekResume() offset = %d, want %d", resumed.Offset, 2*blockSize)
+	}
+	if err := Decompress(context.Background(), io.NopCloser(src), dir, resumed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "l", "c"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	// the hardlink target is extracted by the first run
+	a, _ := os.Stat(filepath.Join(dir, "a"))
+	l, _ := os.Stat(filepath.Join(dir, "l"))
+	if !os.SameFile(a, l) {
+		t.Error("l should be the hardlink of a")
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("the state file should be removed, got %v", err)
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		flags DecompressFlags
+		want  int64
+	}{
+		{name: "no state"},
+		{name: "old format", state: "512\t\"a\"\n", want: 0},
+		{name: "entries", state: "512\t\"a\"\t1024\t48\t\"/d/a\"\n1536\t\"b\"\t2048\t48\t\"/d/b\"\n", want: 2048},
+		{name: "symlink", state: "512\t\"a\"\t1024\t50\t\"/d/a\"\n", want: 0},
+		{name: "directory", state: "512\t\"a\"\t1024\t53\t\"/d/a\"\n", want: 0},
+		{name: "directory without times", state: "512\t\"a\"\t1024\t53\t\"/d/a\"\n", flags: DecompressFlags{NoSameTime: true}, want: 1024},
+		{name: "members", state: "512\t\"a\"\t1024\t48\t\"/d/a\"\n", flags: DecompressFlags{Members: []string{"a"}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.flags.StateFile = filepath.Join(t.TempDir(), "state")
+			if tt.state != "" {
+				if err := os.WriteFile(tt.flags.StateFile, []byte(tt.state), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got, err := ResumeOffset(tt.flags); err != nil || got != tt.want {
+				t.Errorf("ResumeOffset() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
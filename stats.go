@@ -0,0 +1,109 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"io"
+)
+
+// Stats counts the entries and the bytes of the compression and the extraction,
+// so the embedders and the summary don't have to derive them from the logs
+type Stats struct {
+	Files     int
+	Dirs      int
+	Symlinks  int
+	Hardlinks int
+	// BytesIn is the bytes read, the file contents on create and the archive on extract
+	BytesIn int64
+	// BytesOut is the bytes written, the archive on create and the file contents on extract
+	BytesOut int64
+	// MetadataFailures are the failures to restore the owners, the modes and the times on extract
+	// with DecompressFlags.WarnMetadata, they are also in Warnings
+	MetadataFailures int
+	// Warnings are the messages of the logged warnings
+	Warnings []string
+	// Estimates are the sizes of the sources in the dry run of the compression
+	Estimates []SizeEstimate
+}
+
+// add counts the entry, it does nothing if the stats is nil
+func (s *Stats) add(typeflag byte) {
+	if s == nil {
+		return
+	}
+	switch typeflag {
+	case tar.TypeReg:
+		s.Files++
+	case tar.TypeDir:
+		s.Dirs++
+	case tar.TypeSymlink:
+		s.Symlinks++
+	case tar.TypeLink:
+		s.Hardlinks++
+	}
+}
+
+// addMetadataFailure counts the failure to restore the metadata
+func (s *Stats) addMetadataFailure() {
+	if s != nil {
+		s.MetadataFailures++
+	}
+}
+
+func (s *Stats) addIn(n int64) {
+	if s != nil {
+		s.BytesIn += n
+	}
+}
+
+func (s *Stats) addOut(n int64) {
+	if s != nil {
+		s.BytesOut += n
+	}
+}
+
+// logger returns the logger which records the warnings
+func (s *Stats) logger(logger Logger) Logger {
+	if s == nil {
+		return logger
+	}
+	return statsLogger{Logger: logger, stats: s}
+}
+
+type statsLogger struct {
+	Logger
+	stats *Stats
+}
+
+func (l statsLogger) Warn(msg string, args ...any) {
+	l.stats.Warnings = append(l.stats.Warnings, msg)
+	l.Logger.Warn(msg, args...)
+}
+
+// countWriter counts the bytes written to the archive
+type countWriter struct {
+	io.WriteCloser
+	stats *Stats
+}
+
+func (c countWriter) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.stats.addOut(int64(n))
+	return n, err
+}
+
+func (c countWriter) CloseWithError(err error) error {
+	closeWithError(c.WriteCloser, err)
+	return nil
+}
+
+// countReader counts the bytes read from the archive
+type countReader struct {
+	io.ReadCloser
+	stats *Stats
+}
+
+func (c countReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.stats.addIn(int64(n))
+	return n, err
+}
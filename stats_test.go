@@ -0,0 +1,58 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "dir/b"} {
+		if err := os.WriteFile(filepath.Join(source, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a", filepath.Join(source, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var created Stats
+	archiver := GZipArchiver{Level: 1}
+	ctFlags := CompressFlags{Archiver: archiver, Relative: true, Dedup: true, Stats: &created, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, ctFlags, source); err != nil {
+		t.Fatal(err)
+	}
+	// the second file is a hardlink to the first one
+	want := Stats{Files: 1, Dirs: 2, Symlinks: 1, Hardlinks: 1, BytesIn: 7, BytesOut: int64(buf.Len())}
+	if !reflect.DeepEqual(created, want) {
+		t.Errorf("create stats = %+v, want %+v", created, want)
+	}
+
+	var extracted Stats
+	deFlags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Stats: &extracted, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), t.TempDir(), deFlags); err != nil {
+		t.Fatal(err)
+	}
+	want = Stats{Files: 1, Dirs: 2, Symlinks: 1, Hardlinks: 1, BytesIn: int64(buf.Len()), BytesOut: 7}
+	if !reflect.DeepEqual(extracted, want) {
+		t.Errorf("extract stats = %+v, want %+v", extracted, want)
+	}
+
+	var warned Stats
+	ctFlags = CompressFlags{Archiver: archiver, AbsoluteNames: true, DryRun: true, Stats: &warned, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{io.Discard}, ctFlags, source); err != nil {
+		t.Fatal(err)
+	}
+	if len(warned.Warnings) != 1 {
+		t.Errorf("Warnings = %v, want the absolute names warning", warned.Warnings)
+	}
+}
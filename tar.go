@@ -3,15 +3,17 @@ package gotgz
 import (
 	"archive/tar"
 	"context"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/bmatcuk/doublestar/v4"
+	"time"
 )
 
 type CompressFlags struct {
@@ -23,13 +25,141 @@ type CompressFlags struct {
 	S3PartSize int64
 	S3Thread   int
 	Metadata   map[string]string
+	// AbsoluteNames keeps the leading slash and `..` in the names like `-P` flag in tar command
+	AbsoluteNames bool
+	// Checksum is updated with the compressed archive while it's written,
+	// so the digest is available without reading the archive again
+	Checksum hash.Hash
+	// Normalize is the unicode normalization form of the names, it can be nfc or nfd
+	Normalize string
+	// GlobalHeader is written as the pax global header at the start of the archive if it's not empty,
+	// GlobalHeaderName is its name, it's GlobalHeaderName if it's empty, see ExpandHeaderName for the templates
+	GlobalHeader     map[string]string
+	GlobalHeaderName string
+	// PAXRecords are added to the pax records of every member, e.g. the build ids and the provenance,
+	// the records of the header fields like path and mtime can't be set
+	PAXRecords map[string]string
+	// Manifest appends the ManifestName member which summarizes the members with the checksums
+	Manifest bool
+	// ManifestChecksum is the checksum algorithm of the manifest, it's DefaultManifestChecksum if it's empty,
+	// see NewChecksum for the algorithms
+	ManifestChecksum string
+	// Stats is filled with the counters of the entries and the bytes if it's not nil
+	Stats *Stats
+	// Dedup archives the files with the same content, mode and owner as the hardlinks to the first one,
+	// the modification times of the copies are not kept
+	Dedup bool
+	// NumericOwner stores the uid and gid without the user and group names,
+	// so the archive is reproducible across the hosts with different passwd databases
+	NumericOwner bool
+	// Uid and Gid override the owner of the entries if they are not nil, the user and group names are
+	// the names of the ids on this host, they are empty if the ids are unknown
+	Uid, Gid *int
+	// Retries is the max retries of the transient errors to walk and read the files, e.g. EIO, ESTALE and EAGAIN
+	// of the network mounts, the delay is doubled after every retry
+	Retries int
+	// Spool buffers the archive between the compression and the s3 upload, so the compression isn't stalled
+	// by the slow or retried parts, it's the directory of the temporary file or SpoolMemory, both of them are
+	// unbounded and hold the archive which isn't uploaded yet
+	Spool string
+	// ScanLimit is the max entries to scan per second, it's unlimited if it's not positive,
+	// so the backups on the busy hosts don't degrade the foreground I/O
+	ScanLimit float64
+	// Scanner vetoes the regular files by their content before they are archived if it's not nil,
+	// it's also called in the dry run
+	Scanner Scanner
+	// SourcesFrom calls fn with more sources after the sources if it's not nil, e.g. the names read from a list
+	// while they are archived, so the long lists aren't kept in the memory
+	SourcesFrom func(fn func(Source) error) error
+	// Nested are the members of the other archives which are appended after the sources
+	Nested []NestedSource
+	// Entries are appended after the sources and the nested archives, their contents are read from the readers
+	Entries []Entry
+	// Label is written as the GNU volume header at the start of the archive if it's not empty like `tar -V`
+	Label string
+	// FollowArgs archives the targets of the symbolic links in the sources with the names of the links
+	// like `-H` flag in tar command, the symbolic links under the sources are archived as the links
+	FollowArgs bool
+	// Existing is the decompressed tar stream of the archive to append to like `tar -r`, see OpenAppend,
+	// its members are copied as is before the sources and its end of archive is dropped
+	Existing io.Reader
+	// Update only appends the files which are newer than their last copies in Existing like `tar -u`,
+	// the files which aren't in it are always appended
+	Update bool
+	// Transform is the sed replace expressions which rename the members, see ParseTransform, the directories keep
+	// the trailing slash and the members whose names are empty after it are skipped, the link targets aren't changed
+	Transform []string
+	// Paths is filled with the file of every member archived from the sources if it's not nil, the key is the member name,
+	// e.g. verify the archive with FilesystemDiff after it's written
+	Paths map[string]string
+}
+
+type checksumWriter struct {
+	io.WriteCloser
+	hash hash.Hash
+}
+
+func (c checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.hash.Write(p[:n])
+	return n, err
+}
+
+func (c checksumWriter) CloseWithError(err error) error {
+	closeWithError(c.WriteCloser, err)
+	return nil
+}
+
+// Source is a path to archive, the name in the archive is relative to the Dir if it's not empty,
+// it's the same with `-C` flag in tar command
+type Source struct {
+	Dir  string
+	Path string
+}
+
+// Root returns the path to walk
+func (s Source) Root() string {
+	if s.Dir == "" || filepath.IsAbs(s.Path) {
+		return filepath.Clean(s.Path)
+	}
+	return filepath.Join(s.Dir, s.Path)
 }
 
 func Compress(ctx context.Context, dest io.WriteCloser, flags CompressFlags, sources ...string) (err error) {
+	var items = make([]Source, len(sources))
+	for i, src := range sources {
+		items[i] = Source{Path: src}
+	}
+	return CompressSources(ctx, dest, flags, items...)
+}
+
+func CompressSources(ctx context.Context, dest io.WriteCloser, flags CompressFlags, sources ...Source) (err error) {
 	if flags.Archiver == nil {
 		return fmt.Errorf("archiver is nil")
 	}
 
+	normalize, err := Normalizer(flags.Normalize)
+	if err != nil {
+		return err
+	}
+	transform, err := ParseTransform(flags.Transform)
+	if err != nil {
+		return err
+	}
+	if flags.Existing != nil && flags.Manifest {
+		return fmt.Errorf("the manifest can't be appended to the existing archive")
+	}
+	if err := checkPAXRecords(flags.PAXRecords); err != nil {
+		return err
+	}
+
+	if flags.Stats != nil {
+		dest = countWriter{WriteCloser: dest, stats: flags.Stats}
+	}
+	if flags.Checksum != nil {
+		dest = checksumWriter{WriteCloser: dest, hash: flags.Checksum}
+	}
+
 	zr, err := flags.Archiver.Writer(dest)
 	if err != nil {
 		return err
@@ -39,21 +169,88 @@ func Compress(ctx context.Context, dest io.WriteCloser, flags CompressFlags, sou
 	if logger == nil {
 		logger = slog.Default()
 	}
+	logger = flags.Stats.logger(logger)
+	retry := fsRetry{ctx: ctx, retries: flags.Retries, logger: logger}
 
 	tw := tar.NewWriter(zr)
 	defer func() {
 		if err != nil {
 			zr.Close()
 			tw.Close()
-			dest.Close()
+			closeWithError(dest, err)
 		}
 	}()
 
-	logger.Debug("flags", "dry-run", flags.DryRun, "relative", flags.Relative,
+	if flags.AbsoluteNames {
+		logger.Warn("the leading slash and `..` are kept in the names, the archive can be extracted outside of the directory")
+	}
+
+	logger.Debug("flags", "dry-run", flags.DryRun, "relative", flags.Relative, "absolute-names", flags.AbsoluteNames,
 		"exclude", flags.Exclude, "archiver", flags.Archiver.Name(),
 		"s3-part-size", flags.S3PartSize, "s3-thread", flags.S3Thread)
 
-	var iterater = func(rootPath string) filepath.WalkFunc {
+	// archived is the modification time of the last copy of every existing member for the update
+	var archived map[string]time.Time
+	if flags.Existing != nil {
+		var fn func(*tar.Header) bool
+		if flags.Update {
+			archived = make(map[string]time.Time)
+			fn = func(header *tar.Header) bool {
+				archived[header.Name] = header.ModTime
+				return true
+			}
+		}
+		// the existing members are kept in the dry run too, the label and the global header
+		// are only at the start of the archive
+		n, err := copyMembers(ctx, zr, flags.Existing, fn)
+		if err != nil {
+			return err
+		}
+		logger.Debug("copied the existing members", "count", n)
+	}
+	if flags.Label != "" && !flags.DryRun && flags.Existing == nil {
+		if err := writeVolumeLabel(tw, flags.Label); err != nil {
+			return err
+		}
+	}
+	globalHeader := flags.GlobalHeader
+	if flags.Manifest && flags.ManifestChecksum != "" && flags.ManifestChecksum != DefaultManifestChecksum {
+		// the verifier hashes the members with the algorithm before the manifest at the end is read
+		globalHeader = maps.Clone(globalHeader)
+		if globalHeader == nil {
+			globalHeader = make(map[string]string, 1)
+		}
+		globalHeader[PAXManifestChecksum] = flags.ManifestChecksum
+	}
+	if len(globalHeader) > 0 && !flags.DryRun && flags.Existing == nil {
+		if err := writeGlobalHeader(tw, flags.GlobalHeaderName, globalHeader); err != nil {
+			return err
+		}
+	}
+
+	var manifest *manifestWriter
+	if flags.Manifest && !flags.DryRun {
+		alg := flags.ManifestChecksum
+		if alg == "" {
+			alg = DefaultManifestChecksum
+		}
+		if _, err := NewChecksum(alg); err != nil {
+			return err
+		}
+		manifest = &manifestWriter{digests: make(Digests), alg: alg}
+	}
+
+	var dedup *contentDedup
+	if flags.Dedup {
+		dedup = newContentDedup()
+	}
+
+	// estimator estimates the compressed size of the current source in the dry run
+	var estimator *sizeEstimator
+	var limiter = newScanLimiter(flags.ScanLimit)
+
+	names := newOwnerNames()
+	var iterater = func(rootPath, baseDir string) filepath.WalkFunc {
 		return func(absPath string, fi os.FileInfo, err error) error {
 			if err != nil {
 				return err
@@ -64,36 +261,25 @@ func Compress(ctx context.Context, dest io.WriteCloser, flags CompressFlags, sou
 				return ctx.Err()
 			default:
 			}
+			if err := limiter.wait(ctx); err != nil {
+				return err
+			}
 
 			isLink, isFile, isDir := IsSymbolicLink(fi.Mode()), fi.Mode().IsRegular(), fi.Mode().IsDir()
 			switch {
 			case isLink, isFile, isDir:
-				// if we have path rootPath `/data` and absPath `/data/.github/dependabot.yml` and pattern `.github/**`
-				// we should use `.github/dependabot.yml` as the path, so the user don't need to use pattern `/data.github/**`
-				path := absPath
-				rel, err := filepath.Rel(rootPath, absPath)
-				if err == nil {
-					path = rel
-				}
-				for _, pattern := range flags.Exclude {
-					if doublestar.MatchUnvalidated(pattern, path) {
-						logger.Debug("exclude", "target", absPath, "parttern", pattern)
-						if isDir {
-							return filepath.SkipDir
-						}
-						return nil
+				if pattern, ok := excluded(flags.Exclude, rootPath, absPath); ok {
+					logger.Debug("exclude", "target", absPath, "parttern", pattern)
+					if isDir {
+						return filepath.SkipDir
 					}
+					return nil
 				}
-				logger.Info("append", "target", absPath)
 			default:
 				logger.Debug("skip", "target", absPath, "mode", fi.Mode().String())
 				return nil
 			}
 
-			if flags.DryRun {
-				return nil
-			}
-
 			var link = absPath
 			if isLink {
 				link, err = os.Readlink(absPath)
@@ -107,35 +293,135 @@ func Compress(ctx context.Context, dest io.WriteCloser, flags CompressFlags, sou
 			if err != nil {
 				return err
 			}
+			// the names of the overridden owners are the names of the new ids, or the names of the files
+			// would be restored on extract by the names
+			if flags.Uid != nil {
+				header.Uid, header.Uname = *flags.Uid, names.user(*flags.Uid)
+			}
+			if flags.Gid != nil {
+				header.Gid, header.Gname = *flags.Gid, names.group(*flags.Gid)
+			}
+			if flags.NumericOwner {
+				header.Uname, header.Gname = "", ""
+			}
+
+			// if we have baseDir `/etc` and absPath `/etc/nginx/nginx.conf`
+			// we should use `nginx/nginx.conf` as the name
+			name := absPath
+			if baseDir != "" {
+				if rel, err := filepath.Rel(baseDir, absPath); err == nil {
+					name = rel
+				}
+			}
 
 			// if we have absPath `../demo/test.txt` and basePath `../demo`
 			// we should use `test.txt` as the name
-			if flags.Relative || strings.HasPrefix(absPath, "../") {
+			if flags.Relative || (!flags.AbsoluteNames && strings.HasPrefix(name, "../")) {
 				rel, err := filepath.Rel(rootPath, absPath)
 				if err != nil {
 					return err
 				}
 				header.Name = filepath.ToSlash(rel)
 			} else {
-				header.Name = filepath.ToSlash(absPath)
+				header.Name = filepath.ToSlash(name)
 			}
 
 			// trim the leading slash
-			if filepath.IsAbs(header.Name) {
+			if filepath.IsAbs(header.Name) && !flags.AbsoluteNames {
 				header.Name = header.Name[1:]
 			}
+			if normalize != nil {
+				header.Name, header.Linkname = normalize(header.Name), normalize(header.Linkname)
+			}
+			// the directories have the trailing slash like GNU tar, so the empty directories are kept by the tools
+			// which don't check the type, e.g. the directory marker objects of s3
+			if isDir && !strings.HasSuffix(header.Name, "/") {
+				header.Name += "/"
+			}
+			if transform != nil {
+				ok, err := renameMember(transform, header, flags.AbsoluteNames)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					logger.Debug("skip the empty name after the transform", "target", absPath)
+					return nil
+				}
+			}
+			// the archived time is in seconds
+			if mtime, ok := archived[header.Name]; ok && !fi.ModTime().Truncate(time.Second).After(mtime.Truncate(time.Second)) {
+				logger.Debug("skip the unchanged file", "target", absPath, "path", header.Name)
+				return nil
+			}
+			logger.Info("append", "target", absPath)
+
+			// the scanned content is archived from the same descriptor
+			var scanned *os.File
+			if isFile && flags.Scanner != nil {
+				file, skip, err := scanFile(flags.Scanner, retry, absPath)
+				if err != nil {
+					return err
+				}
+				if skip {
+					logger.Warn("skip the file by the scanner", "target", absPath)
+					return nil
+				}
+				scanned = file
+				defer scanned.Close()
+				// the header is of the file which is walked, it's replaced before the scan
+				if st, err := scanned.Stat(); err != nil || !os.SameFile(fi, st) {
+					return fmt.Errorf("%s is replaced during the scan", absPath)
+				}
+			}
+
+			if flags.DryRun {
+				if isFile && estimator != nil {
+					return estimator.add(absPath, fi.Size())
+				}
+				return nil
+			}
+
+			if isFile && dedup != nil {
+				linked, err := dedup.link(absPath, header)
+				if err != nil {
+					return err
+				}
+				if linked {
+					logger.Debug("dedup", "path", header.Name, "link", header.Linkname)
+					isFile = false
+				}
+			}
 			logger.Debug("tar", "path", header.Name)
+			stampRecords(header, flags.PAXRecords)
 			if err := tw.WriteHeader(header); err != nil {
 				return err
 			}
+			flags.Stats.add(header.Typeflag)
+			if flags.Paths != nil {
+				flags.Paths[header.Name] = absPath
+			}
 
 			// if it's a file, write file content
+			var hash hash.Hash
 			if isFile {
-				data, err := os.Open(absPath)
-				if err != nil {
-					return err
+				data := scanned
+				if data == nil {
+					err := retry.do("open", absPath, func() (err error) {
+						data, err = os.Open(absPath)
+						return err
+					})
+					if err != nil {
+						return err
+					}
+				}
+				var w io.Writer = tw
+				if manifest != nil {
+					hash = manifest.hash()
+					w = io.MultiWriter(tw, hash)
 				}
-				if _, err := io.Copy(tw, data); err != nil {
+				n, err := io.Copy(w, retry.reader(absPath, data))
+				flags.Stats.addIn(n)
+				if err != nil {
 					_ = data.Close()
 					return err
 				}
@@ -143,13 +429,81 @@ func Compress(ctx context.Context, dest io.WriteCloser, flags CompressFlags, sou
 					return err
 				}
 			}
+			if manifest != nil {
+				manifest.add(header, hash)
+			}
 			return nil
 		}
 	}
 
+	compressSource := func(src Source) (err error) {
+		var baseDir string
+		if src.Dir != "" && !filepath.IsAbs(src.Path) {
+			baseDir = filepath.Clean(src.Dir)
+		}
+		if flags.DryRun {
+			if estimator, err = newSizeEstimator(flags.Archiver); err != nil {
+				return err
+			}
+		}
+		root, walkFn := src.Root(), iterater(src.Root(), baseDir)
+		if flags.FollowArgs {
+			if root, walkFn, err = followRoot(root, walkFn); err != nil {
+				return err
+			}
+		}
+		if err := retry.walk(root, walkFn); err != nil {
+			return err
+		}
+		if estimator != nil {
+			estimated, err := estimator.estimate()
+			if err != nil {
+				return err
+			}
+			logger.Info("estimate", "source", src.Path, "size", estimator.size, "compressed", estimated)
+			if flags.Stats != nil {
+				flags.Stats.Estimates = append(flags.Stats.Estimates, SizeEstimate{Source: src.Path, Files: estimator.files, Size: estimator.size, Estimated: estimated})
+			}
+		}
+		return nil
+	}
 	for _, src := range sources {
-		if err := filepath.Walk(src,
-			iterater(filepath.Clean(src))); err != nil {
+		if err := compressSource(src); err != nil {
+			return err
+		}
+	}
+	if flags.SourcesFrom != nil {
+		if err := flags.SourcesFrom(compressSource); err != nil {
+			return err
+		}
+	}
+
+	for _, nested := range flags.Nested {
+		if err := writeNested(ctx, tw, nested, flags, logger, manifest, normalize, transform); err != nil {
+			return fmt.Errorf("%s: %w", nested.Name, err)
+		}
+	}
+
+	for _, entry := range flags.Entries {
+		if normalize != nil {
+			entry.Name = normalize(entry.Name)
+		}
+		if transform != nil {
+			if entry.Name = transform(entry.Name); entry.Name == "" {
+				continue
+			}
+		}
+		logger.Info("append", "entry", entry.Name)
+		if flags.DryRun {
+			continue
+		}
+		if err := writeEntry(tw, entry, flags, manifest); err != nil {
+			return err
+		}
+	}
+
+	if manifest != nil {
+		if err := manifest.write(tw); err != nil {
 			return err
 		}
 	}
@@ -165,15 +519,218 @@ func Compress(ctx context.Context, dest io.WriteCloser, flags CompressFlags, sou
 	return dest.Close()
 }
 
+// followRoot walks the target if the root is a symbolic link, the paths are mapped back under the root,
+// so the names in the archive are the same as the link is a directory or a file
+func followRoot(root string, fn filepath.WalkFunc) (string, filepath.WalkFunc, error) {
+	fi, err := os.Lstat(root)
+	if err != nil || !IsSymbolicLink(fi.Mode()) {
+		// the error is reported by the walk
+		return root, fn, nil
+	}
+	target, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", nil, err
+	}
+	return target, func(path string, fi os.FileInfo, err error) error {
+		if rel, relErr := filepath.Rel(target, path); relErr == nil {
+			path = filepath.Join(root, rel)
+		}
+		return fn(path, fi, err)
+	}, nil
+}
+
+// excluded returns the pattern which excludes the path
+func excluded(patterns []string, rootPath, absPath string) (string, bool) {
+	// if we have path rootPath `/data` and absPath `/data/.github/dependabot.yml` and pattern `.github/**`
+	// we should use `.github/dependabot.yml` as the path, so the user don't need to use pattern `/data.github/**`
+	path := absPath
+	rel, err := filepath.Rel(rootPath, absPath)
+	if err == nil {
+		path = rel
+	}
+	return excludedName(patterns, path)
+}
+
 type DecompressFlags struct {
-	DryRun          bool
-	NoSamePerm      bool
+	DryRun     bool
+	NoSamePerm bool
+	// DirPerm and FilePerm are the permissions of the extracted directories and files with NoSamePerm,
+	// and DirPerm is also used for the parent directories which are not in the archive,
+	// DefaultDirPerm and DefaultFilePerm are used if they are 0
+	DirPerm  fs.FileMode
+	FilePerm fs.FileMode
+	// ApplyUmask applies the umask of the process to the permissions in the archive with NoSamePerm like tar,
+	// instead of using DirPerm and FilePerm
+	ApplyUmask bool
+	// WarnMetadata logs and counts the failures to restore the owners and the times instead of failing,
+	// e.g. the restore as non-root, they are reported by MetadataError after the entries are extracted
+	WarnMetadata bool
+	// RecursiveUnlink removes the non-empty directory which is replaced by a file or a link in the archive,
+	// only the empty directory is replaced otherwise
+	RecursiveUnlink bool
 	NoSameOwner     bool
 	NoSameTime      bool
 	NoOverwrite     bool
 	StripComponents int
 	Archiver        Archiver
 	Logger          Logger
+	// Members selects the entries to extract, it's the exact name or the glob pattern,
+	// or the RE2 regular expression if Regex is true, they are matched with the names in the archive
+	// before StripComponents and Transform like tar, so the members are the names listed by -t
+	Members []string
+	Regex   bool
+	// Occurrence extracts only the Nth occurrence of each member if it's greater than 0
+	Occurrence int
+	// Matching are the options of matching the Members, e.g. unanchored and case-insensitive
+	Matching MemberMatch
+	// AbsoluteNames allows the absolute names and `..` in the names like `-P` flag in tar command,
+	// the absolute names are extracted to the absolute paths instead of the directory
+	AbsoluteNames bool
+	// IgnoreZeros continues reading after the end of archive blocks like `--ignore-zeros` in tar command
+	IgnoreZeros bool
+	// Recover skips the corrupt headers and extracts the rest of the archive,
+	// the damages are reported after everything salvageable is extracted
+	Recover bool
+	// StateFile records the extracted entries, the entries in it are skipped if it exists,
+	// so the interrupted extraction can be resumed, it's removed once the extraction is complete
+	StateFile string
+	// Offset is the offset of the uncompressed tar archive where the source starts, it's the ResumeOffset
+	// of the StateFile, so the entries extracted by the previous run aren't read again
+	Offset int64
+	// Normalize is the unicode normalization form of the target paths, it can be nfc or nfd
+	Normalize string
+	// Transform is the sed replace expressions which rename the entries after StripComponents,
+	// e.g. `s/^app-1.0/app/`, the link targets are not changed unless TransformLinks is true
+	Transform []string
+	// TransformLinks applies Transform to the targets of the symbolic links too, e.g. `s,^/opt/app,/srv/app,`
+	TransformLinks bool
+	// RelativeLinks rewrites the absolute targets of the symbolic links to the relative ones in the directory,
+	// e.g. `/usr/lib/libc.so` of `usr/lib64/libc.so` is `../lib/libc.so`, so the system backups restored into
+	// a different root don't point to the files of the host, it's applied after TransformLinks
+	RelativeLinks bool
+	// FromEncoding is the charset of the names in the legacy archives, e.g. latin1 and shift_jis,
+	// they are transcoded to UTF-8 on read, the names in the pax records are UTF-8 already
+	FromEncoding string
+	// OwnerFrom is the source of the owners to restore, it can be ids (default), names or skip,
+	// the ids are the fallback of the names which are unknown on this host
+	OwnerFrom string
+	// Uid and Gid override the owners of the entries, they are restored even with NoSameOwner
+	Uid, Gid *int
+	// Stats is filled with the counters of the entries and the bytes if it's not nil
+	Stats *Stats
+	// Retries is the max retries of the transient errors to write the files and their metadata, e.g. EIO, ESTALE and EAGAIN
+	// of the network mounts, the delay is doubled after every retry
+	Retries int
+	// Preview is called with the entries and their target paths instead of extracting them like DryRun,
+	// so the results of the member selection, StripComponents and Transform can be checked without touching the disk
+	Preview func(header *tar.Header, dest string) error
+	// Label is the shell pattern of the volume label like `tar --label`, the archive is rejected
+	// if it doesn't start with the matched volume label
+	Label string
+	// GlobalHeaders is how the pax global headers are read, it can be GlobalHeadersIgnore (default),
+	// GlobalHeadersHonor or GlobalHeadersKeep
+	GlobalHeaders string
+	// Filter selects the types of the entries to extract, it can be FilterAll (default), FilterFiles,
+	// FilterNoLinks, FilterNoSpecial, or the presets FilterDocs, FilterData and FilterScripts
+	Filter string
+	// Modified selects the entries by their modification times, the parent directories are still created
+	Modified TimeRange
+	// Verbose is called with the extracted entries and their target paths like `tar -xv`, the result tells
+	// whether the existing entry is overwritten or kept with NoOverwrite
+	Verbose func(header *tar.Header, dest string, result ExtractResult) error
+}
+
+// ExtractResult is how the entry is extracted to the target path
+type ExtractResult string
+
+const (
+	ExtractCreated     ExtractResult = "created"
+	ExtractOverwritten ExtractResult = "overwritten"
+	ExtractSkipped     ExtractResult = "skipped"
+)
+
+// verbose reports the extracted entry to Verbose if it's set
+func (f DecompressFlags) verbose(header *tar.Header, dest string, result ExtractResult) error {
+	if f.Verbose == nil {
+		return nil
+	}
+	return f.Verbose(header, dest, result)
+}
+
+func (f DecompressFlags) dirPerm() fs.FileMode {
+	if f.DirPerm == 0 {
+		return DefaultDirPerm
+	}
+	return f.DirPerm
+}
+
+func (f DecompressFlags) filePerm() fs.FileMode {
+	if f.FilePerm == 0 {
+		return DefaultFilePerm
+	}
+	return f.FilePerm
+}
+
+// perm returns the permission of the extracted directory or file
+func (f DecompressFlags) perm(header *tar.Header) fs.FileMode {
+	switch {
+	case !f.NoSamePerm:
+		return fs.FileMode(header.Mode)
+	case f.ApplyUmask:
+		return fs.FileMode(header.Mode).Perm() &^ umask()
+	case header.Typeflag == tar.TypeDir:
+		return f.dirPerm()
+	default:
+		return f.filePerm()
+	}
+}
+
+// link creates the hardlink, the owner and the times are shared with the target
+func (f DecompressFlags) link(retry fsRetry, target, dest string) error {
+	if err := retry.mkdirAll(filepath.Dir(dest), f.dirPerm()); err != nil {
+		return err
+	}
+	return retry.do("link", dest, func() error {
+		return os.Link(target, dest)
+	})
+}
+
+// replace removes the existing entry at the path which can't be overwritten by the entry in place,
+// the directory is kept for the directory entry, the other types are removed, and the non-empty directory
+// is only removed with RecursiveUnlink, the regular file is unlinked instead of truncated as well, so the
+// new content isn't written through its other hardlinks.
+// the result is ExtractSkipped if the entry exists and NoOverwrite is set, the existing directory of
+// the directory entry is created since it's only updated, and the extraction directory itself is never replaced
+func (f DecompressFlags) replace(dir, dest string, typeflag byte, logger Logger) (ExtractResult, error) {
+	if typeflag != tar.TypeDir && filepath.Clean(dest) == filepath.Clean(dir) {
+		return "", fmt.Errorf("the entry can't replace the extraction directory %s", dir)
+	}
+	fi, err := os.Lstat(dest)
+	if os.IsNotExist(err) {
+		return ExtractCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	isDir := typeflag == tar.TypeDir
+	switch {
+	case isDir && fi.IsDir():
+		return ExtractCreated, nil
+	case f.NoOverwrite:
+		logger.Debug("skip", "target", dest)
+		return ExtractSkipped, nil
+	case fi.IsDir() && f.RecursiveUnlink:
+		logger.Debug("replace the directory", "target", dest)
+		return ExtractOverwritten, os.RemoveAll(dest)
+	case fi.IsDir():
+		if err := os.Remove(dest); err != nil {
+			return "", fmt.Errorf("can't replace the directory %s: %w", dest, err)
+		}
+		return ExtractOverwritten, nil
+	default:
+		return ExtractOverwritten, os.Remove(dest)
+	}
 }
 
 func Decompress(ctx context.Context, src io.ReadCloser, dir string, flags DecompressFlags) (err error) {
@@ -182,30 +739,114 @@ func Decompress(ctx context.Context, src io.ReadCloser, dir string, flags Decomp
 	if flags.Archiver == nil {
 		return fmt.Errorf("archiver is nil")
 	}
+	if flags.Preview != nil {
+		flags.DryRun = true
+	}
+
+	matcher, err := newMemberMatcher(flags.Members, flags.Regex, flags.Occurrence, flags.Matching)
+	if err != nil {
+		return err
+	}
+
+	normalize, err := Normalizer(flags.Normalize)
+	if err != nil {
+		return err
+	}
+
+	decode, err := NameDecoder(flags.FromEncoding)
+	if err != nil {
+		return err
+	}
+	if err := checkGlobalHeaders(flags.GlobalHeaders); err != nil {
+		return err
+	}
+
+	owners, err := newOwnerResolver(flags)
+	if err != nil {
+		return err
+	}
+
+	transform, err := ParseTransform(flags.Transform)
+	if err != nil {
+		return err
+	}
 
+	filter, err := typeFilter(flags.Filter)
+	if err != nil {
+		return err
+	}
+
+	if flags.Stats != nil {
+		src = countReader{ReadCloser: src, stats: flags.Stats}
+	}
 	zr, err := flags.Archiver.Reader(src)
 	if err != nil {
 		return err
 	}
+	defer closeReader(zr)
 
 	var logger = flags.Logger
 	if logger == nil {
 		logger = slog.Default()
 	}
+	logger = flags.Stats.logger(logger)
+	retry := fsRetry{ctx: ctx, retries: flags.Retries, logger: logger}
 
-	logger.Debug("flags", "dry-run", flags.DryRun, "strip-components", flags.StripComponents, "archiver", flags.Archiver.Name(),
-		"no-same-perm", flags.NoSamePerm, "no-same-owner", flags.NoSameOwner, "no-same-time", flags.NoSameTime, "no-overwrite", flags.NoOverwrite)
-	tr := tar.NewReader(zr)
+	if flags.AbsoluteNames {
+		logger.Warn("the absolute names and `..` are allowed, the files can be extracted outside of the directory")
+	}
+
+	logger.Debug("flags", "dry-run", flags.DryRun, "absolute-names", flags.AbsoluteNames, "members", flags.Members, "regex", flags.Regex, "strip-components", flags.StripComponents, "archiver", flags.Archiver.Name(),
+		"no-same-perm", flags.NoSamePerm, "no-same-owner", flags.NoSameOwner, "no-same-time", flags.NoSameTime, "no-overwrite", flags.NoOverwrite,
+		"ignore-zeros", flags.IgnoreZeros, "recover", flags.Recover)
+	tr := newTarReader(zr, flags.IgnoreZeros, flags.Recover, logger)
+	tr.decode = decode
+	tr.label = flags.Label
+	tr.globals = flags.GlobalHeaders
+	tr.volume = func(label string) error {
+		logger.Info("volume label", "label", label)
+		return nil
+	}
 
 	var links = make(map[string]*tar.Header)
+	// hardlinks are the links whose targets are not extracted yet
+	var hardlinks = make(map[string]*tar.Header)
+	// dirs are the directories to restore the times after all of the entries are extracted
+	var dirs = make(map[string]*tar.Header)
+	var failures = &metadataFailures{warn: flags.WarnMetadata, logger: logger, stats: flags.Stats}
+	// files are the paths of the regular files by name, the hardlinks are linked to them
+	var files = make(map[string]string)
+
+	var state *extractState
+	if !flags.DryRun {
+		if state, err = openExtractState(flags.StateFile); err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := state.Close(err == nil); err == nil {
+				err = cerr
+			}
+		}()
+		if n := state.Resumed(); n > 0 {
+			logger.Info("resume the extraction", "extracted", n, "state", flags.StateFile, "offset", flags.Offset)
+		}
+		if flags.Offset > 0 {
+			if files, err = state.SkipDone(flags.Offset); err != nil {
+				return err
+			}
+		}
+	} else if flags.Offset > 0 {
+		return fmt.Errorf("the offset %d can't be used without the state file", flags.Offset)
+	}
 
 	// create directory if not exist
-	if dir != "" {
-		if err := os.MkdirAll(dir, DefaultDirPerm); err != nil {
+	if dir != "" && !flags.DryRun {
+		if err := retry.mkdirAll(dir, flags.dirPerm()); err != nil {
 			return err
 		}
 	}
 
+loop:
 	for {
 		select {
 		case <-ctx.Done():
@@ -213,6 +854,18 @@ func Decompress(ctx context.Context, src io.ReadCloser, dir string, flags Decomp
 		default:
 		}
 
+		// stop reading once every member is found with the occurrence
+		if matcher.Done() {
+			break
+		}
+
+		if state != nil {
+			// the rest of the previous entry is read, so the next header starts at the aligned offset
+			if _, err := io.Copy(io.Discard, tr); err == nil {
+				state.End((tr.Offset() + blockSize - 1) / blockSize * blockSize)
+			}
+		}
+
 		header, err := tr.Next()
 		if err == io.EOF {
 			break
@@ -221,11 +874,40 @@ func Decompress(ctx context.Context, src io.ReadCloser, dir string, flags Decomp
 			return err
 		}
 
+		extracted, err := state.Begin(header.Name, tr.Offset(), logger)
+		if err != nil {
+			return err
+		}
+		state.Target(header.Typeflag, "")
+
+		if normalize != nil {
+			header.Name, header.Linkname = normalize(header.Name), normalize(header.Linkname)
+		}
+
 		dest := header.Name
-		if isPathInvalid(dest) {
+		switch {
+		case flags.AbsoluteNames && dest != "" && !strings.Contains(dest, `\`):
+			if filepath.IsAbs(dest) || isPathInvalid(dest) {
+				logger.Warn("extract outside of the directory", "target", dest)
+			}
+		case isPathInvalid(dest):
 			return fmt.Errorf("file name %q is invalid", dest)
 		}
 
+		// the entries are filtered before they are matched, so -occurrence counts the selected entries only
+		if filter != nil && !filter(header) {
+			logger.Debug("skip the entry by the filter", "target", header.Name, "type", string(header.Typeflag), "filter", flags.Filter)
+			continue
+		}
+		if !flags.Modified.Contains(header.ModTime) {
+			logger.Debug("skip the entry by the modification time", "target", header.Name, "mtime", header.ModTime)
+			continue
+		}
+
+		if matcher.Match(dest, header.Typeflag == tar.TypeDir) < 0 {
+			continue
+		}
+
 		// strip components
 		if flags.StripComponents > 0 {
 			dest = StripComponents(dest, flags.StripComponents)
@@ -233,72 +915,189 @@ func Decompress(ctx context.Context, src io.ReadCloser, dir string, flags Decomp
 				logger.Info("skip", "target", header.Name)
 				continue
 			}
+			if !flags.AbsoluteNames && isPathInvalid(dest) {
+				return fmt.Errorf("file name %q of %q is invalid after stripping the components", dest, header.Name)
+			}
 		}
 
-		// it's the same with `-C` flag in tar command
-		if dir != "" {
+		if transform != nil {
+			dest = transform(dest)
+			if dest == "" {
+				logger.Info("skip", "target", header.Name)
+				continue
+			}
+			if !flags.AbsoluteNames && isPathInvalid(dest) {
+				return fmt.Errorf("file name %q of %q is invalid after the transform", dest, header.Name)
+			}
+		}
+
+		if header.Typeflag == tar.TypeSymlink {
+			if transform != nil && flags.TransformLinks {
+				header.Linkname = transform(header.Linkname)
+			}
+			if flags.RelativeLinks {
+				header.Linkname = relativeLink(dest, header.Linkname)
+			}
+		}
+
+		// it's the same with `-C` flag in tar command, the name is cleaned as well,
+		// so `./dir//file` and `dir/file` are the same destination
+		if flags.AbsoluteNames && filepath.IsAbs(dest) {
+			dest = filepath.Clean(dest)
+		} else {
 			dest = filepath.Join(dir, dest)
 		}
 
+		if header.Typeflag == tar.TypeReg {
+			files[header.Name] = dest
+		}
+		state.Target(header.Typeflag, dest)
+
+		if extracted {
+			// the symbolic links are created after all of the entries
+			if header.Typeflag == tar.TypeSymlink {
+				links[dest] = header
+			}
+			logger.Debug("skip the extracted entry", "file", header.Name)
+			continue
+		}
+
 		logger.Info("extract", "file", header.Name,
 			"dest", dest, "isDir", header.Typeflag == tar.TypeDir)
 		if flags.DryRun {
+			if flags.Preview != nil {
+				if err := flags.Preview(header, dest); err != nil {
+					return err
+				}
+			}
 			continue
 		}
+		// the later entry replaces the deferred hardlink
+		delete(hardlinks, dest)
 
 		switch header.Typeflag {
-		case tar.TypeDir:
-			var mode = fs.FileMode(header.Mode)
-			if flags.NoSamePerm {
-				mode = fs.FileMode(DefaultDirPerm)
+		case tar.TypeDir, tar.TypeReg, tar.TypeLink:
+			result, err := flags.replace(dir, dest, header.Typeflag, logger)
+			if err != nil {
+				return err
 			}
-			if err := os.MkdirAll(dest, mode); err != nil {
+			if err := flags.verbose(header, dest, result); err != nil {
 				return err
 			}
-		case tar.TypeReg:
-			if flags.NoOverwrite {
-				// check if the file is exist, if so, skip
-				if _, err := os.Stat(dest); err == nil {
-					logger.Debug("skip", "target", dest)
-					continue
-				}
+			if result == ExtractSkipped {
+				continue
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			mode := flags.perm(header)
+			if err := retry.mkdirAll(dest, mode); err != nil {
+				return err
 			}
+			flags.Stats.add(tar.TypeDir)
+		case tar.TypeReg:
+			mode := flags.perm(header)
 
-			var mode = fs.FileMode(header.Mode)
-			if flags.NoSamePerm {
-				mode = fs.FileMode(DefaultFilePerm)
+			// the parent directory entry can be excluded by the member selection
+			if err := retry.mkdirAll(filepath.Dir(dest), flags.dirPerm()); err != nil {
+				return err
 			}
 
-			fileToWrite, err := os.OpenFile(dest, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+			var fileToWrite *os.File
+			err := retry.do("open", dest, func() (err error) {
+				fileToWrite, err = os.OpenFile(dest, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+				return err
+			})
 			if err != nil {
 				return err
 			}
-			if _, err := io.Copy(fileToWrite, tr); err != nil {
+			n, err := io.Copy(retry.writer(dest, fileToWrite), tr)
+			flags.Stats.addOut(n)
+			if err != nil {
+				fileToWrite.Close()
+				if tr.Truncated(header.Name, err) {
+					break loop
+				}
 				return err
 			}
 			if err := fileToWrite.Close(); err != nil {
 				return err
 			}
+			flags.Stats.add(tar.TypeReg)
 		case tar.TypeSymlink:
 			// save the link for later
 			links[dest] = header
 			continue
+		case tar.TypeLink:
+			target, ok := files[header.Linkname]
+			if !ok {
+				// the target can be after the link, e.g. in the appended archive
+				logger.Debug("defer the hardlink", "file", header.Name, "link", header.Linkname)
+				hardlinks[dest] = header
+				continue
+			}
+			if err := flags.link(retry, target, dest); err != nil {
+				return err
+			}
+			flags.Stats.add(tar.TypeLink)
+			files[header.Name] = dest
+			continue
 		default:
 			continue
 		}
 
-		if !flags.NoSameOwner {
-			if err := os.Chown(dest, header.Uid, header.Gid); err != nil {
+		if uid, gid, ok := owners.owner(header); ok {
+			err := retry.do("chown", dest, func() error {
+				return os.Chown(dest, uid, gid)
+			})
+			if err := failures.check(dest, "chown", err); err != nil {
 				return err
 			}
 		}
 
 		if !flags.NoSameTime {
-			if err := os.Chtimes(dest, header.AccessTime, header.ModTime); err != nil {
+			if header.Typeflag == tar.TypeDir {
+				// the entries in the directory change its times, they are restored at the end
+				dirs[dest] = header
+				continue
+			}
+			err := retry.do("chtimes", dest, func() error {
+				return os.Chtimes(dest, header.AccessTime, header.ModTime)
+			})
+			if err := failures.check(dest, "chtimes", err); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := matcher.Unmatched(); err != nil {
+		return err
+	}
+
+	// create the deferred hardlinks, the link can be the target of another one
+	for len(hardlinks) > 0 {
+		var linked int
+		for dest, header := range hardlinks {
+			target, ok := files[header.Linkname]
+			if !ok {
+				continue
+			}
+			if err := flags.link(retry, target, dest); err != nil {
 				return err
 			}
+			flags.Stats.add(tar.TypeLink)
+			files[header.Name] = dest
+			delete(hardlinks, dest)
+			linked++
+		}
+		if linked == 0 {
+			break
 		}
 	}
+	for _, header := range hardlinks {
+		logger.Warn("skip the hardlink to the unknown file", "file", header.Name, "link", header.Linkname)
+	}
 
 	// create symbolic links
 	for target, header := range links {
@@ -308,20 +1107,68 @@ func Decompress(ctx context.Context, src io.ReadCloser, dir string, flags Decomp
 		default:
 		}
 
+		if state.Resumed() > 0 {
+			if fi, err := os.Lstat(target); err == nil && IsSymbolicLink(fi.Mode()) {
+				continue
+			}
+		}
+
+		result, err := flags.replace(dir, target, tar.TypeSymlink, logger)
+		if err != nil {
+			return err
+		}
+		if err := flags.verbose(header, target, result); err != nil {
+			return err
+		}
+		if result == ExtractSkipped {
+			continue
+		}
+
 		logger.Debug("link", "source", header.Linkname, "target", target)
-		if err := os.Symlink(header.Linkname, target); err != nil {
+		if err := retry.mkdirAll(filepath.Dir(target), flags.dirPerm()); err != nil {
 			return err
 		}
-		if !flags.NoSameOwner {
-			if err := os.Chown(target, header.Uid, header.Gid); err != nil {
+		err = retry.do("symlink", target, func() error {
+			return os.Symlink(header.Linkname, target)
+		})
+		if err != nil {
+			return err
+		}
+		flags.Stats.add(tar.TypeSymlink)
+		// the metadata of the link itself is restored, the target can be outside of the directory
+		if uid, gid, ok := owners.owner(header); ok {
+			err := retry.do("lchown", target, func() error {
+				return lchown(target, uid, gid)
+			})
+			if err := failures.check(target, "lchown", err); err != nil {
+				return err
+			}
+		}
+		if !flags.NoSamePerm {
+			err := retry.do("lchmod", target, func() error {
+				return lchmod(target, fs.FileMode(header.Mode))
+			})
+			if err := failures.check(target, "lchmod", err); err != nil {
 				return err
 			}
 		}
 		if !flags.NoSameTime {
-			if err := os.Chtimes(target, header.AccessTime, header.ModTime); err != nil {
+			err := retry.do("lutimes", target, func() error {
+				return lutimes(target, header.AccessTime, header.ModTime)
+			})
+			if err := failures.check(target, "lutimes", err); err != nil {
 				return err
 			}
 		}
 	}
-	return nil
+
+	for dest, header := range dirs {
+		err := retry.do("chtimes", dest, func() error {
+			return os.Chtimes(dest, header.AccessTime, header.ModTime)
+		})
+		if err := failures.check(dest, "chtimes", err); err != nil {
+			return err
+		}
+	}
+	return errors.Join(tr.Damaged(), failures.Err())
 }
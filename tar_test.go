@@ -1,17 +1,29 @@
 package gotgz
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
 	"os"
+	"os/user"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 )
 
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
 type TestFileInfo struct {
 	Hash string
 	Link string
@@ -63,10 +75,19 @@ func TestTar(t *testing.T) {
 					Archiver: tt.args.archiver,
 					Relative: true,
 					Exclude:  []string{"parent/.exclude/**"},
+					Checksum: sha256.New(),
 				}
 				if err := Compress(context.Background(), file, flags, "testdata"); err != nil {
 					t.Fatal(err)
 				}
+
+				hash, err := GetFileHash(destPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := hex.EncodeToString(flags.Checksum.Sum(nil)); got != hash {
+					t.Fatalf("checksum %s not match %s", got, hash)
+				}
 			}
 
 			{
@@ -225,3 +246,619 @@ func TestTar(t *testing.T) {
 		})
 	}
 }
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+var benchmarkArchivers = []Archiver{
+	GZipArchiver{Level: -1},
+	Lz4Archiver{},
+	ZstdArchiver{},
+}
+
+var benchmarkDistributions = []struct {
+	name  string
+	count int
+	size  int
+}{
+	{name: "small", count: 1000, size: 1 << 10},
+	{name: "medium", count: 100, size: 64 << 10},
+	{name: "large", count: 4, size: 8 << 20},
+}
+
+// createBenchmarkFiles creates count files with the given size,
+// the first half of each file is random and the rest is zero, so it's compressible.
+func createBenchmarkFiles(b *testing.B, count, size int) string {
+	b.Helper()
+	dir := b.TempDir()
+	rnd := rand.New(rand.NewPCG(uint64(count), uint64(size)))
+	buf := make([]byte, size)
+	for i := 0; i < count; i++ {
+		for j := 0; j < size/2; j++ {
+			buf[j] = byte(rnd.Uint32())
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.bin", i)), buf, DefaultFilePerm); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func BenchmarkCompress(b *testing.B) {
+	for _, dist := range benchmarkDistributions {
+		source := createBenchmarkFiles(b, dist.count, dist.size)
+		for _, archiver := range benchmarkArchivers {
+			b.Run(dist.name+"/"+archiver.Name(), func(b *testing.B) {
+				flags := CompressFlags{Archiver: archiver, Relative: true, Logger: discardLogger}
+				b.SetBytes(int64(dist.count * dist.size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := Compress(context.Background(), nopWriteCloser{io.Discard}, flags, source); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	for _, dist := range benchmarkDistributions {
+		source := createBenchmarkFiles(b, dist.count, dist.size)
+		for _, archiver := range benchmarkArchivers {
+			b.Run(dist.name+"/"+archiver.Name(), func(b *testing.B) {
+				var buf bytes.Buffer
+				cflags := CompressFlags{Archiver: archiver, Relative: true, Logger: discardLogger}
+				if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+					b.Fatal(err)
+				}
+
+				dest := b.TempDir()
+				dflags := DecompressFlags{Archiver: archiver, NoSameOwner: true, NoSameTime: true, Logger: discardLogger}
+				b.SetBytes(int64(dist.count * dist.size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					src := io.NopCloser(bytes.NewReader(buf.Bytes()))
+					if err := Decompress(context.Background(), src, dest, dflags); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAbsoluteNames(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source")
+	if err := os.MkdirAll(source, DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	cflags := CompressFlags{Archiver: archiver, AbsoluteNames: true, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(source); err != nil {
+		t.Fatal(err)
+	}
+
+	dflags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Logger: discardLogger}
+	err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), t.TempDir(), dflags)
+	if err == nil {
+		t.Fatal("absolute names should be rejected without AbsoluteNames")
+	}
+
+	dflags.AbsoluteNames = true
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), t.TempDir(), dflags); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(source, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a" {
+		t.Errorf("content %q not match", data)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	const (
+		nfd = "cafe\u0301.txt"
+		nfc = "caf\u00e9.txt"
+	)
+
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, nfd), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	cflags := CompressFlags{Archiver: archiver, Relative: true, Normalize: "nfc", Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), ListFlags{Archiver: archiver}, func(header *tar.Header, _ io.Reader) error {
+		names = append(names, header.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"./", nfc}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+
+	dest := t.TempDir()
+	dflags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Normalize: "nfd", Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, dflags); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, nfd)); err != nil {
+		t.Error(err)
+	}
+
+	dflags.Normalize = "nfkc"
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, dflags); err == nil {
+		t.Error("unsupported form should fail")
+	}
+}
+
+func TestDecompressPerm(t *testing.T) {
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	zw, _ := archiver.Writer(nopWriteCloser{&buf})
+	tw := tar.NewWriter(zw)
+	for _, header := range []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0777},
+		{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0777},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		flags    DecompressFlags
+		wantDir  fs.FileMode
+		wantFile fs.FileMode
+	}{
+		{name: "Custom", flags: DecompressFlags{DirPerm: 0700, FilePerm: 0600}, wantDir: 0700, wantFile: 0600},
+		{name: "Umask", flags: DecompressFlags{ApplyUmask: true}, wantDir: 0777 &^ umask(), wantFile: 0777 &^ umask()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			flags := tt.flags
+			flags.Archiver, flags.Logger = archiver, discardLogger
+			flags.NoSamePerm, flags.NoSameOwner = true, true
+			if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range map[string]fs.FileMode{"dir": tt.wantDir, "dir/file": tt.wantFile} {
+				fi, err := os.Stat(filepath.Join(dest, path))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := fi.Mode().Perm(); got != want {
+					t.Errorf("%s mode = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecompress_Replace(t *testing.T) {
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	zw, _ := archiver.Writer(nopWriteCloser{&buf})
+	tw := tar.NewWriter(zw)
+	for _, header := range []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "file"},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write([]byte("data")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	// the file is replaced by the directory, the directories are replaced by the file and the link
+	if err := os.WriteFile(filepath.Join(dest, "dir"), nil, DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dest, "file", "child"), DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dest, "link"), DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err == nil {
+		t.Fatal("the non-empty directory should not be replaced without RecursiveUnlink")
+	}
+
+	flags.RecursiveUnlink = true
+	// extract twice to overwrite the existing entries of the same types
+	for i := 0; i < 2; i++ {
+		if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dest, "dir")); err != nil || !fi.IsDir() {
+		t.Errorf("dir should be a directory: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "link")); err != nil || string(data) != "data" {
+		t.Errorf("link = %q, %v, want the content of file", data, err)
+	}
+}
+
+func TestDecompress_Verbose(t *testing.T) {
+	data := newTestTar(t, tarFile{"a", "a"}, tarFile{"b", "b"})
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "a"), []byte("old"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	extract := func(flags DecompressFlags) []string {
+		var got []string
+		flags.Archiver, flags.NoSameOwner, flags.Logger = AutoArchiver{Archiver: GZipArchiver{}}, true, discardLogger
+		flags.Verbose = func(header *tar.Header, _ string, result ExtractResult) error {
+			got = append(got, header.Name+"="+string(result))
+			return nil
+		}
+		if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(data)), dest, flags); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got, want := extract(DecompressFlags{NoOverwrite: true}), []string{"a=skipped", "b=created"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Verbose with NoOverwrite = %v, want %v", got, want)
+	}
+	if got, want := extract(DecompressFlags{}), []string{"a=overwritten", "b=overwritten"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Verbose = %v, want %v", got, want)
+	}
+}
+
+func TestCompress_SourcesFrom(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	flags := CompressFlags{Archiver: GZipArchiver{Level: 1}, Logger: discardLogger}
+	flags.SourcesFrom = func(fn func(Source) error) error {
+		for _, name := range []string{"c", "b"} {
+			if err := fn(Source{Dir: dir, Path: name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := CompressSources(context.Background(), nopWriteCloser{&buf}, flags, Source{Dir: dir, Path: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	names, err := listNames(buf.Bytes(), ListFlags{Logger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a=a", "c=c", "b=b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	flags.SourcesFrom = func(fn func(Source) error) error {
+		return errors.New("read the list")
+	}
+	if err := CompressSources(context.Background(), nopWriteCloser{&buf}, flags); err == nil {
+		t.Error("the error of SourcesFrom is ignored")
+	}
+}
+
+func TestDecompress_ReplaceHardlink(t *testing.T) {
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "a"), []byte("old"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dest, "a"), filepath.Join(dest, "other")); err != nil {
+		t.Skip("the hardlinks aren't supported:", err)
+	}
+
+	// the existing file is unlinked, so its other hardlink keeps the old content
+	flags := DecompressFlags{Archiver: AutoArchiver{Archiver: GZipArchiver{}}, NoSameOwner: true, Logger: discardLogger}
+	data := newTestTar(t, tarFile{"a", "new"})
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(data)), dest, flags); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a": "new", "other": "old"} {
+		if got, err := os.ReadFile(filepath.Join(dest, name)); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestDecompress_ReplaceDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    string
+		strip    int
+		absolute bool
+	}{
+		{name: "Dot", entry: "."},
+		{name: "Stripped dot", entry: "x/.", strip: 1},
+		// the absolute names only warn, the entry is refused when it replaces the directory
+		{name: "Absolute names", entry: ".", absolute: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dest, "keep"), []byte("keep"), DefaultFilePerm); err != nil {
+				t.Fatal(err)
+			}
+			flags := DecompressFlags{
+				Archiver:        AutoArchiver{Archiver: GZipArchiver{}},
+				RecursiveUnlink: true,
+				StripComponents: tt.strip,
+				AbsoluteNames:   tt.absolute,
+				NoSameOwner:     true,
+				Logger:          discardLogger,
+			}
+			data := newTestTar(t, tarFile{tt.entry, "evil"})
+			if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(data)), dest, flags); err == nil {
+				t.Error("Decompress() should fail for the entry of the extraction directory")
+			}
+			if got, err := os.ReadFile(filepath.Join(dest, "keep")); err != nil || string(got) != "keep" {
+				t.Errorf("the existing file = %q, %v, want it kept", got, err)
+			}
+		})
+	}
+}
+
+func TestNumericOwner(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	uid, gid := 1234, 5678
+	cflags := CompressFlags{Archiver: archiver, Relative: true, NumericOwner: true, Uid: &uid, Gid: &gid, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+
+	err := List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), ListFlags{Archiver: archiver}, func(header *tar.Header, _ io.Reader) error {
+		if header.Uname != "" || header.Gname != "" {
+			t.Errorf("%s: names = %q/%q, want empty", header.Name, header.Uname, header.Gname)
+		}
+		if header.Uid != uid || header.Gid != gid {
+			t.Errorf("%s: owner = %d/%d, want %d/%d", header.Name, header.Uid, header.Gid, uid, gid)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompress_OwnerNames(t *testing.T) {
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	root, err := user.LookupId("0")
+	if err != nil {
+		t.Skip("the root user is unknown:", err)
+	}
+
+	// the names are the ones of the overridden ids, and they are empty if the ids are unknown
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	uid, gid := 0, 987654
+	cflags := CompressFlags{Archiver: archiver, Relative: true, Uid: &uid, Gid: &gid, Logger: discardLogger}
+	if err := Compress(context.Background(), nopWriteCloser{&buf}, cflags, source); err != nil {
+		t.Fatal(err)
+	}
+	err = List(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), ListFlags{Archiver: archiver}, func(header *tar.Header, _ io.Reader) error {
+		if header.Uname != root.Username || header.Gname != "" {
+			t.Errorf("%s: names = %q/%q, want %q/empty", header.Name, header.Uname, header.Gname, root.Username)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecompress_DirTime(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	zw, _ := archiver.Writer(nopWriteCloser{&buf})
+	tw := tar.NewWriter(zw)
+	for _, header := range []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime},
+		{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0644, ModTime: mtime},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	flags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dir", "dir/file"} {
+		fi, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s mtime = %v, want %v", name, fi.ModTime(), mtime)
+		}
+	}
+}
+
+func TestDecompress_ForwardHardlink(t *testing.T) {
+	var buf bytes.Buffer
+	archiver := GZipArchiver{Level: 1}
+	zw, _ := archiver.Writer(nopWriteCloser{&buf})
+	tw := tar.NewWriter(zw)
+	content := []byte("hello")
+	for _, header := range []*tar.Header{
+		// the link to the link is before both of them
+		{Name: "chain", Typeflag: tar.TypeLink, Linkname: "link"},
+		{Name: "link", Typeflag: tar.TypeLink, Linkname: "file"},
+		{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))},
+		{Name: "missing", Typeflag: tar.TypeLink, Linkname: "unknown"},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	flags := DecompressFlags{Archiver: archiver, NoSameOwner: true, Logger: discardLogger}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, flags); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Stat(filepath.Join(dest, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"link", "chain"} {
+		fi, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(file, fi) {
+			t.Errorf("%s is not linked to the file", name)
+		}
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s content = %q, want %q", name, got, content)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "missing")); !os.IsNotExist(err) {
+		t.Errorf("the hardlink to the unknown file is created: %v", err)
+	}
+}
+
+func TestCompress_EmptyDir(t *testing.T) {
+	source := t.TempDir()
+	for _, dir := range []string{"empty", "pruned"} {
+		if err := os.Mkdir(filepath.Join(source, dir), DefaultDirPerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(source, "pruned", "app.log"), []byte("log"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	cflags := CompressFlags{Archiver: GZipArchiver{}, Exclude: []string{"**/*.log"}, Logger: discardLogger}
+	// the empty directory is added explicitly with the trailing slash as well
+	sources := []Source{{Dir: source, Path: "."}, {Dir: source, Path: "empty/"}}
+	if err := CompressSources(context.Background(), nopWriteCloser{&buf}, cflags, sources...); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := listNames(buf.Bytes(), ListFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"./=", "empty/=", "pruned/=", "empty/="}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+
+	tests := []struct {
+		name    string
+		members []string
+		want    []string
+	}{
+		{name: "All", want: []string{"empty", "pruned"}},
+		{name: "Directory member", members: []string{"pruned/"}, want: []string{"pruned"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			dflags := DecompressFlags{Archiver: GZipArchiver{}, Members: tt.members, NoSameOwner: true, Logger: discardLogger}
+			if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(buf.Bytes())), dest, dflags); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					t.Errorf("%s is not a directory", entry.Name())
+				}
+				got = append(got, entry.Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package gotgz
+
+import (
+	"errors"
+	"io"
+)
+
+// teeWriter writes the same stream to all of the writers, e.g. the local file and the s3 uploads,
+// all of them are aborted if any of them fails
+type teeWriter struct {
+	io.Writer
+	writers []io.WriteCloser
+}
+
+// NewTeeWriter returns the writer which duplicates the writes to all of the writers like io.MultiWriter,
+// the Close closes all of them, and the CloseWithError aborts the s3 uploads instead of completing them
+func NewTeeWriter(writers ...io.WriteCloser) io.WriteCloser {
+	var ws = make([]io.Writer, len(writers))
+	for i, w := range writers {
+		ws[i] = w
+	}
+	return &teeWriter{Writer: io.MultiWriter(ws...), writers: writers}
+}
+
+func (t *teeWriter) Close() error {
+	var errs []error
+	for _, w := range t.writers {
+		errs = append(errs, w.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (t *teeWriter) CloseWithError(err error) error {
+	for _, w := range t.writers {
+		closeWithError(w, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// abortWriter records how it's closed like the s3 writer
+type abortWriter struct {
+	bytes.Buffer
+	closed  bool
+	aborted error
+}
+
+func (a *abortWriter) Close() error {
+	a.closed = true
+	return nil
+}
+
+func (a *abortWriter) CloseWithError(err error) error {
+	a.aborted = err
+	return nil
+}
+
+func TestTeeWriter(t *testing.T) {
+	var first, second abortWriter
+	flags := CompressFlags{Archiver: GZipArchiver{Level: 1}, Logger: discardLogger}
+	if err := Compress(context.Background(), NewTeeWriter(&first, &second), flags, "testdata"); err != nil {
+		t.Fatal(err)
+	}
+	if !first.closed || !second.closed {
+		t.Errorf("the writers are not closed")
+	}
+	if first.Len() == 0 || !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Errorf("the archives are different, %d and %d bytes", first.Len(), second.Len())
+	}
+
+	var aborted abortWriter
+	missing := filepath.Join(t.TempDir(), "missing")
+	if err := Compress(context.Background(), NewTeeWriter(&aborted), flags, missing); err == nil {
+		t.Fatal("Compress() error = nil, want an error")
+	}
+	if aborted.closed || aborted.aborted == nil {
+		t.Errorf("the writer is closed instead of aborted")
+	}
+}
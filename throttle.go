@@ -0,0 +1,40 @@
+package gotgz
+
+import (
+	"context"
+	"time"
+)
+
+// scanLimiter limits the rate of the scanned entries, so the walk of the large trees doesn't saturate the disk
+type scanLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// newScanLimiter returns nil if the rate is not positive, the nil limiter doesn't wait
+func newScanLimiter(rate float64) *scanLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &scanLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait waits for the slot of the next entry or the context is done
+func (l *scanLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	if delay := l.next.Sub(now); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+	return nil
+}
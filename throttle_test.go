@@ -0,0 +1,35 @@
+package gotgz
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScanLimiter(t *testing.T) {
+	if newScanLimiter(0) != nil {
+		t.Error("newScanLimiter(0) != nil, want unlimited")
+	}
+
+	limiter := newScanLimiter(100)
+	start := time.Now()
+	for range 11 {
+		if err := limiter.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first entry doesn't wait
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("scanned 11 entries in %s, want at least 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limiter = newScanLimiter(0.1)
+	if err := limiter.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.wait(ctx); err != context.Canceled {
+		t.Errorf("wait() error = %v, want %v", err, context.Canceled)
+	}
+}
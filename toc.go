@@ -0,0 +1,507 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// TOC is the table of contents of an archive, i.e. the headers of the entries in order, the volume label
+// and the pax global headers are kept as the headers of their types, so the archive can be listed again
+// without reading it
+type TOC struct {
+	ETag    string        `json:"etag"`
+	Headers []*tar.Header `json:"headers"`
+	// Offsets are the offsets of the contents of the headers in the uncompressed tar stream, it's -1 if the
+	// content can't be read at the offset, e.g. the sparse files, the label and the pax global headers
+	Offsets []int64 `json:"offsets,omitempty"`
+}
+
+// Entries returns the count of the entries, the volume label and the pax global headers aren't counted
+func (t *TOC) Entries() int {
+	var n int
+	for _, header := range t.Headers {
+		if header.Typeflag != TypeGNUVolume && header.Typeflag != tar.TypeXGlobalHeader {
+			n++
+		}
+	}
+	return n
+}
+
+// ErrNoContent is returned by the content of the entries which are listed from the TOC
+var ErrNoContent = errors.New("the content isn't in the table of contents")
+
+type noContent struct{}
+
+func (noContent) Read([]byte) (int, error) { return 0, ErrNoContent }
+
+// List lists the entries like List without reading the archive, the content of the entries returns ErrNoContent
+func (t *TOC) List(ctx context.Context, flags ListFlags, fn ListFunc) error {
+	return t.list(ctx, flags, func(header *tar.Header, _ int64) error {
+		return fn(header, noContent{})
+	})
+}
+
+// offset returns the offset of the content of the i-th header, it's -1 if it's unknown
+func (t *TOC) offset(i int) int64 {
+	if len(t.Offsets) != len(t.Headers) {
+		return -1
+	}
+	return t.Offsets[i]
+}
+
+// list calls fn with the matched headers and the offsets of their contents
+func (t *TOC) list(ctx context.Context, flags ListFlags, fn func(header *tar.Header, offset int64) error) error {
+	matcher, err := newMemberMatcher(flags.Members, flags.Regex, flags.Occurrence, flags.Matching)
+	if err != nil {
+		return err
+	}
+
+	var labelled bool
+	for i, header := range t.Headers {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if matcher.Done() {
+			return nil
+		}
+
+		switch header.Typeflag {
+		case TypeGNUVolume:
+			labelled = true
+			if flags.Label != "" {
+				if err := matchVolumeLabel(flags.Label, header.Name); err != nil {
+					return err
+				}
+			}
+			if flags.VolumeLabel != nil {
+				if err := flags.VolumeLabel(header.Name); err != nil {
+					return err
+				}
+			}
+			continue
+		case tar.TypeXGlobalHeader:
+			if flags.GlobalHeader != nil {
+				if err := flags.GlobalHeader(header.PAXRecords); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if flags.Label != "" && !labelled {
+			return fmt.Errorf("archive doesn't have the volume label which matches %q", flags.Label)
+		}
+
+		if !flags.Modified.Contains(header.ModTime) || matcher.Match(header.Name, header.Typeflag == tar.TypeDir) < 0 {
+			continue
+		}
+		if err := fn(header, t.offset(i)); err != nil {
+			return err
+		}
+	}
+	return matcher.Unmatched()
+}
+
+// ReadTOC reads the TOC file
+func ReadTOC(path string) (*TOC, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var toc TOC
+	if err := json.Unmarshal(data, &toc); err != nil {
+		return nil, fmt.Errorf("invalid toc %s: %w", path, err)
+	}
+	return &toc, nil
+}
+
+// WriteTOC writes the TOC file, it's renamed from the temporary file so the readers never see a partial one
+func WriteTOC(path string, toc *TOC) error {
+	data, err := json.Marshal(toc)
+	if err != nil {
+		return err
+	}
+	return writeCacheFile(path, data)
+}
+
+// writeCacheFile writes the file of the cache with the temporary file which is renamed to the path
+func writeCacheFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".cache-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// tocPath returns the path of the cached TOC of the object, it's keyed by the bucket, the key, the ETag
+// and the flags which change the headers
+func tocPath(dir, bucket, s3Key, etag string, flags ListFlags) string {
+	// the empty mode is the default one
+	globals := flags.GlobalHeaders
+	if globals == "" {
+		globals = GlobalHeadersIgnore
+	}
+	key := strings.Join([]string{s3Key, etag, strconv.FormatBool(flags.IgnoreZeros), strconv.FormatBool(flags.Recover),
+		flags.FromEncoding, globals}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, bucket, hex.EncodeToString(sum[:16])+".json")
+}
+
+// TOCCache is the local cache of the s3 archives in Dir, the table of contents of the object is kept by
+// the bucket, the key and the ETag, and the first HeadSize bytes of the object are kept with it if it's set,
+// so the members in the head are read without downloading the object. MaxSize in bytes and MaxAge evict
+// the least recently used files of the cache, they are unlimited if they are 0
+type TOCCache struct {
+	Dir      string
+	HeadSize int64
+	MaxSize  int64
+	MaxAge   time.Duration
+}
+
+// ListCached lists the archive like List, the TOC of the object is cached by its ETag, so the same archive
+// is listed again without downloading it, the content of the entries returns ErrNoContent if it's listed
+// from the cache
+func (s S3) ListCached(ctx context.Context, flags ListFlags, s3Key string, cache TOCCache, fn ListFunc) error {
+	toc, _, err := s.cachedTOC(ctx, flags, s3Key, cache, fn)
+	if err != nil || toc == nil {
+		return err
+	}
+	return toc.List(ctx, flags, fn)
+}
+
+// LookupTOC returns the cached TOC of the object with the ETag without listing it, it's nil if it's not cached
+// with the flags
+func (s S3) LookupTOC(s3Key, etag string, cache TOCCache, flags ListFlags) *TOC {
+	toc, err := ReadTOC(tocPath(cache.Dir, s.bucket, s3Key, etag, flags))
+	if err != nil || toc.ETag != etag {
+		return nil
+	}
+	return toc
+}
+
+// errNotCached is returned when the rest of the entries aren't in the cache, so they are streamed from the object
+var errNotCached = errors.New("the content isn't cached")
+
+// CatCached calls fn with the entries and their contents like List, the entries are found by the cached TOC,
+// the contents in the cached head are read from it, the contents of the uncompressed object are read with
+// the ranged reads, and the compressed object is streamed from the first content which isn't in the head
+func (s S3) CatCached(ctx context.Context, flags ListFlags, s3Key string, cache TOCCache, fn ListFunc) error {
+	toc, head, err := s.cachedTOC(ctx, flags, s3Key, cache, fn)
+	if err != nil || toc == nil {
+		return err
+	}
+
+	data, err := os.ReadFile(head)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var archiver Archiver
+	if len(data) > 0 {
+		archiver, err = DetectCompression(bytes.NewReader(data))
+	} else {
+		archiver, err = s.detectCompression(ctx, s3Key)
+	}
+	if err != nil {
+		return err
+	}
+	plain, size, err := headContent(data, archiver)
+	if err != nil {
+		return err
+	}
+
+	var pos int64
+	var read int
+	err = toc.list(ctx, flags, func(header *tar.Header, offset int64) error {
+		var content io.Reader = bytes.NewReader(nil)
+		switch {
+		case header.Typeflag != tar.TypeReg || header.Size == 0:
+		case offset >= 0 && offset+header.Size <= size:
+			if _, err := io.CopyN(io.Discard, plain, offset-pos); err != nil {
+				return err
+			}
+			pos = offset + header.Size
+			content = io.LimitReader(plain, header.Size)
+			defer func() { _, _ = io.Copy(io.Discard, content) }()
+		case offset >= 0 && archiver == nil:
+			object, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket:  aws.String(s.bucket),
+				Key:     aws.String(s3Key),
+				IfMatch: aws.String(toc.ETag),
+				Range:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+header.Size-1)),
+			})
+			if err != nil {
+				return s.wrapError(s3Key, err)
+			}
+			defer object.Body.Close()
+			content = object.Body
+		default:
+			return errNotCached
+		}
+		if err := fn(header, content); err != nil {
+			return err
+		}
+		read++
+		return nil
+	})
+	if !errors.Is(err, errNotCached) {
+		return err
+	}
+
+	// the entries which are read from the cache are skipped, and the label and the global headers are reported
+	streaming := flags
+	streaming.VolumeLabel, streaming.GlobalHeader = nil, nil
+	var skipped int
+	_, err = s.List(ctx, streaming, s3Key, func(header *tar.Header, content io.Reader) error {
+		if skipped < read {
+			skipped++
+			return nil
+		}
+		return fn(header, content)
+	})
+	return err
+}
+
+// detectCompression returns the archiver of the object by its magic bytes, it's nil if it's uncompressed
+func (s S3) detectCompression(ctx context.Context, s3Key string) (Archiver, error) {
+	head, err := s.RangeReader(ctx, s3Key, 6)
+	if err != nil {
+		return nil, err
+	}
+	defer head.Close()
+	return DetectCompression(head)
+}
+
+// headContent returns the uncompressed tar stream of the cached head and its size, the compressed head
+// is truncated, so its size is the count of the bytes which can be decompressed
+func headContent(data []byte, archiver Archiver) (io.Reader, int64, error) {
+	if archiver == nil || len(data) == 0 {
+		return bytes.NewReader(data), int64(len(data)), nil
+	}
+	decompress := func() (io.Reader, error) {
+		return archiver.Reader(io.NopCloser(bytes.NewReader(data)))
+	}
+	zr, err := decompress()
+	if err != nil {
+		// the head is too short for the header of the compression
+		return bytes.NewReader(nil), 0, nil
+	}
+	size, _ := io.Copy(io.Discard, zr)
+	closeReader(zr)
+	if zr, err = decompress(); err != nil {
+		return nil, 0, err
+	}
+	return zr, size, nil
+}
+
+// cachedTOC returns the cached TOC of the object and the path of its cached head, the TOC is nil if it's not cached,
+// then the object is listed with fn while the TOC is recorded to the cache
+func (s S3) cachedTOC(ctx context.Context, flags ListFlags, s3Key string, cache TOCCache, fn ListFunc) (*TOC, string, error) {
+	var logger Logger = slog.Default()
+	if flags.Logger != nil {
+		logger = flags.Logger
+	}
+
+	info, err := s.Stat(ctx, s3Key)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.ETag == "" {
+		logger.Warn("the toc isn't cached without the etag", "key", s3Key)
+		_, err := s.List(ctx, flags, s3Key, fn)
+		return nil, "", err
+	}
+
+	path := tocPath(cache.Dir, s.bucket, s3Key, info.ETag, flags)
+	head := strings.TrimSuffix(path, ".json") + ".head"
+	defer cache.evict(logger)
+
+	toc, err := ReadTOC(path)
+	if err == nil && toc.ETag == info.ETag {
+		logger.Debug("list from the cached toc", "key", s3Key, "path", path)
+		// the recently used files are kept by the eviction
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		_ = os.Chtimes(head, now, now)
+		return toc, head, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warn("read the cached toc", "path", path, "error", err)
+	}
+
+	// the entries are recorded before they are matched, so the toc is complete for the other members
+	matcher, err := newMemberMatcher(flags.Members, flags.Regex, flags.Occurrence, flags.Matching)
+	if err != nil {
+		return nil, "", err
+	}
+	toc = &TOC{ETag: info.ETag}
+	record := func(header *tar.Header, offset int64) {
+		copied := *header
+		toc.Headers = append(toc.Headers, &copied)
+		toc.Offsets = append(toc.Offsets, offset)
+	}
+	var offset int64
+	recording := flags
+	recording.Members, recording.Regex, recording.Occurrence, recording.Modified = nil, false, 0, TimeRange{}
+	recording.DataOffset = func(o int64) { offset = o }
+	recording.GlobalHeader = func(records map[string]string) error {
+		record(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: GlobalHeaderName, PAXRecords: records}, -1)
+		if flags.GlobalHeader != nil {
+			return flags.GlobalHeader(records)
+		}
+		return nil
+	}
+	recording.VolumeLabel = func(label string) error {
+		record(&tar.Header{Typeflag: TypeGNUVolume, Name: label}, -1)
+		if flags.VolumeLabel != nil {
+			return flags.VolumeLabel(label)
+		}
+		return nil
+	}
+
+	// the object must be the one of the etag, or the toc is cached for the other content
+	data, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(s3Key),
+		IfMatch: aws.String(info.ETag),
+	})
+	if err != nil {
+		return nil, "", s.wrapError(s3Key, err)
+	}
+	body := data.Body
+	headData := &headBuffer{limit: cache.HeadSize}
+	if cache.HeadSize > 0 {
+		body = teeReadCloser{Reader: io.TeeReader(data.Body, headData), Closer: data.Body}
+	}
+	err = List(ctx, body, recording, func(header *tar.Header, content io.Reader) error {
+		if IsSparse(header) {
+			offset = -1
+		}
+		record(header, offset)
+		if !flags.Modified.Contains(header.ModTime) || matcher.Match(header.Name, header.Typeflag == tar.TypeDir) < 0 {
+			return nil
+		}
+		return fn(header, content)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := WriteTOC(path, toc); err != nil {
+		logger.Warn("write the toc to the cache", "path", path, "error", err)
+	} else {
+		logger.Debug("cached the toc", "key", s3Key, "path", path, "entries", len(toc.Headers))
+	}
+	if cache.HeadSize > 0 {
+		if err := writeCacheFile(head, headData.Bytes()); err != nil {
+			logger.Warn("write the head to the cache", "path", head, "error", err)
+		}
+	}
+	return nil, "", matcher.Unmatched()
+}
+
+// IsSparse reports whether the content of the member isn't stored as is in the archive, so it can't be read
+// at its offset
+func IsSparse(header *tar.Header) bool {
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// teeReadCloser closes the object which is read by the TeeReader
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// headBuffer keeps the first limit bytes which are written to it
+type headBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if rest := b.limit - int64(b.Len()); rest > 0 {
+		b.Buffer.Write(p[:min(int64(len(p)), rest)])
+	}
+	return len(p), nil
+}
+
+// evict removes the files of the cache which are older than MaxAge, and then the least recently used ones
+// until the cache fits in MaxSize
+func (c TOCCache) evict(logger Logger) {
+	if c.MaxSize <= 0 && c.MaxAge <= 0 {
+		return
+	}
+	type cached struct {
+		path  string
+		size  int64
+		mtime time.Time
+	}
+	var (
+		files []cached
+		total int64
+	)
+	_ = filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		// the temporary files are being written
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cached{path: path, size: info.Size(), mtime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].mtime.Before(files[j].mtime) })
+
+	now := time.Now()
+	for _, file := range files {
+		expired := c.MaxAge > 0 && now.Sub(file.mtime) > c.MaxAge
+		if !expired && (c.MaxSize <= 0 || total <= c.MaxSize) {
+			break
+		}
+		if err := os.Remove(file.path); err != nil {
+			logger.Warn("evict the cache", "path", file.path, "error", err)
+			continue
+		}
+		logger.Debug("evict the cache", "path", file.path, "size", file.size)
+		total -= file.size
+	}
+}
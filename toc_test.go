@@ -0,0 +1,268 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestTOC_List(t *testing.T) {
+	toc := &TOC{ETag: `"etag"`, Headers: []*tar.Header{
+		{Typeflag: TypeGNUVolume, Name: "backup-2024"},
+		{Typeflag: tar.TypeXGlobalHeader, Name: GlobalHeaderName, PAXRecords: map[string]string{"comment": "test"}},
+		{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0755},
+		{Typeflag: tar.TypeReg, Name: "dir/a.txt", Mode: 0644, Size: 1},
+		{Typeflag: tar.TypeReg, Name: "b.txt", Mode: 0644, Size: 1},
+	}}
+
+	path := filepath.Join(t.TempDir(), "bucket", "toc.json")
+	if err := WriteTOC(path, toc); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := ReadTOC(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		flags   ListFlags
+		want    []string
+		wantErr bool
+	}{
+		{name: "All", want: []string{"label=backup-2024", "global=test", "dir/", "dir/a.txt", "b.txt"}},
+		{name: "Members", flags: ListFlags{Members: []string{"dir"}}, want: []string{"label=backup-2024", "global=test", "dir/", "dir/a.txt"}},
+		{name: "Label", flags: ListFlags{Label: "backup-*"}, want: []string{"label=backup-2024", "global=test", "dir/", "dir/a.txt", "b.txt"}},
+		{name: "Label mismatch", flags: ListFlags{Label: "other"}, wantErr: true},
+		{name: "Unmatched", flags: ListFlags{Members: []string{"missing"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			flags := tt.flags
+			flags.VolumeLabel = func(label string) error {
+				got = append(got, "label="+label)
+				return nil
+			}
+			flags.GlobalHeader = func(records map[string]string) error {
+				got = append(got, "global="+records["comment"])
+				return nil
+			}
+			err := cached.List(context.Background(), flags, func(header *tar.Header, content io.Reader) error {
+				got = append(got, header.Name)
+				if _, err := content.Read(make([]byte, 1)); !errors.Is(err, ErrNoContent) {
+					t.Errorf("read the content error = %v, want ErrNoContent", err)
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("List() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTOCPath(t *testing.T) {
+	base := tocPath("cache", "bucket", "backup.tgz", `"etag"`, ListFlags{})
+	if dir := filepath.Dir(base); dir != filepath.Join("cache", "bucket") {
+		t.Errorf("tocPath() dir = %s, want cache/bucket", dir)
+	}
+	for name, path := range map[string]string{
+		"etag":      tocPath("cache", "bucket", "backup.tgz", `"other"`, ListFlags{}),
+		"key":       tocPath("cache", "bucket", "other.tgz", `"etag"`, ListFlags{}),
+		"recover":   tocPath("cache", "bucket", "backup.tgz", `"etag"`, ListFlags{Recover: true}),
+		"encoding":  tocPath("cache", "bucket", "backup.tgz", `"etag"`, ListFlags{FromEncoding: "latin1"}),
+		"global":    tocPath("cache", "bucket", "backup.tgz", `"etag"`, ListFlags{GlobalHeaders: GlobalHeadersKeep}),
+		"unchanged": tocPath("cache", "bucket", "backup.tgz", `"etag"`, ListFlags{Members: []string{"dir"}}),
+		"default":   tocPath("cache", "bucket", "backup.tgz", `"etag"`, ListFlags{GlobalHeaders: GlobalHeadersIgnore}),
+	} {
+		if (path == base) != (name == "unchanged" || name == "default") {
+			t.Errorf("tocPath() with the different %s = %s, base %s", name, path, base)
+		}
+	}
+}
+
+func TestTOCCache_Evict(t *testing.T) {
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{name: "bucket/old.json", size: 10, age: 48 * time.Hour},
+		{name: "bucket/a.json", size: 10, age: 3 * time.Hour},
+		{name: "bucket/a.head", size: 10, age: 2 * time.Hour},
+		{name: "bucket/b.json", size: 10, age: time.Hour},
+		{name: "bucket/.cache-1.tmp", size: 100, age: 72 * time.Hour},
+	}
+
+	tests := []struct {
+		name  string
+		cache TOCCache
+		want  []string
+	}{
+		{name: "Unlimited", want: []string{".cache-1.tmp", "a.head", "a.json", "b.json", "old.json"}},
+		{name: "MaxAge", cache: TOCCache{MaxAge: 24 * time.Hour}, want: []string{".cache-1.tmp", "a.head", "a.json", "b.json"}},
+		{name: "MaxSize", cache: TOCCache{MaxSize: 20}, want: []string{".cache-1.tmp", "a.head", "b.json"}},
+		{name: "Both", cache: TOCCache{MaxAge: 24 * time.Hour, MaxSize: 10}, want: []string{".cache-1.tmp", "b.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range files {
+				path := filepath.Join(dir, file.name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, make([]byte, file.size), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, now.Add(-file.age), now.Add(-file.age)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cache := tt.cache
+			cache.Dir = dir
+			cache.evict(discardLogger)
+
+			entries, err := os.ReadDir(filepath.Join(dir, "bucket"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evict() kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestS3Object serves the object with the etag, the ranges and If-Match, and counts the GET requests
+// without the range
+func newTestS3Object(t *testing.T, data []byte) (S3, *int) {
+	var (
+		mu   sync.Mutex
+		full int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+			mu.Lock()
+			full++
+			mu.Unlock()
+		}
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewWithOptions(context.Background(), "bucket", []func(*config.LoadOptions) error{
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(aws.AnonymousCredentials{}),
+	}, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(server.URL)
+		o.UsePathStyle = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &full
+}
+
+func TestS3_CatCached(t *testing.T) {
+	large := strings.Repeat("c", 64<<10)
+	archive := newTestTar(t, tarFile{"a.txt", "aaa"}, tarFile{"b.txt", "bbb"}, tarFile{"c.txt", large})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		headSize int64
+		members  []string
+		want     string
+		// wantFull is the count of the downloads of the whole object in the second cat
+		wantFull int
+	}{
+		{name: "Uncompressed", data: archive, members: []string{"b.txt", "c.txt"}, want: "bbb" + large},
+		{name: "Uncompressed head", data: archive, headSize: 4096, members: []string{"a.txt", "c.txt"}, want: "aaa" + large},
+		{name: "Compressed head", data: gzipBytes(t, archive), headSize: 1 << 20, members: []string{"a.txt", "c.txt"}, want: "aaa" + large},
+		{name: "Compressed partial head", data: gzipBytes(t, archive), headSize: 64, members: []string{"a.txt", "b.txt", "c.txt"}, want: "aaabbb" + large, wantFull: 1},
+		{name: "Compressed without head", data: gzipBytes(t, archive), members: []string{"b.txt"}, want: "bbb", wantFull: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, full := newTestS3Object(t, tt.data)
+			cache := TOCCache{Dir: t.TempDir(), HeadSize: tt.headSize}
+			flags := ListFlags{Archiver: AutoArchiver{Archiver: GZipArchiver{}}, Members: tt.members, Logger: discardLogger}
+
+			cat := func() string {
+				var got bytes.Buffer
+				err := client.CatCached(context.Background(), flags, "backup.tar", cache, func(header *tar.Header, content io.Reader) error {
+					_, err := io.Copy(&got, content)
+					return err
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return got.String()
+			}
+
+			if got := cat(); got != tt.want {
+				t.Errorf("CatCached() without the cache = %.20q, want %.20q", got, tt.want)
+			}
+			*full = 0
+			if got := cat(); got != tt.want {
+				t.Errorf("CatCached() with the cache = %.20q, want %.20q", got, tt.want)
+			}
+			if *full != tt.wantFull {
+				t.Errorf("CatCached() downloaded the object %d times, want %d", *full, tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestS3_LookupTOC(t *testing.T) {
+	archive := newTestTar(t, tarFile{"a.txt", "aaa"}, tarFile{"b.txt", "bbb"})
+	client, _ := newTestS3Object(t, archive)
+	cache := TOCCache{Dir: t.TempDir()}
+	if toc := client.LookupTOC("backup.tar", `"etag"`, cache, ListFlags{}); toc != nil {
+		t.Fatal("LookupTOC() should be nil before the archive is listed")
+	}
+
+	flags := ListFlags{Archiver: AutoArchiver{Archiver: GZipArchiver{}}, GlobalHeaders: GlobalHeadersIgnore, Logger: discardLogger}
+	if err := client.ListCached(context.Background(), flags, "backup.tar", cache, func(*tar.Header, io.Reader) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	toc := client.LookupTOC("backup.tar", `"etag"`, cache, ListFlags{})
+	if toc == nil {
+		t.Fatal("LookupTOC() should return the cached toc")
+	}
+	if n := toc.Entries(); n != 2 {
+		t.Errorf("Entries() = %d, want 2", n)
+	}
+	if toc := client.LookupTOC("backup.tar", `"other"`, cache, ListFlags{}); toc != nil {
+		t.Error("LookupTOC() should be nil for the other etag")
+	}
+}
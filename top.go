@@ -0,0 +1,84 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"container/heap"
+	"context"
+	"io"
+	"sort"
+)
+
+// MemberSize is the size of the regular file in the archive,
+// the Compressed is estimated by the compressed bytes read while the file is read,
+// it's not accurate since the decompressor reads ahead
+type MemberSize struct {
+	Name       string
+	Size       int64
+	Compressed int64
+}
+
+// TopReport is the largest regular files in the archive
+type TopReport struct {
+	Members []MemberSize
+	// Compressed is the size of the whole archive
+	Compressed int64
+}
+
+// Top returns the n largest regular files in the archive in descending order
+func Top(ctx context.Context, src io.ReadCloser, flags ListFlags, n int) (TopReport, error) {
+	counter := &countingReader{ReadCloser: src}
+	members := &memberHeap{}
+	err := List(ctx, counter, flags, func(header *tar.Header, content io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		start := counter.n
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return err
+		}
+
+		heap.Push(members, MemberSize{Name: header.Name, Size: header.Size, Compressed: counter.n - start})
+		if members.Len() > n {
+			heap.Pop(members)
+		}
+		return nil
+	})
+	if err != nil {
+		return TopReport{}, err
+	}
+
+	report := TopReport{Members: *members, Compressed: counter.n}
+	sort.Slice(report.Members, func(i, j int) bool {
+		return report.Members[i].Size > report.Members[j].Size
+	})
+	return report, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// memberHeap is the min heap by the size
+type memberHeap []MemberSize
+
+func (h memberHeap) Len() int           { return len(h) }
+func (h memberHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h memberHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *memberHeap) Push(x any) {
+	*h = append(*h, x.(MemberSize))
+}
+
+func (h *memberHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,32 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTop(t *testing.T) {
+	archive := gzipBytes(t, newTestTar(t,
+		tarFile{"small", "1"},
+		tarFile{"large", strings.Repeat("x", 100000)},
+		tarFile{"medium", strings.Repeat("y", 1000)},
+		tarFile{"tiny", ""},
+	))
+
+	report, err := Top(context.Background(), io.NopCloser(bytes.NewReader(archive)), ListFlags{Archiver: GZipArchiver{}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Members) != 2 || report.Members[0].Name != "large" || report.Members[1].Name != "medium" {
+		t.Fatalf("unexpected members %v", report.Members)
+	}
+	if report.Members[0].Size != 100000 {
+		t.Errorf("size = %d, want 100000", report.Members[0].Size)
+	}
+	if report.Compressed != int64(len(archive)) {
+		t.Errorf("compressed = %d, want %d", report.Compressed, len(archive))
+	}
+}
@@ -0,0 +1,150 @@
+package gotgz
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ParseTransform parses the sed replace expressions like `--transform` in tar command,
+// e.g. `s/^old/new/` and `s,\.txt$,.md,g`, the regexp is RE2 instead of the POSIX basic one,
+// the flags can be g for all of the matches and i for case-insensitive, `&` and `\1`..`\9`
+// in the replacement are the match and the groups, the expressions are applied in order
+func ParseTransform(exprs []string) (func(string) string, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	var replaces []func(string) string
+	for _, expr := range exprs {
+		replace, err := parseReplace(expr)
+		if err != nil {
+			return nil, err
+		}
+		replaces = append(replaces, replace)
+	}
+	return func(name string) string {
+		for _, replace := range replaces {
+			name = replace(name)
+		}
+		return name
+	}, nil
+}
+
+// renameMember applies the transform to the name of the member on create, the directory keeps the trailing slash,
+// ok is false if the name is empty after the transform, then the member is skipped like the extraction
+func renameMember(transform func(string) string, header *tar.Header, absoluteNames bool) (ok bool, err error) {
+	name := transform(header.Name)
+	if name == "" {
+		return false, nil
+	}
+	if header.Typeflag == tar.TypeDir && !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	if !absoluteNames && isPathInvalid(name) {
+		return false, fmt.Errorf("file name %q of %q is invalid after the transform", name, header.Name)
+	}
+	header.Name = name
+	return true, nil
+}
+
+func parseReplace(expr string) (func(string) string, error) {
+	if len(expr) < 4 || expr[0] != 's' {
+		return nil, fmt.Errorf("invalid transform %q, it should be s/regexp/replacement/flags", expr)
+	}
+	delim := expr[1]
+	parts := splitUnescaped(expr[2:], delim)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid transform %q, it should be s/regexp/replacement/flags", expr)
+	}
+	pattern, template, flags := parts[0], sedTemplate(parts[1]), parts[2]
+
+	var global bool
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			global = true
+		case 'i':
+			pattern = "(?i)" + pattern
+		default:
+			return nil, fmt.Errorf("unsupported transform flag %q in %q", flag, expr)
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform %q: %w", expr, err)
+	}
+
+	if global {
+		return func(name string) string {
+			return re.ReplaceAllString(name, template)
+		}, nil
+	}
+	return func(name string) string {
+		match := re.FindStringSubmatchIndex(name)
+		if match == nil {
+			return name
+		}
+		result := re.ExpandString(nil, template, name, match)
+		return name[:match[0]] + string(result) + name[match[1]:]
+	}, nil
+}
+
+// splitUnescaped splits the expression by the delimiter which isn't escaped, the escaped delimiter is unescaped
+func splitUnescaped(s string, delim byte) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			part.WriteByte(delim)
+			i++
+		case s[i] == '\\' && i+1 < len(s):
+			part.WriteString(s[i : i+2])
+			i++
+		case s[i] == delim:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(s[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
+// sedTemplate converts the sed replacement to the regexp template
+func sedTemplate(s string) string {
+	var template strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			template.WriteString("${" + string(s[i+1]) + "}")
+			i++
+		case s[i] == '\\' && i+1 < len(s):
+			template.WriteString(strings.ReplaceAll(string(s[i+1]), "$", "$$"))
+			i++
+		case s[i] == '&':
+			template.WriteString("${0}")
+		case s[i] == '$':
+			template.WriteString("$$")
+		default:
+			template.WriteByte(s[i])
+		}
+	}
+	return template.String()
+}
+
+// relativeLink returns the target of the symbolic link which is relative to the link, the absolute target
+// is resolved in the root of the archive, e.g. `/usr/lib/libc.so` of `usr/lib64/libc.so` is `../lib/libc.so`
+func relativeLink(name, target string) string {
+	if !path.IsAbs(target) {
+		return target
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(path.Join("/", name))), filepath.FromSlash(path.Clean(target)))
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(rel)
+}
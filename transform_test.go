@@ -0,0 +1,192 @@
+package gotgz
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	tests := []struct {
+		name    string
+		exprs   []string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Prefix", exprs: []string{"s/^app-1.0/app/"}, input: "app-1.0/bin/app", want: "app/bin/app"},
+		{name: "First only", exprs: []string{"s/a/b/"}, input: "a/a/a", want: "b/a/a"},
+		{name: "Global", exprs: []string{"s/a/b/g"}, input: "a/a/a", want: "b/b/b"},
+		{name: "Case insensitive", exprs: []string{"s/readme/README/i"}, input: "docs/ReadMe.md", want: "docs/README.md"},
+		{name: "Delimiter", exprs: []string{`s,\.txt$,.md,`}, input: "dir/a.txt", want: "dir/a.md"},
+		{name: "Escaped delimiter", exprs: []string{`s/a\/b/c/`}, input: "a/b/d", want: "c/d"},
+		{name: "Groups", exprs: []string{`s/([a-z]+)-([0-9]+)/\2-\1/`}, input: "app-10", want: "10-app"},
+		{name: "Match", exprs: []string{`s/[0-9]+/<&>/`}, input: "v10", want: "v<10>"},
+		{name: "Literal", exprs: []string{`s/x/$1\&/`}, input: "x", want: "$1&"},
+		{name: "Chain", exprs: []string{"s/^a/b/", "s/^b/c/"}, input: "a", want: "c"},
+		{name: "Remove", exprs: []string{"s/.*//"}, input: "a", want: ""},
+		{name: "Invalid", exprs: []string{"s/a/b"}, wantErr: true},
+		{name: "Not replace", exprs: []string{"y/a/b/"}, wantErr: true},
+		{name: "Flag", exprs: []string{"s/a/b/x"}, wantErr: true},
+		{name: "Regexp", exprs: []string{"s/(/b/"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform, err := ParseTransform(tt.exprs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTransform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := transform(tt.input); got != tt.want {
+				t.Errorf("transform() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecompress_TransformOrder(t *testing.T) {
+	data := gzipBytes(t, newTestTar(t,
+		tarFile{name: "app-1.0/bin/app", content: "app"},
+		tarFile{name: "app-1.0/README", content: "readme"},
+		tarFile{name: "other/bin/tool", content: "tool"},
+	))
+
+	tests := []struct {
+		name  string
+		flags DecompressFlags
+		want  []string
+	}{
+		{
+			// the members are the names in the archive, not the stripped or transformed names
+			name:  "Members before strip",
+			flags: DecompressFlags{Members: []string{"app-1.0/bin/*"}, StripComponents: 1},
+			want:  []string{"bin/app"},
+		},
+		{
+			name:  "Stripped name is not a member",
+			flags: DecompressFlags{Members: []string{"bin/*"}, StripComponents: 1},
+			want:  nil,
+		},
+		{
+			name:  "Transform after strip",
+			flags: DecompressFlags{StripComponents: 1, Transform: []string{"s/^bin/usr\\/bin/"}},
+			want:  []string{"README", "usr/bin/app", "usr/bin/tool"},
+		},
+		{
+			name:  "Members before transform",
+			flags: DecompressFlags{Members: []string{"app-1.0"}, Transform: []string{"s/^app-1.0/app/"}},
+			want:  []string{"app/README", "app/bin/app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			flags := tt.flags
+			flags.Archiver, flags.NoSameOwner, flags.Logger = GZipArchiver{}, true, discardLogger
+			err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(data)), dest, flags)
+			if err != nil && tt.want != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					rel, _ := filepath.Rel(dest, path)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	flags := DecompressFlags{Archiver: GZipArchiver{}, NoSameOwner: true, Logger: discardLogger, Transform: []string{"s/^/..\\//"}}
+	if err := Decompress(context.Background(), io.NopCloser(bytes.NewReader(data)), t.TempDir(), flags); err == nil {
+		t.Errorf("Decompress() error = nil, want the invalid name error")
+	}
+}
+
+func TestCompressSources_Transform(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "build", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"build/bin/app": "app", "build/README": "readme", "tmp": "tmp"} {
+		if err := os.WriteFile(filepath.Join(source, filepath.FromSlash(name)), []byte(content), DefaultFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		transform []string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "Prefix",
+			transform: []string{"s,^build/,release/,"},
+			want:      []string{"./=", "release/=", "release/README=readme", "release/bin/=", "release/bin/app=app", "tmp=tmp", "entry=entry"},
+		},
+		{
+			// the directory keeps the trailing slash and the empty names are skipped
+			name:      "Skip",
+			transform: []string{"s,/$,,", "s,^tmp$,,"},
+			want:      []string{"./=", "build/=", "build/README=readme", "build/bin/=", "build/bin/app=app", "entry=entry"},
+		},
+		{name: "Invalid name", transform: []string{"s,^,../,"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			entry := Entry{Name: "entry", Content: bytes.NewReader([]byte("entry"))}
+			flags := CompressFlags{Archiver: GZipArchiver{Level: 1}, Relative: true, Transform: tt.transform, Entries: []Entry{entry}, Logger: discardLogger}
+			err := Compress(context.Background(), nopWriteCloser{&buf}, flags, source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := listNames(buf.Bytes(), ListFlags{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("members = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelativeLink(t *testing.T) {
+	tests := []struct {
+		name, target, want string
+	}{
+		{name: "usr/lib64/libc.so", target: "/usr/lib/libc.so", want: "../lib/libc.so"},
+		{name: "etc/localtime", target: "/usr/share/zoneinfo/UTC", want: "../usr/share/zoneinfo/UTC"},
+		{name: "bin", target: "/usr/bin", want: "usr/bin"},
+		{name: "dir/root", target: "/", want: ".."},
+		{name: "dir/link", target: "file", want: "file"},
+		{name: "dir/link", target: "../../file", want: "../../file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"->"+tt.target, func(t *testing.T) {
+			if got := relativeLink(tt.name, tt.target); got != tt.want {
+				t.Errorf("relativeLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
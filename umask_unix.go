@@ -0,0 +1,16 @@
+//go:build !windows
+
+package gotgz
+
+import (
+	"io/fs"
+	"sync"
+	"syscall"
+)
+
+// umask returns the umask of the process, it's read once since it can only be read by setting it
+var umask = sync.OnceValue(func() fs.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return fs.FileMode(mask)
+})
@@ -0,0 +1,8 @@
+package gotgz
+
+import "io/fs"
+
+// umask returns 0 since there is no umask on windows
+func umask() fs.FileMode {
+	return 0
+}
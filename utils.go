@@ -1,12 +1,28 @@
 package gotgz
 
 import (
+	"archive/tar"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/unicode/norm"
+	"lukechampine.com/blake3"
 )
 
 const (
@@ -21,26 +37,47 @@ type Logger interface {
 	Info(msg string, args ...any)
 }
 
+// isPathInvalid reports whether the name is empty, absolute, escapes the directory or is the directory itself,
+// e.g. `../etc`, `dir/..`, `..`, `.` and `dir/.`, the directory name `./` is valid
 func isPathInvalid(p string) bool {
-	return p == "" || strings.Contains(p, `\`) || strings.Contains(p, "../") || strings.HasPrefix(p, "/")
+	return p == "" || strings.Contains(p, `\`) || strings.Contains(p, "../") || strings.HasPrefix(p, "/") ||
+		p == ".." || strings.HasSuffix(p, "/..") || p == "." || strings.HasSuffix(p, "/.")
+}
+
+// trimUnsafePrefix removes the leading slashes and everything up to the last `..` component of the name like GNU tar,
+// e.g. `/etc/passwd` is `etc/passwd` and `dir/../../etc/passwd` is `etc/passwd`
+func trimUnsafePrefix(p string) string {
+	parts := strings.Split(p, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i] == ".." {
+			parts = parts[i+1:]
+			break
+		}
+	}
+	return strings.TrimLeft(strings.Join(parts, "/"), "/")
 }
 
 func IsSymbolicLink(mode os.FileMode) bool {
 	return mode&os.ModeSymlink != 0
 }
 
+// StripComponents strips n leading components of the name like GNU tar, the leading slashes are skipped,
+// the repeated slashes are one separator and `.` is a component, e.g. `./dir/file` is `dir/file` and
+// `dir//file` is `file` if n is 1, it returns the empty string if the name doesn't have more than n components
 func StripComponents(p string, n int) string {
 	if n <= 0 {
 		return p
 	}
 
-	parts := strings.Split(p, "/")
-	// if n is greater than the number of parts, return the last part
-	if n >= len(parts) {
-		return ""
+	p = strings.TrimLeft(p, "/")
+	for ; n > 0; n-- {
+		_, rest, found := strings.Cut(p, "/")
+		if !found {
+			return ""
+		}
+		p = strings.TrimLeft(rest, "/")
 	}
-
-	return strings.Join(parts[n:], "/")
+	return p
 }
 
 func ParseMetadata(raw string) (map[string]string, error) {
@@ -67,6 +104,114 @@ func ParseMetadata(raw string) (map[string]string, error) {
 	return meta, nil
 }
 
+// ArchiveQuery is the query of the s3 archive url, the reserved keys configure the archive
+// and the others are the metadata of the object
+type ArchiveQuery struct {
+	// Algorithm is the compression algorithm like -algo
+	Algorithm string
+	// Level is the compression level
+	Level string
+
+	// StorageClass, SSE and SSEKMSKeyID are applied to the upload
+	StorageClass string
+	SSE          string
+	SSEKMSKeyID  string
+	// Endpoint and PathStyle configure the s3 client, e.g. for the s3 compatible services
+	Endpoint  string
+	PathStyle bool
+
+	Metadata map[string]string
+}
+
+// ParseArchiveQuery parses the query like `algo=zstd&level=19&owner=alice`
+func ParseArchiveQuery(raw string) (ArchiveQuery, error) {
+	meta, err := ParseMetadata(raw)
+	if err != nil {
+		return ArchiveQuery{}, err
+	}
+
+	var (
+		query     ArchiveQuery
+		pathStyle string
+	)
+	for key, field := range map[string]*string{
+		"algo":          &query.Algorithm,
+		"level":         &query.Level,
+		"storage-class": &query.StorageClass,
+		"sse":           &query.SSE,
+		"sse-kms-key":   &query.SSEKMSKeyID,
+		"endpoint":      &query.Endpoint,
+		"path-style":    &pathStyle,
+	} {
+		if value, ok := meta[key]; ok {
+			*field = value
+			delete(meta, key)
+		}
+	}
+	if pathStyle != "" {
+		if query.PathStyle, err = strconv.ParseBool(pathStyle); err != nil {
+			return ArchiveQuery{}, fmt.Errorf("invalid path-style %q: %w", pathStyle, err)
+		}
+	}
+	if query.SSEKMSKeyID != "" && query.SSE == "" {
+		query.SSE = string(types.ServerSideEncryptionAwsKms)
+	}
+	if len(meta) > 0 {
+		query.Metadata = meta
+	}
+	return query, nil
+}
+
+// Compression returns the compression algorithm with the options for GetCompressionHandlers,
+// the algorithm in the query overrides the given one
+func (q ArchiveQuery) Compression(algo string) string {
+	if q.Algorithm != "" {
+		algo = q.Algorithm
+	}
+	if q.Level != "" {
+		base, _, _ := strings.Cut(algo, "?")
+		algo = base + "?level=" + q.Level
+	}
+	return algo
+}
+
+// ClientOptions returns the s3 client options for the endpoint and the path style
+func (q ArchiveQuery) ClientOptions() []func(*s3.Options) {
+	var fns []func(*s3.Options)
+	if q.Endpoint != "" {
+		fns = append(fns, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(q.Endpoint)
+		})
+	}
+	if q.PathStyle {
+		fns = append(fns, func(o *s3.Options) {
+			o.UsePathStyle = true
+		})
+	}
+	return fns
+}
+
+// PutOptions returns the upload options for the storage class and the encryption
+func (q ArchiveQuery) PutOptions() []func(*s3.PutObjectInput) {
+	var fns []func(*s3.PutObjectInput)
+	if q.StorageClass != "" {
+		fns = append(fns, func(input *s3.PutObjectInput) {
+			input.StorageClass = types.StorageClass(q.StorageClass)
+		})
+	}
+	if q.SSE != "" {
+		fns = append(fns, func(input *s3.PutObjectInput) {
+			input.ServerSideEncryption = types.ServerSideEncryption(q.SSE)
+		})
+	}
+	if q.SSEKMSKeyID != "" {
+		fns = append(fns, func(input *s3.PutObjectInput) {
+			input.SSEKMSKeyId = aws.String(q.SSEKMSKeyID)
+		})
+	}
+	return fns
+}
+
 func AddTarSuffix(fileName, suffix string) string {
 	if suffix == "" {
 		return fileName
@@ -85,7 +230,110 @@ func AddTarSuffix(fileName, suffix string) string {
 	case "date":
 		file = fmt.Sprintf("%s-%s%s", file, time.Now().Format("20060102"), ext)
 	default:
-		file = fmt.Sprintf("%s-%s%s", file, suffix, ext)
+		file = fmt.Sprintf("%s-%s%s", file, ExpandSuffix(suffix, time.Now()), ext)
 	}
 	return filepath.Join(dir, file)
 }
+
+// ExpandSuffix replaces the placeholders in the suffix, `{hostname}` is the host name,
+// `{unix}` is the unix timestamp and the others are the go time layout like `{2006-01-02T15:04:05}`
+func ExpandSuffix(suffix string, now time.Time) string {
+	var res strings.Builder
+	for {
+		start := strings.IndexByte(suffix, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(suffix[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		res.WriteString(suffix[:start])
+		switch placeholder := suffix[start+1 : end]; placeholder {
+		case "hostname":
+			hostname, err := os.Hostname()
+			if err != nil {
+				hostname = "unknown"
+			}
+			res.WriteString(hostname)
+		case "unix":
+			res.WriteString(strconv.FormatInt(now.Unix(), 10))
+		default:
+			res.WriteString(now.Format(placeholder))
+		}
+		suffix = suffix[end+1:]
+	}
+	res.WriteString(suffix)
+	return res.String()
+}
+
+// NewChecksum returns the hash of the algorithm, it can be sha256, sha512, blake3, xxh64 or crc32,
+// xxh64 and crc32 are much faster but they only detect the corruptions instead of the tampering
+func NewChecksum(alg string) (hash.Hash, error) {
+	switch alg {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "blake3":
+		return blake3.New(32, nil), nil
+	case "xxh64":
+		return xxhash.New(), nil
+	case "crc32":
+		return crc32.NewIEEE(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", alg)
+	}
+}
+
+// PAXChecksumPrefix is the prefix of the PAX records which store the checksum of the entry, e.g. GOTGZ.checksum.sha256
+const PAXChecksumPrefix = "GOTGZ.checksum."
+
+// EntryChecksum returns the hex checksum of the regular file entry, the stored PAX checksum record is used
+// if it's present, otherwise the content is read to compute it
+func EntryChecksum(header *tar.Header, content io.Reader, alg string) (string, error) {
+	if sum, ok := header.PAXRecords[PAXChecksumPrefix+alg]; ok {
+		return sum, nil
+	}
+	hash, err := NewChecksum(alg)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Normalizer returns the function to normalize the unicode form of the names, the form can be nfc or nfd,
+// it returns nil if the form is empty
+func Normalizer(form string) (func(string) string, error) {
+	switch strings.ToLower(form) {
+	case "":
+		return nil, nil
+	case "nfc":
+		return norm.NFC.String, nil
+	case "nfd":
+		return norm.NFD.String, nil
+	default:
+		return nil, fmt.Errorf("unsupported unicode normalization form: %s", form)
+	}
+}
+
+// NameDecoder returns the function to transcode the names in the charset to UTF-8, e.g. latin1 and shift_jis,
+// it returns nil if the charset is empty or UTF-8
+func NameDecoder(charset string) (func(string) (string, error), error) {
+	if charset == "" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return nil, nil
+	}
+	return enc.NewDecoder().String, nil
+}
@@ -1,10 +1,17 @@
 package gotgz
 
 import (
+	"archive/tar"
 	"fmt"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 func TestParseMetadata(t *testing.T) {
@@ -183,6 +190,11 @@ func TestAddFileSuffix(t *testing.T) {
 			args: args{fileName: ".example", suffix: ""},
 			want: ".example",
 		},
+		{
+			name: "Add time layout suffix",
+			args: args{fileName: "/path/to/example.tar.gz", suffix: "{200601}"},
+			want: fmt.Sprintf("/path/to/example-%s.tar.gz", time.Now().Format("200601")),
+		},
 		{
 			name: "Add empty suffix to hidden file with extension",
 			args: args{fileName: ".example.txt", suffix: ""},
@@ -197,3 +209,258 @@ func TestAddFileSuffix(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandSuffix(t *testing.T) {
+	now := time.Date(2025, 2, 1, 8, 30, 15, 0, time.UTC)
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		suffix string
+		want   string
+	}{
+		{name: "Literal", suffix: "custom", want: "custom"},
+		{name: "Time layout", suffix: "{2006-01-02T15:04:05}", want: "2025-02-01T08:30:15"},
+		{name: "Unix", suffix: "{unix}", want: "1738398615"},
+		{name: "Hostname", suffix: "{hostname}", want: hostname},
+		{name: "Mixed", suffix: "{hostname}-{20060102}-full", want: hostname + "-20250201-full"},
+		{name: "Unclosed", suffix: "a{2006", want: "a{2006"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandSuffix(tt.suffix, now); got != tt.want {
+				t.Errorf("ExpandSuffix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntryChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  *tar.Header
+		alg     string
+		want    string
+		wantErr bool
+	}{
+		{name: "sha256", header: &tar.Header{}, alg: "sha256", want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{name: "sha512", header: &tar.Header{}, alg: "sha512", want: "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{name: "blake3", header: &tar.Header{}, alg: "blake3", want: "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{name: "xxh64", header: &tar.Header{}, alg: "xxh64", want: "44bc2cf5ad770999"},
+		{name: "crc32", header: &tar.Header{}, alg: "crc32", want: "352441c2"},
+		{name: "PAX record", header: &tar.Header{PAXRecords: map[string]string{PAXChecksumPrefix + "crc32": "stored"}}, alg: "crc32", want: "stored"},
+		{name: "Unsupported", header: &tar.Header{}, alg: "md4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EntryChecksum(tt.header, strings.NewReader("abc"), tt.alg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EntryChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("EntryChecksum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArchiveQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		want        ArchiveQuery
+		compression string
+		wantErr     bool
+	}{
+		{name: "Empty", raw: "", compression: "gzip"},
+		{
+			name:        "Algorithm and level",
+			raw:         "algo=zstd&level=19&owner=alice",
+			want:        ArchiveQuery{Algorithm: "zstd", Level: "19", Metadata: map[string]string{"owner": "alice"}},
+			compression: "zstd?level=19",
+		},
+		{
+			name:        "Level only",
+			raw:         "level=1",
+			want:        ArchiveQuery{Level: "1"},
+			compression: "gzip?level=1",
+		},
+		{
+			name:        "S3 options",
+			raw:         "storage-class=GLACIER_IR&sse-kms-key=key-id&endpoint=http://localhost:9000&path-style=true&owner=alice",
+			want:        ArchiveQuery{StorageClass: "GLACIER_IR", SSE: "aws:kms", SSEKMSKeyID: "key-id", Endpoint: "http://localhost:9000", PathStyle: true, Metadata: map[string]string{"owner": "alice"}},
+			compression: "gzip",
+		},
+		{
+			name:        "SSE only",
+			raw:         "sse=AES256",
+			want:        ArchiveQuery{SSE: "AES256"},
+			compression: "gzip",
+		},
+		{name: "Empty algorithm", raw: "algo=", wantErr: true},
+		{name: "Invalid path style", raw: "path-style=maybe", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseArchiveQuery(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseArchiveQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseArchiveQuery() = %v, want %v", got, tt.want)
+			}
+			if compression := got.Compression("gzip"); compression != tt.compression {
+				t.Errorf("Compression() = %v, want %v", compression, tt.compression)
+			}
+		})
+	}
+}
+
+func TestArchiveQuery_PutOptions(t *testing.T) {
+	query := ArchiveQuery{StorageClass: "STANDARD_IA", SSE: "aws:kms", SSEKMSKeyID: "key-id"}
+	var input s3.PutObjectInput
+	for _, fn := range query.PutOptions() {
+		fn(&input)
+	}
+	if input.StorageClass != types.StorageClassStandardIa {
+		t.Errorf("StorageClass = %v, want %v", input.StorageClass, types.StorageClassStandardIa)
+	}
+	if input.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		t.Errorf("ServerSideEncryption = %v, want %v", input.ServerSideEncryption, types.ServerSideEncryptionAwsKms)
+	}
+	if aws.ToString(input.SSEKMSKeyId) != "key-id" {
+		t.Errorf("SSEKMSKeyId = %v, want key-id", aws.ToString(input.SSEKMSKeyId))
+	}
+	if fns := (ArchiveQuery{}).PutOptions(); len(fns) != 0 {
+		t.Errorf("PutOptions() of the empty query = %d options, want 0", len(fns))
+	}
+}
+
+func TestNameDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		input   string
+		want    string
+		isNil   bool
+		wantErr bool
+	}{
+		{name: "Empty", charset: "", isNil: true},
+		{name: "UTF-8", charset: "utf8", isNil: true},
+		{name: "Latin1", charset: "latin1", input: "caf\xe9", want: "café"},
+		{name: "Shift_JIS", charset: "shift_jis", input: "\x93\xfa\x96\x7b", want: "日本"},
+		{name: "ASCII", charset: "latin1", input: "dir/file.txt", want: "dir/file.txt"},
+		{name: "Unknown", charset: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decode, err := NameDecoder(tt.charset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NameDecoder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (decode == nil) != tt.isNil {
+				t.Fatalf("NameDecoder() is nil = %v, want %v", decode == nil, tt.isNil)
+			}
+			if decode == nil {
+				return
+			}
+			got, err := decode(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripComponents(t *testing.T) {
+	// the results are the same as GNU tar --strip-components
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{name: "dir/file", n: 0, want: "dir/file"},
+		{name: "dir/file", n: 1, want: "file"},
+		{name: "dir/sub/file", n: 2, want: "file"},
+		{name: "dir/file", n: 2, want: ""},
+		{name: "dir", n: 1, want: ""},
+		{name: "dir/", n: 1, want: ""},
+		{name: "dir/sub/", n: 1, want: "sub/"},
+		{name: "./dir/file", n: 1, want: "dir/file"},
+		{name: "./dir/file", n: 2, want: "file"},
+		{name: "./", n: 1, want: ""},
+		{name: "dir//file", n: 1, want: "file"},
+		{name: "dir//sub//file", n: 2, want: "file"},
+		{name: "//dir/file", n: 1, want: "file"},
+		{name: "/dir/file", n: 1, want: "file"},
+		{name: "dir/./file", n: 1, want: "./file"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s-%d", tt.name, tt.n), func(t *testing.T) {
+			if got := StripComponents(tt.name, tt.n); got != tt.want {
+				t.Errorf("StripComponents(%q, %d) = %q, want %q", tt.name, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPathInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "dir/file", want: false},
+		{name: "./dir/file", want: false},
+		{name: "dir//file", want: false},
+		{name: "dir/..file", want: false},
+		{name: "", want: true},
+		{name: "/dir", want: true},
+		{name: "//dir", want: true},
+		{name: "../dir", want: true},
+		{name: "dir/../../etc", want: true},
+		{name: "..", want: true},
+		{name: "dir/..", want: true},
+		{name: `dir\file`, want: true},
+		{name: ".", want: true},
+		{name: "dir/.", want: true},
+		{name: "./", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPathInvalid(tt.name); got != tt.want {
+				t.Errorf("isPathInvalid(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimUnsafePrefix(t *testing.T) {
+	tests := map[string]string{
+		"dir/file":             "dir/file",
+		"./dir/file":           "./dir/file",
+		"/etc/passwd":          "etc/passwd",
+		"//etc/passwd":         "etc/passwd",
+		"../../etc/passwd":     "etc/passwd",
+		"dir/../../etc/passwd": "etc/passwd",
+		"dir/..":               "",
+		"/":                    "",
+		"dir/..file":           "dir/..file",
+	}
+	for name, want := range tests {
+		if got := trimUnsafePrefix(name); got != want {
+			t.Errorf("trimUnsafePrefix(%q) = %q, want %q", name, got, want)
+		}
+	}
+}